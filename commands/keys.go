@@ -0,0 +1,58 @@
+// commands/keys.go
+package commands
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"memoria-backend/repository"
+	"memoria-backend/utils"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// Run executes the command named by args, e.g. "keys rotate"
+func Run(ctx context.Context, args []string, db *gorm.DB, pasteStorage repository.PasteStorage) error {
+	if len(args) >= 2 && args[0] == "keys" && args[1] == "rotate" {
+		return rotateKeys(ctx, args[2:], db, pasteStorage)
+	}
+	return fmt.Errorf("unknown command %q, available commands: keys rotate", strings.Join(args, " "))
+}
+
+// rotateKeys re-wraps every paste data key with the active master key, in batches so it
+// never holds a long transaction. Retire an old master key only after this has finished.
+func rotateKeys(ctx context.Context, args []string, db *gorm.DB, pasteStorage repository.PasteStorage) error {
+	log := utils.LoggerFromContext(ctx)
+
+	flags := flag.NewFlagSet("keys rotate", flag.ContinueOnError)
+	batchSize := flags.Int("batch-size", 500, "number of data keys to re-wrap per transaction")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if *batchSize < 1 {
+		return errors.New("batch size must be at least 1")
+	}
+	if pasteStorage.Keyring == nil {
+		return repository.ErrNoKeyring
+	}
+
+	pasteRepo := repository.NewPasteRepository(db, pasteStorage)
+
+	total := 0
+	for {
+		count, err := pasteRepo.RotateDataKeys(ctx, *batchSize)
+		if err != nil {
+			return fmt.Errorf("rotating data keys after %d pastes: %w", total, err)
+		}
+		if count == 0 {
+			break
+		}
+		total += count
+		log.Info().Int("batch", count).Int("total", total).Msg("Re-wrapped paste data keys")
+	}
+
+	log.Info().Int("total", total).Str("activeKeyId", pasteStorage.Keyring.ActiveKeyID()).Msg("Data key rotation complete")
+	return nil
+}
@@ -33,6 +33,60 @@ var DefaultConfig = map[string]interface{}{
 	"auth.enableLocal":     true,
 	"auth.sessionTimeout":  60,
 	"auth.enable2FA":       false,
+	"auth.require2FA":      false,
 	"auth.tokenExpiration": 24,
 	"auth.allowedOrigins":  []string{"http://localhost:5173"},
+	"auth.adminEmails":     []string{},
+
+	"auth.passwordResetTTL":     60,
+	"auth.verificationTTL":      48,
+	"auth.requireVerifiedEmail": false,
+
+	// OIDC defaults
+	"auth.oidc.enabled":       false,
+	"auth.oidc.providerName":  "SSO",
+	"auth.oidc.redirectURL":   "http://localhost:8080/api/v1/auth/oidc/callback",
+	"auth.oidc.scopes":        []string{"openid", "profile", "email"},
+	"auth.oidc.groupsClaim":   "groups",
+	"auth.oidc.adminGroups":   []string{},
+	"auth.oidc.allowedGroups": []string{},
+	"auth.oidc.autoProvision": true,
+
+	// Mail defaults
+	"mail.driver":   "log",
+	"mail.from":     "Memoria <no-reply@localhost>",
+	"mail.smtpPort": 587,
+
+	// Encryption defaults
+	"encryption.encryptPublic": false,
+
+	// Storage defaults
+	"storage.driver":           "database",
+	"storage.inlineMaxBytes":   65536,
+	"storage.dir":              "./data/content",
+	"storage.compression":      "zstd",
+	"storage.compressMinBytes": 1024,
+	"storage.s3.useSSL":        true,
+
+	// Limit defaults
+	"limits.maxPasteBytes":          1048576,
+	"limits.maxRequestBytes":        2097152,
+	"limits.userDailyPastes":        1000,
+	"limits.userStorageBytes":       104857600,
+	"limits.anonymousDailyPastes":   50,
+	"limits.anonymousStorageBytes":  10485760,
+	"limits.maxAttachmentBytes":     1048576,
+	"limits.maxAttachmentsPerPaste": 10,
+
+	// Collaboration defaults
+	"collab.history":         1000,
+	"collab.persistInterval": 10,
+
+	// Trash defaults
+	"trash.retentionDays": 30,
+	"trash.purgeInterval": 60,
+
+	// Render defaults
+	"render.cacheBytes":   33554432,
+	"render.defaultTheme": "github",
 }
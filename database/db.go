@@ -4,6 +4,7 @@ package database
 import (
 	"fmt"
 	"memoria-backend/models"
+	"memoria-backend/utils"
 
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
@@ -54,9 +55,37 @@ func Initialize(dbConfig Config) (*gorm.DB, error) {
 	}
 
 	// Auto Migrate the schema
-	if err := db.AutoMigrate(&models.User{}, &models.Paste{}); err != nil {
+	if err := db.AutoMigrate(&models.User{}, &models.RecoveryCode{}, &models.APIToken{}, &models.Team{}, &models.TeamMember{}, &models.TeamInvite{}, &models.Paste{}, &models.Tag{}, &models.Folder{}, &models.PasteFile{}, &models.Attachment{}, &models.ContentBlob{}, &models.PasteContent{}, &models.PasteGrant{}, &models.ShareLink{}, &models.PasteLink{}, &models.PasteComment{}); err != nil {
 		return nil, fmt.Errorf("failed to migrate database schema: %w", err)
 	}
+	if err := backfillPasteSlugs(db); err != nil {
+		return nil, fmt.Errorf("failed to backfill paste slugs: %w", err)
+	}
 
 	return db, nil
 }
+
+// backfillPasteSlugs sets the slugs of the pastes last saved before pastes had one, including
+// those in the trash
+func backfillPasteSlugs(db *gorm.DB) error {
+	const batchSize = 500
+	for {
+		var pastes []models.Paste
+		result := db.Unscoped().Select("id", "title").Where("slug IS NULL").Order("id").Limit(batchSize).Find(&pastes)
+		if result.Error != nil || len(pastes) == 0 {
+			return result.Error
+		}
+		err := db.Transaction(func(tx *gorm.DB) error {
+			for _, paste := range pastes {
+				err := tx.Unscoped().Model(&models.Paste{}).Where("id = ?", paste.ID).UpdateColumn("slug", utils.Slugify(paste.Title)).Error
+				if err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+}
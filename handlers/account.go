@@ -0,0 +1,136 @@
+package handlers
+
+import (
+	"errors"
+	"memoria-backend/models"
+	"memoria-backend/services"
+	"memoria-backend/utils"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ForgotPassword godoc
+// @Summary Request a password reset
+// @Description Emails a single-use password reset link. Always succeeds so it can't be used to check which emails have accounts.
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param request body models.ForgotPasswordRequest true "Account email"
+// @Success 202 {object} models.APIResponse[bool]
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse "Local accounts are disabled"
+// @Router /auth/password/forgot [post]
+func (h *AuthHandler) ForgotPassword(c *gin.Context) {
+	ctx := c.Request.Context()
+	log := utils.LoggerFromContext(ctx)
+
+	var req models.ForgotPasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		log.Error().Err(err).Msg("Failed to bind JSON for forgot password request")
+		utils.RespondBadRequest(c, err, "Invalid email format")
+		return
+	}
+
+	if err := h.authService.RequestPasswordReset(ctx, req.Email); err != nil {
+		if errors.Is(err, services.ErrLocalLoginDisabled) {
+			utils.RespondForbidden(c, err, err.Error())
+			return
+		}
+		log.Error().Err(err).Msg("Password reset request failed")
+	}
+
+	utils.RespondSuccess(c, http.StatusAccepted, true, "If an account exists for this email, a reset link has been sent")
+}
+
+// ResetPassword godoc
+// @Summary Reset a password
+// @Description Sets a new password using the token from a password reset email. Each token works once.
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param request body models.ResetPasswordRequest true "Reset token and new password"
+// @Success 200 {object} models.APIResponse[bool]
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 401 {object} models.ErrorResponse "Invalid or expired token"
+// @Failure 403 {object} models.ErrorResponse "The account signs in with single sign-on"
+// @Failure 500 {object} models.ErrorResponse
+// @Router /auth/password/reset [post]
+func (h *AuthHandler) ResetPassword(c *gin.Context) {
+	ctx := c.Request.Context()
+	log := utils.LoggerFromContext(ctx)
+
+	var req models.ResetPasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		log.Error().Err(err).Msg("Failed to bind JSON for reset password request")
+		utils.RespondBadRequest(c, err, "Invalid password reset data format")
+		return
+	}
+
+	if err := h.authService.ResetPassword(ctx, &req); err != nil {
+		log.Info().Err(err).Msg("Password reset failed")
+		respondAuthError(c, err, "Failed to reset password")
+		return
+	}
+
+	utils.RespondOK(c, true, "Password has been reset")
+}
+
+// VerifyEmail godoc
+// @Summary Verify an email address
+// @Description Confirms the account email using the token from a verification email
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param request body models.VerifyEmailRequest true "Verification token"
+// @Success 200 {object} models.APIResponse[bool]
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 401 {object} models.ErrorResponse "Invalid or expired token"
+// @Failure 409 {object} models.ErrorResponse "Email is already verified"
+// @Failure 500 {object} models.ErrorResponse
+// @Router /auth/verify [post]
+func (h *AuthHandler) VerifyEmail(c *gin.Context) {
+	ctx := c.Request.Context()
+	log := utils.LoggerFromContext(ctx)
+
+	var req models.VerifyEmailRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		log.Error().Err(err).Msg("Failed to bind JSON for verify email request")
+		utils.RespondBadRequest(c, err, "Invalid verification data format")
+		return
+	}
+
+	if err := h.authService.VerifyEmail(ctx, req.Token); err != nil {
+		log.Info().Err(err).Msg("Email verification failed")
+		respondAuthError(c, err, "Failed to verify email")
+		return
+	}
+
+	utils.RespondOK(c, true, "Email address verified")
+}
+
+// ResendVerification godoc
+// @Summary Resend the verification email
+// @Description Sends a new verification link to the caller's email address
+// @Tags auth
+// @Produce json
+// @Security BearerAuth
+// @Success 202 {object} models.APIResponse[bool]
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 409 {object} models.ErrorResponse "Email is already verified"
+// @Failure 500 {object} models.ErrorResponse
+// @Router /auth/verify/resend [post]
+func (h *AuthHandler) ResendVerification(c *gin.Context) {
+	ctx := c.Request.Context()
+	log := utils.LoggerFromContext(ctx)
+
+	userID, _ := utils.GetUserID(c)
+
+	if err := h.authService.SendVerificationEmail(ctx, userID); err != nil {
+		log.Info().Err(err).Uint("userId", userID).Msg("Failed to resend verification email")
+		respondAuthError(c, err, "Failed to send verification email")
+		return
+	}
+
+	utils.RespondSuccess(c, http.StatusAccepted, true, "Verification email sent")
+}
@@ -0,0 +1,99 @@
+package handlers
+
+import (
+	"memoria-backend/models"
+	"memoria-backend/services"
+	"memoria-backend/utils"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// AdminHandler handles maintenance endpoints for administrators
+type AdminHandler struct {
+	pasteService  services.PasteService
+	configService services.ConfigService
+}
+
+// NewAdminHandler creates a new admin handler
+func NewAdminHandler(pasteService services.PasteService, configService services.ConfigService) *AdminHandler {
+	return &AdminHandler{
+		pasteService:  pasteService,
+		configService: configService,
+	}
+}
+
+// PurgePaste godoc
+// @Summary Purge a paste
+// @Description Deletes a paste for good, whether it's in the trash or not, with its files, attachments, comments and sharing. It can't be restored.
+// @Tags admin
+// @Produce json
+// @Security BearerAuth
+// @Param id path uint64 true "Paste ID"
+// @Success 200 {object} models.APIResponse[uint64]
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse "Not an administrator"
+// @Failure 404 {object} models.ErrorResponse "Paste not found"
+// @Failure 500 {object} models.ErrorResponse
+// @Router /admin/pastes/{id} [delete]
+func (h *AdminHandler) PurgePaste(c *gin.Context) {
+	ctx := c.Request.Context()
+	log := utils.LoggerFromContext(ctx)
+
+	pasteID, ok := parsePasteID(c)
+	if !ok {
+		return
+	}
+
+	if err := h.pasteService.Purge(ctx, pasteID); err != nil {
+		log.Info().Err(err).Uint64("pasteId", pasteID).Msg("Failed to purge paste")
+		respondPasteError(c, err, "Failed to purge paste")
+		return
+	}
+
+	log.Info().Uint64("pasteId", pasteID).Msg("Purged paste")
+
+	utils.RespondOK(c, pasteID, "Paste purged")
+}
+
+// PurgeTrash godoc
+// @Summary Purge the trash
+// @Description Deletes the pastes that have been in the trash for longer than olderThanDays for good, right away instead of at the next scheduled purge. 0 empties the trash.
+// @Tags admin
+// @Produce json
+// @Security BearerAuth
+// @Param olderThanDays query int false "Only pastes deleted longer ago, in days. Defaults to trash.retentionDays"
+// @Success 200 {object} models.APIResponse[models.TrashPurgeData]
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse "Not an administrator"
+// @Failure 500 {object} models.ErrorResponse
+// @Router /admin/trash/purge [post]
+func (h *AdminHandler) PurgeTrash(c *gin.Context) {
+	ctx := c.Request.Context()
+	log := utils.LoggerFromContext(ctx)
+
+	olderThanDays := h.configService.GetConfig().Trash.RetentionDays
+	if value, ok := c.GetQuery("olderThanDays"); ok {
+		days, err := strconv.Atoi(value)
+		if err != nil || days < 0 {
+			utils.RespondBadRequest(c, err, "olderThanDays must be a number of days")
+			return
+		}
+		olderThanDays = days
+	}
+
+	before := time.Now().Add(-time.Duration(olderThanDays) * 24 * time.Hour)
+	purged, err := h.pasteService.PurgeTrash(ctx, before)
+	if err != nil {
+		log.Error().Err(err).Int("purged", purged).Msg("Failed to purge the trash")
+		utils.RespondInternalError(c, err, "Failed to purge the trash")
+		return
+	}
+
+	log.Info().Int("purged", purged).Int("olderThanDays", olderThanDays).Msg("Purged the trash")
+
+	utils.RespondOK(c, models.TrashPurgeData{Purged: purged}, "Trash purged")
+}
@@ -0,0 +1,138 @@
+package handlers
+
+import (
+	"errors"
+	"memoria-backend/models"
+	"memoria-backend/services"
+	"memoria-backend/utils"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+type APITokenHandler struct {
+	tokenService services.APITokenService
+}
+
+func NewAPITokenHandler(tokenService services.APITokenService) *APITokenHandler {
+	return &APITokenHandler{tokenService: tokenService}
+}
+
+// CreateAPIToken godoc
+// @Summary Create a personal API token
+// @Description Creates a scoped token for CLI and CI use. The token is only returned in this response. Only a logged in session can create tokens, not another API token.
+// @Tags users
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param token body models.CreateAPITokenRequest true "Token name, scopes and optional expiry"
+// @Success 201 {object} models.APIResponse[models.APITokenData] "Created token with its secret"
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse "Scope not allowed"
+// @Failure 500 {object} models.ErrorResponse
+// @Router /users/me/tokens [post]
+func (h *APITokenHandler) CreateAPIToken(c *gin.Context) {
+	ctx := c.Request.Context()
+	log := utils.LoggerFromContext(ctx)
+
+	var req models.CreateAPITokenRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		log.Error().Err(err).Msg("Failed to bind JSON for create API token request")
+		utils.RespondBadRequest(c, err, "Invalid API token data format")
+		return
+	}
+
+	identity, _ := utils.GetAuthIdentity(c)
+
+	tokenData, err := h.tokenService.Create(ctx, identity, &req)
+	if err != nil {
+		log.Error().Err(err).Uint("userId", identity.UserID).Msg("Failed to create API token")
+		switch {
+		case errors.Is(err, services.ErrAPITokenScopeNotAllowed), errors.Is(err, services.ErrAPITokenSessionNeeded):
+			utils.RespondForbidden(c, err, err.Error())
+		case errors.Is(err, services.ErrAPITokenExpiryInPast):
+			utils.RespondBadRequest(c, err, err.Error())
+		default:
+			utils.RespondInternalError(c, err, "Failed to create API token")
+		}
+		return
+	}
+
+	utils.RespondCreated(c, *tokenData, "API token created. Copy it now, it won't be shown again")
+}
+
+// ListAPITokens godoc
+// @Summary List personal API tokens
+// @Description Lists the caller's API tokens with their prefix, scopes, expiry and last use. Only a logged in session can list tokens, not an API token.
+// @Tags users
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} models.APIResponse[models.APITokenListData] "Tokens without their secrets"
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse "Called with an API token"
+// @Failure 500 {object} models.ErrorResponse
+// @Router /users/me/tokens [get]
+func (h *APITokenHandler) ListAPITokens(c *gin.Context) {
+	ctx := c.Request.Context()
+	log := utils.LoggerFromContext(ctx)
+
+	identity, _ := utils.GetAuthIdentity(c)
+
+	tokens, err := h.tokenService.List(ctx, identity)
+	if err != nil {
+		log.Error().Err(err).Uint("userId", identity.UserID).Msg("Failed to list API tokens")
+		if errors.Is(err, services.ErrAPITokenSessionNeeded) {
+			utils.RespondForbidden(c, err, err.Error())
+		} else {
+			utils.RespondInternalError(c, err, "Failed to retrieve API tokens")
+		}
+		return
+	}
+
+	utils.RespondOK(c, models.APITokenListData{APITokens: tokens, Count: len(tokens)}, "API tokens retrieved successfully")
+}
+
+// RevokeAPIToken godoc
+// @Summary Revoke a personal API token
+// @Description Deletes one of the caller's API tokens so it can no longer be used. Only a logged in session can revoke tokens, not an API token.
+// @Tags users
+// @Produce json
+// @Security BearerAuth
+// @Param id path uint true "Token ID"
+// @Success 200 {object} models.APIResponse[uint]
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse "Called with an API token"
+// @Failure 404 {object} models.ErrorResponse "Token not found"
+// @Failure 500 {object} models.ErrorResponse
+// @Router /users/me/tokens/{id} [delete]
+func (h *APITokenHandler) RevokeAPIToken(c *gin.Context) {
+	ctx := c.Request.Context()
+	log := utils.LoggerFromContext(ctx)
+
+	idStr := c.Param("id")
+	id, err := strconv.ParseUint(idStr, 10, 64)
+	if err != nil {
+		log.Error().Err(err).Str("idStr", idStr).Msg("Failed to parse ID for API token")
+		utils.RespondBadRequest(c, err, "Invalid API token ID format")
+		return
+	}
+
+	identity, _ := utils.GetAuthIdentity(c)
+
+	if err := h.tokenService.Revoke(ctx, identity, uint(id)); err != nil {
+		log.Error().Err(err).Uint64("tokenId", id).Msg("Failed to revoke API token")
+		switch {
+		case errors.Is(err, services.ErrAPITokenNotFound):
+			utils.RespondNotFound(c, err, "API token not found")
+		case errors.Is(err, services.ErrAPITokenSessionNeeded):
+			utils.RespondForbidden(c, err, err.Error())
+		default:
+			utils.RespondInternalError(c, err, "Failed to revoke API token")
+		}
+		return
+	}
+
+	utils.RespondOK(c, uint(id), "API token revoked")
+}
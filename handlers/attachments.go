@@ -0,0 +1,232 @@
+package handlers
+
+import (
+	"io"
+	"memoria-backend/models"
+	"memoria-backend/utils"
+	"mime"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// inlineAttachmentTypes are shown in the browser, everything else is only ever downloaded
+var inlineAttachmentTypes = map[string]bool{
+	"image/png":  true,
+	"image/jpeg": true,
+	"image/gif":  true,
+	"image/webp": true,
+}
+
+// serveAttachment streams an attachment with headers that keep browsers from running it:
+// only images are shown inline, the type is never sniffed and scripts are sandboxed
+func serveAttachment(c *gin.Context, attachment *models.Attachment, content io.Reader, size int64, thumbnail bool) {
+	contentType := attachment.MIMEType
+	if thumbnail {
+		contentType = attachment.ThumbnailType
+	}
+
+	mediaType, _, _ := strings.Cut(contentType, ";")
+	disposition := "attachment"
+	if inlineAttachmentTypes[mediaType] {
+		disposition = "inline"
+	}
+	if header := mime.FormatMediaType(disposition, map[string]string{"filename": attachment.FileName}); header != "" {
+		disposition = header
+	}
+
+	c.DataFromReader(http.StatusOK, size, contentType, content, map[string]string{
+		"Content-Disposition":     disposition,
+		"X-Content-Type-Options":  "nosniff",
+		"Content-Security-Policy": "default-src 'none'; sandbox",
+	})
+}
+
+// UploadPasteAttachment godoc
+// @Summary Attach a file to a paste
+// @Description Uploads a screenshot or other small file to a paste the caller may edit. The type is sniffed from the content. Images have EXIF and other metadata stripped and get a thumbnail.
+// @Tags pastes
+// @Accept multipart/form-data
+// @Produce json
+// @Security BearerAuth
+// @Param id path uint64 true "Paste ID"
+// @Param file formData file true "File to attach"
+// @Success 201 {object} models.APIResponse[models.AttachmentData]
+// @Failure 400 {object} models.ErrorResponse "No file, or an image that can't be decoded"
+// @Failure 403 {object} models.ErrorResponse "No edit access to the paste"
+// @Failure 404 {object} models.ErrorResponse "Paste not found"
+// @Failure 422 {object} models.ErrorResponse "Attachment too large, too many attachments or storage quota exceeded"
+// @Failure 500 {object} models.ErrorResponse
+// @Router /paste/{id}/attachments [post]
+func (h *PasteHandler) UploadPasteAttachment(c *gin.Context) {
+	ctx := c.Request.Context()
+	log := utils.LoggerFromContext(ctx)
+
+	id, ok := parsePasteID(c)
+	if !ok {
+		return
+	}
+
+	fileHeader, err := c.FormFile("file")
+	if err != nil {
+		log.Info().Err(err).Uint64("pasteId", id).Msg("Failed to read attachment upload")
+		respondBindError(c, err, "A file is required")
+		return
+	}
+	file, err := fileHeader.Open()
+	if err != nil {
+		log.Error().Err(err).Uint64("pasteId", id).Msg("Failed to open attachment upload")
+		utils.RespondInternalError(c, err, "Failed to read attachment")
+		return
+	}
+	defer file.Close()
+	data, err := io.ReadAll(file)
+	if err != nil {
+		log.Error().Err(err).Uint64("pasteId", id).Msg("Failed to read attachment upload")
+		utils.RespondInternalError(c, err, "Failed to read attachment")
+		return
+	}
+
+	userID, _ := utils.GetUserID(c)
+	attachment, err := h.pasteService.AddAttachment(ctx, id, userID, fileHeader.Filename, data)
+	if err != nil {
+		log.Info().Err(err).Uint64("pasteId", id).Msg("Failed to add paste attachment")
+		respondPasteError(c, err, "Failed to add attachment")
+		return
+	}
+
+	utils.RespondCreated(c, models.AttachmentData{Attachment: attachment}, "Attachment added")
+}
+
+// GetPasteAttachment godoc
+// @Summary Download a paste attachment
+// @Description Returns an attachment or its thumbnail with the same access rules as retrieving the paste. Only images are served inline.
+// @Tags pastes
+// @Param id path uint64 true "Paste ID"
+// @Param attachmentId path uint true "Attachment ID"
+// @Param thumbnail query bool false "Return the thumbnail of an image"
+// @Param pw query string false "Password for protected pastes"
+// @Produce octet-stream
+// @Success 200 {file} file "Attachment content"
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 401 {object} models.ErrorResponse "Password required or invalid password"
+// @Failure 404 {object} models.ErrorResponse "Paste, attachment or thumbnail not found"
+// @Failure 500 {object} models.ErrorResponse
+// @Router /paste/{id}/attachments/{attachmentId} [get]
+func (h *PasteHandler) GetPasteAttachment(c *gin.Context) {
+	ctx := c.Request.Context()
+	log := utils.LoggerFromContext(ctx)
+
+	id, ok := parsePasteID(c)
+	if !ok {
+		return
+	}
+	attachmentID, ok := parseUintParam(c, "attachmentId")
+	if !ok {
+		return
+	}
+
+	paste, err := h.pasteService.GetByID(ctx, id)
+	if err != nil {
+		log.Error().Err(err).Uint64("pasteId", id).Msg("Failed to retrieve paste")
+		respondPasteError(c, err, "Failed to retrieve paste")
+		return
+	}
+	if !h.authorizePasteView(c, paste) {
+		return
+	}
+
+	h.respondAttachment(c, paste, attachmentID)
+}
+
+// GetPasteAttachmentByAccessID godoc
+// @Summary Download an attachment of a paste by its private access ID
+// @Description Returns an attachment or its thumbnail with the same access rules as retrieving the paste by its private access ID
+// @Tags pastes
+// @Param accessId path string true "Private access ID"
+// @Param attachmentId path uint true "Attachment ID"
+// @Param thumbnail query bool false "Return the thumbnail of an image"
+// @Param pw query string false "Password for protected pastes"
+// @Produce octet-stream
+// @Success 200 {file} file "Attachment content"
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 401 {object} models.ErrorResponse "Password required or invalid password"
+// @Failure 404 {object} models.ErrorResponse "Paste, attachment or thumbnail not found"
+// @Failure 500 {object} models.ErrorResponse
+// @Router /paste/private/{accessId}/attachments/{attachmentId} [get]
+func (h *PasteHandler) GetPasteAttachmentByAccessID(c *gin.Context) {
+	ctx := c.Request.Context()
+	log := utils.LoggerFromContext(ctx)
+
+	accessID := c.Param("accessId")
+	attachmentID, ok := parseUintParam(c, "attachmentId")
+	if !ok {
+		return
+	}
+
+	paste, err := h.pasteService.GetByPrivateAccessID(ctx, accessID, c.Query("pw"))
+	if err != nil {
+		log.Error().Err(err).Str("privateAccessId", accessID).Msg("Failed to retrieve paste")
+		respondAccessIDError(c, err)
+		return
+	}
+	if !h.authorizeAccessIDView(c, paste) {
+		return
+	}
+
+	h.respondAttachment(c, paste, attachmentID)
+}
+
+// respondAttachment serves an attachment of a paste the caller was allowed to view
+func (h *PasteHandler) respondAttachment(c *gin.Context, paste *models.Paste, attachmentID uint) {
+	ctx := c.Request.Context()
+	log := utils.LoggerFromContext(ctx)
+
+	thumbnail := c.Query("thumbnail") == "true"
+	attachment, content, size, err := h.pasteService.OpenAttachment(ctx, paste, attachmentID, thumbnail)
+	if err != nil {
+		log.Info().Err(err).Uint64("pasteId", paste.ID).Uint("attachmentId", attachmentID).Msg("Failed to open paste attachment")
+		respondPasteError(c, err, "Failed to retrieve attachment")
+		return
+	}
+	defer content.Close()
+
+	serveAttachment(c, attachment, content, size, thumbnail)
+}
+
+// DeletePasteAttachment godoc
+// @Summary Remove an attachment from a paste
+// @Tags pastes
+// @Produce json
+// @Security BearerAuth
+// @Param id path uint64 true "Paste ID"
+// @Param attachmentId path uint true "Attachment ID"
+// @Success 200 {object} models.APIResponse[uint]
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse "No edit access to the paste"
+// @Failure 404 {object} models.ErrorResponse "Paste or attachment not found"
+// @Failure 500 {object} models.ErrorResponse
+// @Router /paste/{id}/attachments/{attachmentId} [delete]
+func (h *PasteHandler) DeletePasteAttachment(c *gin.Context) {
+	ctx := c.Request.Context()
+	log := utils.LoggerFromContext(ctx)
+
+	id, ok := parsePasteID(c)
+	if !ok {
+		return
+	}
+	attachmentID, ok := parseUintParam(c, "attachmentId")
+	if !ok {
+		return
+	}
+	userID, _ := utils.GetUserID(c)
+
+	if err := h.pasteService.DeleteAttachment(ctx, id, userID, attachmentID); err != nil {
+		log.Info().Err(err).Uint64("pasteId", id).Uint("attachmentId", attachmentID).Msg("Failed to delete paste attachment")
+		respondPasteError(c, err, "Failed to delete attachment")
+		return
+	}
+
+	utils.RespondOK(c, attachmentID, "Attachment removed")
+}
@@ -0,0 +1,364 @@
+package handlers
+
+import (
+	"errors"
+	"memoria-backend/models"
+	"memoria-backend/services"
+	"memoria-backend/utils"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// oidcStateCookie holds the signed OIDC state between the login redirect and the callback
+const oidcStateCookie = "memoria_oidc_state"
+
+type AuthHandler struct {
+	authService   services.AuthService
+	configService services.ConfigService
+}
+
+func NewAuthHandler(authService services.AuthService, configService services.ConfigService) *AuthHandler {
+	return &AuthHandler{authService: authService, configService: configService}
+}
+
+// respondAuthError maps auth service errors to API error responses
+func respondAuthError(c *gin.Context, err error, fallbackMessage string) {
+	switch {
+	case errors.Is(err, services.ErrInvalidCredentials),
+		errors.Is(err, services.ErrInvalidToken),
+		errors.Is(err, services.ErrInvalidTwoFactorCode):
+		utils.RespondUnauthorized(c, err, err.Error())
+	case errors.Is(err, services.ErrTwoFactorDisabled),
+		errors.Is(err, services.ErrTwoFactorRequired),
+		errors.Is(err, services.ErrTwoFactorEnrollmentNeeded),
+		errors.Is(err, services.ErrLocalLoginDisabled),
+		errors.Is(err, services.ErrOIDCDisabled),
+		errors.Is(err, services.ErrPasswordResetSSO):
+		utils.RespondForbidden(c, err, err.Error())
+	case errors.Is(err, services.ErrTwoFactorAlreadyEnabled),
+		errors.Is(err, services.ErrTwoFactorNotEnrolled),
+		errors.Is(err, services.ErrEmailAlreadyVerified):
+		utils.RespondConflict(c, err, err.Error())
+	case errors.Is(err, services.ErrTwoFactorLocked):
+		utils.RespondWithError(c, http.StatusTooManyRequests, err, err.Error())
+	default:
+		utils.RespondInternalError(c, err, fallbackMessage)
+	}
+}
+
+// Login godoc
+// @Summary Log in
+// @Description Logs in with email and password. Returns an access token, or a challenge token when a second factor is needed.
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param credentials body models.LoginRequest true "Login credentials"
+// @Success 200 {object} models.APIResponse[models.LoginData] "Access token or two-factor challenge"
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 401 {object} models.ErrorResponse "Invalid email or password"
+// @Failure 429 {object} models.ErrorResponse "Second factor locked after too many wrong codes"
+// @Failure 500 {object} models.ErrorResponse
+// @Router /auth/login [post]
+func (h *AuthHandler) Login(c *gin.Context) {
+	ctx := c.Request.Context()
+	log := utils.LoggerFromContext(ctx)
+
+	var req models.LoginRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		log.Error().Err(err).Msg("Failed to bind JSON for login request")
+		utils.RespondBadRequest(c, err, "Invalid login data format")
+		return
+	}
+
+	loginData, err := h.authService.Login(ctx, &req)
+	if err != nil {
+		log.Info().Err(err).Msg("Login failed")
+		respondAuthError(c, err, "Failed to log in")
+		return
+	}
+
+	if loginData.TwoFactorRequired || loginData.EnrollmentRequired {
+		utils.RespondOK(c, *loginData, "Second login step required")
+		return
+	}
+
+	utils.RespondOK(c, *loginData, "Logged in successfully")
+}
+
+// VerifyTwoFactor godoc
+// @Summary Complete a two-factor login
+// @Description Exchanges a challenge token and a TOTP or recovery code for an access token. A challenge works once and only until the next login. After 5 wrong codes in a row the challenge is dropped and logins with a second factor are refused for 15 minutes.
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param request body models.TwoFactorVerifyRequest true "Challenge token and code"
+// @Success 200 {object} models.APIResponse[models.LoginData] "Access token"
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 401 {object} models.ErrorResponse "Invalid challenge or code"
+// @Failure 429 {object} models.ErrorResponse "Too many wrong codes"
+// @Failure 500 {object} models.ErrorResponse
+// @Router /auth/2fa/verify [post]
+func (h *AuthHandler) VerifyTwoFactor(c *gin.Context) {
+	ctx := c.Request.Context()
+	log := utils.LoggerFromContext(ctx)
+
+	var req models.TwoFactorVerifyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		log.Error().Err(err).Msg("Failed to bind JSON for two-factor verify request")
+		utils.RespondBadRequest(c, err, "Invalid two-factor data format")
+		return
+	}
+
+	loginData, err := h.authService.VerifyTwoFactor(ctx, &req)
+	if err != nil {
+		log.Info().Err(err).Msg("Two-factor verification failed")
+		respondAuthError(c, err, "Failed to verify second factor")
+		return
+	}
+
+	utils.RespondOK(c, *loginData, "Logged in successfully")
+}
+
+// EnrollTOTP godoc
+// @Summary Start TOTP enrolment
+// @Description Generates a new TOTP secret and otpauth:// provisioning URI. 2FA is enabled once confirmed with a first code.
+// @Tags auth
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} models.APIResponse[models.TOTPEnrollmentData] "Pending TOTP secret"
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse "Two-factor authentication is disabled"
+// @Failure 409 {object} models.ErrorResponse "Two-factor authentication is already enabled"
+// @Failure 500 {object} models.ErrorResponse
+// @Router /auth/2fa/enroll [post]
+func (h *AuthHandler) EnrollTOTP(c *gin.Context) {
+	ctx := c.Request.Context()
+	log := utils.LoggerFromContext(ctx)
+
+	userID, _ := utils.GetUserID(c)
+
+	enrollment, err := h.authService.BeginTOTPEnrollment(ctx, userID)
+	if err != nil {
+		log.Error().Err(err).Uint("userId", userID).Msg("Failed to start TOTP enrolment")
+		respondAuthError(c, err, "Failed to start two-factor enrolment")
+		return
+	}
+
+	utils.RespondOK(c, *enrollment, "Scan the provisioning URI and confirm with a code")
+}
+
+// ConfirmTOTP godoc
+// @Summary Confirm TOTP enrolment
+// @Description Enables 2FA after checking a first code from the authenticator app. Returns single-use recovery codes.
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body models.TOTPCodeRequest true "Current TOTP code"
+// @Success 200 {object} models.APIResponse[models.RecoveryCodesData] "Recovery codes"
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 401 {object} models.ErrorResponse "Invalid code"
+// @Failure 409 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /auth/2fa/confirm [post]
+func (h *AuthHandler) ConfirmTOTP(c *gin.Context) {
+	ctx := c.Request.Context()
+	log := utils.LoggerFromContext(ctx)
+
+	var req models.TOTPCodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		log.Error().Err(err).Msg("Failed to bind JSON for TOTP confirm request")
+		utils.RespondBadRequest(c, err, "Invalid code format")
+		return
+	}
+
+	identity, _ := utils.GetAuthIdentity(c)
+
+	data, err := h.authService.ConfirmTOTPEnrollment(ctx, identity, req.Code)
+	if err != nil {
+		log.Info().Err(err).Uint("userId", identity.UserID).Msg("Failed to confirm TOTP enrolment")
+		respondAuthError(c, err, "Failed to confirm two-factor enrolment")
+		return
+	}
+
+	utils.RespondOK(c, *data, "Two-factor authentication enabled")
+}
+
+// DisableTOTP godoc
+// @Summary Disable TOTP
+// @Description Turns off 2FA for the caller. Requires a current TOTP code or a recovery code.
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body models.TOTPCodeRequest true "TOTP or recovery code"
+// @Success 200 {object} models.APIResponse[bool]
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 401 {object} models.ErrorResponse "Invalid code"
+// @Failure 403 {object} models.ErrorResponse "Two-factor authentication is enforced"
+// @Failure 429 {object} models.ErrorResponse "Second factor locked after too many wrong codes"
+// @Failure 500 {object} models.ErrorResponse
+// @Router /auth/2fa/disable [post]
+func (h *AuthHandler) DisableTOTP(c *gin.Context) {
+	ctx := c.Request.Context()
+	log := utils.LoggerFromContext(ctx)
+
+	var req models.TOTPCodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		log.Error().Err(err).Msg("Failed to bind JSON for TOTP disable request")
+		utils.RespondBadRequest(c, err, "Invalid code format")
+		return
+	}
+
+	userID, _ := utils.GetUserID(c)
+
+	if err := h.authService.DisableTOTP(ctx, userID, req.Code); err != nil {
+		log.Info().Err(err).Uint("userId", userID).Msg("Failed to disable TOTP")
+		respondAuthError(c, err, "Failed to disable two-factor authentication")
+		return
+	}
+
+	utils.RespondOK(c, true, "Two-factor authentication disabled")
+}
+
+// RegenerateRecoveryCodes godoc
+// @Summary Regenerate recovery codes
+// @Description Replaces all recovery codes with a new set. Requires a current TOTP code.
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body models.TOTPCodeRequest true "Current TOTP code"
+// @Success 200 {object} models.APIResponse[models.RecoveryCodesData] "New recovery codes"
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 401 {object} models.ErrorResponse "Invalid code"
+// @Failure 429 {object} models.ErrorResponse "Second factor locked after too many wrong codes"
+// @Failure 500 {object} models.ErrorResponse
+// @Router /auth/2fa/recovery-codes [post]
+func (h *AuthHandler) RegenerateRecoveryCodes(c *gin.Context) {
+	ctx := c.Request.Context()
+	log := utils.LoggerFromContext(ctx)
+
+	var req models.TOTPCodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		log.Error().Err(err).Msg("Failed to bind JSON for recovery codes request")
+		utils.RespondBadRequest(c, err, "Invalid code format")
+		return
+	}
+
+	userID, _ := utils.GetUserID(c)
+
+	data, err := h.authService.RegenerateRecoveryCodes(ctx, userID, req.Code)
+	if err != nil {
+		log.Info().Err(err).Uint("userId", userID).Msg("Failed to regenerate recovery codes")
+		respondAuthError(c, err, "Failed to regenerate recovery codes")
+		return
+	}
+
+	utils.RespondOK(c, *data, "Recovery codes regenerated")
+}
+
+// GetLoginMethods godoc
+// @Summary List login methods
+// @Description Returns which login methods are enabled, so clients know whether to show local login and SSO
+// @Tags auth
+// @Produce json
+// @Success 200 {object} models.APIResponse[models.LoginMethodsData]
+// @Router /auth/methods [get]
+func (h *AuthHandler) GetLoginMethods(c *gin.Context) {
+	ctx := c.Request.Context()
+	utils.RespondOK(c, *h.authService.LoginMethods(ctx), "Login methods retrieved successfully")
+}
+
+// OIDCLogin godoc
+// @Summary Start single sign-on
+// @Description Redirects to the OpenID Connect identity provider using the authorization code flow with PKCE
+// @Tags auth
+// @Param redirect query string false "Path in the web app to return to after login"
+// @Success 302 "Redirect to the identity provider"
+// @Failure 403 {object} models.ErrorResponse "Single sign-on is not enabled"
+// @Failure 500 {object} models.ErrorResponse
+// @Router /auth/oidc/login [get]
+func (h *AuthHandler) OIDCLogin(c *gin.Context) {
+	ctx := c.Request.Context()
+	log := utils.LoggerFromContext(ctx)
+
+	start, err := h.authService.BeginOIDCLogin(ctx, c.Query("redirect"))
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to start SSO login")
+		respondAuthError(c, err, "Failed to start single sign-on")
+		return
+	}
+
+	h.setOIDCStateCookie(c, start.StateToken, int(start.MaxAge.Seconds()))
+	c.Redirect(http.StatusFound, start.AuthorizationURL)
+}
+
+// OIDCCallback godoc
+// @Summary Finish single sign-on
+// @Description Callback for the identity provider. Redirects to the web app with the login result in the URL fragment.
+// @Tags auth
+// @Param code query string false "Authorization code"
+// @Param state query string true "State"
+// @Success 302 "Redirect to the web app"
+// @Router /auth/oidc/callback [get]
+func (h *AuthHandler) OIDCCallback(c *gin.Context) {
+	ctx := c.Request.Context()
+	log := utils.LoggerFromContext(ctx)
+
+	var req models.OIDCCallbackRequest
+	if err := c.ShouldBindQuery(&req); err != nil {
+		log.Error().Err(err).Msg("Failed to bind query for SSO callback")
+		c.Redirect(http.StatusFound, h.oidcResultURL(nil, "", err))
+		return
+	}
+
+	req.StateToken, _ = c.Cookie(oidcStateCookie)
+	h.setOIDCStateCookie(c, "", -1)
+
+	loginData, redirect, err := h.authService.CompleteOIDCLogin(ctx, &req)
+	if err != nil {
+		log.Error().Err(err).Msg("SSO login failed")
+	}
+
+	c.Redirect(http.StatusFound, h.oidcResultURL(loginData, redirect, err))
+}
+
+// setOIDCStateCookie stores or, with a negative maxAge, clears the state cookie
+func (h *AuthHandler) setOIDCStateCookie(c *gin.Context, value string, maxAge int) {
+	secure := c.Request.TLS != nil || h.configService.GetConfig().HTTP.EnableSSL
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(oidcStateCookie, value, maxAge, "/api/v1/auth/oidc", "", secure, true)
+}
+
+// oidcResultURL builds the web app URL the browser lands on after SSO. The result
+// goes in the fragment so tokens never reach server logs.
+func (h *AuthHandler) oidcResultURL(loginData *models.LoginData, redirect string, err error) string {
+	values := url.Values{}
+	if redirect != "" {
+		values.Set("redirect", redirect)
+	}
+
+	switch {
+	case err != nil:
+		values.Set("error", err.Error())
+	case loginData.TwoFactorRequired:
+		values.Set("twoFactorRequired", "true")
+		values.Set("challengeToken", loginData.ChallengeToken)
+	case loginData.EnrollmentRequired:
+		values.Set("enrollmentRequired", "true")
+		values.Set("challengeToken", loginData.ChallengeToken)
+	default:
+		values.Set("token", loginData.Token)
+		if loginData.ExpiresAt != nil {
+			values.Set("expiresAt", strconv.FormatInt(loginData.ExpiresAt.Unix(), 10))
+		}
+	}
+
+	appURL := strings.TrimRight(h.configService.GetConfig().App.AppURL, "/")
+	return appURL + "/auth/callback#" + values.Encode()
+}
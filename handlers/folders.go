@@ -0,0 +1,252 @@
+package handlers
+
+import (
+	"errors"
+	"memoria-backend/models"
+	"memoria-backend/services"
+	"memoria-backend/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+type FolderHandler struct {
+	folderService services.FolderService
+}
+
+func NewFolderHandler(folderService services.FolderService) *FolderHandler {
+	return &FolderHandler{folderService: folderService}
+}
+
+// respondFolderError maps folder service errors to API error responses
+func respondFolderError(c *gin.Context, err error, fallbackMessage string) {
+	switch {
+	case errors.Is(err, services.ErrFolderNotFound),
+		errors.Is(err, services.ErrTeamNotFound):
+		utils.RespondNotFound(c, err, err.Error())
+	case errors.Is(err, services.ErrFolderForbidden),
+		errors.Is(err, services.ErrFolderPublish),
+		errors.Is(err, services.ErrTeamForbidden):
+		utils.RespondForbidden(c, err, err.Error())
+	case errors.Is(err, services.ErrFolderPrivacy),
+		errors.Is(err, services.ErrFolderParent):
+		utils.RespondBadRequest(c, err, err.Error())
+	default:
+		utils.RespondInternalError(c, err, fallbackMessage)
+	}
+}
+
+// ListFolders godoc
+// @Summary List my folders
+// @Description Lists the caller's personal folders and the folders of their teams as a flat list, nested through parentId
+// @Tags folders
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} models.APIResponse[models.FolderListData]
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /folders [get]
+func (h *FolderHandler) ListFolders(c *gin.Context) {
+	ctx := c.Request.Context()
+	log := utils.LoggerFromContext(ctx)
+
+	userID, _ := utils.GetUserID(c)
+
+	folders, err := h.folderService.List(ctx, userID)
+	if err != nil {
+		log.Error().Err(err).Uint("userId", userID).Msg("Failed to list folders")
+		respondFolderError(c, err, "Failed to retrieve folders")
+		return
+	}
+
+	utils.RespondOK(c, models.FolderListData{Folders: folders, Count: len(folders)}, "Folders retrieved successfully")
+}
+
+// CreateFolder godoc
+// @Summary Create a folder
+// @Description Creates a personal folder, or a team folder when teamId is set. Personal folders are private or public, team folders team or public; only team owners can create public team folders. Subfolders must have the same owner as their parent.
+// @Tags folders
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param folder body models.CreateFolderRequest true "Folder settings"
+// @Success 201 {object} models.APIResponse[models.FolderData]
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse "Not an editor of the team or parent folder, or publishing a team folder without being a team owner"
+// @Failure 404 {object} models.ErrorResponse "Team or parent folder not found"
+// @Failure 500 {object} models.ErrorResponse
+// @Router /folders [post]
+func (h *FolderHandler) CreateFolder(c *gin.Context) {
+	ctx := c.Request.Context()
+	log := utils.LoggerFromContext(ctx)
+
+	var req models.CreateFolderRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		log.Error().Err(err).Msg("Failed to bind JSON for create folder request")
+		utils.RespondBadRequest(c, err, "Invalid folder data format")
+		return
+	}
+
+	userID, _ := utils.GetUserID(c)
+
+	folder, err := h.folderService.Create(ctx, userID, &req)
+	if err != nil {
+		log.Info().Err(err).Uint("userId", userID).Msg("Failed to create folder")
+		respondFolderError(c, err, "Failed to create folder")
+		return
+	}
+
+	utils.RespondCreated(c, models.FolderData{Folder: folder}, "Folder created successfully")
+}
+
+// GetFolder godoc
+// @Summary Get a folder
+// @Description Returns a folder with the subfolders and pastes in it the caller can see. Anyone who can see a folder can see the pastes directly in it.
+// @Tags folders
+// @Produce json
+// @Param id path uint true "Folder ID"
+// @Param tag query []string false "Only pastes with all of these tags" collectionFormat(multi)
+// @Success 200 {object} models.APIResponse[models.FolderContentsData]
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse "Folder not found"
+// @Failure 500 {object} models.ErrorResponse
+// @Router /folders/{id} [get]
+func (h *FolderHandler) GetFolder(c *gin.Context) {
+	ctx := c.Request.Context()
+	log := utils.LoggerFromContext(ctx)
+
+	id, ok := parseUintParam(c, "id")
+	if !ok {
+		return
+	}
+	userID, _ := utils.GetUserID(c)
+
+	contents, err := h.folderService.Get(ctx, id, userID, c.QueryArray("tag"))
+	if err != nil {
+		log.Info().Err(err).Uint("folderId", id).Msg("Failed to retrieve folder")
+		respondFolderError(c, err, "Failed to retrieve folder")
+		return
+	}
+
+	utils.RespondOK(c, *contents, "Folder retrieved successfully")
+}
+
+// UpdateFolder godoc
+// @Summary Update a folder
+// @Description Renames a folder, moves it under another folder of the same owner or to the top level, or changes its privacy. Only team owners can make a team folder public, it shows the pastes in it to anyone.
+// @Tags folders
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path uint true "Folder ID"
+// @Param folder body models.UpdateFolderRequest true "Folder settings"
+// @Success 200 {object} models.APIResponse[models.FolderData]
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse "Not allowed to change or publish the folder"
+// @Failure 404 {object} models.ErrorResponse "Folder not found"
+// @Failure 500 {object} models.ErrorResponse
+// @Router /folders/{id} [put]
+func (h *FolderHandler) UpdateFolder(c *gin.Context) {
+	ctx := c.Request.Context()
+	log := utils.LoggerFromContext(ctx)
+
+	id, ok := parseUintParam(c, "id")
+	if !ok {
+		return
+	}
+
+	var req models.UpdateFolderRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		log.Error().Err(err).Msg("Failed to bind JSON for update folder request")
+		utils.RespondBadRequest(c, err, "Invalid folder data format")
+		return
+	}
+
+	userID, _ := utils.GetUserID(c)
+
+	folder, err := h.folderService.Update(ctx, id, userID, &req)
+	if err != nil {
+		log.Info().Err(err).Uint("folderId", id).Msg("Failed to update folder")
+		respondFolderError(c, err, "Failed to update folder")
+		return
+	}
+
+	utils.RespondOK(c, models.FolderData{Folder: folder}, "Folder updated successfully")
+}
+
+// DeleteFolder godoc
+// @Summary Delete a folder
+// @Description Deletes a folder. Its subfolders and pastes move up into its parent, or to the top level.
+// @Tags folders
+// @Produce json
+// @Security BearerAuth
+// @Param id path uint true "Folder ID"
+// @Success 200 {object} models.APIResponse[uint]
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse "Not allowed to change the folder"
+// @Failure 404 {object} models.ErrorResponse "Folder not found"
+// @Failure 500 {object} models.ErrorResponse
+// @Router /folders/{id} [delete]
+func (h *FolderHandler) DeleteFolder(c *gin.Context) {
+	ctx := c.Request.Context()
+	log := utils.LoggerFromContext(ctx)
+
+	id, ok := parseUintParam(c, "id")
+	if !ok {
+		return
+	}
+	userID, _ := utils.GetUserID(c)
+
+	if err := h.folderService.Delete(ctx, id, userID); err != nil {
+		log.Info().Err(err).Uint("folderId", id).Msg("Failed to delete folder")
+		respondFolderError(c, err, "Failed to delete folder")
+		return
+	}
+
+	utils.RespondOK(c, id, "Folder deleted")
+}
+
+// MovePasteToFolder godoc
+// @Summary Move a paste into a folder
+// @Description Moves a paste into a folder the caller may change, or out of its folder when folderId is left out. Anyone who can see the folder can see the paste. Only the paste's owner may move it.
+// @Tags pastes
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path uint64 true "Paste ID"
+// @Param folder body models.MovePasteRequest true "Target folder"
+// @Success 200 {object} models.APIResponse[uint64]
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse "Not the paste's owner, or not allowed to change the folder"
+// @Failure 404 {object} models.ErrorResponse "Paste or folder not found"
+// @Failure 500 {object} models.ErrorResponse
+// @Router /paste/{id}/folder [put]
+func (h *PasteHandler) MovePasteToFolder(c *gin.Context) {
+	ctx := c.Request.Context()
+	log := utils.LoggerFromContext(ctx)
+
+	id, ok := parsePasteID(c)
+	if !ok {
+		return
+	}
+
+	var req models.MovePasteRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		log.Error().Err(err).Msg("Failed to bind JSON for move paste request")
+		utils.RespondBadRequest(c, err, "Invalid folder data format")
+		return
+	}
+
+	userID, _ := utils.GetUserID(c)
+
+	if err := h.pasteService.MoveToFolder(ctx, id, userID, req.FolderID); err != nil {
+		log.Info().Err(err).Uint64("pasteId", id).Msg("Failed to move paste")
+		respondPasteError(c, err, "Failed to move paste")
+		return
+	}
+
+	utils.RespondOK(c, id, "Paste moved")
+}
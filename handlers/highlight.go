@@ -0,0 +1,153 @@
+package handlers
+
+import (
+	"errors"
+	"memoria-backend/models"
+	"memoria-backend/services"
+	"memoria-backend/utils"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetPasteHTML godoc
+// @Summary Render a paste as highlighted HTML
+// @Description Renders a paste server-side as syntax highlighted HTML with numbered, linkable lines (#L12, or #f2-L12 for the second file of a multi-file paste), with the same access rules as retrieving the paste. Text pastes and markdown files are rendered as sanitised GitHub flavoured markdown with anchored headings, unless source=true or a language is given. By default it returns a fragment styled by the stylesheet at /paste/themes/{theme}/css; standalone=true returns a complete page with the theme embedded. Client-side encrypted pastes can't be rendered.
+// @Tags pastes
+// @Param id path uint64 true "Paste ID"
+// @Param language query string false "Language to highlight as, instead of the paste's own"
+// @Param source query bool false "Highlight markdown as source instead of rendering it"
+// @Param standalone query bool false "Return a complete HTML page with the theme's stylesheet embedded"
+// @Param theme query string false "Theme of a standalone page, defaults to the server's default theme"
+// @Param pw query string false "Password for protected pastes"
+// @Produce html
+// @Success 200 {string} string "Highlighted HTML"
+// @Failure 400 {object} models.ErrorResponse "Unknown language or theme, or an encrypted paste"
+// @Failure 401 {object} models.ErrorResponse "Password required or invalid password"
+// @Failure 404 {object} models.ErrorResponse "Paste not found"
+// @Failure 500 {object} models.ErrorResponse
+// @Router /paste/{id}/html [get]
+func (h *PasteHandler) GetPasteHTML(c *gin.Context) {
+	ctx := c.Request.Context()
+	log := utils.LoggerFromContext(ctx)
+
+	id, ok := parsePasteID(c)
+	if !ok {
+		return
+	}
+
+	paste, err := h.pasteService.GetByID(ctx, id)
+	if err != nil {
+		log.Error().Err(err).Uint64("pasteId", id).Msg("Failed to retrieve paste")
+		respondPasteError(c, err, "Failed to retrieve paste")
+		return
+	}
+	if !h.authorizePasteView(c, paste) {
+		return
+	}
+
+	var req models.RenderPasteRequest
+	if err := c.ShouldBindQuery(&req); err != nil {
+		utils.RespondBadRequest(c, err, "Invalid query parameters")
+		return
+	}
+
+	var rendered string
+	if req.Standalone {
+		rendered, err = h.highlightService.RenderDocument(ctx, paste, &req)
+	} else {
+		rendered, err = h.highlightService.RenderPaste(ctx, paste, &req)
+	}
+	if err != nil {
+		log.Info().Err(err).Uint64("pasteId", id).Msg("Failed to render paste")
+		respondPasteError(c, err, "Failed to render paste")
+		return
+	}
+
+	c.Header("X-Content-Type-Options", "nosniff")
+	c.Header("Content-Security-Policy", "default-src 'none'; style-src 'unsafe-inline'; img-src https: data:")
+	c.Data(http.StatusOK, "text/html; charset=utf-8", []byte(rendered))
+}
+
+// GetPasteTOC godoc
+// @Summary Get the table of contents of a paste
+// @Description Lists the headings of a paste's markdown, nested by level, with the anchors they have in /paste/{id}/html. Pastes without markdown have an empty table of contents. Client-side encrypted pastes can't be read.
+// @Tags pastes
+// @Param id path uint64 true "Paste ID"
+// @Param pw query string false "Password for protected pastes"
+// @Produce json
+// @Success 200 {object} models.APIResponse[models.PasteTOCData]
+// @Failure 400 {object} models.ErrorResponse "Encrypted paste"
+// @Failure 401 {object} models.ErrorResponse "Password required or invalid password"
+// @Failure 404 {object} models.ErrorResponse "Paste not found"
+// @Failure 500 {object} models.ErrorResponse
+// @Router /paste/{id}/toc [get]
+func (h *PasteHandler) GetPasteTOC(c *gin.Context) {
+	ctx := c.Request.Context()
+	log := utils.LoggerFromContext(ctx)
+
+	id, ok := parsePasteID(c)
+	if !ok {
+		return
+	}
+
+	paste, err := h.pasteService.GetByID(ctx, id)
+	if err != nil {
+		log.Error().Err(err).Uint64("pasteId", id).Msg("Failed to retrieve paste")
+		respondPasteError(c, err, "Failed to retrieve paste")
+		return
+	}
+	if !h.authorizePasteView(c, paste) {
+		return
+	}
+
+	entries, err := h.highlightService.TableOfContents(ctx, paste)
+	if err != nil {
+		log.Info().Err(err).Uint64("pasteId", id).Msg("Failed to read table of contents")
+		respondPasteError(c, err, "Failed to read table of contents")
+		return
+	}
+
+	utils.RespondOK(c, models.PasteTOCData{Entries: entries}, "Table of contents retrieved successfully")
+}
+
+// ListHighlightThemes godoc
+// @Summary List highlighting themes
+// @Description Lists the themes rendered pastes can be styled with
+// @Tags pastes
+// @Produce json
+// @Success 200 {object} models.APIResponse[models.HighlightThemesData]
+// @Router /paste/themes [get]
+func (h *PasteHandler) ListHighlightThemes(c *gin.Context) {
+	themes := h.highlightService.Themes()
+	utils.RespondOK(c, models.HighlightThemesData{Themes: themes, Default: h.configService.GetConfig().Render.DefaultTheme}, "Themes retrieved successfully")
+}
+
+// GetHighlightThemeCSS godoc
+// @Summary Get the stylesheet of a highlighting theme
+// @Description Returns the CSS that styles the HTML of /paste/{id}/html in a theme
+// @Tags pastes
+// @Param theme path string true "Theme name"
+// @Produce css
+// @Success 200 {string} string "Stylesheet"
+// @Failure 404 {object} models.ErrorResponse "Unknown theme"
+// @Failure 500 {object} models.ErrorResponse
+// @Router /paste/themes/{theme}/css [get]
+func (h *PasteHandler) GetHighlightThemeCSS(c *gin.Context) {
+	ctx := c.Request.Context()
+	log := utils.LoggerFromContext(ctx)
+
+	css, err := h.highlightService.ThemeCSS(c.Param("theme"))
+	if err != nil {
+		if errors.Is(err, services.ErrUnknownTheme) {
+			utils.RespondNotFound(c, err, err.Error())
+			return
+		}
+		log.Error().Err(err).Str("theme", c.Param("theme")).Msg("Failed to write theme stylesheet")
+		utils.RespondInternalError(c, err, "Failed to retrieve theme")
+		return
+	}
+
+	c.Header("Cache-Control", "public, max-age=86400")
+	c.Data(http.StatusOK, "text/css; charset=utf-8", []byte(css))
+}
@@ -0,0 +1,54 @@
+package handlers
+
+import (
+	"memoria-backend/models"
+	"memoria-backend/services"
+	"memoria-backend/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+type LanguageHandler struct {
+	languageService services.LanguageService
+}
+
+func NewLanguageHandler(languageService services.LanguageService) *LanguageHandler {
+	return &LanguageHandler{languageService: languageService}
+}
+
+// ListLanguages godoc
+// @Summary List the supported languages
+// @Description Lists the languages a paste's syntaxHighlight can be set to. Each can be given by its ID, its name or one of its aliases and is stored by its ID.
+// @Tags languages
+// @Produce json
+// @Success 200 {object} models.APIResponse[models.LanguageListData]
+// @Router /languages [get]
+func (h *LanguageHandler) ListLanguages(c *gin.Context) {
+	languages := h.languageService.List()
+	utils.RespondOK(c, models.LanguageListData{Languages: languages, Count: len(languages)}, "Languages retrieved successfully")
+}
+
+// DetectLanguage godoc
+// @Summary Guess the language of some content
+// @Description Guesses the language from a shebang, an editor modeline, the extension of the file name and the content itself. Pastes created or updated without a syntaxHighlight get the best guess when it's confident enough.
+// @Tags languages
+// @Accept json
+// @Produce json
+// @Param request body models.DetectLanguageRequest true "Content to guess the language of"
+// @Success 200 {object} models.APIResponse[models.LanguageGuessData]
+// @Failure 400 {object} models.ErrorResponse
+// @Router /paste/detect-language [post]
+func (h *LanguageHandler) DetectLanguage(c *gin.Context) {
+	ctx := c.Request.Context()
+	log := utils.LoggerFromContext(ctx)
+
+	var req models.DetectLanguageRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		log.Error().Err(err).Msg("Failed to bind JSON for detect language request")
+		utils.RespondBadRequest(c, err, "Invalid detect language request format")
+		return
+	}
+
+	guesses := h.languageService.Detect(req.FileName, req.Content)
+	utils.RespondOK(c, models.LanguageGuessData{Guesses: guesses}, "Languages detected successfully")
+}
@@ -0,0 +1,188 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"memoria-backend/models"
+	"memoria-backend/services"
+	"memoria-backend/utils"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+)
+
+// CollabSubprotocol is the WebSocket subprotocol of the collaboration protocol
+const CollabSubprotocol = "memoria-collab"
+
+const (
+	collabWriteTimeout   = 10 * time.Second
+	collabPongTimeout    = 60 * time.Second
+	collabPingInterval   = collabPongTimeout * 9 / 10
+	collabMaxMessageSize = 1 << 20
+)
+
+// collabUpgrader accepts WebSocket handshakes from the origins allowed to use the API. The
+// handshake never echoes the bearer subprotocol a token may come in.
+func (h *PasteHandler) collabUpgrader() *websocket.Upgrader {
+	allowedOrigins := h.configService.GetConfig().Auth.AllowedOrigins
+	return &websocket.Upgrader{
+		Subprotocols: []string{CollabSubprotocol},
+		CheckOrigin: func(r *http.Request) bool {
+			origin := r.Header.Get("Origin")
+			return origin == "" || slices.Contains(allowedOrigins, origin) || slices.Contains(allowedOrigins, "*")
+		},
+	}
+}
+
+// CollaboratePaste godoc
+// @Summary Edit a paste together in real time
+// @Description Upgrades to a WebSocket (subprotocol memoria-collab) joining the collaboration session of a paste, with the same access rules as retrieving the paste. Browsers may send their token as a "bearer.<token>" subprotocol. The server first sends a snapshot of the files and participants; clients then send edits as operations based on the last revision they saw, which the server transforms against concurrent edits, acknowledges and relays to everyone else. Callers who can't edit the paste, or whose token lacks the pastes:write scope, join read-only. Edits are saved to the paste periodically and when the last participant leaves; updates made to the paste meanwhile are merged into the document, or end the session when they changed its files. Client-side encrypted pastes can't be edited together.
+// @Tags pastes
+// @Param id path uint64 true "Paste ID"
+// @Param pw query string false "Password for protected pastes"
+// @Success 101 {object} models.CollabMessage "Switching protocols, messages are CollabMessage JSON"
+// @Failure 400 {object} models.ErrorResponse "Encrypted paste or not a WebSocket handshake"
+// @Failure 401 {object} models.ErrorResponse "Password required or invalid password"
+// @Failure 403 {object} models.ErrorResponse "Origin not allowed"
+// @Failure 404 {object} models.ErrorResponse "Paste not found"
+// @Failure 500 {object} models.ErrorResponse
+// @Router /paste/{id}/collab [get]
+func (h *PasteHandler) CollaboratePaste(c *gin.Context) {
+	ctx := c.Request.Context()
+	log := utils.LoggerFromContext(ctx)
+
+	id, ok := parsePasteID(c)
+	if !ok {
+		return
+	}
+
+	paste, err := h.pasteService.GetByID(ctx, id)
+	if err != nil {
+		log.Error().Err(err).Uint64("pasteId", id).Msg("Failed to retrieve paste")
+		respondPasteError(c, err, "Failed to retrieve paste")
+		return
+	}
+	if !h.authorizePasteView(c, paste) {
+		return
+	}
+	if paste.IsEncrypted() {
+		respondPasteError(c, services.ErrCollabEncrypted, "Failed to join collaboration")
+		return
+	}
+	if !websocket.IsWebSocketUpgrade(c.Request) {
+		utils.RespondBadRequest(c, nil, "Expected a WebSocket handshake")
+		return
+	}
+
+	// Viewers who may not edit the paste follow along read-only
+	userID, _ := utils.GetUserID(c)
+	readOnly := false
+	if identity, ok := utils.GetAuthIdentity(c); ok && !identity.HasScope(models.ScopePastesWrite) {
+		readOnly = true
+	}
+	if err := h.pasteService.CanEdit(ctx, paste, userID); err != nil {
+		if !errors.Is(err, services.ErrPasteForbidden) {
+			log.Error().Err(err).Uint64("pasteId", id).Msg("Failed to check paste access")
+			utils.RespondInternalError(c, err, "Failed to join collaboration")
+			return
+		}
+		readOnly = true
+	}
+
+	// The session outlives the handshake request, which ends with the upgrade
+	sessionCtx := context.WithoutCancel(ctx)
+	client, err := h.collabService.Join(sessionCtx, paste, userID, readOnly)
+	if err != nil {
+		log.Error().Err(err).Uint64("pasteId", id).Msg("Failed to join paste collaboration")
+		respondPasteError(c, err, "Failed to join collaboration")
+		return
+	}
+
+	conn, err := h.collabUpgrader().Upgrade(c.Writer, c.Request, nil)
+	if err != nil {
+		// The upgrader already responded
+		log.Info().Err(err).Uint64("pasteId", id).Msg("WebSocket handshake failed")
+		client.Leave(sessionCtx)
+		return
+	}
+
+	// Refused messages are handed to the writer one by one so each gets its error back, a
+	// client sending faster than it reads its errors is slowed down
+	refusals := make(chan models.CollabMessage)
+	writerDone := make(chan struct{})
+	go func() {
+		defer close(writerDone)
+		h.writeCollabMessages(sessionCtx, conn, client, refusals)
+	}()
+	h.readCollabMessages(sessionCtx, conn, client, refusals, writerDone)
+}
+
+// readCollabMessages hands the client's messages to the session until the connection closes
+// or the writer stops
+func (h *PasteHandler) readCollabMessages(ctx context.Context, conn *websocket.Conn, client *services.CollabClient, refusals chan<- models.CollabMessage, writerDone <-chan struct{}) {
+	log := utils.LoggerFromContext(ctx)
+	defer client.Leave(ctx)
+
+	conn.SetReadLimit(collabMaxMessageSize)
+	_ = conn.SetReadDeadline(time.Now().Add(collabPongTimeout))
+	conn.SetPongHandler(func(string) error {
+		return conn.SetReadDeadline(time.Now().Add(collabPongTimeout))
+	})
+
+	for {
+		var msg models.CollabMessage
+		if err := conn.ReadJSON(&msg); err != nil {
+			if websocket.IsUnexpectedCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway) {
+				log.Info().Err(err).Str("clientId", client.ID).Msg("Collaboration connection closed")
+			}
+			return
+		}
+		if err := client.Handle(ctx, &msg); err != nil {
+			select {
+			case refusals <- models.CollabMessage{Type: models.CollabMessageError, Revision: msg.Revision, File: msg.File, Error: err.Error()}:
+			case <-writerDone:
+				return
+			}
+		}
+	}
+}
+
+// writeCollabMessages sends the session's messages to the client and keeps the connection
+// alive, closing it once the client left or fell behind
+func (h *PasteHandler) writeCollabMessages(ctx context.Context, conn *websocket.Conn, client *services.CollabClient, refusals <-chan models.CollabMessage) {
+	log := utils.LoggerFromContext(ctx)
+	ticker := time.NewTicker(collabPingInterval)
+	defer func() {
+		ticker.Stop()
+		conn.Close()
+	}()
+
+	for {
+		var msg models.CollabMessage
+		select {
+		case message, ok := <-client.Messages():
+			if !ok {
+				_ = conn.SetWriteDeadline(time.Now().Add(collabWriteTimeout))
+				_ = conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""))
+				return
+			}
+			msg = message
+		case msg = <-refusals:
+		case <-ticker.C:
+			_ = conn.SetWriteDeadline(time.Now().Add(collabWriteTimeout))
+			if err := conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+				return
+			}
+			continue
+		}
+
+		_ = conn.SetWriteDeadline(time.Now().Add(collabWriteTimeout))
+		if err := conn.WriteJSON(msg); err != nil {
+			log.Info().Err(err).Str("clientId", client.ID).Msg("Failed to write collaboration message")
+			return
+		}
+	}
+}
@@ -0,0 +1,326 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"memoria-backend/models"
+	"memoria-backend/repository"
+	"memoria-backend/services"
+	"memoria-backend/utils"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// testConfigService serves a fixed configuration
+type testConfigService struct {
+	services.ConfigService
+	config *models.Configuration
+}
+
+func (s *testConfigService) GetConfig() *models.Configuration {
+	return s.config
+}
+
+// testCollabServer serves the collaboration endpoint of a paste service on a SQLite
+// database. Callers authenticate with "Bearer <user ID>", or "Bearer <user ID>:read" for a
+// token limited to reading. Sessions only save when their last participant leaves unless
+// configured otherwise.
+type testCollabServer struct {
+	server       *httptest.Server
+	pasteService services.PasteService
+}
+
+func newTestCollabServer(t *testing.T, configure func(config *models.Configuration)) *testCollabServer {
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "memoria.db")), &gorm.Config{Logger: logger.Discard})
+	require.NoError(t, err)
+	require.NoError(t, db.AutoMigrate(&models.User{}, &models.Team{}, &models.TeamMember{}, &models.Paste{}, &models.Tag{}, &models.Folder{}, &models.PasteFile{}, &models.Attachment{}, &models.ContentBlob{}, &models.PasteContent{}, &models.PasteGrant{}, &models.ShareLink{}, &models.PasteLink{}, &models.PasteComment{}))
+
+	config := &models.Configuration{}
+	config.Collab.History = 100
+	config.Collab.PersistInterval = 3600
+	config.Trash.RetentionDays = 30
+	if configure != nil {
+		configure(config)
+	}
+	configService := &testConfigService{config: config}
+
+	pasteRepo := repository.NewPasteRepository(db, repository.PasteStorage{})
+	pasteService := services.NewPasteService(
+		pasteRepo,
+		repository.NewTeamRepository(db),
+		repository.NewPasteGrantRepository(db),
+		repository.NewShareLinkRepository(db),
+		repository.NewUserRepository(db),
+		repository.NewAttachmentRepository(db, repository.PasteStorage{}),
+		repository.NewFolderRepository(db),
+		repository.NewPasteLinkRepository(db),
+		repository.NewPasteCommentRepository(db),
+		services.NewLanguageService(),
+		services.NewQuotaService(pasteRepo, configService),
+		configService,
+	)
+	collabService := services.NewCollabService(pasteService, services.NewMemoryPubSub(), configService)
+	handler := NewPasteHandler(pasteService, nil, collabService, configService)
+
+	gin.SetMode(gin.TestMode)
+	engine := gin.New()
+	engine.GET("/paste/:id/collab", func(c *gin.Context) {
+		token, ok := strings.CutPrefix(c.GetHeader("Authorization"), "Bearer ")
+		if !ok {
+			return
+		}
+		user, readOnly := strings.CutSuffix(token, ":read")
+		userID, err := strconv.ParseUint(user, 10, 32)
+		require.NoError(t, err)
+		scopes := []string{models.ScopePastesRead, models.ScopePastesWrite}
+		if readOnly {
+			scopes = scopes[:1]
+		}
+		c.Set(utils.AuthIdentityKey, &models.AuthIdentity{UserID: uint(userID), Scopes: scopes})
+	}, handler.CollaboratePaste)
+
+	server := httptest.NewServer(engine)
+	t.Cleanup(server.Close)
+	return &testCollabServer{server: server, pasteService: pasteService}
+}
+
+func (s *testCollabServer) createPaste(t *testing.T, privacy, userID, content string) *models.Paste {
+	paste, err := s.pasteService.Create(context.Background(), &models.CreatePasteRequest{
+		Title:   "Notes",
+		Content: content,
+		Privacy: privacy,
+		UserID:  userID,
+	})
+	require.NoError(t, err)
+	return paste
+}
+
+// dial joins the collaboration session of the paste, token may be empty to join anonymously
+func (s *testCollabServer) dial(pasteID uint64, token string) (*websocket.Conn, *http.Response, error) {
+	header := http.Header{}
+	if token != "" {
+		header.Set("Authorization", "Bearer "+token)
+	}
+	dialer := websocket.Dialer{Subprotocols: []string{CollabSubprotocol}}
+	url := "ws" + strings.TrimPrefix(s.server.URL, "http") + "/paste/" + strconv.FormatUint(pasteID, 10) + "/collab"
+	return dialer.Dial(url, header)
+}
+
+func (s *testCollabServer) join(t *testing.T, pasteID uint64, token string) *websocket.Conn {
+	conn, _, err := s.dial(pasteID, token)
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+// readMessage returns the next message of the given type, skipping presence updates and
+// other participants leaving
+func readMessage(t *testing.T, conn *websocket.Conn, messageType string) models.CollabMessage {
+	require.NoError(t, conn.SetReadDeadline(time.Now().Add(5*time.Second)))
+	for {
+		var msg models.CollabMessage
+		require.NoError(t, conn.ReadJSON(&msg))
+		if msg.Type == messageType {
+			return msg
+		}
+		require.Contains(t, []string{models.CollabMessagePresence, models.CollabMessageLeave}, msg.Type, "unexpected %+v", msg)
+	}
+}
+
+func TestCollaboratePasteRelaysEdits(t *testing.T) {
+	s := newTestCollabServer(t, nil)
+	paste := s.createPaste(t, "private", "1", "héllo")
+
+	first := s.join(t, paste.ID, "1")
+	snapshot := readMessage(t, first, models.CollabMessageSnapshot)
+	assert.False(t, snapshot.ReadOnly)
+	assert.Equal(t, 0, snapshot.Revision)
+	require.Len(t, snapshot.Files, 1)
+	assert.Equal(t, "héllo", snapshot.Files[0].Content)
+	file := snapshot.Files[0].Name
+
+	second := s.join(t, paste.ID, "1")
+	assert.Equal(t, "héllo", readMessage(t, second, models.CollabMessageSnapshot).Files[0].Content)
+
+	edit := models.CollabMessage{Type: models.CollabMessageOperation, File: file, Operation: []models.CollabOpComponent{{Retain: 5}, {Insert: " 🙂"}}}
+	require.NoError(t, first.WriteJSON(edit))
+	assert.Equal(t, 1, readMessage(t, first, models.CollabMessageAck).Revision)
+
+	relayed := readMessage(t, second, models.CollabMessageOperation)
+	assert.Equal(t, 1, relayed.Revision)
+	assert.Equal(t, file, relayed.File)
+	assert.Equal(t, edit.Operation, relayed.Operation)
+
+	// An edit based on the old revision is transformed against the one made meanwhile
+	require.NoError(t, second.WriteJSON(models.CollabMessage{Type: models.CollabMessageOperation, File: file, Operation: []models.CollabOpComponent{{Insert: ">"}, {Retain: 5}}}))
+	assert.Equal(t, 2, readMessage(t, second, models.CollabMessageAck).Revision)
+	third := s.join(t, paste.ID, "1")
+	assert.Equal(t, ">héllo 🙂", readMessage(t, third, models.CollabMessageSnapshot).Files[0].Content)
+}
+
+func TestCollaboratePasteRefusesEditsOfViewers(t *testing.T) {
+	s := newTestCollabServer(t, nil)
+	public := s.createPaste(t, "public", "1", "shared")
+
+	// Someone else's public paste and a token without the write scope both join read-only
+	for _, token := range []string{"2", "1:read", ""} {
+		conn := s.join(t, public.ID, token)
+		snapshot := readMessage(t, conn, models.CollabMessageSnapshot)
+		assert.True(t, snapshot.ReadOnly, "token %q", token)
+
+		// Every edit is answered, also when they come faster than the errors are read
+		for revision := 0; revision < 5; revision++ {
+			require.NoError(t, conn.WriteJSON(models.CollabMessage{Type: models.CollabMessageOperation, Revision: revision, File: snapshot.Files[0].Name, Operation: []models.CollabOpComponent{{Delete: 6}}}))
+		}
+		for revision := 0; revision < 5; revision++ {
+			refusal := readMessage(t, conn, models.CollabMessageError)
+			assert.Equal(t, services.ErrCollabReadOnly.Error(), refusal.Error, "token %q", token)
+			assert.Equal(t, revision, refusal.Revision, "token %q", token)
+		}
+	}
+
+	stored, err := s.pasteService.GetByID(context.Background(), public.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "shared", stored.Content)
+
+	// Private pastes refuse the handshake of everyone but their author
+	private := s.createPaste(t, "private", "1", "secret")
+	for _, token := range []string{"2", ""} {
+		_, resp, err := s.dial(private.ID, token)
+		require.ErrorIs(t, err, websocket.ErrBadHandshake, "token %q", token)
+		assert.Equal(t, http.StatusForbidden, resp.StatusCode, "token %q", token)
+	}
+}
+
+func TestCollaboratePasteSavesWhenTheLastParticipantLeaves(t *testing.T) {
+	s := newTestCollabServer(t, nil)
+	paste := s.createPaste(t, "private", "1", "draft")
+
+	conn := s.join(t, paste.ID, "1")
+	file := readMessage(t, conn, models.CollabMessageSnapshot).Files[0].Name
+	require.NoError(t, conn.WriteJSON(models.CollabMessage{Type: models.CollabMessageOperation, File: file, Operation: []models.CollabOpComponent{{Delete: 5}, {Insert: "final 日本"}}}))
+	readMessage(t, conn, models.CollabMessageAck)
+	require.NoError(t, conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, "")))
+
+	var stored *models.Paste
+	require.Eventually(t, func() bool {
+		var err error
+		stored, err = s.pasteService.GetByID(context.Background(), paste.ID)
+		require.NoError(t, err)
+		return stored.Content != "draft"
+	}, 5*time.Second, 20*time.Millisecond)
+	assert.Equal(t, "final 日本", stored.Content)
+	assert.Equal(t, "1", stored.UserID)
+	assert.Greater(t, stored.Version, paste.Version)
+
+	// A new session starts from the saved document
+	rejoined := s.join(t, paste.ID, "1")
+	assert.Equal(t, "final 日本", readMessage(t, rejoined, models.CollabMessageSnapshot).Files[0].Content)
+}
+
+// saveEverySecond makes sessions save their document every second
+func saveEverySecond(config *models.Configuration) {
+	config.Collab.PersistInterval = 1
+}
+
+func (s *testCollabServer) update(t *testing.T, paste *models.Paste, req *models.UpdatePasteRequest) {
+	stored, err := s.pasteService.GetByID(context.Background(), paste.ID)
+	require.NoError(t, err)
+	req.ID = paste.ID
+	req.Title = stored.Title
+	req.Privacy = stored.Privacy
+	req.UserID = stored.UserID
+	req.Version = stored.Version
+	_, err = s.pasteService.Update(context.Background(), req)
+	require.NoError(t, err)
+}
+
+func TestCollaboratePasteMergesChangesSavedOutsideTheSession(t *testing.T) {
+	s := newTestCollabServer(t, saveEverySecond)
+	paste := s.createPaste(t, "private", "1", "draft")
+
+	conn := s.join(t, paste.ID, "1")
+	file := readMessage(t, conn, models.CollabMessageSnapshot).Files[0].Name
+	require.NoError(t, conn.WriteJSON(models.CollabMessage{Type: models.CollabMessageOperation, File: file, Operation: []models.CollabOpComponent{{Retain: 5}, {Insert: "!"}}}))
+	readMessage(t, conn, models.CollabMessageAck)
+
+	// Saved elsewhere before the session's first save, which then fails on its version
+	s.update(t, paste, &models.UpdatePasteRequest{Content: "# draft"})
+
+	// The change reaches the session as an edit of its own and the merge is saved
+	merged := readMessage(t, conn, models.CollabMessageOperation)
+	assert.Empty(t, merged.ClientID)
+	assert.Equal(t, []models.CollabOpComponent{{Insert: "# "}, {Retain: 6}}, merged.Operation)
+
+	var stored *models.Paste
+	require.Eventually(t, func() bool {
+		var err error
+		stored, err = s.pasteService.GetByID(context.Background(), paste.ID)
+		require.NoError(t, err)
+		return stored.Content == "# draft!"
+	}, 5*time.Second, 20*time.Millisecond)
+
+	// Leaving saves nothing more, the session is based on the version it saved
+	require.NoError(t, conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, "")))
+	rejoined := s.join(t, paste.ID, "1")
+	assert.Equal(t, "# draft!", readMessage(t, rejoined, models.CollabMessageSnapshot).Files[0].Content)
+	after, err := s.pasteService.GetByID(context.Background(), paste.ID)
+	require.NoError(t, err)
+	assert.Equal(t, stored.Version, after.Version)
+}
+
+func TestCollaboratePasteEndsWhenFilesChangeOutsideTheSession(t *testing.T) {
+	s := newTestCollabServer(t, saveEverySecond)
+	paste := s.createPaste(t, "private", "1", "draft")
+
+	conn := s.join(t, paste.ID, "1")
+	file := readMessage(t, conn, models.CollabMessageSnapshot).Files[0].Name
+	require.NoError(t, conn.WriteJSON(models.CollabMessage{Type: models.CollabMessageOperation, File: file, Operation: []models.CollabOpComponent{{Delete: 5}}}))
+	readMessage(t, conn, models.CollabMessageAck)
+
+	s.update(t, paste, &models.UpdatePasteRequest{Files: []models.PasteFileRequest{
+		{Name: "main.go", Content: "package main"},
+		{Name: "go.mod", Content: "module notes"},
+	}})
+
+	// Files can't be merged into the session, its participants are told to reload
+	assert.Equal(t, services.ErrCollabConflict.Error(), readMessage(t, conn, models.CollabMessageError).Error)
+	_, _, err := conn.ReadMessage()
+	assert.True(t, websocket.IsCloseError(err, websocket.CloseNormalClosure), "%v", err)
+
+	// The session was refused its save, the files it couldn't merge are still there
+	stored, err := s.pasteService.GetByID(context.Background(), paste.ID)
+	require.NoError(t, err)
+	require.Len(t, stored.Files, 2)
+	assert.Equal(t, "package main", stored.Files[0].Content)
+}
+
+func TestCollaboratePasteEndsWhenThePasteIsDeleted(t *testing.T) {
+	s := newTestCollabServer(t, saveEverySecond)
+	paste := s.createPaste(t, "private", "1", "draft")
+
+	conn := s.join(t, paste.ID, "1")
+	file := readMessage(t, conn, models.CollabMessageSnapshot).Files[0].Name
+	_, err := s.pasteService.Delete(context.Background(), paste.ID, paste.Version)
+	require.NoError(t, err)
+	require.NoError(t, conn.WriteJSON(models.CollabMessage{Type: models.CollabMessageOperation, File: file, Operation: []models.CollabOpComponent{{Delete: 5}}}))
+	readMessage(t, conn, models.CollabMessageAck)
+
+	// Saving can't succeed anymore, so the session ends instead of trying again
+	assert.Equal(t, services.ErrCollabGone.Error(), readMessage(t, conn, models.CollabMessageError).Error)
+	_, _, err = conn.ReadMessage()
+	assert.True(t, websocket.IsCloseError(err, websocket.CloseNormalClosure), "%v", err)
+}
@@ -0,0 +1,305 @@
+package handlers
+
+import (
+	"memoria-backend/models"
+	"memoria-backend/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// commentedPaste loads the paste of a comment route, responding and returning false when it
+// doesn't exist or the caller may not view it
+func (h *PasteHandler) commentedPaste(c *gin.Context) (*models.Paste, bool) {
+	ctx := c.Request.Context()
+	log := utils.LoggerFromContext(ctx)
+
+	id, ok := parsePasteID(c)
+	if !ok {
+		return nil, false
+	}
+
+	paste, err := h.pasteService.GetByID(ctx, id)
+	if err != nil {
+		log.Error().Err(err).Uint64("pasteId", id).Msg("Failed to retrieve paste")
+		respondPasteError(c, err, "Failed to retrieve paste")
+		return nil, false
+	}
+	if !h.authorizePasteView(c, paste) {
+		return nil, false
+	}
+	return paste, true
+}
+
+// ListPasteComments godoc
+// @Summary List the comments on a paste
+// @Description Returns the comment threads of a paste, oldest first with their replies, with the same access rules as retrieving the paste. Comments on lines carry the file, line range and revision (content hash) they refer to; outdated ones point at lines a later revision changed.
+// @Tags pastes
+// @Produce json
+// @Param id path uint64 true "Paste ID"
+// @Param pw query string false "Password for protected pastes"
+// @Success 200 {object} models.APIResponse[models.PasteCommentListData]
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 401 {object} models.ErrorResponse "Password required or invalid password"
+// @Failure 404 {object} models.ErrorResponse "Paste not found"
+// @Failure 500 {object} models.ErrorResponse
+// @Router /paste/{id}/comments [get]
+func (h *PasteHandler) ListPasteComments(c *gin.Context) {
+	ctx := c.Request.Context()
+	log := utils.LoggerFromContext(ctx)
+
+	paste, ok := h.commentedPaste(c)
+	if !ok {
+		return
+	}
+
+	comments, err := h.pasteService.GetComments(ctx, paste)
+	if err != nil {
+		log.Error().Err(err).Uint64("pasteId", paste.ID).Msg("Failed to list paste comments")
+		respondPasteError(c, err, "Failed to list comments")
+		return
+	}
+
+	utils.RespondOK(c, comments, "Comments retrieved successfully")
+}
+
+// CreatePasteComment godoc
+// @Summary Comment on a paste
+// @Description Comments on a paste the caller can view, on a line range of one of its files, on the paste as a whole, or as a reply to a thread. A contentHash refuses the comment when the file has changed since the client read it.
+// @Tags pastes
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path uint64 true "Paste ID"
+// @Param pw query string false "Password for protected pastes"
+// @Param comment body models.CreatePasteCommentRequest true "The comment and what it's on"
+// @Success 201 {object} models.APIResponse[models.PasteCommentData]
+// @Failure 400 {object} models.ErrorResponse "Invalid line range or reply"
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse "Comments are disabled"
+// @Failure 404 {object} models.ErrorResponse "Paste or parent comment not found"
+// @Failure 409 {object} models.ErrorResponse "The file changed since"
+// @Failure 500 {object} models.ErrorResponse
+// @Router /paste/{id}/comments [post]
+func (h *PasteHandler) CreatePasteComment(c *gin.Context) {
+	ctx := c.Request.Context()
+	log := utils.LoggerFromContext(ctx)
+
+	paste, ok := h.commentedPaste(c)
+	if !ok {
+		return
+	}
+
+	var req models.CreatePasteCommentRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		log.Error().Err(err).Msg("Failed to bind JSON for create paste comment request")
+		utils.RespondBadRequest(c, err, "Invalid comment data format")
+		return
+	}
+
+	userID, _ := utils.GetUserID(c)
+
+	comment, err := h.pasteService.AddComment(ctx, paste, userID, &req)
+	if err != nil {
+		log.Info().Err(err).Uint64("pasteId", paste.ID).Msg("Failed to comment on paste")
+		respondPasteError(c, err, "Failed to comment on paste")
+		return
+	}
+
+	utils.RespondCreated(c, models.PasteCommentData{Comment: comment}, "Comment added successfully")
+}
+
+// UpdatePasteComment godoc
+// @Summary Edit a comment
+// @Description Changes the text of one of the caller's comments
+// @Tags pastes
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path uint64 true "Paste ID"
+// @Param commentId path uint true "Comment ID"
+// @Param pw query string false "Password for protected pastes"
+// @Param comment body models.UpdatePasteCommentRequest true "The new text"
+// @Success 200 {object} models.APIResponse[models.PasteCommentData]
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse "Not the comment's author"
+// @Failure 404 {object} models.ErrorResponse "Paste or comment not found"
+// @Failure 500 {object} models.ErrorResponse
+// @Router /paste/{id}/comments/{commentId} [put]
+func (h *PasteHandler) UpdatePasteComment(c *gin.Context) {
+	ctx := c.Request.Context()
+	log := utils.LoggerFromContext(ctx)
+
+	paste, ok := h.commentedPaste(c)
+	if !ok {
+		return
+	}
+	commentID, ok := parseUintParam(c, "commentId")
+	if !ok {
+		return
+	}
+
+	var req models.UpdatePasteCommentRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		log.Error().Err(err).Msg("Failed to bind JSON for update paste comment request")
+		utils.RespondBadRequest(c, err, "Invalid comment data format")
+		return
+	}
+
+	userID, _ := utils.GetUserID(c)
+
+	comment, err := h.pasteService.UpdateComment(ctx, paste, userID, commentID, &req)
+	if err != nil {
+		log.Info().Err(err).Uint64("pasteId", paste.ID).Uint("commentId", commentID).Msg("Failed to update paste comment")
+		respondPasteError(c, err, "Failed to update comment")
+		return
+	}
+
+	utils.RespondOK(c, models.PasteCommentData{Comment: comment}, "Comment updated successfully")
+}
+
+// DeletePasteComment godoc
+// @Summary Delete a comment
+// @Description Deletes a comment along with its replies. Authors can delete their own comments, the paste's owner can delete any.
+// @Tags pastes
+// @Produce json
+// @Security BearerAuth
+// @Param id path uint64 true "Paste ID"
+// @Param commentId path uint true "Comment ID"
+// @Param pw query string false "Password for protected pastes"
+// @Success 200 {object} models.APIResponse[uint]
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse "Neither the comment's author nor the paste's owner"
+// @Failure 404 {object} models.ErrorResponse "Paste or comment not found"
+// @Failure 500 {object} models.ErrorResponse
+// @Router /paste/{id}/comments/{commentId} [delete]
+func (h *PasteHandler) DeletePasteComment(c *gin.Context) {
+	ctx := c.Request.Context()
+	log := utils.LoggerFromContext(ctx)
+
+	paste, ok := h.commentedPaste(c)
+	if !ok {
+		return
+	}
+	commentID, ok := parseUintParam(c, "commentId")
+	if !ok {
+		return
+	}
+	userID, _ := utils.GetUserID(c)
+
+	if err := h.pasteService.DeleteComment(ctx, paste, userID, commentID); err != nil {
+		log.Info().Err(err).Uint64("pasteId", paste.ID).Uint("commentId", commentID).Msg("Failed to delete paste comment")
+		respondPasteError(c, err, "Failed to delete comment")
+		return
+	}
+
+	utils.RespondOK(c, commentID, "Comment deleted")
+}
+
+// ResolvePasteComment godoc
+// @Summary Resolve a comment thread
+// @Description Marks the thread of a comment as resolved. The thread's author and anyone who may edit the paste can resolve it.
+// @Tags pastes
+// @Produce json
+// @Security BearerAuth
+// @Param id path uint64 true "Paste ID"
+// @Param commentId path uint true "Comment ID"
+// @Param pw query string false "Password for protected pastes"
+// @Success 200 {object} models.APIResponse[models.PasteCommentData]
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse "Neither the thread's author nor an editor of the paste"
+// @Failure 404 {object} models.ErrorResponse "Paste or comment not found"
+// @Failure 500 {object} models.ErrorResponse
+// @Router /paste/{id}/comments/{commentId}/resolve [post]
+func (h *PasteHandler) ResolvePasteComment(c *gin.Context) {
+	h.setPasteCommentResolved(c, true)
+}
+
+// UnresolvePasteComment godoc
+// @Summary Reopen a comment thread
+// @Description Marks a resolved thread as unresolved again, with the same access rules as resolving it
+// @Tags pastes
+// @Produce json
+// @Security BearerAuth
+// @Param id path uint64 true "Paste ID"
+// @Param commentId path uint true "Comment ID"
+// @Param pw query string false "Password for protected pastes"
+// @Success 200 {object} models.APIResponse[models.PasteCommentData]
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse "Neither the thread's author nor an editor of the paste"
+// @Failure 404 {object} models.ErrorResponse "Paste or comment not found"
+// @Failure 500 {object} models.ErrorResponse
+// @Router /paste/{id}/comments/{commentId}/unresolve [post]
+func (h *PasteHandler) UnresolvePasteComment(c *gin.Context) {
+	h.setPasteCommentResolved(c, false)
+}
+
+func (h *PasteHandler) setPasteCommentResolved(c *gin.Context, resolved bool) {
+	ctx := c.Request.Context()
+	log := utils.LoggerFromContext(ctx)
+
+	paste, ok := h.commentedPaste(c)
+	if !ok {
+		return
+	}
+	commentID, ok := parseUintParam(c, "commentId")
+	if !ok {
+		return
+	}
+	userID, _ := utils.GetUserID(c)
+
+	comment, err := h.pasteService.ResolveComment(ctx, paste, userID, commentID, resolved)
+	if err != nil {
+		log.Info().Err(err).Uint64("pasteId", paste.ID).Uint("commentId", commentID).Msg("Failed to change comment thread state")
+		respondPasteError(c, err, "Failed to update comment")
+		return
+	}
+
+	utils.RespondOK(c, models.PasteCommentData{Comment: comment}, "Comment updated successfully")
+}
+
+// UpdatePasteCommentSettings godoc
+// @Summary Turn comments on a paste on or off
+// @Description Stops or allows new comments on a paste. Existing comments stay. Only the paste's owner can change this.
+// @Tags pastes
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path uint64 true "Paste ID"
+// @Param settings body models.PasteCommentSettingsRequest true "Whether comments are disabled"
+// @Success 200 {object} models.APIResponse[uint64]
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse "Not the paste's owner"
+// @Failure 404 {object} models.ErrorResponse "Paste not found"
+// @Failure 500 {object} models.ErrorResponse
+// @Router /paste/{id}/comments/settings [put]
+func (h *PasteHandler) UpdatePasteCommentSettings(c *gin.Context) {
+	ctx := c.Request.Context()
+	log := utils.LoggerFromContext(ctx)
+
+	id, ok := parsePasteID(c)
+	if !ok {
+		return
+	}
+
+	var req models.PasteCommentSettingsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		log.Error().Err(err).Msg("Failed to bind JSON for paste comment settings request")
+		utils.RespondBadRequest(c, err, "Invalid comment settings format")
+		return
+	}
+
+	userID, _ := utils.GetUserID(c)
+
+	if err := h.pasteService.SetCommentsDisabled(ctx, id, userID, *req.Disabled); err != nil {
+		log.Info().Err(err).Uint64("pasteId", id).Msg("Failed to change paste comment settings")
+		respondPasteError(c, err, "Failed to change comment settings")
+		return
+	}
+
+	utils.RespondOK(c, id, "Comment settings updated")
+}
@@ -0,0 +1,122 @@
+package handlers
+
+import (
+	"errors"
+	"io"
+	"memoria-backend/models"
+	"memoria-backend/services"
+	"memoria-backend/utils"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ForkPaste godoc
+// @Summary Fork a paste
+// @Description Creates a new paste owned by the caller with the content and files of a paste they can view, linked back to it through forkedFromId. Forking a password-protected paste requires its password in pw. Forks of anything but an openly public paste default to private.
+// @Tags pastes
+// @Accept json
+// @Produce json
+// @Param id path uint64 true "Paste ID"
+// @Param pw query string false "Password of the source paste"
+// @Param fork body models.ForkPasteRequest false "Settings of the fork"
+// @Success 201 {object} models.APIResponse[models.PasteData] "Success response with the fork"
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 401 {object} models.ErrorResponse "Password required or invalid password"
+// @Failure 403 {object} models.ErrorResponse "No access to the source or verified email required for public pastes"
+// @Failure 404 {object} models.ErrorResponse "Paste not found"
+// @Failure 422 {object} models.ErrorResponse "Paste too large or storage quota exceeded"
+// @Failure 429 {object} models.ErrorResponse "Daily paste limit reached"
+// @Failure 500 {object} models.ErrorResponse
+// @Router /paste/{id}/fork [post]
+func (h *PasteHandler) ForkPaste(c *gin.Context) {
+	ctx := c.Request.Context()
+	log := utils.LoggerFromContext(ctx)
+
+	id, ok := parsePasteID(c)
+	if !ok {
+		return
+	}
+
+	// The body is optional, an empty one forks with the defaults
+	var req models.ForkPasteRequest
+	if err := c.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+		log.Error().Err(err).Msg("Failed to bind JSON for fork paste request")
+		respondBindError(c, err, "Invalid fork data format")
+		return
+	}
+
+	source, err := h.pasteService.GetByID(ctx, id)
+	if err != nil {
+		log.Error().Err(err).Uint64("pasteId", id).Msg("Failed to retrieve paste")
+		respondPasteError(c, err, "Failed to retrieve paste")
+		return
+	}
+	if !h.authorizePasteView(c, source) {
+		return
+	}
+	if req.Privacy == "" {
+		req.Privacy = services.DefaultForkPrivacy(source)
+	}
+	if !h.checkVerifiedForPublic(c, req.Privacy) {
+		return
+	}
+
+	if userID, ok := utils.GetUserID(c); ok {
+		req.UserID = strconv.FormatUint(uint64(userID), 10)
+	} else {
+		req.ClientIP = c.ClientIP()
+	}
+
+	paste, err := h.pasteService.Fork(ctx, id, &req)
+	if err != nil {
+		log.Error().Err(err).Uint64("pasteId", id).Msg("Failed to fork paste")
+		respondPasteError(c, err, "Failed to fork paste")
+		return
+	}
+
+	utils.RespondCreated(c, models.PasteData{Paste: paste}, "Paste forked successfully")
+}
+
+// ListPasteForks godoc
+// @Summary List the forks of a paste
+// @Description Returns the tree of forks made from a paste, with the same access rules as retrieving the paste. Only forks the caller can view are listed and counted.
+// @Tags pastes
+// @Produce json
+// @Param id path uint64 true "Paste ID"
+// @Param pw query string false "Password for protected pastes"
+// @Success 200 {object} models.APIResponse[models.PasteForksData]
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 401 {object} models.ErrorResponse "Password required or invalid password"
+// @Failure 404 {object} models.ErrorResponse "Paste not found"
+// @Failure 500 {object} models.ErrorResponse
+// @Router /paste/{id}/forks [get]
+func (h *PasteHandler) ListPasteForks(c *gin.Context) {
+	ctx := c.Request.Context()
+	log := utils.LoggerFromContext(ctx)
+
+	id, ok := parsePasteID(c)
+	if !ok {
+		return
+	}
+
+	paste, err := h.pasteService.GetByID(ctx, id)
+	if err != nil {
+		log.Error().Err(err).Uint64("pasteId", id).Msg("Failed to retrieve paste")
+		respondPasteError(c, err, "Failed to retrieve paste")
+		return
+	}
+	if !h.authorizePasteView(c, paste) {
+		return
+	}
+
+	userID, _ := utils.GetUserID(c)
+	forks, err := h.pasteService.GetForks(ctx, paste, userID)
+	if err != nil {
+		log.Error().Err(err).Uint64("pasteId", id).Msg("Failed to list paste forks")
+		respondPasteError(c, err, "Failed to list forks")
+		return
+	}
+
+	utils.RespondOK(c, forks, "Forks retrieved successfully")
+}
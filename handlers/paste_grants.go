@@ -0,0 +1,164 @@
+package handlers
+
+import (
+	"memoria-backend/models"
+	"memoria-backend/utils"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// parsePasteID reads the paste ID path parameter, responding with 400 when it isn't numeric
+func parsePasteID(c *gin.Context) (uint64, bool) {
+	idStr := c.Param("id")
+	id, err := strconv.ParseUint(idStr, 10, 64)
+	if err != nil {
+		log := utils.LoggerFromContext(c.Request.Context())
+		log.Error().Err(err).Str("idStr", idStr).Msg("Failed to parse ID for paste")
+		utils.RespondBadRequest(c, err, "Invalid paste ID format")
+		return 0, false
+	}
+	return id, true
+}
+
+// ListPasteGrants godoc
+// @Summary List who a paste is shared with
+// @Description Lists the users and teams a paste is shared with. Only the paste's author (or a team owner for team pastes) can see them.
+// @Tags pastes
+// @Produce json
+// @Security BearerAuth
+// @Param id path uint64 true "Paste ID"
+// @Success 200 {object} models.APIResponse[models.PasteGrantListData]
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse "Not the paste's owner"
+// @Failure 404 {object} models.ErrorResponse "Paste not found"
+// @Failure 500 {object} models.ErrorResponse
+// @Router /paste/{id}/grants [get]
+func (h *PasteHandler) ListPasteGrants(c *gin.Context) {
+	ctx := c.Request.Context()
+	log := utils.LoggerFromContext(ctx)
+
+	pasteID, ok := parsePasteID(c)
+	if !ok {
+		return
+	}
+	userID, _ := utils.GetUserID(c)
+
+	grants, err := h.pasteService.GetGrants(ctx, pasteID, userID)
+	if err != nil {
+		log.Info().Err(err).Uint64("pasteId", pasteID).Msg("Failed to list paste grants")
+		respondPasteError(c, err, "Failed to retrieve paste grants")
+		return
+	}
+
+	utils.RespondOK(c, models.PasteGrantListData{Grants: grants, Count: len(grants)}, "Grants retrieved successfully")
+}
+
+// CreatePasteGrant godoc
+// @Summary Share a paste
+// @Description Grants a user (by ID or email) or a team view or edit access to a paste. Sharing again with the same user or team changes their permission.
+// @Tags pastes
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path uint64 true "Paste ID"
+// @Param grant body models.CreatePasteGrantRequest true "Who to share with and the permission"
+// @Success 201 {object} models.APIResponse[models.PasteGrantData]
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse "Not the paste's owner"
+// @Failure 404 {object} models.ErrorResponse "Paste not found"
+// @Failure 500 {object} models.ErrorResponse
+// @Router /paste/{id}/grants [post]
+func (h *PasteHandler) CreatePasteGrant(c *gin.Context) {
+	ctx := c.Request.Context()
+	log := utils.LoggerFromContext(ctx)
+
+	pasteID, ok := parsePasteID(c)
+	if !ok {
+		return
+	}
+
+	var req models.CreatePasteGrantRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		log.Error().Err(err).Msg("Failed to bind JSON for create paste grant request")
+		utils.RespondBadRequest(c, err, "Invalid grant data format")
+		return
+	}
+
+	userID, _ := utils.GetUserID(c)
+
+	grant, err := h.pasteService.AddGrant(ctx, pasteID, userID, &req)
+	if err != nil {
+		log.Info().Err(err).Uint64("pasteId", pasteID).Msg("Failed to share paste")
+		respondPasteError(c, err, "Failed to share paste")
+		return
+	}
+
+	utils.RespondCreated(c, models.PasteGrantData{Grant: grant}, "Paste shared successfully")
+}
+
+// DeletePasteGrant godoc
+// @Summary Stop sharing a paste
+// @Description Removes a grant so the user or team loses the access it gave
+// @Tags pastes
+// @Produce json
+// @Security BearerAuth
+// @Param id path uint64 true "Paste ID"
+// @Param grantId path uint true "Grant ID"
+// @Success 200 {object} models.APIResponse[uint]
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse "Not the paste's owner"
+// @Failure 404 {object} models.ErrorResponse "Paste or grant not found"
+// @Failure 500 {object} models.ErrorResponse
+// @Router /paste/{id}/grants/{grantId} [delete]
+func (h *PasteHandler) DeletePasteGrant(c *gin.Context) {
+	ctx := c.Request.Context()
+	log := utils.LoggerFromContext(ctx)
+
+	pasteID, ok := parsePasteID(c)
+	if !ok {
+		return
+	}
+	grantID, ok := parseUintParam(c, "grantId")
+	if !ok {
+		return
+	}
+	userID, _ := utils.GetUserID(c)
+
+	if err := h.pasteService.RemoveGrant(ctx, pasteID, userID, grantID); err != nil {
+		log.Info().Err(err).Uint64("pasteId", pasteID).Uint("grantId", grantID).Msg("Failed to remove paste grant")
+		respondPasteError(c, err, "Failed to remove grant")
+		return
+	}
+
+	utils.RespondOK(c, grantID, "Grant removed")
+}
+
+// ListSharedPastes godoc
+// @Summary List pastes shared with me
+// @Description Lists pastes other users shared with the caller directly or through one of their teams, with the permission they have
+// @Tags users
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} models.APIResponse[models.SharedPasteListData]
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /users/me/shared [get]
+func (h *PasteHandler) ListSharedPastes(c *gin.Context) {
+	ctx := c.Request.Context()
+	log := utils.LoggerFromContext(ctx)
+
+	userID, _ := utils.GetUserID(c)
+
+	shared, err := h.pasteService.GetSharedWithUser(ctx, userID)
+	if err != nil {
+		log.Error().Err(err).Uint("userId", userID).Msg("Failed to list shared pastes")
+		respondPasteError(c, err, "Failed to retrieve shared pastes")
+		return
+	}
+
+	utils.RespondOK(c, models.SharedPasteListData{Pastes: shared, Count: len(shared)}, "Shared pastes retrieved successfully")
+}
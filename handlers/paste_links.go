@@ -0,0 +1,76 @@
+package handlers
+
+import (
+	"memoria-backend/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ListPasteBacklinks godoc
+// @Summary List the pastes linking to a paste
+// @Description Returns the pastes whose text or markdown refers to this one through [[slug]], [[id]] or memoria://paste/id, with the same access rules as retrieving the paste. Only pastes the caller can view are listed and counted.
+// @Tags pastes
+// @Produce json
+// @Param id path uint64 true "Paste ID"
+// @Param pw query string false "Password for protected pastes"
+// @Success 200 {object} models.APIResponse[models.PasteBacklinksData]
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 401 {object} models.ErrorResponse "Password required or invalid password"
+// @Failure 404 {object} models.ErrorResponse "Paste not found"
+// @Failure 500 {object} models.ErrorResponse
+// @Router /paste/{id}/backlinks [get]
+func (h *PasteHandler) ListPasteBacklinks(c *gin.Context) {
+	ctx := c.Request.Context()
+	log := utils.LoggerFromContext(ctx)
+
+	id, ok := parsePasteID(c)
+	if !ok {
+		return
+	}
+
+	paste, err := h.pasteService.GetByID(ctx, id)
+	if err != nil {
+		log.Error().Err(err).Uint64("pasteId", id).Msg("Failed to retrieve paste")
+		respondPasteError(c, err, "Failed to retrieve paste")
+		return
+	}
+	if !h.authorizePasteView(c, paste) {
+		return
+	}
+
+	userID, _ := utils.GetUserID(c)
+	backlinks, err := h.pasteService.GetBacklinks(ctx, paste, userID)
+	if err != nil {
+		log.Error().Err(err).Uint64("pasteId", id).Msg("Failed to list paste backlinks")
+		respondPasteError(c, err, "Failed to list backlinks")
+		return
+	}
+
+	utils.RespondOK(c, backlinks, "Backlinks retrieved successfully")
+}
+
+// GetPasteGraph godoc
+// @Summary Get the link graph of my pastes
+// @Description Returns the caller's pastes and the pastes they link to or are linked from as nodes, and the links between them as edges. Pastes the caller can't view are left out.
+// @Tags users
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} models.APIResponse[models.PasteLinkGraphData]
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /users/me/graph [get]
+func (h *PasteHandler) GetPasteGraph(c *gin.Context) {
+	ctx := c.Request.Context()
+	log := utils.LoggerFromContext(ctx)
+
+	userID, _ := utils.GetUserID(c)
+
+	graph, err := h.pasteService.GetLinkGraph(ctx, userID)
+	if err != nil {
+		log.Error().Err(err).Uint("userId", userID).Msg("Failed to build paste link graph")
+		respondPasteError(c, err, "Failed to retrieve paste graph")
+		return
+	}
+
+	utils.RespondOK(c, graph, "Paste graph retrieved successfully")
+}
@@ -0,0 +1,71 @@
+package handlers
+
+import (
+	"memoria-backend/models"
+	"memoria-backend/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ListTrash godoc
+// @Summary List my trash
+// @Description Lists the deleted pastes the caller can restore, their own and those of teams they edit pastes in, most recently deleted first. Content isn't included.
+// @Tags users
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} models.APIResponse[models.TrashListData]
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /users/me/trash [get]
+func (h *PasteHandler) ListTrash(c *gin.Context) {
+	ctx := c.Request.Context()
+	log := utils.LoggerFromContext(ctx)
+
+	userID, _ := utils.GetUserID(c)
+
+	trash, err := h.pasteService.GetTrash(ctx, userID)
+	if err != nil {
+		log.Error().Err(err).Uint("userId", userID).Msg("Failed to list trash")
+		respondPasteError(c, err, "Failed to retrieve trash")
+		return
+	}
+
+	utils.RespondOK(c, models.TrashListData{Pastes: trash, Count: len(trash)}, "Trash retrieved successfully")
+}
+
+// RestorePaste godoc
+// @Summary Restore a paste from the trash
+// @Description Takes a deleted paste out of the trash, with its files, attachments, comments and sharing as they were. Anyone who could edit the paste may restore it.
+// @Tags pastes
+// @Produce json
+// @Security BearerAuth
+// @Param id path uint64 true "Paste ID"
+// @Success 200 {object} models.APIResponse[models.PasteData]
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse "Not allowed to edit the paste"
+// @Failure 404 {object} models.ErrorResponse "Paste not in the trash"
+// @Failure 500 {object} models.ErrorResponse
+// @Router /paste/{id}/restore [post]
+func (h *PasteHandler) RestorePaste(c *gin.Context) {
+	ctx := c.Request.Context()
+	log := utils.LoggerFromContext(ctx)
+
+	pasteID, ok := parsePasteID(c)
+	if !ok {
+		return
+	}
+	userID, _ := utils.GetUserID(c)
+
+	paste, err := h.pasteService.Restore(ctx, pasteID, userID)
+	if err != nil {
+		log.Info().Err(err).Uint64("pasteId", pasteID).Msg("Failed to restore paste")
+		respondPasteError(c, err, "Failed to restore paste")
+		return
+	}
+
+	log.Info().Uint64("pasteId", pasteID).Msg("Restored paste from the trash")
+
+	c.Header("ETag", pasteETag(paste))
+	utils.RespondOK(c, models.PasteData{Paste: paste}, "Paste restored")
+}
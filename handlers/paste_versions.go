@@ -0,0 +1,48 @@
+package handlers
+
+import (
+	"memoria-backend/models"
+	"memoria-backend/utils"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// pasteETag is the entity tag of a paste, its version
+func pasteETag(paste *models.Paste) string {
+	return `"` + strconv.FormatUint(paste.Version, 10) + `"`
+}
+
+// respondNotModified sets the paste's ETag, and responds with 304 and returns true when the
+// client's copy from If-None-Match is still current. Call it once access was checked.
+func respondNotModified(c *gin.Context, paste *models.Paste) bool {
+	etag := pasteETag(paste)
+	c.Header("ETag", etag)
+
+	for _, candidate := range strings.Split(c.GetHeader("If-None-Match"), ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == etag || candidate == "*" {
+			c.Status(http.StatusNotModified)
+			return true
+		}
+	}
+	return false
+}
+
+// requestedVersion returns the version of the paste a change was made to: the one in If-Match,
+// or else the one in the body. Responds and returns false when If-Match isn't a version.
+func requestedVersion(c *gin.Context, bodyVersion uint64) (uint64, bool) {
+	header := strings.TrimSpace(c.GetHeader("If-Match"))
+	if header == "" {
+		return bodyVersion, true
+	}
+
+	version, err := strconv.ParseUint(strings.Trim(header, `"`), 10, 64)
+	if err != nil || version == 0 || !strings.HasPrefix(header, `"`) {
+		utils.RespondBadRequest(c, err, `If-Match must be the ETag of the paste, such as "3"`)
+		return 0, false
+	}
+	return version, true
+}
@@ -1,22 +1,134 @@
 package handlers
 
 import (
+	"archive/zip"
+	"encoding/hex"
+	"errors"
 	"fmt"
 	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"io"
 	"memoria-backend/models"
 	"memoria-backend/services"
 	"memoria-backend/utils"
+	"net/http"
 	"strconv"
 	"strings"
 	"time"
 )
 
 type PasteHandler struct {
-	pasteService services.PasteService
+	pasteService     services.PasteService
+	highlightService services.HighlightService
+	collabService    services.CollabService
+	configService    services.ConfigService
 }
 
-func NewPasteHandler(pasteService services.PasteService) *PasteHandler {
-	return &PasteHandler{pasteService: pasteService}
+func NewPasteHandler(pasteService services.PasteService, highlightService services.HighlightService, collabService services.CollabService, configService services.ConfigService) *PasteHandler {
+	return &PasteHandler{pasteService: pasteService, highlightService: highlightService, collabService: collabService, configService: configService}
+}
+
+// checkVerifiedForPublic responds with 403 and returns false when the server requires a
+// verified email for public pastes and the signed in user hasn't verified theirs
+func (h *PasteHandler) checkVerifiedForPublic(c *gin.Context, privacy string) bool {
+	if privacy != "public" || !h.configService.GetConfig().Auth.RequireVerifiedEmail {
+		return true
+	}
+
+	identity, ok := utils.GetAuthIdentity(c)
+	if !ok || identity.EmailVerified {
+		return true
+	}
+
+	log := utils.LoggerFromContext(c.Request.Context())
+	log.Info().Uint("userId", identity.UserID).Msg("Public paste blocked, email not verified")
+	utils.RespondForbidden(c, services.ErrEmailNotVerified, "Verify your email address before publishing public pastes")
+	return false
+}
+
+// respondPasteError maps paste service errors to API error responses
+func respondPasteError(c *gin.Context, err error, fallbackMessage string) {
+	var quotaErr *services.QuotaError
+	var versionErr *services.PasteVersionError
+	var patchErr *services.PastePatchError
+	switch {
+	case errors.As(err, &quotaErr):
+		respondQuotaError(c, quotaErr)
+	case errors.As(err, &versionErr):
+		c.Header("ETag", `"`+strconv.FormatUint(versionErr.Current, 10)+`"`)
+		utils.RespondWithErrorDetails(c, http.StatusConflict, err, versionErr.Details(), err.Error())
+	case errors.As(err, &patchErr):
+		utils.RespondWithErrorDetails(c, http.StatusBadRequest, err, patchErr.Details(), err.Error())
+	case errors.Is(err, services.ErrPasteVersionRequired):
+		utils.RespondWithError(c, http.StatusPreconditionRequired, err, err.Error())
+	case errors.Is(err, services.ErrTeamNotFound):
+		utils.RespondNotFound(c, err, err.Error())
+	case errors.Is(err, services.ErrTeamForbidden),
+		errors.Is(err, services.ErrPasteForbidden),
+		errors.Is(err, services.ErrFolderForbidden),
+		errors.Is(err, services.ErrPasteCommentsDisabled):
+		utils.RespondForbidden(c, err, err.Error())
+	case errors.Is(err, services.ErrPasteCommentStale):
+		utils.RespondConflict(c, err, err.Error())
+	case errors.Is(err, services.ErrShareLinkReadOnly):
+		utils.RespondForbidden(c, err, err.Error())
+	case errors.Is(err, services.ErrShareLinkPassword):
+		utils.RespondUnauthorized(c, err, err.Error())
+	case errors.Is(err, services.ErrPasteGrantNotFound),
+		errors.Is(err, services.ErrContentHashUnknown),
+		errors.Is(err, services.ErrAttachmentNotFound),
+		errors.Is(err, services.ErrAttachmentNoThumbnail),
+		errors.Is(err, services.ErrFolderNotFound),
+		errors.Is(err, services.ErrShareLinkNotFound),
+		errors.Is(err, services.ErrShareLinkInvalid),
+		errors.Is(err, services.ErrPasteCommentNotFound),
+		errors.Is(err, gorm.ErrRecordNotFound):
+		utils.RespondNotFound(c, err, err.Error())
+	case errors.Is(err, services.ErrTeamRequired),
+		errors.Is(err, services.ErrShareLinkEncryption),
+		errors.Is(err, services.ErrContentHashMismatch),
+		errors.Is(err, services.ErrPasteFileName),
+		errors.Is(err, services.ErrPasteFilesEncrypted),
+		errors.Is(err, services.ErrAttachmentImage),
+		errors.Is(err, services.ErrTagInvalid),
+		errors.Is(err, services.ErrUnknownLanguage),
+		errors.Is(err, services.ErrUnknownTheme),
+		errors.Is(err, services.ErrRenderingEncrypted),
+		errors.Is(err, services.ErrPasteGrantTarget),
+		errors.Is(err, services.ErrPasteGrantNoSubject),
+		errors.Is(err, services.ErrPasteGrantAuthor),
+		errors.Is(err, services.ErrPasteCommentAnchor),
+		errors.Is(err, services.ErrPasteCommentReply),
+		errors.Is(err, services.ErrPasteCommentEncrypted),
+		errors.Is(err, services.ErrCollabEncrypted),
+		errors.Is(err, services.ErrPastePatch),
+		errors.Is(err, services.ErrShareLinkExpiryInPast):
+		utils.RespondBadRequest(c, err, err.Error())
+	default:
+		utils.RespondInternalError(c, err, fallbackMessage)
+	}
+}
+
+// respondQuotaError reports a paste limit along with how far it was exceeded. The daily
+// paste limit is a rate limit, the size limits can't be fixed by retrying.
+func respondQuotaError(c *gin.Context, err *services.QuotaError) {
+	if errors.Is(err, services.ErrDailyPasteLimit) {
+		c.Header("Retry-After", strconv.Itoa(int(time.Until(err.ResetsAt).Seconds())+1))
+		utils.RespondWithErrorDetails(c, http.StatusTooManyRequests, err, err.Details(), err.Error())
+		return
+	}
+	utils.RespondWithErrorDetails(c, http.StatusUnprocessableEntity, err, err.Details(), err.Error())
+}
+
+// respondBindError rejects a request body that couldn't be bound, telling bodies over the
+// request size limit apart from malformed ones
+func respondBindError(c *gin.Context, err error, message string) {
+	var maxBytesErr *http.MaxBytesError
+	if errors.As(err, &maxBytesErr) {
+		utils.RespondWithErrorDetails(c, http.StatusUnprocessableEntity, err, map[string]interface{}{"limit": maxBytesErr.Limit}, "Request body too large")
+		return
+	}
+	utils.RespondBadRequest(c, err, message)
 }
 
 func IsPasteExpired(paste *models.Paste) error {
@@ -33,15 +145,139 @@ func IsPasteExpired(paste *models.Paste) error {
 	return nil
 }
 
+// authorizePasteView runs the checks GetPaste applies before showing a paste: expiry, access
+// and the paste password from the pw query parameter. It responds and returns false when
+// the caller may not see the paste.
+func (h *PasteHandler) authorizePasteView(c *gin.Context, paste *models.Paste) bool {
+	ctx := c.Request.Context()
+	log := utils.LoggerFromContext(ctx)
+	id := paste.ID
+
+	// Check if paste is expired
+	if err := IsPasteExpired(paste); err != nil {
+		log.Info().Err(err).Uint64("pasteId", id).Msg("Attempted to access expired paste")
+		utils.RespondNotFound(c, err, "This paste has expired and is no longer available")
+		return false
+	}
+
+	// Private and team pastes are only served here to their author and the users and
+	// teams they're shared with, everyone else needs the private access ID
+	userID, _ := utils.GetUserID(c)
+	if err := h.pasteService.CanView(ctx, paste, userID); err != nil {
+		if !errors.Is(err, services.ErrPasteForbidden) {
+			log.Error().Err(err).Uint64("pasteId", id).Msg("Failed to check paste access")
+			utils.RespondInternalError(c, err, "Failed to retrieve paste")
+			return false
+		}
+		if paste.Privacy == "private" {
+			log.Info().Uint64("pasteId", id).Msg("Attempted to access private paste without access ID")
+			utils.RespondForbidden(c, nil, "This is a private paste. Please use the private access ID to view it.")
+			return false
+		}
+		log.Info().Uint64("pasteId", id).Msg("Attempted to access team paste without membership")
+		utils.RespondNotFound(c, err, "Paste not found")
+		return false
+	}
+
+	if paste.Password != "" {
+		providedPassword := c.Query("pw")
+
+		if providedPassword == "" {
+			log.Info().Uint64("pasteId", id).Msg("Attempted to access password-protected paste without password")
+			utils.RespondUnauthorized(c, nil, "Error verifying password")
+			return false
+		}
+
+		passwordValid, err := h.pasteService.VerifyPassword(ctx, id, providedPassword)
+		if err != nil {
+			log.Error().Err(err).Uint64("pasteId", id).Msg("Error verifying password")
+			utils.RespondInternalError(c, err, "Error verifying password")
+			return false
+		}
+
+		if !passwordValid {
+			log.Info().Uint64("pasteId", id).Msg("Invalid Password provided for password protected paste")
+			utils.RespondUnauthorized(c, err, "Invalid password")
+			return false
+		}
+	}
+	return true
+}
+
+// respondAccessIDError answers a failed lookup by access ID. Share links check the password
+// before counting a use, a wrong one is reported like on the paste's own access ID.
+func respondAccessIDError(c *gin.Context, err error) {
+	if errors.Is(err, services.ErrShareLinkPassword) {
+		if c.Query("pw") == "" {
+			utils.RespondUnauthorized(c, nil, "Error verifying password")
+			return
+		}
+		utils.RespondUnauthorized(c, err, "Invalid password")
+		return
+	}
+	utils.RespondNotFound(c, err, "Paste not found")
+}
+
+// authorizeAccessIDView runs the checks GetPasteByPrivateAccessID applies before showing a
+// paste found by its access ID: team membership, expiry and password
+func (h *PasteHandler) authorizeAccessIDView(c *gin.Context, paste *models.Paste) bool {
+	ctx := c.Request.Context()
+	log := utils.LoggerFromContext(ctx)
+
+	// The access ID stands in for a grant on private pastes, team pastes still need membership
+	userID, _ := utils.GetUserID(c)
+	if err := h.pasteService.CanView(ctx, paste, userID); paste.Privacy == models.PrivacyTeam && err != nil {
+		log.Info().Err(err).Uint64("pasteId", paste.ID).Msg("Attempted to access team paste without membership")
+		utils.RespondNotFound(c, err, "Paste not found")
+		return false
+	}
+
+	// Check if paste is expired
+	if err := IsPasteExpired(paste); err != nil {
+		log.Info().Err(err).Uint64("pasteId", paste.ID).Msg("Attempted to access expired paste")
+		utils.RespondNotFound(c, err, "This paste has expired and is no longer available")
+		return false
+	}
+
+	if paste.Password != "" {
+		providedPassword := c.Query("pw")
+
+		if providedPassword == "" {
+			log.Info().Uint64("id", paste.ID).Msg("Attempted to access password-protected paste without password")
+			utils.RespondUnauthorized(c, nil, "Error verifying password")
+			return false
+		}
+
+		passwordValid, err := h.pasteService.VerifyPassword(ctx, paste.ID, providedPassword)
+		if err != nil {
+			log.Error().Err(err).Uint64("pasteId", paste.ID).Msg("Error verifying password")
+			utils.RespondInternalError(c, err, "Error verifying password")
+			return false
+		}
+
+		if !passwordValid {
+			log.Info().Uint64("pasteId", paste.ID).Msg("Invalid Password provided for password protected paste")
+			utils.RespondUnauthorized(c, err, "Invalid password")
+			return false
+		}
+	}
+
+	return true
+}
+
 // CreatePaste godoc
 // @Summary Create paste
-// @Description Creates a new paste
+// @Description Creates a new paste. Pastes with encryption metadata hold client-side ciphertext, which the server stores and returns unchanged. Content that was uploaded before can be referenced by contentHash instead.
 // @Tags pastes
 // @Accept json
 // @Produce json
 // @Param paste body models.CreatePasteRequest true "Paste data"
 // @Success 200 {object} models.APIResponse[models.PasteData] "Success response with paste data"
 // @Failure 400 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse "Verified email required for public pastes"
+// @Failure 404 {object} models.ErrorResponse "No readable content with contentHash"
+// @Failure 422 {object} models.ErrorResponse "Paste too large or storage quota exceeded"
+// @Failure 429 {object} models.ErrorResponse "Daily paste limit reached"
 // @Failure 500 {object} models.ErrorResponse
 // @Router /paste [post]
 func (h *PasteHandler) CreatePaste(c *gin.Context) {
@@ -51,7 +287,7 @@ func (h *PasteHandler) CreatePaste(c *gin.Context) {
 	var req models.CreatePasteRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
 		log.Error().Err(err).Msg("Failed to bind JSON for create paste request")
-		utils.RespondBadRequest(c, err, "Invalid paste data format")
+		respondBindError(c, err, "Invalid paste data format")
 		return
 	}
 
@@ -60,32 +296,47 @@ func (h *PasteHandler) CreatePaste(c *gin.Context) {
 	// }
 	//
 
-	log.Info().
-		Str("title", req.Title).
-		Str("contentPreview", utils.Truncate(req.Content, 50)).
-		Msg("Creating new paste")
+	if !h.checkVerifiedForPublic(c, req.Privacy) {
+		return
+	}
+
+	if userID, ok := utils.GetUserID(c); ok {
+		req.UserID = strconv.FormatUint(uint64(userID), 10)
+	} else {
+		req.ClientIP = c.ClientIP()
+	}
+
+	// Encrypted content is opaque ciphertext and must never end up in the logs
+	event := log.Info().Str("title", req.Title).Bool("encrypted", req.Encryption != nil)
+	if req.Encryption == nil {
+		event = event.Str("contentPreview", utils.Truncate(req.Content, 50))
+	}
+	event.Msg("Creating new paste")
 
 	paste, err := h.pasteService.Create(ctx, &req)
 	if err != nil {
 		log.Error().Err(err).Msg("Failed to create paste")
-		utils.RespondInternalError(c, err, "Failed to create paste")
+		respondPasteError(c, err, "Failed to create paste")
 		return
 	}
 
 	log.Info().Uint64("pasteId", paste.ID).Msg("Successfully created paste")
 
+	c.Header("ETag", pasteETag(paste))
 	pasteData := models.PasteData{Paste: paste}
 	utils.RespondCreated(c, pasteData, "Paste created successfully")
 }
 
 // GetPaste godoc
 // @Summary Gets a specific paste
-// @Description Retrieve a paste by ID
+// @Description Retrieve a paste by ID. The ETag is the paste's version, If-None-Match with it answers 304 while the paste is unchanged.
 // @Tags pastes
 // @Param id path uint64 true "Paste ID"
 // @Param pw query string false "Password for protected pastes"
+// @Param If-None-Match header string false "ETag of a copy the client has"
 // @Produce json
 // @Success 200 {object} models.APIResponse[models.PasteData] "Success response with paste data"
+// @Success 304 "The paste is unchanged"
 // @Failure 400 {object} models.ErrorResponse
 // @Failure 401 {object} models.ErrorResponse "Pssword required or invalid password"
 // @Failure 404 {object} models.ErrorResponse "Paste not found"
@@ -112,60 +363,207 @@ func (h *PasteHandler) GetPaste(c *gin.Context) {
 		utils.RespondNotFound(c, err, "Paste not found")
 		return
 	}
-	// Check if paste is expired
-	if err := IsPasteExpired(paste); err != nil {
-		log.Info().Err(err).Uint64("pasteId", id).Msg("Attempted to access expired paste")
-		utils.RespondNotFound(c, err, "This paste has expired and is no longer available")
+	if !h.authorizePasteView(c, paste) {
+		return
+	}
+	if respondNotModified(c, paste) {
+		return
+	}
+
+	log.Info().Uint64("pasteId", id).Msg("Successfully retrieved paste")
+
+	pasteData := models.PasteData{Paste: paste}
+	utils.RespondOK(c, pasteData, "Paste retrieved successfully")
+}
+
+// GetRawPaste godoc
+// @Summary Gets a paste's raw content
+// @Description Streams the content of a paste as plain text, with the same access rules and ETag as retrieving the paste
+// @Tags pastes
+// @Param id path uint64 true "Paste ID"
+// @Param pw query string false "Password for protected pastes"
+// @Param If-None-Match header string false "ETag of a copy the client has"
+// @Produce plain
+// @Success 200 {string} string "Paste content"
+// @Success 304 "The paste is unchanged"
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 401 {object} models.ErrorResponse "Password required or invalid password"
+// @Failure 404 {object} models.ErrorResponse "Paste not found"
+// @Failure 500 {object} models.ErrorResponse
+// @Router /paste/{id}/raw [get]
+func (h *PasteHandler) GetRawPaste(c *gin.Context) {
+	ctx := c.Request.Context()
+	log := utils.LoggerFromContext(ctx)
+
+	id, ok := parsePasteID(c)
+	if !ok {
 		return
 	}
 
-	// Check if paste is private - if so, don't allow access through this endpoint
-	if paste.Privacy == "private" {
-		log.Info().Uint64("pasteId", id).Msg("Attempted to access private paste without access ID")
-		utils.RespondForbidden(c, nil, "This is a private paste. Please use the private access ID to view it.")
+	paste, content, size, err := h.pasteService.OpenContent(ctx, id, "")
+	if err != nil {
+		log.Error().Err(err).Uint64("pasteId", id).Msg("Failed to open paste content")
+		respondPasteError(c, err, "Failed to retrieve paste")
 		return
 	}
+	defer content.Close()
 
-	if paste.Password != "" {
-		providedPassword := c.Query("pw")
+	if !h.authorizePasteView(c, paste) {
+		return
+	}
+	if respondNotModified(c, paste) {
+		return
+	}
 
-		if providedPassword == "" {
-			log.Info().Uint64("pasteId", id).Msg("Attempted to access password-protected paste without password")
-			utils.RespondUnauthorized(c, err, "Error verifying password")
-			return
-		}
+	c.DataFromReader(http.StatusOK, size, "text/plain; charset=utf-8", content, nil)
+}
 
-		passwordValid, err := h.pasteService.VerifyPassword(ctx, id, providedPassword)
+// GetRawPasteFile godoc
+// @Summary Gets the raw content of a paste file
+// @Description Streams one file of a paste as plain text. Pastes created without files have a single file named paste.txt.
+// @Tags pastes
+// @Param id path uint64 true "Paste ID"
+// @Param name path string true "File name"
+// @Param pw query string false "Password for protected pastes"
+// @Param If-None-Match header string false "ETag of a copy the client has"
+// @Produce plain
+// @Success 200 {string} string "File content"
+// @Success 304 "The paste is unchanged"
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 401 {object} models.ErrorResponse "Password required or invalid password"
+// @Failure 404 {object} models.ErrorResponse "Paste or file not found"
+// @Failure 500 {object} models.ErrorResponse
+// @Router /paste/{id}/files/{name}/raw [get]
+func (h *PasteHandler) GetRawPasteFile(c *gin.Context) {
+	ctx := c.Request.Context()
+	log := utils.LoggerFromContext(ctx)
+
+	id, ok := parsePasteID(c)
+	if !ok {
+		return
+	}
+	name := c.Param("name")
+
+	paste, content, size, err := h.pasteService.OpenContent(ctx, id, name)
+	if err != nil {
+		log.Error().Err(err).Uint64("pasteId", id).Str("fileName", name).Msg("Failed to open paste file")
+		respondPasteError(c, err, "Failed to retrieve paste file")
+		return
+	}
+	defer content.Close()
+
+	if !h.authorizePasteView(c, paste) {
+		return
+	}
+	if respondNotModified(c, paste) {
+		return
+	}
+
+	c.DataFromReader(http.StatusOK, size, "text/plain; charset=utf-8", content, nil)
+}
+
+// DownloadPasteArchive godoc
+// @Summary Downloads all files of a paste
+// @Description Returns the files of a paste as a zip archive, with the same access rules as retrieving the paste
+// @Tags pastes
+// @Param id path uint64 true "Paste ID"
+// @Param pw query string false "Password for protected pastes"
+// @Produce application/zip
+// @Success 200 {file} file "Zip archive of the paste's files"
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 401 {object} models.ErrorResponse "Password required or invalid password"
+// @Failure 404 {object} models.ErrorResponse "Paste not found"
+// @Failure 500 {object} models.ErrorResponse
+// @Router /paste/{id}/zip [get]
+func (h *PasteHandler) DownloadPasteArchive(c *gin.Context) {
+	ctx := c.Request.Context()
+	log := utils.LoggerFromContext(ctx)
+
+	id, ok := parsePasteID(c)
+	if !ok {
+		return
+	}
+
+	paste, err := h.pasteService.GetByID(ctx, id)
+	if err != nil {
+		log.Error().Err(err).Uint64("pasteId", id).Msg("Failed to retrieve paste")
+		respondPasteError(c, err, "Failed to retrieve paste")
+		return
+	}
+	if !h.authorizePasteView(c, paste) {
+		return
+	}
+
+	c.Header("Content-Type", "application/zip")
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="paste-%d.zip"`, id))
+	c.Status(http.StatusOK)
+
+	archive := zip.NewWriter(c.Writer)
+	for _, file := range paste.FileList() {
+		writer, err := archive.Create(file.Name)
+		if err == nil {
+			_, err = io.WriteString(writer, file.Content)
+		}
 		if err != nil {
-			log.Error().Err(err).Uint64("pasteId", id).Msg("Error verifying password")
-			utils.RespondInternalError(c, err, "Error verifying password")
+			// The response has started, all that's left is to cut it short
+			log.Error().Err(err).Uint64("pasteId", id).Msg("Failed to write paste archive")
 			return
 		}
+	}
+	if err := archive.Close(); err != nil {
+		log.Error().Err(err).Uint64("pasteId", id).Msg("Failed to write paste archive")
+	}
+}
 
-		if !passwordValid {
-			log.Info().Uint64("pasteId", id).Msg("Invalid Password provided for password protected paste")
-			utils.RespondUnauthorized(c, err, "Invalid password")
-			return
-		}
+// HeadPasteContent godoc
+// @Summary Checks whether content was already uploaded
+// @Description Reports whether a paste the caller can read has content with the given hash, so it can be created by contentHash instead of uploading the content again. The hash is the SHA-256 of the content, or for private, team and password-protected pastes the contentHash they show.
+// @Tags pastes
+// @Param hash path string true "Hex SHA-256 of the content or a paste's contentHash"
+// @Success 200 "Content exists"
+// @Failure 400 "Invalid hash"
+// @Failure 404 "Content not found"
+// @Failure 500
+// @Router /paste/content/{hash} [head]
+func (h *PasteHandler) HeadPasteContent(c *gin.Context) {
+	ctx := c.Request.Context()
+	log := utils.LoggerFromContext(ctx)
 
+	hash := c.Param("hash")
+	if _, err := hex.DecodeString(hash); err != nil || len(hash) != 64 {
+		c.Status(http.StatusBadRequest)
+		return
 	}
 
-	log.Info().Uint64("pasteId", id).Msg("Successfully retrieved paste")
-
-	pasteData := models.PasteData{Paste: paste}
-	utils.RespondOK(c, pasteData, "Paste retrieved successfully")
+	userID, _ := utils.GetUserID(c)
+	exists, err := h.pasteService.ContentExists(ctx, hash, userID)
+	if err != nil {
+		log.Error().Err(err).Str("contentHash", hash).Msg("Failed to look up content hash")
+		c.Status(http.StatusInternalServerError)
+		return
+	}
+	if !exists {
+		c.Status(http.StatusNotFound)
+		return
+	}
+	c.Status(http.StatusOK)
 }
 
 // UpdatePaste godoc
 // @Summary Update paste
-// @Description Update a pastes value
+// @Description Update a pastes value. The version of the paste being changed must be sent in If-Match or as version; changes to an outdated version are refused with the current version, so they don't overwrite changes the client hasn't seen.
 // @Tags pastes
 // @Accept json
 // @Produce json
+// @Param If-Match header string false "ETag of the paste being changed"
 // @Param paste body models.UpdatePasteRequest true "Updated paste data"
 // @Success 200 {object} models.APIResponse[models.PasteData] "Success response with paste data"
 // @Failure 404 {object} models.ErrorResponse "Paste not found"
 // @Failure 400 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse "Verified email required for public pastes, or team role too low"
+// @Failure 409 {object} models.ErrorResponse "The paste changed since this version"
+// @Failure 422 {object} models.ErrorResponse "Paste too large or storage quota exceeded"
+// @Failure 428 {object} models.ErrorResponse "No version sent"
 // @Failure 500 {object} models.ErrorResponse
 // @Router /paste [put]
 func (h *PasteHandler) UpdatePaste(c *gin.Context) {
@@ -175,38 +573,140 @@ func (h *PasteHandler) UpdatePaste(c *gin.Context) {
 	var req models.UpdatePasteRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
 		log.Error().Err(err).Msg("Failed to bind JSON for update paste request")
-		utils.RespondBadRequest(c, err, "Invalid paste data format")
+		respondBindError(c, err, "Invalid paste data format")
 		return
 	}
 
-	log.Info().
-		Uint64("pasteId", req.ID).
-		Str("title", req.Title).
-		Str("contentPreview", utils.Truncate(req.Content, 50)).
-		Msg("Updating paste")
+	if !h.checkVerifiedForPublic(c, req.Privacy) {
+		return
+	}
+	version, ok := requestedVersion(c, req.Version)
+	if !ok {
+		return
+	}
+	req.Version = version
+
+	if userID, ok := utils.GetUserID(c); ok {
+		req.UserID = strconv.FormatUint(uint64(userID), 10)
+	}
+
+	event := log.Info().Uint64("pasteId", req.ID).Str("title", req.Title).Bool("encrypted", req.Encryption != nil)
+	if req.Encryption == nil {
+		event = event.Str("contentPreview", utils.Truncate(req.Content, 50))
+	}
+	event.Msg("Updating paste")
 
 	paste, err := h.pasteService.Update(ctx, &req)
 	if err != nil {
 		log.Error().Err(err).Uint64("pasteId", req.ID).Msg("Failed to update paste")
-		utils.RespondInternalError(c, err, "Failed to update paste")
+		respondPasteError(c, err, "Failed to update paste")
 		return
 	}
 
 	log.Info().Uint64("pasteId", req.ID).Msg("Successfully updated paste")
 
+	c.Header("ETag", pasteETag(paste))
 	pasteData := models.PasteData{Paste: paste}
 	utils.RespondOK(c, pasteData, "Paste updated successfully")
 }
 
+// PatchPaste godoc
+// @Summary Change some fields of a paste
+// @Description Patches the changeable fields of a paste (models.PastePatchDocument) with an RFC 7396 merge patch (application/merge-patch+json or application/json), or an RFC 6902 JSON Patch (application/json-patch+json). A merge patch of {"expiresAt": null} removes the expiry, fields left out stay as they are. The version of the paste must be sent in If-Match, as version in a merge patch, or in a test of /version in a JSON Patch. Changing privacy, password, team or expiry needs ownership of the paste.
+// @Tags pastes
+// @Accept json
+// @Produce json
+// @Param id path uint64 true "Paste ID"
+// @Param If-Match header string false "ETag of the paste being changed"
+// @Param patch body models.PastePatchDocument true "Merge patch or JSON Patch of the paste's fields"
+// @Success 200 {object} models.APIResponse[models.PasteData] "Success response with paste data"
+// @Failure 400 {object} models.ErrorResponse "Malformed patch or invalid fields"
+// @Failure 403 {object} models.ErrorResponse "Can't edit the paste, or only its owner can change these fields"
+// @Failure 404 {object} models.ErrorResponse "Paste not found"
+// @Failure 409 {object} models.ErrorResponse "The paste changed since this version"
+// @Failure 415 {object} models.ErrorResponse "Not a merge patch or JSON Patch"
+// @Failure 422 {object} models.ErrorResponse "Paste too large or storage quota exceeded"
+// @Failure 428 {object} models.ErrorResponse "No version sent"
+// @Failure 500 {object} models.ErrorResponse
+// @Router /paste/{id} [patch]
+func (h *PasteHandler) PatchPaste(c *gin.Context) {
+	ctx := c.Request.Context()
+	log := utils.LoggerFromContext(ctx)
+
+	id, ok := parsePasteID(c)
+	if !ok {
+		return
+	}
+
+	req := models.PatchPasteRequest{}
+	switch c.ContentType() {
+	case "application/merge-patch+json", "application/json":
+	case "application/json-patch+json":
+		req.JSONPatch = true
+	default:
+		utils.RespondWithError(c, http.StatusUnsupportedMediaType, nil, "Send an application/merge-patch+json or application/json-patch+json patch")
+		return
+	}
+
+	patch, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		respondBindError(c, err, "Failed to read the patch")
+		return
+	}
+	req.Patch = patch
+	if req.Version, ok = requestedVersion(c, 0); !ok {
+		return
+	}
+	if userID, ok := utils.GetUserID(c); ok {
+		req.UserID = strconv.FormatUint(uint64(userID), 10)
+	}
+
+	paste, err := h.pasteService.GetByID(ctx, id)
+	if err != nil {
+		log.Error().Err(err).Uint64("pasteId", id).Msg("Failed to retrieve paste")
+		respondPasteError(c, err, "Failed to retrieve paste")
+		return
+	}
+
+	update, err := h.pasteService.PatchRequest(ctx, paste, &req)
+	if err != nil {
+		log.Info().Err(err).Uint64("pasteId", id).Msg("Paste patch rejected")
+		respondPasteError(c, err, "Failed to patch paste")
+		return
+	}
+	if !h.checkVerifiedForPublic(c, update.Privacy) {
+		return
+	}
+
+	log.Info().Uint64("pasteId", id).Bool("jsonPatch", req.JSONPatch).Msg("Patching paste")
+
+	paste, err = h.pasteService.Update(ctx, update)
+	if err != nil {
+		log.Error().Err(err).Uint64("pasteId", id).Msg("Failed to patch paste")
+		respondPasteError(c, err, "Failed to patch paste")
+		return
+	}
+
+	log.Info().Uint64("pasteId", id).Msg("Successfully patched paste")
+
+	c.Header("ETag", pasteETag(paste))
+	utils.RespondOK(c, models.PasteData{Paste: paste}, "Paste updated successfully")
+}
+
 // DeletePaste godoc
 // @Summary Deletes paste by ID
-// @Description delete a paste by ID
+// @Description Moves a paste to the trash, from where it can be restored until it's purged after trash.retentionDays. The version of the paste must be sent in If-Match or as version, a paste changed since isn't deleted.
 // @Tags pastes
 // @Accept json
 // @Param id path uint64 true "Paste ID"
+// @Param If-Match header string false "ETag of the paste"
+// @Param version query uint64 false "Version of the paste, when If-Match isn't sent"
 // @Produce json
 // @Success 200 {object} models.APIResponse[uint64]
+// @Failure 403 {object} models.ErrorResponse "Team role too low"
 // @Failure 404 {object} models.ErrorResponse
+// @Failure 409 {object} models.ErrorResponse "The paste changed since this version"
+// @Failure 428 {object} models.ErrorResponse "No version sent"
 // @Failure 500 {object} models.ErrorResponse "Internal Server Error"
 // @Router /paste [delete]
 func (h *PasteHandler) DeletePaste(c *gin.Context) {
@@ -224,27 +724,52 @@ func (h *PasteHandler) DeletePaste(c *gin.Context) {
 
 	log.Info().Uint64("pasteId", id).Msg("Deleting paste")
 
-	deletedID, err := h.pasteService.Delete(ctx, id)
+	paste, err := h.pasteService.GetByID(ctx, id)
 	if err != nil {
-		log.Error().Err(err).Uint64("pasteId", id).Msg("Failed to delete paste")
+		log.Error().Err(err).Uint64("pasteId", id).Msg("Failed to retrieve paste")
 		utils.RespondNotFound(c, err, "Paste not found or could not be deleted")
 		return
 	}
 
+	userID, _ := utils.GetUserID(c)
+	if err := h.pasteService.CanEdit(ctx, paste, userID); err != nil {
+		log.Info().Err(err).Uint64("pasteId", id).Msg("Paste delete rejected")
+		respondPasteError(c, err, "Failed to delete paste")
+		return
+	}
+
+	queryVersion, err := strconv.ParseUint(c.DefaultQuery("version", "0"), 10, 64)
+	if err != nil {
+		utils.RespondBadRequest(c, err, "Invalid version")
+		return
+	}
+	version, ok := requestedVersion(c, queryVersion)
+	if !ok {
+		return
+	}
+
+	deletedID, err := h.pasteService.Delete(ctx, id, version)
+	if err != nil {
+		log.Info().Err(err).Uint64("pasteId", id).Msg("Failed to delete paste")
+		respondPasteError(c, err, "Failed to delete paste")
+		return
+	}
+
 	log.Info().Uint64("pasteId", id).Msg("Successfully deleted paste")
 
 	// For delete operations, you can return an empty data struct or the deleted paste
-	utils.RespondOK(c, deletedID, "Paste deleted successfully")
+	utils.RespondOK(c, deletedID, "Paste moved to the trash")
 }
 
 // ListPastes godoc
 // @Summary Lists out all the pastes
-// @Description Returns a list of all the pastes. # TODO: pagination
+// @Description Returns a page of the public pastes, newest first, with their metadata and tags but not their content. At most 100 pastes are returned per page.
 // @Tags pastes
 // @Accept json
 // @Produce json
 // @Param page query int false "Page number" default(1)
 // @Param limit query int false "Items per page" default(10)
+// @Param tag query []string false "Only pastes with all of these tags" collectionFormat(multi)
 // @Success 200 {object} models.APIResponse[models.PasteListData] "Success response with paste list data"
 // @Failure 400 {object} models.ErrorResponse
 // @Failure 500 {object} models.ErrorResponse
@@ -259,7 +784,7 @@ func (h *PasteHandler) ListPastes(c *gin.Context) {
 
 	log.Info().Int("page", page).Int("limit", limit).Msg("Retrieving pastes")
 
-	pastes, err := h.pasteService.GetAll(ctx)
+	pastes, err := h.pasteService.GetAll(ctx, c.QueryArray("tag"), page, limit)
 	if err != nil {
 		log.Error().Err(err).Msg("Failed to retrieve all pastes")
 		utils.RespondInternalError(c, err, "Failed to retrieve pastes")
@@ -277,13 +802,16 @@ func (h *PasteHandler) ListPastes(c *gin.Context) {
 
 // GetPasteByPrivateAccessID godoc
 // @Summary Gets a specific private paste using its private access ID
-// @Description Retrieve a private paste by its private access ID
+// @Description Retrieve a private paste by its private access ID or the access ID of one of its share links. Each request through a share link counts as one use, requests for an expired paste or with a wrong password don't. The ETag and If-None-Match work as when retrieving the paste by ID.
 // @Tags pastes
 // @Param accessId path string true "Private Access ID"
 // @Param pw query string false "Password for protected pastes"
+// @Param If-None-Match header string false "ETag of a copy the client has"
 // @Produce json
 // @Success 200 {object} models.APIResponse[models.PasteData] "Success response with paste data"
+// @Success 304 "The paste is unchanged"
 // @Failure 400 {object} models.ErrorResponse
+// @Failure 401 {object} models.ErrorResponse "Password required or invalid password"
 // @Failure 404 {object} models.ErrorResponse "Paste not found"
 // @Failure 500 {object} models.ErrorResponse
 // @Router /paste/private/{accessId} [get]
@@ -294,42 +822,17 @@ func (h *PasteHandler) GetPasteByPrivateAccessID(c *gin.Context) {
 	accessID := c.Param("accessId")
 	log.Info().Str("privateAccessId", accessID).Msg("Retrieving paste by private access ID")
 
-	paste, err := h.pasteService.GetByPrivateAccessID(ctx, accessID)
+	paste, err := h.pasteService.GetByPrivateAccessID(ctx, accessID, c.Query("pw"))
 	if err != nil {
 		log.Error().Err(err).Str("privateAccessId", accessID).Msg("Failed to retrieve paste")
-		utils.RespondNotFound(c, err, "Paste not found")
+		respondAccessIDError(c, err)
 		return
 	}
-	// Check if paste is expired
-
-	if err := IsPasteExpired(paste); err != nil {
-		log.Info().Err(err).Uint64("pasteId", paste.ID).Msg("Attempted to access expired paste")
-		utils.RespondNotFound(c, err, "This paste has expired and is no longer available")
+	if !h.authorizeAccessIDView(c, paste) {
 		return
 	}
-
-	if paste.Password != "" {
-		providedPassword := c.Query("pw")
-
-		if providedPassword == "" {
-			log.Info().Uint64("id", paste.ID).Msg("Attempted to access password-protected paste without password")
-			utils.RespondUnauthorized(c, err, "Error verifying password")
-			return
-		}
-
-		passwordValid, err := h.pasteService.VerifyPassword(ctx, paste.ID, providedPassword)
-		if err != nil {
-			log.Error().Err(err).Uint64("pasteId", paste.ID).Msg("Error verifying password")
-			utils.RespondInternalError(c, err, "Error verifying password")
-			return
-		}
-
-		if !passwordValid {
-			log.Info().Uint64("pasteId", paste.ID).Msg("Invalid Password provided for password protected paste")
-			utils.RespondUnauthorized(c, err, "Invalid password")
-			return
-		}
-
+	if respondNotModified(c, paste) {
+		return
 	}
 
 	log.Info().Str("privateAccessId", accessID).Msg("Successfully retrieved paste")
@@ -371,6 +874,16 @@ func (h *PasteHandler) GetPastesByPrivateAccessIDs(c *gin.Context) {
 		return
 	}
 
+	// Team-only pastes are left out for callers outside the team
+	userID, _ := utils.GetUserID(c)
+	var visible []models.Paste
+	for _, paste := range pastes {
+		if paste.Privacy != models.PrivacyTeam || h.pasteService.CanView(ctx, &paste, userID) == nil {
+			visible = append(visible, paste)
+		}
+	}
+	pastes = visible
+
 	log.Info().Int("count", len(pastes)).Msg("Successfully retrieved pastes by private access IDs")
 
 	pasteListData := models.PasteListData{
@@ -0,0 +1,243 @@
+package handlers
+
+import (
+	"memoria-backend/models"
+	"memoria-backend/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ListShareLinks godoc
+// @Summary List a paste's share links
+// @Description Lists the named share links of a paste with their permission, limits and usage. Only the paste's owner can see them.
+// @Tags pastes
+// @Produce json
+// @Security BearerAuth
+// @Param id path uint64 true "Paste ID"
+// @Success 200 {object} models.APIResponse[models.ShareLinkListData]
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse "Not the paste's owner"
+// @Failure 404 {object} models.ErrorResponse "Paste not found"
+// @Failure 500 {object} models.ErrorResponse
+// @Router /paste/{id}/links [get]
+func (h *PasteHandler) ListShareLinks(c *gin.Context) {
+	ctx := c.Request.Context()
+	log := utils.LoggerFromContext(ctx)
+
+	pasteID, ok := parsePasteID(c)
+	if !ok {
+		return
+	}
+	userID, _ := utils.GetUserID(c)
+
+	links, err := h.pasteService.GetShareLinks(ctx, pasteID, userID)
+	if err != nil {
+		log.Info().Err(err).Uint64("pasteId", pasteID).Msg("Failed to list share links")
+		respondPasteError(c, err, "Failed to retrieve share links")
+		return
+	}
+
+	utils.RespondOK(c, models.ShareLinkListData{ShareLinks: links, Count: len(links)}, "Share links retrieved successfully")
+}
+
+// CreateShareLink godoc
+// @Summary Create a share link
+// @Description Creates a named link to the paste, resolved through /paste/private/{accessId}. A link can be read-only or allow editing, and can expire or be limited to a number of uses.
+// @Tags pastes
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path uint64 true "Paste ID"
+// @Param link body models.CreateShareLinkRequest true "Link name, permission and limits"
+// @Success 201 {object} models.APIResponse[models.ShareLinkData]
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse "Not the paste's owner"
+// @Failure 404 {object} models.ErrorResponse "Paste not found"
+// @Failure 500 {object} models.ErrorResponse
+// @Router /paste/{id}/links [post]
+func (h *PasteHandler) CreateShareLink(c *gin.Context) {
+	ctx := c.Request.Context()
+	log := utils.LoggerFromContext(ctx)
+
+	pasteID, ok := parsePasteID(c)
+	if !ok {
+		return
+	}
+
+	var req models.CreateShareLinkRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		log.Error().Err(err).Msg("Failed to bind JSON for create share link request")
+		utils.RespondBadRequest(c, err, "Invalid share link data format")
+		return
+	}
+
+	userID, _ := utils.GetUserID(c)
+
+	link, err := h.pasteService.CreateShareLink(ctx, pasteID, userID, &req)
+	if err != nil {
+		log.Info().Err(err).Uint64("pasteId", pasteID).Msg("Failed to create share link")
+		respondPasteError(c, err, "Failed to create share link")
+		return
+	}
+
+	utils.RespondCreated(c, models.ShareLinkData{ShareLink: link}, "Share link created successfully")
+}
+
+// RevokeShareLink godoc
+// @Summary Revoke a share link
+// @Description Deletes a share link, its URL stops working immediately
+// @Tags pastes
+// @Produce json
+// @Security BearerAuth
+// @Param id path uint64 true "Paste ID"
+// @Param linkId path uint true "Share link ID"
+// @Success 200 {object} models.APIResponse[uint]
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse "Not the paste's owner"
+// @Failure 404 {object} models.ErrorResponse "Paste or share link not found"
+// @Failure 500 {object} models.ErrorResponse
+// @Router /paste/{id}/links/{linkId} [delete]
+func (h *PasteHandler) RevokeShareLink(c *gin.Context) {
+	ctx := c.Request.Context()
+	log := utils.LoggerFromContext(ctx)
+
+	pasteID, ok := parsePasteID(c)
+	if !ok {
+		return
+	}
+	linkID, ok := parseUintParam(c, "linkId")
+	if !ok {
+		return
+	}
+	userID, _ := utils.GetUserID(c)
+
+	if err := h.pasteService.RevokeShareLink(ctx, pasteID, userID, linkID); err != nil {
+		log.Info().Err(err).Uint64("pasteId", pasteID).Uint("shareLinkId", linkID).Msg("Failed to revoke share link")
+		respondPasteError(c, err, "Failed to revoke share link")
+		return
+	}
+
+	utils.RespondOK(c, linkID, "Share link revoked")
+}
+
+// RotateShareLink godoc
+// @Summary Rotate a share link
+// @Description Gives a share link a new access ID, keeping its name, permission and limits. The old URL stops working.
+// @Tags pastes
+// @Produce json
+// @Security BearerAuth
+// @Param id path uint64 true "Paste ID"
+// @Param linkId path uint true "Share link ID"
+// @Success 200 {object} models.APIResponse[models.ShareLinkData]
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse "Not the paste's owner"
+// @Failure 404 {object} models.ErrorResponse "Paste or share link not found"
+// @Failure 500 {object} models.ErrorResponse
+// @Router /paste/{id}/links/{linkId}/rotate [post]
+func (h *PasteHandler) RotateShareLink(c *gin.Context) {
+	ctx := c.Request.Context()
+	log := utils.LoggerFromContext(ctx)
+
+	pasteID, ok := parsePasteID(c)
+	if !ok {
+		return
+	}
+	linkID, ok := parseUintParam(c, "linkId")
+	if !ok {
+		return
+	}
+	userID, _ := utils.GetUserID(c)
+
+	link, err := h.pasteService.RotateShareLink(ctx, pasteID, userID, linkID)
+	if err != nil {
+		log.Info().Err(err).Uint64("pasteId", pasteID).Uint("shareLinkId", linkID).Msg("Failed to rotate share link")
+		respondPasteError(c, err, "Failed to rotate share link")
+		return
+	}
+
+	utils.RespondOK(c, models.ShareLinkData{ShareLink: link}, "Share link rotated")
+}
+
+// RotatePrivateAccessID godoc
+// @Summary Rotate a paste's private access ID
+// @Description Replaces the private access ID the paste was created with. Its share links are not affected.
+// @Tags pastes
+// @Produce json
+// @Security BearerAuth
+// @Param id path uint64 true "Paste ID"
+// @Success 200 {object} models.APIResponse[models.PasteData]
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse "Not the paste's owner"
+// @Failure 404 {object} models.ErrorResponse "Paste not found"
+// @Failure 500 {object} models.ErrorResponse
+// @Router /paste/{id}/rotate-access-id [post]
+func (h *PasteHandler) RotatePrivateAccessID(c *gin.Context) {
+	ctx := c.Request.Context()
+	log := utils.LoggerFromContext(ctx)
+
+	pasteID, ok := parsePasteID(c)
+	if !ok {
+		return
+	}
+	userID, _ := utils.GetUserID(c)
+
+	paste, err := h.pasteService.RotatePrivateAccessID(ctx, pasteID, userID)
+	if err != nil {
+		log.Info().Err(err).Uint64("pasteId", pasteID).Msg("Failed to rotate private access ID")
+		respondPasteError(c, err, "Failed to rotate private access ID")
+		return
+	}
+
+	utils.RespondOK(c, models.PasteData{Paste: paste}, "Private access ID rotated")
+}
+
+// UpdatePasteByAccessID godoc
+// @Summary Edit a paste through a share link
+// @Description Updates a paste's title and content using a share link with edit permission. Privacy, password and expiry can only be changed by the paste's owner. The version of the paste being edited must be sent in If-Match or as version; edits to an outdated version are refused with the current version.
+// @Tags pastes
+// @Accept json
+// @Produce json
+// @Param accessId path string true "Share link access ID"
+// @Param If-Match header string false "ETag of the paste being edited"
+// @Param paste body models.UpdateSharedPasteRequest true "Updated paste content"
+// @Success 200 {object} models.APIResponse[models.PasteData]
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 401 {object} models.ErrorResponse "Invalid paste password"
+// @Failure 403 {object} models.ErrorResponse "Share link is read-only"
+// @Failure 404 {object} models.ErrorResponse "Share link invalid, expired or used up"
+// @Failure 409 {object} models.ErrorResponse "The paste changed since this version"
+// @Failure 422 {object} models.ErrorResponse "Paste too large or the owner's storage quota exceeded"
+// @Failure 428 {object} models.ErrorResponse "No version sent"
+// @Failure 500 {object} models.ErrorResponse
+// @Router /paste/private/{accessId} [put]
+func (h *PasteHandler) UpdatePasteByAccessID(c *gin.Context) {
+	ctx := c.Request.Context()
+	log := utils.LoggerFromContext(ctx)
+
+	var req models.UpdateSharedPasteRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		log.Error().Err(err).Msg("Failed to bind JSON for shared paste update")
+		respondBindError(c, err, "Invalid paste data format")
+		return
+	}
+	version, ok := requestedVersion(c, req.Version)
+	if !ok {
+		return
+	}
+	req.Version = version
+
+	paste, err := h.pasteService.UpdateViaShareLink(ctx, c.Param("accessId"), &req)
+	if err != nil {
+		log.Info().Err(err).Msg("Failed to update paste through share link")
+		respondPasteError(c, err, "Failed to update paste")
+		return
+	}
+
+	c.Header("ETag", pasteETag(paste))
+	utils.RespondOK(c, models.PasteData{Paste: paste}, "Paste updated successfully")
+}
@@ -0,0 +1,44 @@
+package handlers
+
+import (
+	"memoria-backend/models"
+	"memoria-backend/utils"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxTagSuggestions caps how many tags one autocomplete request returns
+const maxTagSuggestions = 50
+
+// SuggestTags godoc
+// @Summary Autocomplete tag names
+// @Description Suggests tags starting with the given prefix, most used first. Only tags on public pastes and the caller's own pastes are counted.
+// @Tags pastes
+// @Produce json
+// @Param q query string false "Tag prefix"
+// @Param limit query int false "Number of suggestions, at most 50" default(10)
+// @Success 200 {object} models.APIResponse[models.TagSuggestionsData]
+// @Failure 500 {object} models.ErrorResponse
+// @Router /paste/tags [get]
+func (h *PasteHandler) SuggestTags(c *gin.Context) {
+	ctx := c.Request.Context()
+	log := utils.LoggerFromContext(ctx)
+
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "10"))
+	if err != nil || limit <= 0 {
+		limit = 10
+	}
+	limit = min(limit, maxTagSuggestions)
+
+	userID, _ := utils.GetUserID(c)
+
+	tags, err := h.pasteService.SuggestTags(ctx, c.Query("q"), userID, limit)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to suggest tags")
+		utils.RespondInternalError(c, err, "Failed to suggest tags")
+		return
+	}
+
+	utils.RespondOK(c, models.TagSuggestionsData{Tags: tags}, "Tags retrieved successfully")
+}
@@ -0,0 +1,489 @@
+package handlers
+
+import (
+	"errors"
+	"memoria-backend/models"
+	"memoria-backend/services"
+	"memoria-backend/utils"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+type TeamHandler struct {
+	teamService services.TeamService
+}
+
+func NewTeamHandler(teamService services.TeamService) *TeamHandler {
+	return &TeamHandler{teamService: teamService}
+}
+
+// respondTeamError maps team service errors to API error responses
+func respondTeamError(c *gin.Context, err error, fallbackMessage string) {
+	switch {
+	case errors.Is(err, services.ErrTeamNotFound),
+		errors.Is(err, services.ErrTeamMemberNotFound),
+		errors.Is(err, services.ErrTeamInviteNotFound):
+		utils.RespondNotFound(c, err, err.Error())
+	case errors.Is(err, services.ErrTeamForbidden):
+		utils.RespondForbidden(c, err, err.Error())
+	case errors.Is(err, services.ErrTeamLastOwner):
+		utils.RespondConflict(c, err, err.Error())
+	case errors.Is(err, services.ErrTeamInviteInvalid),
+		errors.Is(err, services.ErrTeamInviteExpiryPast):
+		utils.RespondBadRequest(c, err, err.Error())
+	default:
+		utils.RespondInternalError(c, err, fallbackMessage)
+	}
+}
+
+// parseUintParam reads a numeric path parameter, responding with 400 when it isn't one
+func parseUintParam(c *gin.Context, name string) (uint, bool) {
+	value := c.Param(name)
+	id, err := strconv.ParseUint(value, 10, 64)
+	if err != nil {
+		log := utils.LoggerFromContext(c.Request.Context())
+		log.Error().Err(err).Str(name, value).Msg("Failed to parse path parameter")
+		utils.RespondBadRequest(c, err, "Invalid "+name+" format")
+		return 0, false
+	}
+	return uint(id), true
+}
+
+// CreateTeam godoc
+// @Summary Create a team
+// @Description Creates a team with the caller as its first owner
+// @Tags teams
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param team body models.CreateTeamRequest true "Team name and description"
+// @Success 201 {object} models.APIResponse[models.TeamData]
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /teams [post]
+func (h *TeamHandler) CreateTeam(c *gin.Context) {
+	ctx := c.Request.Context()
+	log := utils.LoggerFromContext(ctx)
+
+	var req models.CreateTeamRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		log.Error().Err(err).Msg("Failed to bind JSON for create team request")
+		utils.RespondBadRequest(c, err, "Invalid team data format")
+		return
+	}
+
+	userID, _ := utils.GetUserID(c)
+
+	teamData, err := h.teamService.Create(ctx, userID, &req)
+	if err != nil {
+		log.Error().Err(err).Uint("userId", userID).Msg("Failed to create team")
+		respondTeamError(c, err, "Failed to create team")
+		return
+	}
+
+	utils.RespondCreated(c, *teamData, "Team created successfully")
+}
+
+// ListTeams godoc
+// @Summary List my teams
+// @Description Lists the teams the caller belongs to, with their role in each
+// @Tags teams
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} models.APIResponse[models.TeamListData]
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /teams [get]
+func (h *TeamHandler) ListTeams(c *gin.Context) {
+	ctx := c.Request.Context()
+	log := utils.LoggerFromContext(ctx)
+
+	userID, _ := utils.GetUserID(c)
+
+	teams, err := h.teamService.GetByUserID(ctx, userID)
+	if err != nil {
+		log.Error().Err(err).Uint("userId", userID).Msg("Failed to list teams")
+		respondTeamError(c, err, "Failed to retrieve teams")
+		return
+	}
+
+	utils.RespondOK(c, models.TeamListData{Teams: teams, Count: len(teams)}, "Teams retrieved successfully")
+}
+
+// GetTeam godoc
+// @Summary Get a team
+// @Description Returns a team and its members. Only members can see a team.
+// @Tags teams
+// @Produce json
+// @Security BearerAuth
+// @Param id path uint true "Team ID"
+// @Success 200 {object} models.APIResponse[models.TeamData]
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse "Team not found"
+// @Failure 500 {object} models.ErrorResponse
+// @Router /teams/{id} [get]
+func (h *TeamHandler) GetTeam(c *gin.Context) {
+	ctx := c.Request.Context()
+	log := utils.LoggerFromContext(ctx)
+
+	teamID, ok := parseUintParam(c, "id")
+	if !ok {
+		return
+	}
+	userID, _ := utils.GetUserID(c)
+
+	teamData, err := h.teamService.Get(ctx, teamID, userID)
+	if err != nil {
+		log.Info().Err(err).Uint("teamId", teamID).Msg("Failed to retrieve team")
+		respondTeamError(c, err, "Failed to retrieve team")
+		return
+	}
+
+	utils.RespondOK(c, *teamData, "Team retrieved successfully")
+}
+
+// UpdateTeam godoc
+// @Summary Update a team
+// @Description Renames a team or changes its description. Owners only.
+// @Tags teams
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path uint true "Team ID"
+// @Param team body models.UpdateTeamRequest true "Team name and description"
+// @Success 200 {object} models.APIResponse[models.TeamData]
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse "Not an owner"
+// @Failure 404 {object} models.ErrorResponse "Team not found"
+// @Failure 500 {object} models.ErrorResponse
+// @Router /teams/{id} [put]
+func (h *TeamHandler) UpdateTeam(c *gin.Context) {
+	ctx := c.Request.Context()
+	log := utils.LoggerFromContext(ctx)
+
+	teamID, ok := parseUintParam(c, "id")
+	if !ok {
+		return
+	}
+
+	var req models.UpdateTeamRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		log.Error().Err(err).Msg("Failed to bind JSON for update team request")
+		utils.RespondBadRequest(c, err, "Invalid team data format")
+		return
+	}
+
+	userID, _ := utils.GetUserID(c)
+
+	teamData, err := h.teamService.Update(ctx, teamID, userID, &req)
+	if err != nil {
+		log.Info().Err(err).Uint("teamId", teamID).Msg("Failed to update team")
+		respondTeamError(c, err, "Failed to update team")
+		return
+	}
+
+	utils.RespondOK(c, *teamData, "Team updated successfully")
+}
+
+// DeleteTeam godoc
+// @Summary Delete a team
+// @Description Deletes a team, its memberships, invitations and folders. Team-only pastes become private to their authors, pastes in the team's folders move out of them. Owners only.
+// @Tags teams
+// @Produce json
+// @Security BearerAuth
+// @Param id path uint true "Team ID"
+// @Success 200 {object} models.APIResponse[uint]
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse "Not an owner"
+// @Failure 404 {object} models.ErrorResponse "Team not found"
+// @Failure 500 {object} models.ErrorResponse
+// @Router /teams/{id} [delete]
+func (h *TeamHandler) DeleteTeam(c *gin.Context) {
+	ctx := c.Request.Context()
+	log := utils.LoggerFromContext(ctx)
+
+	teamID, ok := parseUintParam(c, "id")
+	if !ok {
+		return
+	}
+	userID, _ := utils.GetUserID(c)
+
+	if err := h.teamService.Delete(ctx, teamID, userID); err != nil {
+		log.Info().Err(err).Uint("teamId", teamID).Msg("Failed to delete team")
+		respondTeamError(c, err, "Failed to delete team")
+		return
+	}
+
+	utils.RespondOK(c, teamID, "Team deleted successfully")
+}
+
+// ListTeamPastes godoc
+// @Summary List team pastes
+// @Description Lists every paste that belongs to the team. Members only.
+// @Tags teams
+// @Produce json
+// @Security BearerAuth
+// @Param id path uint true "Team ID"
+// @Param tag query []string false "Only pastes with all of these tags" collectionFormat(multi)
+// @Success 200 {object} models.APIResponse[models.PasteListData]
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse "Team not found"
+// @Failure 500 {object} models.ErrorResponse
+// @Router /teams/{id}/pastes [get]
+func (h *TeamHandler) ListTeamPastes(c *gin.Context) {
+	ctx := c.Request.Context()
+	log := utils.LoggerFromContext(ctx)
+
+	teamID, ok := parseUintParam(c, "id")
+	if !ok {
+		return
+	}
+	userID, _ := utils.GetUserID(c)
+
+	pastes, err := h.teamService.GetPastes(ctx, teamID, userID, c.QueryArray("tag"))
+	if err != nil {
+		log.Info().Err(err).Uint("teamId", teamID).Msg("Failed to list team pastes")
+		respondTeamError(c, err, "Failed to retrieve team pastes")
+		return
+	}
+
+	utils.RespondOK(c, models.PasteListData{Pastes: pastes, Count: len(pastes)}, "Pastes retrieved successfully")
+}
+
+// UpdateTeamMember godoc
+// @Summary Change a member's role
+// @Description Sets a member's role to owner, editor or viewer. Owners only. The last owner can't be demoted.
+// @Tags teams
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path uint true "Team ID"
+// @Param userId path uint true "Member user ID"
+// @Param role body models.UpdateTeamMemberRequest true "New role"
+// @Success 200 {object} models.APIResponse[uint]
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse "Not an owner"
+// @Failure 404 {object} models.ErrorResponse "Team or member not found"
+// @Failure 409 {object} models.ErrorResponse "Last owner"
+// @Failure 500 {object} models.ErrorResponse
+// @Router /teams/{id}/members/{userId} [put]
+func (h *TeamHandler) UpdateTeamMember(c *gin.Context) {
+	ctx := c.Request.Context()
+	log := utils.LoggerFromContext(ctx)
+
+	teamID, ok := parseUintParam(c, "id")
+	if !ok {
+		return
+	}
+	memberID, ok := parseUintParam(c, "userId")
+	if !ok {
+		return
+	}
+
+	var req models.UpdateTeamMemberRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		log.Error().Err(err).Msg("Failed to bind JSON for update team member request")
+		utils.RespondBadRequest(c, err, "Invalid role")
+		return
+	}
+
+	userID, _ := utils.GetUserID(c)
+
+	if err := h.teamService.UpdateMemberRole(ctx, teamID, userID, memberID, req.Role); err != nil {
+		log.Info().Err(err).Uint("teamId", teamID).Uint("memberId", memberID).Msg("Failed to change team member role")
+		respondTeamError(c, err, "Failed to change member role")
+		return
+	}
+
+	utils.RespondOK(c, memberID, "Member role updated")
+}
+
+// RemoveTeamMember godoc
+// @Summary Remove a member
+// @Description Removes a member from the team. Owners can remove anyone, members can remove themselves to leave.
+// @Tags teams
+// @Produce json
+// @Security BearerAuth
+// @Param id path uint true "Team ID"
+// @Param userId path uint true "Member user ID"
+// @Success 200 {object} models.APIResponse[uint]
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse "Not an owner"
+// @Failure 404 {object} models.ErrorResponse "Team or member not found"
+// @Failure 409 {object} models.ErrorResponse "Last owner"
+// @Failure 500 {object} models.ErrorResponse
+// @Router /teams/{id}/members/{userId} [delete]
+func (h *TeamHandler) RemoveTeamMember(c *gin.Context) {
+	ctx := c.Request.Context()
+	log := utils.LoggerFromContext(ctx)
+
+	teamID, ok := parseUintParam(c, "id")
+	if !ok {
+		return
+	}
+	memberID, ok := parseUintParam(c, "userId")
+	if !ok {
+		return
+	}
+	userID, _ := utils.GetUserID(c)
+
+	if err := h.teamService.RemoveMember(ctx, teamID, userID, memberID); err != nil {
+		log.Info().Err(err).Uint("teamId", teamID).Uint("memberId", memberID).Msg("Failed to remove team member")
+		respondTeamError(c, err, "Failed to remove member")
+		return
+	}
+
+	utils.RespondOK(c, memberID, "Member removed")
+}
+
+// CreateTeamInvite godoc
+// @Summary Create an invitation link
+// @Description Creates a link that adds whoever opens it to the team with the given role. The token is only returned in this response. Owners only.
+// @Tags teams
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path uint true "Team ID"
+// @Param invite body models.CreateTeamInviteRequest true "Role, use limit and expiry"
+// @Success 201 {object} models.APIResponse[models.TeamInviteData]
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse "Not an owner"
+// @Failure 404 {object} models.ErrorResponse "Team not found"
+// @Failure 500 {object} models.ErrorResponse
+// @Router /teams/{id}/invites [post]
+func (h *TeamHandler) CreateTeamInvite(c *gin.Context) {
+	ctx := c.Request.Context()
+	log := utils.LoggerFromContext(ctx)
+
+	teamID, ok := parseUintParam(c, "id")
+	if !ok {
+		return
+	}
+
+	var req models.CreateTeamInviteRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		log.Error().Err(err).Msg("Failed to bind JSON for create team invite request")
+		utils.RespondBadRequest(c, err, "Invalid invitation data format")
+		return
+	}
+
+	userID, _ := utils.GetUserID(c)
+
+	inviteData, err := h.teamService.CreateInvite(ctx, teamID, userID, &req)
+	if err != nil {
+		log.Info().Err(err).Uint("teamId", teamID).Msg("Failed to create team invitation")
+		respondTeamError(c, err, "Failed to create invitation")
+		return
+	}
+
+	utils.RespondCreated(c, *inviteData, "Invitation created. Copy the link now, it won't be shown again")
+}
+
+// ListTeamInvites godoc
+// @Summary List invitation links
+// @Description Lists the team's invitations with their role, uses and expiry. Owners only.
+// @Tags teams
+// @Produce json
+// @Security BearerAuth
+// @Param id path uint true "Team ID"
+// @Success 200 {object} models.APIResponse[models.TeamInviteListData]
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse "Not an owner"
+// @Failure 404 {object} models.ErrorResponse "Team not found"
+// @Failure 500 {object} models.ErrorResponse
+// @Router /teams/{id}/invites [get]
+func (h *TeamHandler) ListTeamInvites(c *gin.Context) {
+	ctx := c.Request.Context()
+	log := utils.LoggerFromContext(ctx)
+
+	teamID, ok := parseUintParam(c, "id")
+	if !ok {
+		return
+	}
+	userID, _ := utils.GetUserID(c)
+
+	invites, err := h.teamService.GetInvites(ctx, teamID, userID)
+	if err != nil {
+		log.Info().Err(err).Uint("teamId", teamID).Msg("Failed to list team invitations")
+		respondTeamError(c, err, "Failed to retrieve invitations")
+		return
+	}
+
+	utils.RespondOK(c, models.TeamInviteListData{Invites: invites, Count: len(invites)}, "Invitations retrieved successfully")
+}
+
+// RevokeTeamInvite godoc
+// @Summary Revoke an invitation link
+// @Description Deletes an invitation so its link stops working. Owners only.
+// @Tags teams
+// @Produce json
+// @Security BearerAuth
+// @Param id path uint true "Team ID"
+// @Param inviteId path uint true "Invitation ID"
+// @Success 200 {object} models.APIResponse[uint]
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse "Not an owner"
+// @Failure 404 {object} models.ErrorResponse "Team or invitation not found"
+// @Failure 500 {object} models.ErrorResponse
+// @Router /teams/{id}/invites/{inviteId} [delete]
+func (h *TeamHandler) RevokeTeamInvite(c *gin.Context) {
+	ctx := c.Request.Context()
+	log := utils.LoggerFromContext(ctx)
+
+	teamID, ok := parseUintParam(c, "id")
+	if !ok {
+		return
+	}
+	inviteID, ok := parseUintParam(c, "inviteId")
+	if !ok {
+		return
+	}
+	userID, _ := utils.GetUserID(c)
+
+	if err := h.teamService.RevokeInvite(ctx, teamID, userID, inviteID); err != nil {
+		log.Info().Err(err).Uint("teamId", teamID).Uint("inviteId", inviteID).Msg("Failed to revoke team invitation")
+		respondTeamError(c, err, "Failed to revoke invitation")
+		return
+	}
+
+	utils.RespondOK(c, inviteID, "Invitation revoked")
+}
+
+// JoinTeam godoc
+// @Summary Join a team
+// @Description Accepts an invitation link and adds the caller to the team
+// @Tags teams
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body models.JoinTeamRequest true "Invitation token"
+// @Success 200 {object} models.APIResponse[models.TeamData]
+// @Failure 400 {object} models.ErrorResponse "Invalid, expired or used up invitation"
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /teams/join [post]
+func (h *TeamHandler) JoinTeam(c *gin.Context) {
+	ctx := c.Request.Context()
+	log := utils.LoggerFromContext(ctx)
+
+	var req models.JoinTeamRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		log.Error().Err(err).Msg("Failed to bind JSON for join team request")
+		utils.RespondBadRequest(c, err, "Invalid invitation format")
+		return
+	}
+
+	userID, _ := utils.GetUserID(c)
+
+	teamData, err := h.teamService.Join(ctx, userID, req.Token)
+	if err != nil {
+		log.Info().Err(err).Uint("userId", userID).Msg("Failed to join team")
+		respondTeamError(c, err, "Failed to join team")
+		return
+	}
+
+	utils.RespondOK(c, *teamData, "Joined team")
+}
@@ -0,0 +1,43 @@
+package handlers
+
+import (
+	"memoria-backend/models"
+	"memoria-backend/services"
+	"memoria-backend/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+type UsageHandler struct {
+	quotaService services.QuotaService
+}
+
+func NewUsageHandler(quotaService services.QuotaService) *UsageHandler {
+	return &UsageHandler{quotaService: quotaService}
+}
+
+// GetUsage godoc
+// @Summary Get paste usage
+// @Description Returns how many pastes the caller created today and how much content they store, along with their limits. Limits of 0 are unlimited.
+// @Tags users
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} models.APIResponse[models.UsageData] "Usage and limits"
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /users/me/usage [get]
+func (h *UsageHandler) GetUsage(c *gin.Context) {
+	ctx := c.Request.Context()
+	log := utils.LoggerFromContext(ctx)
+
+	userID, _ := utils.GetUserID(c)
+
+	usage, err := h.quotaService.GetUsage(ctx, userID, "")
+	if err != nil {
+		log.Error().Err(err).Uint("userId", userID).Msg("Failed to get usage")
+		utils.RespondInternalError(c, err, "Failed to get usage")
+		return
+	}
+
+	utils.RespondOK(c, models.UsageData{Usage: usage}, "Usage retrieved successfully")
+}
@@ -3,9 +3,12 @@ package handlers
 
 import (
 	"memoria-backend/models"
+	"memoria-backend/services"
+	"memoria-backend/utils"
 	"net/http"
 
 	"github.com/gin-gonic/gin"
+	"golang.org/x/crypto/bcrypt"
 	"gorm.io/gorm"
 )
 
@@ -21,8 +24,11 @@ import (
 //	@Failure		400		{object}	models.ErrorResponse
 //	@Failure		500		{object}	models.ErrorResponse
 //	@Router			/users [post]
-func CreateUser(db *gorm.DB) gin.HandlerFunc {
+func CreateUser(db *gorm.DB, authService services.AuthService) gin.HandlerFunc {
 	return func(c *gin.Context) {
+		ctx := c.Request.Context()
+		log := utils.LoggerFromContext(ctx)
+
 		var user models.User
 		if err := c.ShouldBindJSON(&user); err != nil {
 			c.JSON(http.StatusBadRequest, models.ErrorResponse{
@@ -43,6 +49,11 @@ func CreateUser(db *gorm.DB) gin.HandlerFunc {
 			return
 		}
 
+		// The account exists either way, the user can ask for a new link later
+		if err := authService.SendVerificationEmail(ctx, user.ID); err != nil {
+			log.Error().Err(err).Uint("userId", user.ID).Msg("Failed to send verification email")
+		}
+
 		c.JSON(http.StatusCreated, user.ToResponse())
 	}
 }
@@ -105,26 +116,37 @@ func GetUser(db *gorm.DB) gin.HandlerFunc {
 // UpdateUser godoc
 //
 //	@Summary		Update a user
-//	@Description	Update a user's information
+//	@Description	Update a user's information. Users can update their own account, admins any account. A new email address has to be verified again, a verification email is sent to it. Changing your own password requires the current one.
 //	@Tags			users
 //	@Accept			json
 //	@Produce		json
-//	@Param			id		path		int			true	"User ID"
-//	@Param			user	body		models.User	true	"User data"
+//	@Security		BearerAuth
+//	@Param			id		path		int							true	"User ID"
+//	@Param			user	body		models.UpdateUserRequest	true	"User data"
 //	@Success		200		{object}	models.UserResponse
 //	@Failure		400		{object}	models.ErrorResponse
+//	@Failure		401		{object}	models.ErrorResponse
+//	@Failure		403		{object}	models.ErrorResponse
 //	@Failure		404		{object}	models.ErrorResponse
 //	@Failure		500		{object}	models.ErrorResponse
 //	@Router			/users/{id} [put]
-func UpdateUser(db *gorm.DB) gin.HandlerFunc {
+func UpdateUser(db *gorm.DB, authService services.AuthService) gin.HandlerFunc {
 	return func(c *gin.Context) {
+		ctx := c.Request.Context()
+		log := utils.LoggerFromContext(ctx)
+
 		var user models.User
 		if err := db.First(&user, c.Param("id")).Error; err != nil {
 			c.JSON(http.StatusNotFound, models.ErrorResponse{Error: "User not found"})
 			return
 		}
+		identity, ok := authorizeUserChange(c, &user)
+		if !ok {
+			return
+		}
 
-		if err := c.ShouldBindJSON(&user); err != nil {
+		var req models.UpdateUserRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
 			c.JSON(http.StatusBadRequest, models.ErrorResponse{
 				Error:   models.ErrorTypeBadRequest,
 				Message: "Error updating user, Bad request",
@@ -133,7 +155,46 @@ func UpdateUser(db *gorm.DB) gin.HandlerFunc {
 			return
 		}
 
-		db.Save(&user)
+		if req.Password != "" {
+			if user.OIDCSubject != nil {
+				utils.RespondForbidden(c, nil, "This account signs in with single sign-on and has no password")
+				return
+			}
+			// A stolen session alone isn't enough to take over the account, admins resetting
+			// someone else's password don't know it
+			if identity.UserID == user.ID {
+				if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(req.CurrentPassword)); err != nil {
+					utils.RespondUnauthorized(c, nil, "Current password is incorrect")
+					return
+				}
+			}
+			user.Password = req.Password
+		}
+		user.Name = req.Name
+
+		// The verification was for the old address
+		emailChanged := req.Email != user.Email
+		if emailChanged {
+			user.Email = req.Email
+			user.EmailVerified = false
+			user.EmailVerifiedAt = nil
+		}
+
+		if err := db.Save(&user).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+				Error:   models.ErrorTypeInternalError,
+				Message: "Could not update user. Internal Server Error",
+				Details: map[string]interface{}{"error": err.Error()},
+			})
+			return
+		}
+
+		if emailChanged {
+			if err := authService.SendVerificationEmail(ctx, user.ID); err != nil {
+				log.Error().Err(err).Uint("userId", user.ID).Msg("Failed to send verification email")
+			}
+		}
+
 		c.JSON(http.StatusOK, user.ToResponse())
 	}
 }
@@ -141,12 +202,15 @@ func UpdateUser(db *gorm.DB) gin.HandlerFunc {
 // DeleteUser godoc
 //
 //	@Summary		Delete a user
-//	@Description	Delete a user by ID
+//	@Description	Delete a user by ID. Users can delete their own account, admins any account.
 //	@Tags			users
 //	@Accept			json
 //	@Produce		json
+//	@Security		BearerAuth
 //	@Param			id	path		int	true	"User ID"
 //	@Success		204	{object}	nil
+//	@Failure		401	{object}	models.ErrorResponse
+//	@Failure		403	{object}	models.ErrorResponse
 //	@Failure		404	{object}	models.ErrorResponse
 //	@Failure		500	{object}	models.ErrorResponse
 //	@Router			/users/{id} [delete]
@@ -157,8 +221,33 @@ func DeleteUser(db *gorm.DB) gin.HandlerFunc {
 			c.JSON(http.StatusNotFound, models.ErrorResponse{Error: "User not found"})
 			return
 		}
+		if _, ok := authorizeUserChange(c, &user); !ok {
+			return
+		}
 
-		db.Delete(&user)
+		if err := db.Delete(&user).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+				Error:   models.ErrorTypeInternalError,
+				Message: "Could not delete user. Internal Server Error",
+				Details: map[string]interface{}{"error": err.Error()},
+			})
+			return
+		}
 		c.Status(http.StatusNoContent)
 	}
 }
+
+// authorizeUserChange lets callers change their own account and admins any account. It
+// writes the error response when the caller may not.
+func authorizeUserChange(c *gin.Context, user *models.User) (*models.AuthIdentity, bool) {
+	identity, ok := utils.GetAuthIdentity(c)
+	if !ok {
+		utils.RespondUnauthorized(c, nil, "Authentication required")
+		return nil, false
+	}
+	if identity.UserID != user.ID && !identity.HasScope(models.ScopeAdmin) {
+		utils.RespondForbidden(c, nil, "You can only change your own account")
+		return nil, false
+	}
+	return identity, true
+}
@@ -0,0 +1,113 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"memoria-backend/models"
+	"memoria-backend/utils"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// newTestUserServer serves the user update and delete endpoints on a SQLite database.
+// Callers authenticate with "Bearer <user ID>", or "Bearer <user ID>:admin" for an admin.
+func newTestUserServer(t *testing.T) (*gorm.DB, http.Handler) {
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "memoria.db")), &gorm.Config{Logger: logger.Discard})
+	require.NoError(t, err)
+	require.NoError(t, db.AutoMigrate(&models.User{}))
+
+	gin.SetMode(gin.TestMode)
+	engine := gin.New()
+	authenticate := func(c *gin.Context) {
+		token, ok := strings.CutPrefix(c.GetHeader("Authorization"), "Bearer ")
+		if !ok {
+			return
+		}
+		user, admin := strings.CutSuffix(token, ":admin")
+		userID, err := strconv.ParseUint(user, 10, 32)
+		require.NoError(t, err)
+		scopes := []string{models.ScopePastesRead, models.ScopePastesWrite}
+		if admin {
+			scopes = append(scopes, models.ScopeAdmin)
+		}
+		c.Set(utils.AuthIdentityKey, &models.AuthIdentity{UserID: uint(userID), Scopes: scopes})
+	}
+	// The tests keep email addresses, so no verification email is sent
+	engine.PUT("/users/:id", authenticate, UpdateUser(db, nil))
+	engine.DELETE("/users/:id", authenticate, DeleteUser(db))
+	return db, engine
+}
+
+func createTestUser(t *testing.T, db *gorm.DB, email string) *models.User {
+	user := &models.User{Name: "User", Email: email, Password: "old password"}
+	require.NoError(t, db.Create(user).Error)
+	return user
+}
+
+func sendUserRequest(handler http.Handler, method string, userID uint, token, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, "/users/"+strconv.FormatUint(uint64(userID), 10), strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, req)
+	return recorder
+}
+
+func storedPassword(t *testing.T, db *gorm.DB, userID uint) string {
+	var user models.User
+	require.NoError(t, db.First(&user, userID).Error)
+	return user.Password
+}
+
+func TestUpdateUserOnlyAllowsTheUserOrAnAdmin(t *testing.T) {
+	db, handler := newTestUserServer(t)
+	user := createTestUser(t, db, "user@example.com")
+	other := createTestUser(t, db, "other@example.com")
+	body := `{"name":"Renamed","email":"user@example.com"}`
+
+	assert.Equal(t, http.StatusUnauthorized, sendUserRequest(handler, http.MethodPut, user.ID, "", body).Code)
+	assert.Equal(t, http.StatusForbidden, sendUserRequest(handler, http.MethodPut, user.ID, strconv.Itoa(int(other.ID)), body).Code)
+	assert.Equal(t, http.StatusForbidden, sendUserRequest(handler, http.MethodDelete, user.ID, strconv.Itoa(int(other.ID)), "").Code)
+
+	assert.Equal(t, http.StatusOK, sendUserRequest(handler, http.MethodPut, user.ID, strconv.Itoa(int(user.ID)), body).Code)
+	assert.Equal(t, http.StatusOK, sendUserRequest(handler, http.MethodPut, user.ID, strconv.Itoa(int(other.ID))+":admin", body).Code)
+	assert.Equal(t, http.StatusNoContent, sendUserRequest(handler, http.MethodDelete, user.ID, strconv.Itoa(int(user.ID)), "").Code)
+	assert.Equal(t, http.StatusNoContent, sendUserRequest(handler, http.MethodDelete, other.ID, strconv.Itoa(int(user.ID))+":admin", "").Code)
+}
+
+func TestUpdateUserRequiresTheCurrentPasswordToChangeIt(t *testing.T) {
+	db, handler := newTestUserServer(t)
+	user := createTestUser(t, db, "user@example.com")
+	token := strconv.Itoa(int(user.ID))
+
+	for _, body := range []string{
+		`{"name":"User","email":"user@example.com","password":"new password"}`,
+		`{"name":"User","email":"user@example.com","password":"new password","currentPassword":"wrong password"}`,
+	} {
+		assert.Equal(t, http.StatusUnauthorized, sendUserRequest(handler, http.MethodPut, user.ID, token, body).Code, body)
+	}
+	assert.NoError(t, bcrypt.CompareHashAndPassword([]byte(storedPassword(t, db, user.ID)), []byte("old password")))
+
+	body := `{"name":"User","email":"user@example.com","password":"new password","currentPassword":"old password"}`
+	assert.Equal(t, http.StatusOK, sendUserRequest(handler, http.MethodPut, user.ID, token, body).Code)
+	assert.NoError(t, bcrypt.CompareHashAndPassword([]byte(storedPassword(t, db, user.ID)), []byte("new password")))
+
+	// Admins can set someone else's password without knowing it
+	admin := createTestUser(t, db, "admin@example.com")
+	body = `{"name":"User","email":"user@example.com","password":"admin password"}`
+	assert.Equal(t, http.StatusOK, sendUserRequest(handler, http.MethodPut, user.ID, strconv.Itoa(int(admin.ID))+":admin", body).Code)
+	assert.NoError(t, bcrypt.CompareHashAndPassword([]byte(storedPassword(t, db, user.ID)), []byte("admin password")))
+}
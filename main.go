@@ -3,12 +3,14 @@ package main
 
 import (
 	"context"
+	"memoria-backend/commands"
 	"memoria-backend/database"
 	"memoria-backend/middleware"
 	"memoria-backend/repository"
 	"memoria-backend/router"
 	"memoria-backend/services"
 	logger "memoria-backend/utils"
+	"os"
 
 	_ "memoria-backend/docs"
 
@@ -61,7 +63,20 @@ func main() {
 		log.Fatal().Err(err).Msg("Failed to connect to database:")
 	}
 
-	r := router.Setup(ctx, db, configService)
+	pasteStorage, err := services.NewPasteStorage(appConfig, db)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Failed to set up paste storage")
+	}
+
+	// Maintenance commands, e.g. `main keys rotate`, run instead of the server
+	if len(os.Args) > 1 {
+		if err := commands.Run(ctx, os.Args[1:], db, pasteStorage); err != nil {
+			log.Fatal().Err(err).Msg("Command failed")
+		}
+		return
+	}
+
+	r := router.Setup(ctx, db, configService, pasteStorage)
 
 	r.Use(middleware.LoggerMiddleware())
 
@@ -0,0 +1,130 @@
+package middleware
+
+import (
+	"errors"
+	"memoria-backend/models"
+	"memoria-backend/services"
+	"memoria-backend/utils"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// bearerToken extracts the token from an "Authorization: Bearer <token>" header. Browsers
+// can't set headers on WebSocket handshakes, so those may offer a "bearer.<token>" subprotocol
+// instead.
+func bearerToken(c *gin.Context) string {
+	header := c.GetHeader("Authorization")
+	if len(header) > 7 && strings.EqualFold(header[:7], "Bearer ") {
+		return strings.TrimSpace(header[7:])
+	}
+	if strings.EqualFold(c.GetHeader("Upgrade"), "websocket") {
+		for _, protocol := range strings.Split(c.GetHeader("Sec-WebSocket-Protocol"), ",") {
+			if token, ok := strings.CutPrefix(strings.TrimSpace(protocol), "bearer."); ok {
+				return token
+			}
+		}
+	}
+	return ""
+}
+
+// RequireAuth rejects requests that don't carry a valid bearer token for one of
+// the given purposes. Without purposes only full access tokens are accepted.
+func RequireAuth(authService services.AuthService, purposes ...string) gin.HandlerFunc {
+	if len(purposes) == 0 {
+		purposes = []string{models.TokenPurposeAccess}
+	}
+
+	return func(c *gin.Context) {
+		ctx := c.Request.Context()
+		log := utils.LoggerFromContext(ctx)
+
+		token := bearerToken(c)
+		if token == "" {
+			utils.RespondUnauthorized(c, nil, "Authentication is required to access this resource")
+			c.Abort()
+			return
+		}
+
+		identity, err := authService.ValidateToken(ctx, token)
+		if err != nil {
+			log.Info().Err(err).Msg("Rejected bearer token")
+			if errors.Is(err, services.ErrTwoFactorEnrollmentNeeded) {
+				utils.RespondForbidden(c, err, "Two-factor enrolment is required")
+			} else {
+				utils.RespondUnauthorized(c, err, "Invalid or expired token")
+			}
+			c.Abort()
+			return
+		}
+
+		allowed := false
+		for _, purpose := range purposes {
+			if identity.Purpose == purpose {
+				allowed = true
+				break
+			}
+		}
+		if !allowed {
+			utils.RespondUnauthorized(c, nil, "This token can't be used for this resource")
+			c.Abort()
+			return
+		}
+
+		c.Set(utils.AuthIdentityKey, identity)
+		c.Next()
+	}
+}
+
+// RequireScope rejects authenticated callers whose token wasn't granted the scope.
+// It must run after RequireAuth.
+func RequireScope(scope string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		identity, ok := utils.GetAuthIdentity(c)
+		if !ok {
+			utils.RespondUnauthorized(c, nil, "Authentication is required to access this resource")
+			c.Abort()
+			return
+		}
+
+		if !identity.HasScope(scope) {
+			utils.RespondForbidden(c, nil, "This token is missing the "+scope+" scope")
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// OptionalAuth identifies the caller when a bearer token is sent but lets anonymous
+// requests through. A token that is sent must be valid and carry the scope.
+func OptionalAuth(authService services.AuthService, scope string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx := c.Request.Context()
+		log := utils.LoggerFromContext(ctx)
+
+		token := bearerToken(c)
+		if token == "" {
+			c.Next()
+			return
+		}
+
+		identity, err := authService.ValidateToken(ctx, token)
+		if err != nil || identity.Purpose != models.TokenPurposeAccess {
+			log.Info().Err(err).Msg("Rejected bearer token")
+			utils.RespondUnauthorized(c, err, "Invalid or expired token")
+			c.Abort()
+			return
+		}
+
+		if !identity.HasScope(scope) {
+			utils.RespondForbidden(c, nil, "This token is missing the "+scope+" scope")
+			c.Abort()
+			return
+		}
+
+		c.Set(utils.AuthIdentityKey, identity)
+		c.Next()
+	}
+}
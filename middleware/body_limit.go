@@ -0,0 +1,30 @@
+package middleware
+
+import (
+	"fmt"
+	"memoria-backend/utils"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// BodySizeLimit rejects request bodies larger than maxBytes. Bodies that announce their
+// length are rejected before anything is read, others fail once they read past the limit.
+func BodySizeLimit(maxBytes int64) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if maxBytes <= 0 || c.Request.Body == nil {
+			c.Next()
+			return
+		}
+
+		if c.Request.ContentLength > maxBytes {
+			err := fmt.Errorf("request body of %d bytes exceeds the limit of %d bytes", c.Request.ContentLength, maxBytes)
+			utils.RespondWithErrorDetails(c, http.StatusUnprocessableEntity, err, map[string]interface{}{"limit": maxBytes}, "Request body too large")
+			c.Abort()
+			return
+		}
+
+		c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxBytes)
+		c.Next()
+	}
+}
@@ -0,0 +1,54 @@
+// models/api_token.go
+package models
+
+import "time"
+
+// Scopes that can be granted to personal API tokens
+const (
+	ScopePastesRead  = "pastes:read"
+	ScopePastesWrite = "pastes:write"
+	ScopeAdmin       = "admin"
+)
+
+// APITokenPrefix marks a bearer token as a personal API token rather than a JWT
+const APITokenPrefix = "mem_"
+
+// APIToken represents a personal access token used by CLIs and CI jobs
+// @Description Personal API token. The secret itself is only returned once, at creation.
+type APIToken struct {
+	ID         uint       `json:"id" gorm:"primaryKey" example:"1"`
+	UserID     uint       `json:"-" gorm:"index;not null"`
+	Name       string     `json:"name" gorm:"not null" example:"GitHub Actions"`
+	Prefix     string     `json:"prefix" gorm:"type:varchar(16);not null" example:"mem_3f9a1c2e"`
+	TokenHash  string     `json:"-" gorm:"type:varchar(64);uniqueIndex;not null"`
+	Scopes     []string   `json:"scopes" gorm:"serializer:json" example:"pastes:read,pastes:write"`
+	ExpiresAt  *time.Time `json:"expiresAt,omitempty" example:"2024-01-01T00:00:00Z"`
+	LastUsedAt *time.Time `json:"lastUsedAt,omitempty" example:"2023-06-01T12:00:00Z"`
+	CreatedAt  time.Time  `json:"createdAt" example:"2023-01-01T00:00:00Z"`
+}
+
+// CreateAPITokenRequest represents a request to create a personal API token
+type CreateAPITokenRequest struct {
+	Name      string     `json:"name" binding:"required,max=100" example:"GitHub Actions"`
+	Scopes    []string   `json:"scopes" binding:"required,min=1,dive,oneof=pastes:read pastes:write admin" example:"pastes:read,pastes:write"`
+	ExpiresAt *time.Time `json:"expiresAt,omitempty" example:"2024-01-01T00:00:00Z"`
+}
+
+// APITokenData represents the response data for token endpoints
+// @Description Personal API token response wrapper
+type APITokenData struct {
+	APIToken *APIToken `json:"apiToken,omitempty"`
+	// Token is the plaintext secret, only present in the create response
+	Token string `json:"token,omitempty" example:"mem_3f9a1c2e..."`
+}
+
+// APITokenListData represents a list of personal API tokens
+type APITokenListData struct {
+	APITokens []APIToken `json:"apiTokens"`
+	Count     int        `json:"count"`
+}
+
+// TableName specifies the database table name for the APIToken model
+func (APIToken) TableName() string {
+	return "api_tokens"
+}
@@ -0,0 +1,32 @@
+package models
+
+import "time"
+
+// Attachment is a binary file attached to a paste, such as a screenshot. It's only served
+// through its paste, so the paste's privacy, password and expiry apply to it.
+// @Description A file attached to a paste
+type Attachment struct {
+	ID            uint   `gorm:"primaryKey" json:"id" example:"1"`
+	PasteID       uint64 `gorm:"index;not null" json:"-"`
+	FileName      string `gorm:"type:varchar(255);not null" json:"fileName" example:"screenshot.png"`
+	MIMEType      string `gorm:"type:varchar(255);not null" json:"mimeType" example:"image/png"` // Sniffed from the content, never taken from the upload
+	Size          int64  `gorm:"not null" json:"size" example:"48213"`
+	Width         int    `json:"width,omitempty" example:"1280"` // Images only
+	Height        int    `json:"height,omitempty" example:"720"`
+	ContentHash   string `gorm:"type:varchar(64);not null" json:"-"` // Blob holding the data
+	ThumbnailHash string `gorm:"type:varchar(64)" json:"-"`          // Blob holding the thumbnail
+	// ThumbnailType is the MIME type of the thumbnail, empty when there is none
+	ThumbnailType string    `gorm:"type:varchar(255)" json:"thumbnailType,omitempty" example:"image/png"`
+	CreatedAt     time.Time `gorm:"autoCreateTime" json:"createdAt" example:"2023-01-01T00:00:00Z"`
+}
+
+// TableName specifies the database table name for the Attachment model
+func (Attachment) TableName() string {
+	return "attachments"
+}
+
+// AttachmentData represents the response data for attachment endpoints
+// @Description Attachment response wrapper
+type AttachmentData struct {
+	Attachment *Attachment `json:"attachment,omitempty"`
+}
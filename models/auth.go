@@ -0,0 +1,121 @@
+// models/auth.go
+package models
+
+import "time"
+
+// Token purposes distinguish full access tokens from the short-lived tokens
+// handed out between the two steps of a two-factor login
+const (
+	TokenPurposeAccess     = "access"
+	TokenPurposeTwoFactor  = "2fa_challenge"
+	TokenPurposeEnrollment = "2fa_enroll"
+	TokenPurposeOIDCState  = "oidc_state"
+	TokenPurposeReset      = "password_reset"
+	TokenPurposeVerify     = "verify_email"
+)
+
+// AuthIdentity describes the caller behind a validated token
+type AuthIdentity struct {
+	UserID  uint
+	Purpose string
+	Scopes  []string
+	// EmailVerified mirrors the user's verification status at the time of the request
+	EmailVerified bool
+	// TokenID is set when the caller authenticated with a personal API token
+	TokenID uint
+}
+
+// HasScope reports whether the identity was granted the scope. Admin implies every scope.
+func (i *AuthIdentity) HasScope(scope string) bool {
+	for _, granted := range i.Scopes {
+		if granted == scope || granted == ScopeAdmin {
+			return true
+		}
+	}
+	return false
+}
+
+// LoginRequest represents a local account login attempt
+type LoginRequest struct {
+	Email    string `json:"email" binding:"required,email" example:"john@example.com"`
+	Password string `json:"password" binding:"required" example:"strongpassword123"`
+}
+
+// LoginData represents the response data for a login step
+// @Description Either an access token, or a challenge token for the second login step
+type LoginData struct {
+	Token              string        `json:"token,omitempty"`
+	ExpiresAt          *time.Time    `json:"expiresAt,omitempty" example:"2023-01-02T00:00:00Z"`
+	User               *UserResponse `json:"user,omitempty"`
+	TwoFactorRequired  bool          `json:"twoFactorRequired,omitempty" example:"false"`
+	EnrollmentRequired bool          `json:"enrollmentRequired,omitempty" example:"false"`
+	ChallengeToken     string        `json:"challengeToken,omitempty"`
+}
+
+// TwoFactorVerifyRequest completes a login with either a TOTP code or a recovery code
+type TwoFactorVerifyRequest struct {
+	ChallengeToken string `json:"challengeToken" binding:"required"`
+	Code           string `json:"code,omitempty" example:"123456"`
+	RecoveryCode   string `json:"recoveryCode,omitempty" example:"abcd-efgh-ijkl-mnop"`
+}
+
+// TOTPCodeRequest carries a single TOTP or recovery code
+type TOTPCodeRequest struct {
+	Code string `json:"code" binding:"required" example:"123456"`
+}
+
+// TOTPEnrollmentData represents a pending TOTP enrolment
+// @Description Secret and otpauth:// URI to load into an authenticator app
+type TOTPEnrollmentData struct {
+	Secret          string `json:"secret" example:"JBSWY3DPEHPK3PXP"`
+	ProvisioningURI string `json:"provisioningUri" example:"otpauth://totp/Memoria:john@example.com?issuer=Memoria&secret=JBSWY3DPEHPK3PXP"`
+}
+
+// RecoveryCodesData represents freshly generated recovery codes. They are only shown once.
+// @Description Single-use recovery codes, plus an access token when enrolment was forced at login
+type RecoveryCodesData struct {
+	RecoveryCodes []string   `json:"recoveryCodes"`
+	Token         string     `json:"token,omitempty"`
+	ExpiresAt     *time.Time `json:"expiresAt,omitempty" example:"2023-01-02T00:00:00Z"`
+}
+
+// LoginMethodsData tells clients which login methods are available
+// @Description Enabled login methods
+type LoginMethodsData struct {
+	Local        bool   `json:"local" example:"true"`
+	OIDC         bool   `json:"oidc" example:"false"`
+	ProviderName string `json:"providerName,omitempty" example:"Keycloak"`
+}
+
+// OIDCLoginStart is the redirect to the identity provider plus the signed state
+// that has to be kept in a cookie until the callback
+type OIDCLoginStart struct {
+	AuthorizationURL string
+	StateToken       string
+	MaxAge           time.Duration
+}
+
+// OIDCCallbackRequest represents the identity provider's redirect back to the API
+type OIDCCallbackRequest struct {
+	Code             string `form:"code"`
+	State            string `form:"state" binding:"required"`
+	Error            string `form:"error"`
+	ErrorDescription string `form:"error_description"`
+	StateToken       string `form:"-"` // Read from the state cookie
+}
+
+// ForgotPasswordRequest asks for a password reset email
+type ForgotPasswordRequest struct {
+	Email string `json:"email" binding:"required,email" example:"john@example.com"`
+}
+
+// ResetPasswordRequest sets a new password using a reset token
+type ResetPasswordRequest struct {
+	Token    string `json:"token" binding:"required"`
+	Password string `json:"password" binding:"required,min=8" example:"newstrongpassword123" format:"password"`
+}
+
+// VerifyEmailRequest confirms an email address using a verification token
+type VerifyEmailRequest struct {
+	Token string `json:"token" binding:"required"`
+}
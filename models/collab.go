@@ -0,0 +1,60 @@
+package models
+
+// Types of the messages exchanged over a collaboration WebSocket
+const (
+	CollabMessageSnapshot  = "snapshot" // Server: the document and who's in the session, sent on joining
+	CollabMessageOperation = "op"       // Client: an edit. Server: someone else's edit
+	CollabMessageAck       = "ack"      // Server: the client's edit was applied
+	CollabMessageCursor    = "cursor"   // Client: the cursor or selection moved
+	CollabMessagePresence  = "presence" // Server: someone joined or moved their cursor
+	CollabMessageLeave     = "leave"    // Server: someone left
+	CollabMessageError     = "error"    // Server: the client's last message was refused
+)
+
+// CollabMessage is a message of the collaboration protocol. Edits are operations on one file
+// of the paste, based on the revision the client last saw: a run of components that retain,
+// insert or delete text, covering the whole file. Positions and lengths count Unicode code
+// points.
+type CollabMessage struct {
+	Type         string              `json:"type" example:"op"`
+	Revision     int                 `json:"revision" example:"42"`
+	File         string              `json:"file,omitempty" example:"paste.txt"`
+	Operation    []CollabOpComponent `json:"operation,omitempty"`
+	Cursor       *CollabCursor       `json:"cursor,omitempty"`
+	ClientID     string              `json:"clientId,omitempty" example:"3f2a9c1e"`
+	Participant  *CollabParticipant  `json:"participant,omitempty"`
+	Files        []CollabFile        `json:"files,omitempty"`
+	Participants []CollabParticipant `json:"participants,omitempty"`
+	ReadOnly     bool                `json:"readOnly,omitempty"`
+	Error        string              `json:"error,omitempty"`
+}
+
+// CollabOpComponent is one step of an operation, exactly one of its fields is set
+type CollabOpComponent struct {
+	Retain int    `json:"retain,omitempty" example:"5"`
+	Insert string `json:"insert,omitempty" example:"hello"`
+	Delete int    `json:"delete,omitempty" example:"2"`
+}
+
+// CollabCursor is where a participant's cursor is, SelectionEnd differs from Position while
+// text is selected
+type CollabCursor struct {
+	File         string `json:"file" example:"paste.txt"`
+	Position     int    `json:"position" example:"12"`
+	SelectionEnd int    `json:"selectionEnd" example:"12"`
+}
+
+// CollabFile is a file of the paste being edited
+type CollabFile struct {
+	Name    string `json:"name" example:"paste.txt"`
+	Content string `json:"content" example:"console.log('Hello world');"`
+}
+
+// CollabParticipant is someone connected to a collaboration session. Anonymous participants
+// have no user ID.
+type CollabParticipant struct {
+	ClientID string        `json:"clientId" example:"3f2a9c1e"`
+	UserID   uint          `json:"userId,omitempty" example:"1"`
+	ReadOnly bool          `json:"readOnly,omitempty" example:"false"`
+	Cursor   *CollabCursor `json:"cursor,omitempty"`
+}
@@ -0,0 +1,70 @@
+package models
+
+import "time"
+
+// Folder privacy. Public folders are visible to everyone, private ones to their owner and
+// team folders to the team's members.
+const (
+	FolderPrivacyPublic  = "public"
+	FolderPrivacyPrivate = "private"
+	FolderPrivacyTeam    = "team"
+)
+
+// Folder is a collection of pastes owned by a user or a team. Folders nest, and anyone who
+// can see a folder can see the pastes directly in it, so a whole folder can be shared at once.
+// @Description A folder (collection) of pastes
+type Folder struct {
+	ID        uint      `gorm:"primaryKey" json:"id" example:"1"`
+	Name      string    `gorm:"type:varchar(100);not null" json:"name" example:"Runbooks"`
+	ParentID  *uint     `gorm:"index" json:"parentId,omitempty" example:"1"`
+	UserID    uint      `gorm:"index" json:"userId,omitempty" example:"1"` // Owner of a personal folder, 0 for team folders
+	TeamID    *uint     `gorm:"index" json:"teamId,omitempty" example:"1"`
+	Privacy   string    `gorm:"type:varchar(10);not null" json:"privacy" example:"private"`
+	CreatedAt time.Time `json:"createdAt" example:"2023-01-01T00:00:00Z"`
+	UpdatedAt time.Time `json:"updatedAt" example:"2023-01-01T00:00:00Z"`
+}
+
+// TableName specifies the database table name for the Folder model
+func (Folder) TableName() string {
+	return "folders"
+}
+
+// CreateFolderRequest represents a request to create a folder. Folders with a teamId belong
+// to the team, nested folders belong to the owner of their parent.
+type CreateFolderRequest struct {
+	Name     string `json:"name" binding:"required,max=100" example:"Runbooks"`
+	ParentID *uint  `json:"parentId,omitempty" example:"1"`
+	TeamID   *uint  `json:"teamId,omitempty" example:"1"`
+	Privacy  string `json:"privacy" binding:"required,oneof=public private team" example:"private"`
+}
+
+// UpdateFolderRequest renames a folder, moves it or changes its privacy. A folder without
+// parentId moves to the top level.
+type UpdateFolderRequest struct {
+	Name     string `json:"name" binding:"required,max=100" example:"Runbooks"`
+	ParentID *uint  `json:"parentId,omitempty" example:"1"`
+	Privacy  string `json:"privacy" binding:"required,oneof=public private team" example:"team"`
+}
+
+// MovePasteRequest moves a paste into a folder, or out of its folder without folderId
+type MovePasteRequest struct {
+	FolderID *uint `json:"folderId,omitempty" example:"1"`
+}
+
+// FolderData represents the response data for a single folder
+type FolderData struct {
+	Folder *Folder `json:"folder,omitempty"`
+}
+
+// FolderListData represents a flat list of folders, nested through parentId
+type FolderListData struct {
+	Folders []Folder `json:"folders"`
+	Count   int      `json:"count"`
+}
+
+// FolderContentsData is a folder with the subfolders and pastes in it the caller can see
+type FolderContentsData struct {
+	Folder  *Folder  `json:"folder"`
+	Folders []Folder `json:"folders"`
+	Pastes  []Paste  `json:"pastes"`
+}
@@ -0,0 +1,32 @@
+package models
+
+// HighlightThemesData lists the themes rendered pastes can be styled with
+// @Description Highlighting themes
+type HighlightThemesData struct {
+	Themes  []string `json:"themes" example:"github,monokai"`
+	Default string   `json:"default" example:"github"`
+}
+
+// RenderPasteRequest holds the query parameters of the HTML view of a paste
+type RenderPasteRequest struct {
+	Language   string `form:"language"`
+	Source     bool   `form:"source"`
+	Standalone bool   `form:"standalone"`
+	Theme      string `form:"theme"`
+}
+
+// TOCEntry is a heading of a markdown paste
+// @Description Table of contents entry
+type TOCEntry struct {
+	Level    int        `json:"level" example:"2"`
+	Text     string     `json:"text" example:"Getting started"`
+	ID       string     `json:"id" example:"getting-started"`
+	File     string     `json:"file,omitempty" example:"README.md"`
+	Children []TOCEntry `json:"children,omitempty"`
+}
+
+// PasteTOCData is the table of contents of a paste
+// @Description Paste table of contents
+type PasteTOCData struct {
+	Entries []TOCEntry `json:"entries"`
+}
@@ -0,0 +1,36 @@
+package models
+
+// Language is a language pastes can be highlighted as
+// @Description A syntax highlighting language
+type Language struct {
+	ID         string   `json:"id" example:"python"` // What syntaxHighlight is set to
+	Name       string   `json:"name" example:"Python"`
+	Aliases    []string `json:"aliases,omitempty" example:"py,python3"` // Also accepted for syntaxHighlight
+	Extensions []string `json:"extensions,omitempty" example:".py,.pyw"`
+}
+
+// LanguageListData represents the languages pastes can be highlighted as
+type LanguageListData struct {
+	Languages []Language `json:"languages"`
+	Count     int        `json:"count"`
+}
+
+// DetectLanguageRequest represents a request to guess the language of some content
+type DetectLanguageRequest struct {
+	Content  string `json:"content" binding:"required"`
+	FileName string `json:"fileName,omitempty" example:"main.py"` // A paste title or file name, its extension is a strong hint
+}
+
+// LanguageGuess is one guess at the language of some content
+// @Description A guessed language with how confident the guess is
+type LanguageGuess struct {
+	Language   string  `json:"language" example:"python"`
+	Name       string  `json:"name" example:"Python"`
+	Confidence float64 `json:"confidence" example:"0.9"`                                            // Between 0 and 1
+	Reason     string  `json:"reason" example:"shebang" enums:"shebang,modeline,extension,content"` // Strongest evidence for the guess
+}
+
+// LanguageGuessData represents the guesses at the language of some content, best first
+type LanguageGuessData struct {
+	Guesses []LanguageGuess `json:"guesses"`
+}
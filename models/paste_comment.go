@@ -0,0 +1,73 @@
+package models
+
+import "time"
+
+// PasteComment is a comment on a paste, anchored to a line range of one of its files or to
+// the paste as a whole. Replies belong to the thread of a top-level comment and have no
+// anchor of their own.
+// @Description A comment on a paste or on some of its lines
+type PasteComment struct {
+	ID        uint   `json:"id" gorm:"primaryKey" example:"1"`
+	PasteID   uint64 `json:"pasteId" gorm:"index;not null" example:"123111"`
+	ParentID  *uint  `json:"parentId,omitempty" gorm:"index" example:"1"`
+	UserID    uint   `json:"userId" gorm:"index;not null" example:"2"`
+	Body      string `json:"body" gorm:"type:text;not null" example:"This should check the error"`
+	File      string `json:"file,omitempty" gorm:"type:varchar(255)" example:"main.go"`
+	StartLine int    `json:"startLine,omitempty" example:"12"`
+	EndLine   int    `json:"endLine,omitempty" example:"14"`
+	// ContentHash is the revision of the file the lines refer to, moved along when a later
+	// revision keeps the commented lines
+	ContentHash string `json:"contentHash,omitempty" gorm:"type:varchar(64)" example:"9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08"`
+	// AnchorText is the text of the commented lines, looked for again in later revisions
+	AnchorText string `json:"-" gorm:"type:text"`
+	// Outdated is set once a revision changed the commented lines, the line range then still
+	// refers to ContentHash
+	Outdated   bool           `json:"outdated" example:"false"`
+	Resolved   bool           `json:"resolved" example:"false"`
+	ResolvedBy *uint          `json:"resolvedBy,omitempty" example:"1"`
+	ResolvedAt *time.Time     `json:"resolvedAt,omitempty" example:"2023-01-02T00:00:00Z"`
+	CreatedAt  time.Time      `json:"createdAt" example:"2023-01-01T00:00:00Z"`
+	UpdatedAt  time.Time      `json:"updatedAt" example:"2023-01-01T00:00:00Z"`
+	Replies    []PasteComment `json:"replies,omitempty" gorm:"-"`
+}
+
+// CreatePasteCommentRequest comments on a paste. Comments on lines give the file and line
+// range, replies give the comment they reply to instead.
+type CreatePasteCommentRequest struct {
+	Body string `json:"body" binding:"required,max=10000" example:"This should check the error"`
+	// File is the name of the commented file, it can be left out for single-file pastes
+	File      string `json:"file,omitempty" binding:"max=255" example:"main.go"`
+	StartLine int    `json:"startLine,omitempty" binding:"min=0" example:"12"`
+	EndLine   int    `json:"endLine,omitempty" binding:"omitempty,gtefield=StartLine" example:"14"`
+	// ContentHash is the revision of the file the client commented on, a comment on a
+	// revision that has since changed is refused
+	ContentHash string `json:"contentHash,omitempty" binding:"omitempty,len=64,hexadecimal"`
+	ParentID    *uint  `json:"parentId,omitempty" example:"1"`
+}
+
+// UpdatePasteCommentRequest changes the text of a comment
+type UpdatePasteCommentRequest struct {
+	Body string `json:"body" binding:"required,max=10000" example:"This should check the error"`
+}
+
+// PasteCommentSettingsRequest turns comments on a paste on or off
+type PasteCommentSettingsRequest struct {
+	Disabled *bool `json:"disabled" binding:"required" example:"true"`
+}
+
+// PasteCommentData represents the response data for a single comment
+type PasteCommentData struct {
+	Comment *PasteComment `json:"comment,omitempty"`
+}
+
+// PasteCommentListData represents the comment threads of a paste
+type PasteCommentListData struct {
+	Comments []PasteComment `json:"comments"`
+	Count    int            `json:"count"`
+	Disabled bool           `json:"disabled"`
+}
+
+// TableName specifies the database table name for the PasteComment model
+func (PasteComment) TableName() string {
+	return "paste_comments"
+}
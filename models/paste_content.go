@@ -0,0 +1,49 @@
+// models/paste_content.go
+package models
+
+import "time"
+
+// StoredContent is paste content along with how the paste repository stored it. Callers
+// only ever see the plaintext in Content, the rest is bookkeeping of the repository.
+type StoredContent struct {
+	Content string `gorm:"type:text;not null" json:"content" example:"console.log('Hello world');"`
+	// Server-side encryption at rest
+	DataKey   string `gorm:"type:text" json:"-"`              // Wrapped data key, base64. Empty when stored in plaintext
+	DataKeyID string `gorm:"type:varchar(64);index" json:"-"` // Master key that wrapped DataKey
+	// ContentHash is the SHA-256 of the content, or an HMAC-SHA256 keyed from the keyring for
+	// pastes that are always encrypted at rest. Large content lives in a shared content blob
+	// under this hash, the Content column is empty then.
+	ContentHash string `gorm:"type:varchar(64);index" json:"contentHash,omitempty" example:"9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08"`
+	ContentSize int64  `json:"-"` // Length of the plaintext content in bytes
+}
+
+// ContentBlob is paste content kept in the content store. Pastes with identical content share
+// one blob, which is removed when the last paste referring to it goes away.
+type ContentBlob struct {
+	Hash        string    `gorm:"type:varchar(64);primaryKey"` // Hash of the plaintext, matches Paste.ContentHash
+	StoreKey    string    `gorm:"type:varchar(64);not null"`   // Key in the content store, SHA-256 of the stored bytes
+	Size        int64     `gorm:"not null"`                    // Plaintext length
+	StoredSize  int64     `gorm:"not null"`                    // Length after compression and encryption
+	Compression string    `gorm:"type:varchar(10)"`            // Empty when stored uncompressed
+	DataKey     string    `gorm:"type:text"`                   // Wrapped data key, empty when stored in plaintext
+	DataKeyID   string    `gorm:"type:varchar(64);index"`      // Master key that wrapped DataKey
+	RefCount    int       `gorm:"not null;default:0"`          // Number of pastes, paste files and attachments with this content
+	CreatedAt   time.Time `gorm:"autoCreateTime"`
+}
+
+// TableName specifies the database table name for the ContentBlob model
+func (ContentBlob) TableName() string {
+	return "content_blobs"
+}
+
+// PasteContent holds the bytes of content blobs for the database content store
+type PasteContent struct {
+	Hash      string    `gorm:"type:varchar(64);primaryKey"`
+	Data      []byte    `gorm:"not null"`
+	CreatedAt time.Time `gorm:"autoCreateTime"`
+}
+
+// TableName specifies the database table name for the PasteContent model
+func (PasteContent) TableName() string {
+	return "paste_contents"
+}
@@ -0,0 +1,40 @@
+package models
+
+// DefaultFileName is the file name of pastes created with plain content instead of files
+const DefaultFileName = "paste.txt"
+
+// PasteFile is one file of a multi-file paste
+// @Description A named file within a paste, with its own syntax highlighting
+type PasteFile struct {
+	ID              uint64 `gorm:"primaryKey" json:"-"`
+	PasteID         uint64 `gorm:"index;not null" json:"-"`
+	Position        int    `gorm:"not null" json:"-"` // Order of the file within the paste
+	Name            string `gorm:"type:varchar(255);not null" json:"name" example:"main.go"`
+	SyntaxHighlight string `gorm:"default:'text'" json:"syntaxHighlight" example:"go"`
+	StoredContent   `gorm:"embedded"`
+}
+
+// TableName specifies the database table name for the PasteFile model
+func (PasteFile) TableName() string {
+	return "paste_files"
+}
+
+// PasteFileRequest is a file of a paste being created or updated
+type PasteFileRequest struct {
+	Name            string `json:"name" binding:"required,max=255" example:"main.go"`
+	Content         string `json:"content" example:"package main"`
+	SyntaxHighlight string `json:"syntaxHighlight,omitempty" example:"go"`
+}
+
+// FileList returns the files of the paste. A paste created with plain content is a single
+// file named DefaultFileName.
+func (p *Paste) FileList() []PasteFile {
+	if len(p.Files) > 0 {
+		return p.Files
+	}
+	return []PasteFile{{
+		Name:            DefaultFileName,
+		SyntaxHighlight: p.SyntaxHighlight,
+		StoredContent:   p.StoredContent,
+	}}
+}
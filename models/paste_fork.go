@@ -0,0 +1,36 @@
+package models
+
+import "time"
+
+// ForkPasteRequest represents a request to fork a paste. The fork copies the source's title
+// and content; everything else starts fresh from what is given here.
+type ForkPasteRequest struct {
+	Title     string    `json:"title,omitempty" example:"My take on the snippet"` // Defaults to the source's title
+	Privacy   string    `json:"privacy,omitempty" binding:"omitempty,oneof=public private password team" example:"public"`
+	Password  string    `json:"password,omitempty" example:"mySecurePassword123"` // For the fork, the source's password goes in the pw query parameter
+	TeamID    *uint     `json:"teamId,omitempty" example:"1"`
+	ExpiresAt time.Time `json:"expiresAt,omitempty" example:"2023-01-08T00:00:00Z"`
+	UserID    string    `json:"-"` // Set from the authenticated caller, never from the body
+	ClientIP  string    `json:"-"` // Set from the request, anonymous quotas are per IP address
+}
+
+// PasteFork is a fork in a paste's fork tree, along with the forks made from it
+// @Description A fork of a paste and its own forks
+type PasteFork struct {
+	ID        uint64      `json:"id" example:"123112"`
+	Title     string      `json:"title" example:"My take on the snippet"`
+	UserID    string      `json:"user_id,omitempty" example:"u98765zyxwv"`
+	Privacy   string      `json:"privacy" example:"public"`
+	CreatedAt time.Time   `json:"createdAt" example:"2023-01-01T00:00:00Z"`
+	ForkCount int         `json:"forkCount" example:"1"`
+	Forks     []PasteFork `json:"forks"`
+}
+
+// PasteForksData represents the fork tree of a paste. Only forks the caller may see are
+// listed and counted.
+// @Description Forks of a paste
+type PasteForksData struct {
+	ForkedFromID *uint64     `json:"forkedFromId,omitempty" example:"123110"`
+	ForkCount    int         `json:"forkCount" example:"2"`
+	Forks        []PasteFork `json:"forks"`
+}
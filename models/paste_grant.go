@@ -0,0 +1,61 @@
+// models/paste_grant.go
+package models
+
+import "time"
+
+// Permission levels a paste can be shared with
+const (
+	PastePermissionView = "view"
+	PastePermissionEdit = "edit"
+	// PastePermissionOwner is never granted, it's what the author (or a team owner for
+	// team pastes) holds and allows managing the paste's grants
+	PastePermissionOwner = "owner"
+)
+
+// PasteGrant shares a paste with a single user or with every member of a team
+// @Description Access granted on a paste to a user or a team
+type PasteGrant struct {
+	ID         uint      `json:"id" gorm:"primaryKey" example:"1"`
+	PasteID    uint64    `json:"pasteId" gorm:"not null;uniqueIndex:idx_paste_grants_user;uniqueIndex:idx_paste_grants_team" example:"123111"`
+	UserID     *uint     `json:"userId,omitempty" gorm:"index;uniqueIndex:idx_paste_grants_user" example:"2"`
+	TeamID     *uint     `json:"teamId,omitempty" gorm:"index;uniqueIndex:idx_paste_grants_team" example:"1"`
+	Permission string    `json:"permission" gorm:"type:varchar(10);not null" example:"view"`
+	CreatedBy  uint      `json:"createdBy" example:"1"`
+	CreatedAt  time.Time `json:"createdAt" example:"2023-01-01T00:00:00Z"`
+}
+
+// CreatePasteGrantRequest shares a paste. Exactly one of UserID, Email or TeamID must be set.
+type CreatePasteGrantRequest struct {
+	UserID     *uint  `json:"userId,omitempty" example:"2"`
+	Email      string `json:"email,omitempty" binding:"omitempty,email" example:"jane@example.com"`
+	TeamID     *uint  `json:"teamId,omitempty" example:"1"`
+	Permission string `json:"permission" binding:"required,oneof=view edit" example:"view"`
+}
+
+// PasteGrantData represents the response data for a single grant
+type PasteGrantData struct {
+	Grant *PasteGrant `json:"grant,omitempty"`
+}
+
+// PasteGrantListData represents the grants on a paste
+type PasteGrantListData struct {
+	Grants []PasteGrant `json:"grants"`
+	Count  int          `json:"count"`
+}
+
+// SharedPaste is a paste shared with the caller along with the access they have
+type SharedPaste struct {
+	Paste      Paste  `json:"paste"`
+	Permission string `json:"permission" example:"edit"`
+}
+
+// SharedPasteListData represents the pastes shared with the caller
+type SharedPasteListData struct {
+	Pastes []SharedPaste `json:"pastes"`
+	Count  int           `json:"count"`
+}
+
+// TableName specifies the database table name for the PasteGrant model
+func (PasteGrant) TableName() string {
+	return "paste_grants"
+}
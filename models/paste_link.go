@@ -0,0 +1,40 @@
+package models
+
+// PasteLink is a reference from one paste's content to another, written as [[slug]],
+// [[id]] or memoria://paste/id
+// @Description A link from one paste to another
+type PasteLink struct {
+	SourceID uint64 `gorm:"primaryKey;autoIncrement:false" json:"sourceId" example:"123111"`
+	TargetID uint64 `gorm:"primaryKey;autoIncrement:false;index" json:"targetId" example:"123112"`
+}
+
+// TableName specifies the database table name for the PasteLink model
+func (PasteLink) TableName() string {
+	return "paste_links"
+}
+
+// PasteLinkNode is a paste in the link graph or in a backlink list. Only pastes the caller may
+// view are listed.
+// @Description A paste linking to or linked from another paste
+type PasteLinkNode struct {
+	ID      uint64 `json:"id" example:"123111"`
+	Title   string `json:"title,omitempty" example:"Postgres runbook"`
+	UserID  string `json:"user_id,omitempty" example:"u98765zyxwv"`
+	Privacy string `json:"privacy,omitempty" example:"public"`
+}
+
+// PasteBacklinksData lists the pastes linking to a paste. Only pastes the caller may see are
+// listed and counted.
+// @Description Pastes linking to a paste
+type PasteBacklinksData struct {
+	Backlinks []PasteLinkNode `json:"backlinks"`
+	Count     int             `json:"count" example:"2"`
+}
+
+// PasteLinkGraphData is the graph of links between the caller's pastes and the pastes they
+// link to or are linked from
+// @Description Nodes and edges of a paste link graph
+type PasteLinkGraphData struct {
+	Nodes []PasteLinkNode `json:"nodes"`
+	Edges []PasteLink     `json:"edges"`
+}
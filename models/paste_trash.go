@@ -0,0 +1,21 @@
+package models
+
+import "time"
+
+// TrashedPaste is a deleted paste waiting in the trash to be restored or purged
+type TrashedPaste struct {
+	Paste     Paste     `json:"paste"`
+	DeletedAt time.Time `json:"deletedAt" example:"2023-01-01T00:00:00Z"`
+	PurgesAt  time.Time `json:"purgesAt" example:"2023-01-31T00:00:00Z"` // When it's deleted for good
+}
+
+// TrashListData represents the pastes in the caller's trash
+type TrashListData struct {
+	Pastes []TrashedPaste `json:"pastes"`
+	Count  int            `json:"count"`
+}
+
+// TrashPurgeData reports how many pastes a purge deleted for good
+type TrashPurgeData struct {
+	Purged int `json:"purged" example:"12"`
+}
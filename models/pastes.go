@@ -1,42 +1,141 @@
 package models
 
-import "time"
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
 
 // Paste represents a stored text snippet with metadata
 // @Description A text snippet with formatting, expiration, and privacy settings
 type Paste struct {
-	ID              uint64    `gorm:"primaryKey" json:"id" example:"123111" binding:"required"`
-	Title           string    `gorm:"not null" json:"title" example:"My Code Snippet" binding:"required"`
-	Content         string    `gorm:"type:text;not null" json:"content" example:"console.log('Hello world');" binding:"required"`
+	ID    uint64 `gorm:"primaryKey" json:"id" example:"123111" binding:"required"`
+	Title string `gorm:"not null" json:"title" example:"My Code Snippet" binding:"required"`
+	// Slug is the slug of the title that [[slug]] references resolve by, the repository sets it
+	// on every save. It's NULL for pastes last saved before it existed until they're backfilled.
+	Slug            *string `gorm:"type:varchar(100);index" json:"-"`
+	StoredContent   `gorm:"embedded"`
 	SyntaxHighlight string    `gorm:"default:'text'" json:"syntaxHighlight" example:"javascript" binding:"required"`
 	EditorType      string    `gorm:"default:'code';column:editor_type" json:"editorType" example:"code" binding:"required,oneof=code text"`
 	CreatedAt       time.Time `gorm:"autoCreateTime" json:"createdAt" example:"2023-01-01T00:00:00Z"`
 	ExpiresAt       time.Time `gorm:"index" json:"expiresAt,omitempty" example:"2023-01-08T00:00:00Z"`
-	Privacy         string    `gorm:"default:'public'" json:"privacy" example:"public" binding:"required,oneof=public private"` // "public", "private"
+	Privacy         string    `gorm:"default:'public'" json:"privacy" example:"public" binding:"required,oneof=public private team"` // "public", "private", "team"
 	PrivateAccessID string    `gorm:"type:varchar(64);uniqueIndex" json:"privateAccessId,omitempty" example:"abc123xyz456"`
 	Password        string    `gorm:"type:varchar(100)" json:"-"` // Stored as hash, not returned
 	UserID          string    `gorm:"index" json:"user_id,omitempty" example:"u98765zyxwv"`
+	TeamID          *uint     `gorm:"index" json:"teamId,omitempty" example:"1"`
+	ForkedFromID    *uint64   `gorm:"index" json:"forkedFromId,omitempty" example:"123110"` // Paste this one was forked from
+	FolderID        *uint     `gorm:"index" json:"folderId,omitempty" example:"1"`
+	Tags            []Tag     `gorm:"many2many:paste_tags" json:"tags,omitempty"`
+	// Encryption is set for client-side encrypted pastes, Content then holds the ciphertext.
+	// It's a nullable JSON column, NULL for pastes that aren't encrypted.
+	Encryption *PasteEncryption `gorm:"serializer:json;type:jsonb" json:"encryption,omitempty"`
+	// Files of a multi-file paste in order. Content then mirrors the first file and isn't
+	// stored separately, ContentSize is the size of all files together.
+	Files       []PasteFile  `gorm:"foreignKey:PasteID" json:"files,omitempty"`
+	Attachments []Attachment `gorm:"foreignKey:PasteID" json:"attachments,omitempty"`
+	CreatorIP   string       `gorm:"type:varchar(45);index" json:"-"` // Only recorded for anonymous pastes, their quotas are per IP address
+	// CommentsDisabled stops new comments, set by the paste's owner
+	CommentsDisabled bool `gorm:"not null;default:false" json:"commentsDisabled,omitempty" example:"false"`
+	// Version counts the changes to the paste, clients send it back so they don't overwrite
+	// changes they haven't seen. It's also the paste's ETag.
+	Version uint64 `gorm:"not null;default:1" json:"version" example:"3"`
+	// DeletedAt is set while the paste is in the trash, queries skip it until it's restored
+	DeletedAt gorm.DeletedAt `gorm:"index" json:"-"`
+}
+
+// PasteEncryption describes how the client encrypted a paste so another client can decrypt
+// it. The key never reaches the server, it travels in the URL fragment.
+// @Description Cipher metadata for a client-side encrypted paste
+type PasteEncryption struct {
+	Algorithm      string `json:"algorithm" binding:"required,oneof=aes-256-gcm xchacha20-poly1305" example:"aes-256-gcm"`
+	IV             string `json:"iv" binding:"required,base64" example:"3q2+7wAAAAAAAAAA"`
+	KDF            string `json:"kdf,omitempty" binding:"omitempty,oneof=pbkdf2-sha256 argon2id" example:"pbkdf2-sha256"`
+	KDFSalt        string `json:"kdfSalt,omitempty" binding:"required_with=KDF,omitempty,base64" example:"c2FsdHNhbHRzYWx0"`
+	KDFIterations  int    `json:"kdfIterations,omitempty" binding:"required_with=KDF,omitempty,min=1" example:"600000"`
+	KDFMemoryKiB   int    `json:"kdfMemoryKiB,omitempty" binding:"omitempty,min=1" example:"65536"`
+	KDFParallelism int    `json:"kdfParallelism,omitempty" binding:"omitempty,min=1" example:"1"`
+}
+
+// IsEncrypted reports whether the paste's content is client-side ciphertext. Such content
+// must be stored and returned as-is, never logged, indexed or rendered.
+func (p *Paste) IsEncrypted() bool {
+	return p.Encryption != nil
 }
 
 type CreatePasteRequest struct {
-	Title           string    `json:"title" binding:"required"`
-	Content         string    `json:"content" binding:"required"`
+	Title   string `json:"title" binding:"required"`
+	Content string `json:"content" binding:"required_without_all=ContentHash Files,excluded_with=Files"`
+	// ContentHash reuses the content of a paste the caller can read instead of uploading it again
+	ContentHash     string    `json:"contentHash,omitempty" binding:"omitempty,len=64,hexadecimal,excluded_with=Files"`
 	SyntaxHighlight string    `json:"syntaxHighlight,omitempty" `
 	EditorType      string    `json:"editorType,omitempty" example:"code" binding:"oneof=code text"`
 	ExpiresAt       time.Time `json:"expiresAt,omitempty" example:"2023-01-08T00:00:00Z"`
-	Privacy         string    `json:"privacy" binding:"required,oneof=public private password"`
+	Privacy         string    `json:"privacy" binding:"required,oneof=public private password team"`
 	Password        string    `json:"password,omitempty" example:"mySecurePassword123"`
+	TeamID          *uint     `json:"teamId,omitempty" example:"1"`
+	// Encryption marks the content as ciphertext produced by the client
+	Encryption *PasteEncryption `json:"encryption,omitempty"`
+	UserID     string           `json:"-"` // Set from the authenticated caller, never from the body
+	ClientIP   string           `json:"-"` // Set from the request, anonymous quotas are per IP address
+	// ForkedFromID links a fork to its source, set by the service when forking
+	ForkedFromID *uint64 `json:"-"`
+	// Files makes a multi-file paste, in place of content
+	Files []PasteFileRequest `json:"files,omitempty" binding:"omitempty,max=50,dive"`
+	Tags  []string           `json:"tags,omitempty" binding:"omitempty,max=20,dive,max=50" example:"runbook,postgres"`
+	// FolderID puts the paste in a folder the caller may edit
+	FolderID *uint `json:"folderId,omitempty" example:"1"`
 }
 
 type UpdatePasteRequest struct {
-	Title           string    `json:"title" binding:"required"`
-	ID              uint64    `json:"id" binding:"required"`
-	Content         string    `json:"content" binding:"required"`
-	SyntaxHighlight string    `json:"syntaxHighlight,omitempty" `
-	EditorType      string    `json:"editorType,omitempty"`
-	ExpiresAt       time.Time `json:"expiresAt,omitempty" example:"2023-01-08T00:00:00Z"`
-	Privacy         string    `json:"privacy" binding:"required,oneof=public private password"`
-	Password        string    `json:"password,omitempty" example:"mySecurePassword123"`
+	Title           string `json:"title" binding:"required"`
+	ID              uint64 `json:"id" binding:"required"`
+	Content         string `json:"content" binding:"required_without=Files,excluded_with=Files"`
+	SyntaxHighlight string `json:"syntaxHighlight,omitempty" `
+	EditorType      string `json:"editorType,omitempty"`
+	// ExpiresAt replaces the expiry, leaving it out keeps it and the zero time removes it
+	ExpiresAt *time.Time `json:"expiresAt,omitempty" example:"2023-01-08T00:00:00Z"`
+	Privacy   string     `json:"privacy" binding:"required,oneof=public private password team"`
+	Password  string     `json:"password,omitempty" example:"mySecurePassword123"`
+	TeamID    *uint      `json:"teamId,omitempty" example:"1"`
+	// Encryption marks the content as ciphertext produced by the client
+	Encryption *PasteEncryption `json:"encryption,omitempty"`
+	UserID     string           `json:"-"` // Set from the authenticated caller, never from the body
+	// Files replaces the files of the paste, a paste updated with content becomes a single-file paste
+	Files []PasteFileRequest `json:"files,omitempty" binding:"omitempty,max=50,dive"`
+	// Tags replaces the paste's tags, leaving them out keeps them and an empty list removes them
+	Tags []string `json:"tags,omitempty" binding:"omitempty,max=20,dive,max=50" example:"runbook,postgres"`
+	// Version is the version of the paste the change was made to, unless sent in If-Match
+	Version uint64 `json:"version,omitempty" example:"3"`
+}
+
+// PastePatchDocument is what PATCH /paste/{id} applies a patch to: the fields of a paste
+// that can be changed, as they are. A paste without an expiry has a null expiresAt, single-file
+// pastes have content and multi-file pastes files.
+type PastePatchDocument struct {
+	Title           string             `json:"title" binding:"required,max=255" example:"My Code Snippet"`
+	Content         *string            `json:"content,omitempty" binding:"required_without=Files,excluded_with=Files" example:"console.log('Hello world');"`
+	Files           []PasteFileRequest `json:"files,omitempty" binding:"omitempty,min=1,max=50,dive"`
+	SyntaxHighlight string             `json:"syntaxHighlight" example:"javascript"`
+	EditorType      string             `json:"editorType" binding:"omitempty,oneof=code text" example:"code"`
+	ExpiresAt       *time.Time         `json:"expiresAt" example:"2023-01-08T00:00:00Z"`
+	Privacy         string             `json:"privacy" binding:"required,oneof=public private password team" example:"public"`
+	// Password sets a new password, the current one is never shown
+	Password   string           `json:"password,omitempty" example:"mySecurePassword123"`
+	TeamID     *uint            `json:"teamId" example:"1"`
+	Tags       []string         `json:"tags" binding:"max=20,dive,max=50" example:"runbook,postgres"`
+	Encryption *PasteEncryption `json:"encryption,omitempty"`
+	// Version is the version of the paste the patch was made to, unless sent in If-Match
+	Version uint64 `json:"version" example:"3"`
+}
+
+// PatchPasteRequest is a patch to a paste's PastePatchDocument
+type PatchPasteRequest struct {
+	Patch []byte
+	// JSONPatch marks an RFC 6902 JSON Patch, otherwise the patch is an RFC 7396 merge patch
+	JSONPatch bool
+	Version   uint64 // From If-Match, otherwise the patch must carry the version
+	UserID    string
 }
 
 type PasteListRequest struct {
@@ -0,0 +1,61 @@
+// models/share_link.go
+package models
+
+import "time"
+
+// ShareLink is a named, revocable link to a paste. Each link has its own access ID so
+// one can be rotated or revoked without touching the others.
+// @Description Named share link for a paste, resolved through /paste/private/{accessId}
+type ShareLink struct {
+	ID         uint       `json:"id" gorm:"primaryKey" example:"1"`
+	PasteID    uint64     `json:"pasteId" gorm:"index;not null" example:"123111"`
+	Name       string     `json:"name" gorm:"not null" example:"Shared with support"`
+	AccessID   string     `json:"accessId" gorm:"type:varchar(64);uniqueIndex;not null" example:"abc123xyz456"`
+	Permission string     `json:"permission" gorm:"type:varchar(10);not null" example:"view"`
+	MaxUses    int        `json:"maxUses" example:"10"` // 0 means unlimited
+	Uses       int        `json:"uses" example:"3"`
+	ExpiresAt  *time.Time `json:"expiresAt,omitempty" example:"2023-01-08T00:00:00Z"`
+	LastUsedAt *time.Time `json:"lastUsedAt,omitempty" example:"2023-01-02T00:00:00Z"`
+	CreatedBy  uint       `json:"createdBy" example:"1"`
+	CreatedAt  time.Time  `json:"createdAt" example:"2023-01-01T00:00:00Z"`
+}
+
+// CreateShareLinkRequest represents a request to create a share link
+type CreateShareLinkRequest struct {
+	Name       string     `json:"name" binding:"required,max=100" example:"Shared with support"`
+	Permission string     `json:"permission" binding:"required,oneof=view edit" example:"view"`
+	MaxUses    int        `json:"maxUses,omitempty" binding:"min=0" example:"10"`
+	ExpiresAt  *time.Time `json:"expiresAt,omitempty" example:"2023-01-08T00:00:00Z"`
+}
+
+// UpdateSharedPasteRequest edits a paste through a share link with edit rights. Link
+// holders can change the content but not the paste's privacy, password or expiry.
+type UpdateSharedPasteRequest struct {
+	Title           string `json:"title" binding:"required"`
+	Content         string `json:"content" binding:"required_without=Files,excluded_with=Files"`
+	SyntaxHighlight string `json:"syntaxHighlight,omitempty"`
+	EditorType      string `json:"editorType,omitempty" binding:"omitempty,oneof=code text"`
+	Password        string `json:"password,omitempty"` // The paste's password, when it has one
+	// Encryption carries the new cipher metadata when editing an encrypted paste
+	Encryption *PasteEncryption `json:"encryption,omitempty"`
+	// Files replaces the files of the paste, a paste updated with content becomes a single-file paste
+	Files []PasteFileRequest `json:"files,omitempty" binding:"omitempty,max=50,dive"`
+	// Version is the version of the paste the change was made to, unless sent in If-Match
+	Version uint64 `json:"version,omitempty" example:"3"`
+}
+
+// ShareLinkData represents the response data for a single share link
+type ShareLinkData struct {
+	ShareLink *ShareLink `json:"shareLink,omitempty"`
+}
+
+// ShareLinkListData represents the share links of a paste
+type ShareLinkListData struct {
+	ShareLinks []ShareLink `json:"shareLinks"`
+	Count      int         `json:"count"`
+}
+
+// TableName specifies the database table name for the ShareLink model
+func (ShareLink) TableName() string {
+	return "share_links"
+}
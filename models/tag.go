@@ -0,0 +1,27 @@
+package models
+
+// Tag is a label users put on pastes. Tag names are shared by everyone and normalised to
+// lower case, so the same topic gets the same tag.
+// @Description A tag on a paste
+type Tag struct {
+	ID   uint   `gorm:"primaryKey" json:"id" example:"1"`
+	Name string `gorm:"type:varchar(50);uniqueIndex;not null" json:"name" example:"runbook"`
+}
+
+// TableName specifies the database table name for the Tag model
+func (Tag) TableName() string {
+	return "tags"
+}
+
+// TagSuggestion is a tag offered for autocompletion along with how many pastes the caller
+// can see carry it
+// @Description Tag autocomplete suggestion
+type TagSuggestion struct {
+	Name  string `json:"name" example:"runbook"`
+	Count int64  `json:"count" example:"12"`
+}
+
+// TagSuggestionsData represents the response data for tag autocompletion
+type TagSuggestionsData struct {
+	Tags []TagSuggestion `json:"tags"`
+}
@@ -0,0 +1,128 @@
+// models/team.go
+package models
+
+import "time"
+
+// Team member roles. Owners manage the team, editors write team pastes and viewers read them.
+const (
+	TeamRoleOwner  = "owner"
+	TeamRoleEditor = "editor"
+	TeamRoleViewer = "viewer"
+)
+
+// PrivacyTeam makes a paste visible to every member of the team it belongs to
+const PrivacyTeam = "team"
+
+// Team represents an organisation whose members share pastes
+// @Description A team (organisation) that owns shared pastes
+type Team struct {
+	ID          uint      `json:"id" gorm:"primaryKey" example:"1"`
+	Name        string    `json:"name" gorm:"not null" example:"Platform Team"`
+	Description string    `json:"description,omitempty" example:"Runbooks and snippets for the platform team"`
+	CreatedAt   time.Time `json:"createdAt" example:"2023-01-01T00:00:00Z"`
+	UpdatedAt   time.Time `json:"updatedAt" example:"2023-01-01T00:00:00Z"`
+}
+
+// TeamMember links a user to a team with a role
+type TeamMember struct {
+	TeamID    uint      `json:"teamId" gorm:"primaryKey"`
+	UserID    uint      `json:"userId" gorm:"primaryKey;index"`
+	Role      string    `json:"role" gorm:"type:varchar(20);not null"`
+	CreatedAt time.Time `json:"joinedAt"`
+}
+
+// TeamInvite is a shareable link that adds whoever opens it to the team.
+// Only a hash of the invite token is stored.
+// @Description Team invitation link. The token itself is only returned once, at creation.
+type TeamInvite struct {
+	ID        uint       `json:"id" gorm:"primaryKey" example:"1"`
+	TeamID    uint       `json:"teamId" gorm:"index;not null" example:"1"`
+	Role      string     `json:"role" gorm:"type:varchar(20);not null" example:"editor"`
+	TokenHash string     `json:"-" gorm:"type:varchar(64);uniqueIndex;not null"`
+	CreatedBy uint       `json:"createdBy" example:"1"`
+	MaxUses   int        `json:"maxUses" example:"10"` // 0 means unlimited
+	Uses      int        `json:"uses" example:"3"`
+	ExpiresAt *time.Time `json:"expiresAt,omitempty" example:"2023-01-08T00:00:00Z"`
+	CreatedAt time.Time  `json:"createdAt" example:"2023-01-01T00:00:00Z"`
+}
+
+// TeamMemberResponse is a team member with their public user details
+type TeamMemberResponse struct {
+	UserID   uint      `json:"userId" example:"1"`
+	Name     string    `json:"name" example:"John Doe"`
+	Email    string    `json:"email" example:"john@example.com"`
+	Role     string    `json:"role" example:"editor"`
+	JoinedAt time.Time `json:"joinedAt" example:"2023-01-01T00:00:00Z"`
+}
+
+// CreateTeamRequest represents a request to create a team
+type CreateTeamRequest struct {
+	Name        string `json:"name" binding:"required,max=100" example:"Platform Team"`
+	Description string `json:"description,omitempty" binding:"max=500" example:"Runbooks and snippets for the platform team"`
+}
+
+// UpdateTeamRequest represents a request to rename or describe a team
+type UpdateTeamRequest struct {
+	Name        string `json:"name" binding:"required,max=100" example:"Platform Team"`
+	Description string `json:"description,omitempty" binding:"max=500" example:"Runbooks and snippets for the platform team"`
+}
+
+// UpdateTeamMemberRequest changes a member's role
+type UpdateTeamMemberRequest struct {
+	Role string `json:"role" binding:"required,oneof=owner editor viewer" example:"editor"`
+}
+
+// CreateTeamInviteRequest represents a request to create an invitation link
+type CreateTeamInviteRequest struct {
+	Role      string     `json:"role" binding:"required,oneof=owner editor viewer" example:"editor"`
+	MaxUses   int        `json:"maxUses,omitempty" binding:"min=0" example:"10"`
+	ExpiresAt *time.Time `json:"expiresAt,omitempty" example:"2023-01-08T00:00:00Z"`
+}
+
+// JoinTeamRequest accepts an invitation
+type JoinTeamRequest struct {
+	Token string `json:"token" binding:"required"`
+}
+
+// TeamData represents the response data for team endpoints
+// @Description Team response wrapper with the caller's role
+type TeamData struct {
+	Team    *Team                `json:"team,omitempty"`
+	Role    string               `json:"role,omitempty" example:"owner"`
+	Members []TeamMemberResponse `json:"members,omitempty"`
+}
+
+// TeamListData represents the teams the caller belongs to
+type TeamListData struct {
+	Teams []TeamData `json:"teams"`
+	Count int        `json:"count"`
+}
+
+// TeamInviteData represents the response data for invitation endpoints
+type TeamInviteData struct {
+	Invite *TeamInvite `json:"invite,omitempty"`
+	// Token and URL are only present in the create response
+	Token string `json:"token,omitempty"`
+	URL   string `json:"url,omitempty" example:"http://localhost:3000/teams/join?token=..."`
+}
+
+// TeamInviteListData represents a team's open invitations
+type TeamInviteListData struct {
+	Invites []TeamInvite `json:"invites"`
+	Count   int          `json:"count"`
+}
+
+// TableName specifies the database table name for the Team model
+func (Team) TableName() string {
+	return "teams"
+}
+
+// TableName specifies the database table name for the TeamMember model
+func (TeamMember) TableName() string {
+	return "team_members"
+}
+
+// TableName specifies the database table name for the TeamInvite model
+func (TeamInvite) TableName() string {
+	return "team_invites"
+}
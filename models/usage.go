@@ -0,0 +1,20 @@
+package models
+
+import "time"
+
+// Usage reports how much of their paste limits a user has used, limits of 0 mean unlimited
+// @Description Paste creation and storage usage against the caller's limits
+type Usage struct {
+	PastesToday       int64     `json:"pastesToday" example:"12"`
+	DailyPasteLimit   int       `json:"dailyPasteLimit" example:"1000"`
+	StorageBytes      int64     `json:"storageBytes" example:"52341"`
+	StorageQuotaBytes int64     `json:"storageQuotaBytes" example:"104857600"`
+	MaxPasteBytes     int       `json:"maxPasteBytes" example:"1048576"`
+	ResetsAt          time.Time `json:"resetsAt" example:"2024-01-02T00:00:00Z"` // When pastesToday starts over
+}
+
+// UsageData represents the response data for the usage endpoint
+// @Description Usage response wrapper
+type UsageData struct {
+	Usage *Usage `json:"usage"`
+}
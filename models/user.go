@@ -2,6 +2,8 @@
 package models
 
 import (
+	"time"
+
 	"golang.org/x/crypto/bcrypt"
 	"gorm.io/gorm"
 )
@@ -12,11 +14,47 @@ type User struct {
 	Name     string `json:"name" gorm:"not null" example:"John Doe" binding:"required" minLength:"2" maxLength:"100"`
 	Email    string `json:"email" gorm:"uniqueIndex;not null" example:"john@example.com" binding:"required,email"`
 	Password string `json:"password,omitempty" gorm:"not null" example:"strongpassword123" binding:"required,min=8" swaggertype:"string" format:"password"` // omitempty will exclude it from JSON responses
+
+	EmailVerified   bool       `json:"-" gorm:"default:false"`
+	EmailVerifiedAt *time.Time `json:"-"`
+
+	// Role is "user" or "admin". For SSO users it follows the identity provider's groups.
+	Role string `json:"-" gorm:"type:varchar(20);default:'user'"`
+
+	// Identity provider link for single sign-on users
+	OIDCIssuer  *string `json:"-" gorm:"column:oidc_issuer;uniqueIndex:idx_users_oidc_identity"`
+	OIDCSubject *string `json:"-" gorm:"column:oidc_subject;uniqueIndex:idx_users_oidc_identity"`
+
+	// Two-factor authentication state, never bound from or returned in JSON
+	TwoFactorEnabled bool   `json:"-" gorm:"default:false"`
+	TOTPSecret       string `json:"-" gorm:"column:totp_secret;type:varchar(64)"`
+	TOTPLastStep     int64  `json:"-" gorm:"column:totp_last_step;default:0"` // Last accepted TOTP time step, prevents code reuse
+
+	// Login challenge state, only the latest challenge is accepted and only once
+	TwoFactorChallengeID string    `json:"-" gorm:"column:two_factor_challenge_id;type:varchar(64)"`
+	TwoFactorFailures    int       `json:"-" gorm:"default:0"` // Wrong second factors since the last accepted one
+	TwoFactorLockedUntil time.Time `json:"-"`                  // No second factor is accepted before then
+}
+
+// User roles
+const (
+	RoleUser  = "user"
+	RoleAdmin = "admin"
+)
+
+// RecoveryCode is a single-use code that can stand in for a TOTP code.
+// Only the SHA-256 hash of the code is stored.
+type RecoveryCode struct {
+	ID        uint       `gorm:"primaryKey"`
+	UserID    uint       `gorm:"index;not null"`
+	CodeHash  string     `gorm:"type:varchar(64);uniqueIndex;not null"`
+	UsedAt    *time.Time `gorm:"index"`
+	CreatedAt time.Time
 }
 
 // BeforeSave hook to hash password before saving to database
 func (u *User) BeforeSave(tx *gorm.DB) error {
-	if u.Password != "" {
+	if u.Password != "" && !isBcryptHash(u.Password) {
 		hashedPassword, err := bcrypt.GenerateFromPassword([]byte(u.Password), bcrypt.DefaultCost)
 		if err != nil {
 			return err
@@ -26,18 +64,39 @@ func (u *User) BeforeSave(tx *gorm.DB) error {
 	return nil
 }
 
+// isBcryptHash reports whether the password is already hashed, so saving a loaded
+// user doesn't hash the hash
+func isBcryptHash(password string) bool {
+	_, err := bcrypt.Cost([]byte(password))
+	return err == nil
+}
+
+// UpdateUserRequest changes a user's profile, and their password when one is given
+type UpdateUserRequest struct {
+	Name            string `json:"name" binding:"required" example:"John Doe" minLength:"2" maxLength:"100"`
+	Email           string `json:"email" binding:"required,email" example:"john@example.com"`
+	Password        string `json:"password,omitempty" binding:"omitempty,min=8" example:"newstrongpassword123" format:"password"`
+	CurrentPassword string `json:"currentPassword,omitempty" example:"strongpassword123" format:"password"` // Required to change your own password
+}
+
 // For API responses, we want to exclude the password
 type UserResponse struct {
-	ID    uint   `json:"id"`
-	Name  string `json:"name"`
-	Email string `json:"email"`
+	ID               uint   `json:"id"`
+	Name             string `json:"name"`
+	Email            string `json:"email"`
+	EmailVerified    bool   `json:"emailVerified"`
+	TwoFactorEnabled bool   `json:"twoFactorEnabled"`
+	Role             string `json:"role"`
 }
 
 // ToResponse converts User to UserResponse
 func (u *User) ToResponse() UserResponse {
 	return UserResponse{
-		ID:    u.ID,
-		Name:  u.Name,
-		Email: u.Email,
+		ID:               u.ID,
+		Name:             u.Name,
+		Email:            u.Email,
+		EmailVerified:    u.EmailVerified,
+		TwoFactorEnabled: u.TwoFactorEnabled,
+		Role:             u.Role,
 	}
 }
@@ -0,0 +1,54 @@
+package repository
+
+import (
+	"context"
+	"memoria-backend/models"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type APITokenRepository interface {
+	Create(ctx context.Context, token *models.APIToken) (*models.APIToken, error)
+	GetByHash(ctx context.Context, tokenHash string) (*models.APIToken, error)
+	GetByUserID(ctx context.Context, userID uint) ([]models.APIToken, error)
+	Delete(ctx context.Context, userID uint, id uint) (bool, error)
+	UpdateLastUsed(ctx context.Context, id uint, lastUsedAt time.Time) error
+}
+
+type apiTokenRepository struct {
+	db *gorm.DB
+}
+
+func NewAPITokenRepository(db *gorm.DB) APITokenRepository {
+	return &apiTokenRepository{
+		db: db,
+	}
+}
+
+func (r *apiTokenRepository) Create(ctx context.Context, token *models.APIToken) (*models.APIToken, error) {
+	result := r.db.Create(token)
+	return token, result.Error
+}
+
+func (r *apiTokenRepository) GetByHash(ctx context.Context, tokenHash string) (*models.APIToken, error) {
+	var token models.APIToken
+	result := r.db.Where("token_hash = ?", tokenHash).First(&token)
+	return &token, result.Error
+}
+
+func (r *apiTokenRepository) GetByUserID(ctx context.Context, userID uint) ([]models.APIToken, error) {
+	var tokens []models.APIToken
+	result := r.db.Where("user_id = ?", userID).Order("created_at DESC").Find(&tokens)
+	return tokens, result.Error
+}
+
+// Delete removes a token owned by the user. It reports false when no such token exists.
+func (r *apiTokenRepository) Delete(ctx context.Context, userID uint, id uint) (bool, error) {
+	result := r.db.Where("id = ? AND user_id = ?", id, userID).Delete(&models.APIToken{})
+	return result.RowsAffected == 1, result.Error
+}
+
+func (r *apiTokenRepository) UpdateLastUsed(ctx context.Context, id uint, lastUsedAt time.Time) error {
+	return r.db.Model(&models.APIToken{}).Where("id = ?", id).UpdateColumn("last_used_at", lastUsedAt).Error
+}
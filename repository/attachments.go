@@ -0,0 +1,87 @@
+package repository
+
+import (
+	"context"
+	"io"
+	"memoria-backend/models"
+
+	"gorm.io/gorm"
+)
+
+type AttachmentRepository interface {
+	Create(ctx context.Context, paste *models.Paste, attachment *models.Attachment, data []byte, thumbnail []byte) error
+	Open(ctx context.Context, hash string) (io.ReadCloser, int64, error)
+	Delete(ctx context.Context, attachment *models.Attachment) error
+}
+
+// attachmentRepository keeps attachment data and thumbnails as content blobs, so they are
+// deduplicated, compressed and encrypted at rest the same way as paste content
+type attachmentRepository struct {
+	*pasteRepository
+}
+
+func NewAttachmentRepository(db *gorm.DB, storage PasteStorage) AttachmentRepository {
+	return &attachmentRepository{
+		pasteRepository: &pasteRepository{db: db, storage: storage},
+	}
+}
+
+// Create stores the data and thumbnail of a new attachment to the paste. Attachments are
+// encrypted at rest whenever the paste's content would be.
+func (r *attachmentRepository) Create(ctx context.Context, paste *models.Paste, attachment *models.Attachment, data []byte, thumbnail []byte) error {
+	if r.storage.Store == nil {
+		return ErrNoContentStore
+	}
+	encrypt := r.shouldEncrypt(paste)
+	keyHash := r.shouldKeyHash(paste)
+
+	var acquired []string
+	blobs := map[*string][]byte{&attachment.ContentHash: data}
+	if thumbnail != nil {
+		blobs[&attachment.ThumbnailHash] = thumbnail
+	}
+	for hash, content := range blobs {
+		*hash = r.contentHash(content, keyHash)
+		if err := r.acquireBlob(ctx, *hash, content, encrypt); err != nil {
+			r.releaseBlobs(ctx, acquired)
+			return err
+		}
+		acquired = append(acquired, *hash)
+	}
+
+	attachment.PasteID = paste.ID
+	attachment.Size = int64(len(data))
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(attachment).Error; err != nil {
+			return err
+		}
+		return bumpVersion(tx, paste.ID)
+	})
+	if err != nil {
+		r.releaseBlobs(ctx, acquired)
+		return err
+	}
+	return nil
+}
+
+// Open opens a reader over the plaintext of an attachment's data or thumbnail
+func (r *attachmentRepository) Open(ctx context.Context, hash string) (io.ReadCloser, int64, error) {
+	return r.openBlob(ctx, hash)
+}
+
+func (r *attachmentRepository) Delete(ctx context.Context, attachment *models.Attachment) error {
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Delete(&models.Attachment{}, attachment.ID).Error; err != nil {
+			return err
+		}
+		return bumpVersion(tx, attachment.PasteID)
+	})
+	if err != nil {
+		return err
+	}
+	r.releaseBlob(ctx, attachment.ContentHash)
+	if attachment.ThumbnailHash != "" {
+		r.releaseBlob(ctx, attachment.ThumbnailHash)
+	}
+	return nil
+}
@@ -0,0 +1,249 @@
+package repository
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"memoria-backend/models"
+	"memoria-backend/utils"
+
+	"github.com/klauspost/compress/zstd"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Compression algorithms for content blobs
+const (
+	CompressionNone = "none"
+	CompressionZstd = "zstd"
+	CompressionGzip = "gzip"
+)
+
+// acquireBlob adds a reference to the blob holding content, storing the content first when no
+// paste refers to it yet. A blob keeps the compression and encryption it was first stored with.
+func (r *pasteRepository) acquireBlob(ctx context.Context, hash string, content []byte, encrypt bool) error {
+	result := r.db.Model(&models.ContentBlob{}).
+		Where("hash = ?", hash).
+		UpdateColumn("ref_count", gorm.Expr("ref_count + 1"))
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 1 {
+		return nil
+	}
+
+	blob := &models.ContentBlob{Hash: hash, Size: int64(len(content)), RefCount: 1}
+	stored := content
+
+	if r.storage.Compression != "" && r.storage.Compression != CompressionNone && len(content) >= r.storage.CompressMinBytes {
+		compressed, err := compress(r.storage.Compression, content)
+		if err != nil {
+			return err
+		}
+		// Already compressed data can grow, keep whichever is smaller
+		if len(compressed) < len(content) {
+			stored = compressed
+			blob.Compression = r.storage.Compression
+		}
+	}
+
+	if encrypt {
+		ciphertext, wrappedKey, keyID, err := r.storage.Keyring.Encrypt(stored)
+		if err != nil {
+			return err
+		}
+		stored = ciphertext
+		blob.DataKey = base64.StdEncoding.EncodeToString(wrappedKey)
+		blob.DataKeyID = keyID
+	}
+
+	blob.StoreKey = ContentHash(stored)
+	blob.StoredSize = int64(len(stored))
+	if err := r.storage.Store.Put(ctx, blob.StoreKey, stored); err != nil {
+		return err
+	}
+
+	result = r.db.Clauses(clause.OnConflict{DoNothing: true}).Create(blob)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 1 {
+		return nil
+	}
+
+	// Someone else stored the same content in the meantime, refer to theirs instead
+	var existing models.ContentBlob
+	if err := r.db.Where("hash = ?", hash).First(&existing).Error; err == nil && existing.StoreKey != blob.StoreKey {
+		if err := r.storage.Store.Delete(ctx, blob.StoreKey); err != nil {
+			log := utils.LoggerFromContext(ctx)
+			log.Error().Err(err).Str("storeKey", blob.StoreKey).Msg("Failed to delete duplicate stored content")
+		}
+	}
+	return r.acquireBlob(ctx, hash, content, encrypt)
+}
+
+// releaseBlob drops a reference to a blob and deletes it once no paste refers to it anymore.
+// Failures only leave an orphaned blob behind, so they're logged instead of failing the write.
+func (r *pasteRepository) releaseBlob(ctx context.Context, hash string) {
+	log := utils.LoggerFromContext(ctx)
+
+	for {
+		var blob models.ContentBlob
+		if err := r.db.Where("hash = ?", hash).First(&blob).Error; err != nil {
+			if !errors.Is(err, gorm.ErrRecordNotFound) {
+				log.Error().Err(err).Str("contentHash", hash).Msg("Failed to load content blob")
+			}
+			return
+		}
+
+		// Last reference, remove the blob along with its stored content
+		result := r.db.Where("hash = ? AND ref_count <= 1", hash).Delete(&models.ContentBlob{})
+		if result.Error != nil {
+			log.Error().Err(result.Error).Str("contentHash", hash).Msg("Failed to delete content blob")
+			return
+		}
+		if result.RowsAffected == 1 {
+			if err := r.storage.Store.Delete(ctx, blob.StoreKey); err != nil {
+				log.Error().Err(err).Str("storeKey", blob.StoreKey).Msg("Failed to delete stored content")
+			}
+			return
+		}
+
+		result = r.db.Model(&models.ContentBlob{}).
+			Where("hash = ? AND ref_count > 1", hash).
+			UpdateColumn("ref_count", gorm.Expr("ref_count - 1"))
+		if result.Error != nil {
+			log.Error().Err(result.Error).Str("contentHash", hash).Msg("Failed to release content blob")
+			return
+		}
+		if result.RowsAffected == 1 {
+			return
+		}
+		// The reference count changed between the two statements, look again
+	}
+}
+
+// openBlob opens a reader over the plaintext of a blob and returns its length. Unencrypted
+// blobs are streamed from the content store, encrypted ones are decrypted in memory first.
+func (r *pasteRepository) openBlob(ctx context.Context, hash string) (io.ReadCloser, int64, error) {
+	if r.storage.Store == nil {
+		return nil, 0, ErrNoContentStore
+	}
+
+	var blob models.ContentBlob
+	if err := r.db.Where("hash = ?", hash).First(&blob).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, 0, ErrContentNotFound
+		}
+		return nil, 0, err
+	}
+
+	reader, err := r.storage.Store.Get(ctx, blob.StoreKey)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	if blob.DataKey != "" {
+		defer reader.Close()
+		if r.storage.Keyring == nil {
+			return nil, 0, ErrNoKeyring
+		}
+		ciphertext, err := io.ReadAll(reader)
+		if err != nil {
+			return nil, 0, err
+		}
+		wrappedKey, err := base64.StdEncoding.DecodeString(blob.DataKey)
+		if err != nil {
+			return nil, 0, err
+		}
+		plaintext, err := r.storage.Keyring.Decrypt(ciphertext, wrappedKey, blob.DataKeyID)
+		if err != nil {
+			return nil, 0, err
+		}
+		reader = io.NopCloser(bytes.NewReader(plaintext))
+	}
+
+	decompressed, err := decompress(blob.Compression, reader)
+	if err != nil {
+		reader.Close()
+		return nil, 0, err
+	}
+	return decompressed, blob.Size, nil
+}
+
+// readBlob returns the whole plaintext of a blob
+func (r *pasteRepository) readBlob(ctx context.Context, hash string) (string, error) {
+	reader, _, err := r.openBlob(ctx, hash)
+	if err != nil {
+		return "", err
+	}
+	defer reader.Close()
+
+	content, err := io.ReadAll(reader)
+	return string(content), err
+}
+
+func compress(algorithm string, content []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	switch algorithm {
+	case CompressionZstd:
+		encoder, err := zstd.NewWriter(&buf)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := encoder.Write(content); err != nil {
+			encoder.Close()
+			return nil, err
+		}
+		if err := encoder.Close(); err != nil {
+			return nil, err
+		}
+	case CompressionGzip:
+		writer := gzip.NewWriter(&buf)
+		if _, err := writer.Write(content); err != nil {
+			writer.Close()
+			return nil, err
+		}
+		if err := writer.Close(); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("unknown compression %q", algorithm)
+	}
+	return buf.Bytes(), nil
+}
+
+// decompress wraps reader so it yields the uncompressed content. Closing the result closes reader.
+func decompress(algorithm string, reader io.ReadCloser) (io.ReadCloser, error) {
+	switch algorithm {
+	case "":
+		return reader, nil
+	case CompressionZstd:
+		decoder, err := zstd.NewReader(reader)
+		if err != nil {
+			return nil, err
+		}
+		return &decompressingReader{Reader: decoder, close: func() error { decoder.Close(); return reader.Close() }}, nil
+	case CompressionGzip:
+		gz, err := gzip.NewReader(reader)
+		if err != nil {
+			return nil, err
+		}
+		return &decompressingReader{Reader: gz, close: func() error { gz.Close(); return reader.Close() }}, nil
+	default:
+		return nil, fmt.Errorf("unknown compression %q", algorithm)
+	}
+}
+
+type decompressingReader struct {
+	io.Reader
+	close func() error
+}
+
+func (d *decompressingReader) Close() error {
+	return d.close()
+}
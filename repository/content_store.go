@@ -0,0 +1,154 @@
+package repository
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"memoria-backend/models"
+	"os"
+	"path/filepath"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	ErrContentNotFound    = errors.New("content not found in content store")
+	ErrInvalidContentHash = errors.New("content store keys must be hex SHA-256 hashes")
+)
+
+// ContentStore keeps paste content outside the pastes table, addressed by the SHA-256 of
+// the content. Storing the same content twice is a no-op.
+type ContentStore interface {
+	Put(ctx context.Context, hash string, content []byte) error
+	Get(ctx context.Context, hash string) (io.ReadCloser, error)
+	Delete(ctx context.Context, hash string) error
+}
+
+// ContentHash returns the key content is stored under
+func ContentHash(content []byte) string {
+	sum := sha256.Sum256(content)
+	return hex.EncodeToString(sum[:])
+}
+
+// isContentHash reports whether hash looks like a hex SHA-256, anything else never names content.
+// Every store checks it, those that build paths or object keys from the hash rely on it.
+func isContentHash(hash string) bool {
+	if len(hash) != sha256.Size*2 {
+		return false
+	}
+	_, err := hex.DecodeString(hash)
+	return err == nil
+}
+
+// dbContentStore keeps content in the paste_contents table of the main database
+type dbContentStore struct {
+	db *gorm.DB
+}
+
+func NewDBContentStore(db *gorm.DB) ContentStore {
+	return &dbContentStore{
+		db: db,
+	}
+}
+
+func (s *dbContentStore) Put(ctx context.Context, hash string, content []byte) error {
+	if !isContentHash(hash) {
+		return ErrInvalidContentHash
+	}
+	return s.db.Clauses(clause.OnConflict{DoNothing: true}).
+		Create(&models.PasteContent{Hash: hash, Data: content}).Error
+}
+
+func (s *dbContentStore) Get(ctx context.Context, hash string) (io.ReadCloser, error) {
+	if !isContentHash(hash) {
+		return nil, ErrContentNotFound
+	}
+	var content models.PasteContent
+	if err := s.db.Where("hash = ?", hash).First(&content).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrContentNotFound
+		}
+		return nil, err
+	}
+	return io.NopCloser(bytes.NewReader(content.Data)), nil
+}
+
+func (s *dbContentStore) Delete(ctx context.Context, hash string) error {
+	if !isContentHash(hash) {
+		return nil
+	}
+	return s.db.Where("hash = ?", hash).Delete(&models.PasteContent{}).Error
+}
+
+// fsContentStore keeps content as files below dir, sharded by the first two hash characters
+type fsContentStore struct {
+	dir string
+}
+
+func NewFSContentStore(dir string) (ContentStore, error) {
+	if err := os.MkdirAll(dir, 0o750); err != nil {
+		return nil, err
+	}
+	return &fsContentStore{
+		dir: dir,
+	}, nil
+}
+
+func (s *fsContentStore) path(hash string) string {
+	return filepath.Join(s.dir, hash[:2], hash)
+}
+
+func (s *fsContentStore) Put(ctx context.Context, hash string, content []byte) error {
+	if !isContentHash(hash) {
+		return ErrInvalidContentHash
+	}
+	path := s.path(hash)
+	if _, err := os.Stat(path); err == nil {
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o750); err != nil {
+		return err
+	}
+
+	// Write to a temporary file first so readers never see partial content
+	tmp, err := os.CreateTemp(filepath.Dir(path), hash+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(content); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+func (s *fsContentStore) Get(ctx context.Context, hash string) (io.ReadCloser, error) {
+	if !isContentHash(hash) {
+		return nil, ErrContentNotFound
+	}
+	file, err := os.Open(s.path(hash))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrContentNotFound
+	}
+	return file, err
+}
+
+func (s *fsContentStore) Delete(ctx context.Context, hash string) error {
+	if !isContentHash(hash) {
+		return nil
+	}
+	err := os.Remove(s.path(hash))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	return err
+}
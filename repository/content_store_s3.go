@@ -0,0 +1,79 @@
+package repository
+
+import (
+	"bytes"
+	"context"
+	"io"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+)
+
+// S3Options configures the S3-compatible content store
+type S3Options struct {
+	Endpoint  string
+	Region    string
+	Bucket    string
+	Prefix    string
+	AccessKey string
+	SecretKey string
+	UseSSL    bool
+}
+
+// s3ContentStore keeps content as objects in an S3-compatible bucket
+type s3ContentStore struct {
+	client *minio.Client
+	bucket string
+	prefix string
+}
+
+func NewS3ContentStore(opts S3Options) (ContentStore, error) {
+	client, err := minio.New(opts.Endpoint, &minio.Options{
+		Creds:  credentials.NewStaticV4(opts.AccessKey, opts.SecretKey, ""),
+		Secure: opts.UseSSL,
+		Region: opts.Region,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &s3ContentStore{
+		client: client,
+		bucket: opts.Bucket,
+		prefix: opts.Prefix,
+	}, nil
+}
+
+func (s *s3ContentStore) Put(ctx context.Context, hash string, content []byte) error {
+	if !isContentHash(hash) {
+		return ErrInvalidContentHash
+	}
+	_, err := s.client.PutObject(ctx, s.bucket, s.prefix+hash, bytes.NewReader(content), int64(len(content)),
+		minio.PutObjectOptions{ContentType: "application/octet-stream"})
+	return err
+}
+
+func (s *s3ContentStore) Get(ctx context.Context, hash string) (io.ReadCloser, error) {
+	if !isContentHash(hash) {
+		return nil, ErrContentNotFound
+	}
+	// GetObject is lazy, stat first so a missing object fails here instead of mid-stream
+	object, err := s.client.GetObject(ctx, s.bucket, s.prefix+hash, minio.GetObjectOptions{})
+	if err != nil {
+		return nil, err
+	}
+	if _, err := object.Stat(); err != nil {
+		object.Close()
+		if minio.ToErrorResponse(err).Code == "NoSuchKey" {
+			return nil, ErrContentNotFound
+		}
+		return nil, err
+	}
+	return object, nil
+}
+
+func (s *s3ContentStore) Delete(ctx context.Context, hash string) error {
+	if !isContentHash(hash) {
+		return nil
+	}
+	return s.client.RemoveObject(ctx, s.bucket, s.prefix+hash, minio.RemoveObjectOptions{})
+}
@@ -0,0 +1,224 @@
+package repository
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"memoria-backend/models"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// testS3Server is an in-memory stand-in for the object API of an S3-compatible server
+type testS3Server struct {
+	lock    sync.Mutex
+	objects map[string][]byte
+}
+
+func (s *testS3Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	key := strings.TrimPrefix(r.URL.Path, "/")
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	switch r.Method {
+	case http.MethodPut:
+		body, err := readS3Body(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		s.objects[key] = body
+		sum := md5.Sum(body)
+		w.Header().Set("ETag", `"`+hex.EncodeToString(sum[:])+`"`)
+	case http.MethodGet, http.MethodHead:
+		object, ok := s.objects[key]
+		if !ok {
+			w.Header().Set("Content-Type", "application/xml")
+			w.WriteHeader(http.StatusNotFound)
+			if r.Method == http.MethodGet {
+				fmt.Fprintf(w, `<Error><Code>NoSuchKey</Code><Message>The specified key does not exist.</Message><Key>%s</Key></Error>`, key)
+			}
+			return
+		}
+		sum := md5.Sum(object)
+		w.Header().Set("ETag", `"`+hex.EncodeToString(sum[:])+`"`)
+		w.Header().Set("Content-Length", fmt.Sprint(len(object)))
+		w.Header().Set("Last-Modified", "Mon, 19 Oct 2026 00:00:00 GMT")
+		if r.Method == http.MethodGet {
+			w.Write(object)
+		}
+	case http.MethodDelete:
+		delete(s.objects, key)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+// readS3Body reads an upload, decoding the chunks of a streaming upload
+func readS3Body(r *http.Request) ([]byte, error) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil || !strings.HasPrefix(r.Header.Get("X-Amz-Content-Sha256"), "STREAMING-") {
+		return body, err
+	}
+
+	var decoded []byte
+	for {
+		header, rest, ok := strings.Cut(string(body), "\r\n")
+		if !ok {
+			return nil, fmt.Errorf("truncated chunk")
+		}
+		size, _, _ := strings.Cut(header, ";")
+		var n int
+		if _, err := fmt.Sscanf(size, "%x", &n); err != nil {
+			return nil, err
+		}
+		if n == 0 {
+			return decoded, nil
+		}
+		decoded = append(decoded, rest[:n]...)
+		body = []byte(strings.TrimPrefix(rest[n:], "\r\n"))
+	}
+}
+
+func newTestDBContentStore(t *testing.T) ContentStore {
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "memoria.db")), &gorm.Config{Logger: logger.Discard})
+	require.NoError(t, err)
+	require.NoError(t, db.AutoMigrate(&models.PasteContent{}))
+	return NewDBContentStore(db)
+}
+
+func newTestFSContentStore(t *testing.T) ContentStore {
+	store, err := NewFSContentStore(filepath.Join(t.TempDir(), "content"))
+	require.NoError(t, err)
+	return store
+}
+
+func newTestS3ContentStore(t *testing.T) ContentStore {
+	server := httptest.NewServer(&testS3Server{objects: map[string][]byte{}})
+	t.Cleanup(server.Close)
+
+	endpoint, err := url.Parse(server.URL)
+	require.NoError(t, err)
+	store, err := NewS3ContentStore(S3Options{
+		Endpoint:  endpoint.Host,
+		Region:    "us-east-1",
+		Bucket:    "memoria",
+		Prefix:    "pastes/",
+		AccessKey: "access-key",
+		SecretKey: "secret-key",
+	})
+	require.NoError(t, err)
+	return store
+}
+
+func readContent(t *testing.T, store ContentStore, hash string) []byte {
+	reader, err := store.Get(context.Background(), hash)
+	require.NoError(t, err)
+	defer reader.Close()
+	content, err := io.ReadAll(reader)
+	require.NoError(t, err)
+	return content
+}
+
+func TestContentStores(t *testing.T) {
+	stores := map[string]func(t *testing.T) ContentStore{
+		"database": newTestDBContentStore,
+		"fs":       newTestFSContentStore,
+		"s3":       newTestS3ContentStore,
+	}
+
+	for name, newStore := range stores {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			store := newStore(t)
+			content := []byte("SELECT * FROM pastes;\n")
+			hash := ContentHash(content)
+
+			_, err := store.Get(ctx, hash)
+			assert.ErrorIs(t, err, ErrContentNotFound)
+
+			require.NoError(t, store.Put(ctx, hash, content))
+			assert.Equal(t, content, readContent(t, store, hash))
+
+			// Content is addressed by its hash, storing it again changes nothing
+			require.NoError(t, store.Put(ctx, hash, content))
+			assert.Equal(t, content, readContent(t, store, hash))
+
+			empty := ContentHash([]byte{})
+			require.NoError(t, store.Put(ctx, empty, []byte{}))
+			assert.Empty(t, readContent(t, store, empty))
+
+			require.NoError(t, store.Delete(ctx, hash))
+			_, err = store.Get(ctx, hash)
+			assert.ErrorIs(t, err, ErrContentNotFound)
+			assert.Empty(t, readContent(t, store, empty))
+
+			// Deleting what isn't there is not an error, releases may race
+			assert.NoError(t, store.Delete(ctx, hash))
+		})
+	}
+}
+
+func TestContentStoresRejectInvalidHashes(t *testing.T) {
+	stores := map[string]func(t *testing.T) ContentStore{
+		"database": newTestDBContentStore,
+		"fs":       newTestFSContentStore,
+		"s3":       newTestS3ContentStore,
+	}
+	invalid := []string{
+		"",
+		"ab",
+		"../../../../etc/passwd",
+		strings.Repeat("z", 64),
+		strings.Repeat("a", 63),
+		strings.Repeat("a", 62) + "/.",
+		ContentHash([]byte("content")) + "0",
+	}
+
+	for name, newStore := range stores {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			store := newStore(t)
+			for _, hash := range invalid {
+				assert.ErrorIs(t, store.Put(ctx, hash, []byte("content")), ErrInvalidContentHash, "put %q", hash)
+				_, err := store.Get(ctx, hash)
+				assert.ErrorIs(t, err, ErrContentNotFound, "get %q", hash)
+				assert.NoError(t, store.Delete(ctx, hash), "delete %q", hash)
+			}
+		})
+	}
+}
+
+func TestFSContentStoreLayout(t *testing.T) {
+	ctx := context.Background()
+	dir := filepath.Join(t.TempDir(), "content")
+	store, err := NewFSContentStore(dir)
+	require.NoError(t, err)
+
+	content := []byte("sharded")
+	hash := ContentHash(content)
+	require.NoError(t, store.Put(ctx, hash, content))
+
+	// Files are sharded by the first two hash characters and no temporary files are left
+	entries, err := os.ReadDir(filepath.Join(dir, hash[:2]))
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	assert.Equal(t, hash, entries[0].Name())
+}
@@ -0,0 +1,85 @@
+package repository
+
+import (
+	"context"
+	"memoria-backend/models"
+
+	"gorm.io/gorm"
+)
+
+type FolderRepository interface {
+	Create(ctx context.Context, folder *models.Folder) (*models.Folder, error)
+	GetByID(ctx context.Context, id uint) (*models.Folder, error)
+	GetByIDs(ctx context.Context, ids []uint) ([]models.Folder, error)
+	GetByOwner(ctx context.Context, userID uint, teamIDs []uint) ([]models.Folder, error)
+	GetChildren(ctx context.Context, parentID uint) ([]models.Folder, error)
+	Update(ctx context.Context, folder *models.Folder) (*models.Folder, error)
+	Delete(ctx context.Context, folder *models.Folder) error
+}
+
+type folderRepository struct {
+	db *gorm.DB
+}
+
+func NewFolderRepository(db *gorm.DB) FolderRepository {
+	return &folderRepository{
+		db: db,
+	}
+}
+
+func (r *folderRepository) Create(ctx context.Context, folder *models.Folder) (*models.Folder, error) {
+	result := r.db.Create(folder)
+	return folder, result.Error
+}
+
+func (r *folderRepository) GetByID(ctx context.Context, id uint) (*models.Folder, error) {
+	var folder models.Folder
+	result := r.db.First(&folder, id)
+	return &folder, result.Error
+}
+
+// GetByIDs returns those of the folders that exist
+func (r *folderRepository) GetByIDs(ctx context.Context, ids []uint) ([]models.Folder, error) {
+	var folders []models.Folder
+	if len(ids) == 0 {
+		return folders, nil
+	}
+	result := r.db.Where("id IN ?", ids).Find(&folders)
+	return folders, result.Error
+}
+
+// GetByOwner returns the personal folders of the user and the folders of the given teams
+func (r *folderRepository) GetByOwner(ctx context.Context, userID uint, teamIDs []uint) ([]models.Folder, error) {
+	var folders []models.Folder
+	query := r.db.Where("user_id = ? AND team_id IS NULL", userID)
+	if len(teamIDs) > 0 {
+		query = query.Or("team_id IN ?", teamIDs)
+	}
+	result := query.Order("name").Find(&folders)
+	return folders, result.Error
+}
+
+func (r *folderRepository) GetChildren(ctx context.Context, parentID uint) ([]models.Folder, error) {
+	var folders []models.Folder
+	result := r.db.Where("parent_id = ?", parentID).Order("name").Find(&folders)
+	return folders, result.Error
+}
+
+func (r *folderRepository) Update(ctx context.Context, folder *models.Folder) (*models.Folder, error) {
+	result := r.db.Save(folder)
+	return folder, result.Error
+}
+
+// Delete removes the folder and moves its subfolders and pastes up into its parent
+func (r *folderRepository) Delete(ctx context.Context, folder *models.Folder) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.Folder{}).Where("parent_id = ?", folder.ID).UpdateColumn("parent_id", folder.ParentID).Error; err != nil {
+			return err
+		}
+		// Pastes in the trash too, so they aren't restored into a folder that's gone
+		if err := tx.Unscoped().Model(&models.Paste{}).Where("folder_id = ?", folder.ID).UpdateColumn("folder_id", folder.ParentID).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&models.Folder{}, folder.ID).Error
+	})
+}
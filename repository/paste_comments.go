@@ -0,0 +1,95 @@
+package repository
+
+import (
+	"context"
+	"memoria-backend/models"
+
+	"gorm.io/gorm"
+)
+
+type PasteCommentRepository interface {
+	GetByPasteID(ctx context.Context, pasteID uint64) ([]models.PasteComment, error)
+	GetByID(ctx context.Context, pasteID uint64, id uint) (*models.PasteComment, error)
+	GetAnchored(ctx context.Context, pasteID uint64) ([]models.PasteComment, error)
+	Create(ctx context.Context, comment *models.PasteComment) (*models.PasteComment, error)
+	Update(ctx context.Context, comment *models.PasteComment) (*models.PasteComment, error)
+	UpdateAnchors(ctx context.Context, comments []models.PasteComment) error
+	Delete(ctx context.Context, pasteID uint64, id uint) (bool, error)
+}
+
+type pasteCommentRepository struct {
+	db *gorm.DB
+}
+
+func NewPasteCommentRepository(db *gorm.DB) PasteCommentRepository {
+	return &pasteCommentRepository{
+		db: db,
+	}
+}
+
+// GetByPasteID returns the comments on a paste and their replies, oldest first
+func (r *pasteCommentRepository) GetByPasteID(ctx context.Context, pasteID uint64) ([]models.PasteComment, error) {
+	var comments []models.PasteComment
+	result := r.db.Where("paste_id = ?", pasteID).Order("created_at, id").Find(&comments)
+	return comments, result.Error
+}
+
+func (r *pasteCommentRepository) GetByID(ctx context.Context, pasteID uint64, id uint) (*models.PasteComment, error) {
+	var comment models.PasteComment
+	if err := r.db.Where("id = ? AND paste_id = ?", id, pasteID).First(&comment).Error; err != nil {
+		return nil, err
+	}
+	return &comment, nil
+}
+
+// GetAnchored returns the comments on lines of a paste that still point at their lines
+func (r *pasteCommentRepository) GetAnchored(ctx context.Context, pasteID uint64) ([]models.PasteComment, error) {
+	var comments []models.PasteComment
+	result := r.db.
+		Where("paste_id = ? AND parent_id IS NULL AND start_line > 0 AND outdated = ?", pasteID, false).
+		Find(&comments)
+	return comments, result.Error
+}
+
+func (r *pasteCommentRepository) Create(ctx context.Context, comment *models.PasteComment) (*models.PasteComment, error) {
+	result := r.db.Create(comment)
+	return comment, result.Error
+}
+
+func (r *pasteCommentRepository) Update(ctx context.Context, comment *models.PasteComment) (*models.PasteComment, error) {
+	result := r.db.Save(comment)
+	return comment, result.Error
+}
+
+// UpdateAnchors stores where the comments' lines moved to, or that they're outdated
+func (r *pasteCommentRepository) UpdateAnchors(ctx context.Context, comments []models.PasteComment) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		for _, comment := range comments {
+			err := tx.Model(&models.PasteComment{}).Where("id = ?", comment.ID).UpdateColumns(map[string]interface{}{
+				"start_line":   comment.StartLine,
+				"end_line":     comment.EndLine,
+				"content_hash": comment.ContentHash,
+				"outdated":     comment.Outdated,
+			}).Error
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// Delete removes a comment from the paste along with its replies. It reports false when no
+// such comment exists.
+func (r *pasteCommentRepository) Delete(ctx context.Context, pasteID uint64, id uint) (bool, error) {
+	var deleted bool
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Where("id = ? AND paste_id = ?", id, pasteID).Delete(&models.PasteComment{})
+		if result.Error != nil || result.RowsAffected == 0 {
+			return result.Error
+		}
+		deleted = true
+		return tx.Where("parent_id = ?", id).Delete(&models.PasteComment{}).Error
+	})
+	return deleted, err
+}
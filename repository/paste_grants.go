@@ -0,0 +1,106 @@
+package repository
+
+import (
+	"context"
+	"memoria-backend/models"
+
+	"gorm.io/gorm"
+)
+
+type PasteGrantRepository interface {
+	GetByPasteID(ctx context.Context, pasteID uint64) ([]models.PasteGrant, error)
+	GetForUser(ctx context.Context, pasteID uint64, userID uint, teamIDs []uint) ([]models.PasteGrant, error)
+	GetForUserOnPastes(ctx context.Context, pasteIDs []uint64, userID uint, teamIDs []uint) ([]models.PasteGrant, error)
+	GetSharedWithUser(ctx context.Context, userID uint, teamIDs []uint) ([]models.PasteGrant, error)
+	Save(ctx context.Context, grant *models.PasteGrant) (*models.PasteGrant, error)
+	Delete(ctx context.Context, pasteID uint64, id uint) (bool, error)
+}
+
+type pasteGrantRepository struct {
+	db *gorm.DB
+}
+
+func NewPasteGrantRepository(db *gorm.DB) PasteGrantRepository {
+	return &pasteGrantRepository{
+		db: db,
+	}
+}
+
+func (r *pasteGrantRepository) GetByPasteID(ctx context.Context, pasteID uint64) ([]models.PasteGrant, error) {
+	var grants []models.PasteGrant
+	result := r.db.Where("paste_id = ?", pasteID).Order("created_at").Find(&grants)
+	return grants, result.Error
+}
+
+// GetForUser returns the grants on a paste that apply to the user directly or through one of their teams
+func (r *pasteGrantRepository) GetForUser(ctx context.Context, pasteID uint64, userID uint, teamIDs []uint) ([]models.PasteGrant, error) {
+	var grants []models.PasteGrant
+	query := r.db.Where("paste_id = ?", pasteID)
+	if len(teamIDs) > 0 {
+		query = query.Where("user_id = ? OR team_id IN ?", userID, teamIDs)
+	} else {
+		query = query.Where("user_id = ?", userID)
+	}
+	result := query.Find(&grants)
+	return grants, result.Error
+}
+
+// GetForUserOnPastes returns the grants on any of the pastes that apply to the user directly
+// or through one of their teams
+func (r *pasteGrantRepository) GetForUserOnPastes(ctx context.Context, pasteIDs []uint64, userID uint, teamIDs []uint) ([]models.PasteGrant, error) {
+	var grants []models.PasteGrant
+	if len(pasteIDs) == 0 {
+		return grants, nil
+	}
+	query := r.db.Where("paste_id IN ?", pasteIDs)
+	if len(teamIDs) > 0 {
+		query = query.Where("user_id = ? OR team_id IN ?", userID, teamIDs)
+	} else {
+		query = query.Where("user_id = ?", userID)
+	}
+	result := query.Find(&grants)
+	return grants, result.Error
+}
+
+// GetSharedWithUser returns every grant that applies to the user directly or through one of their teams
+func (r *pasteGrantRepository) GetSharedWithUser(ctx context.Context, userID uint, teamIDs []uint) ([]models.PasteGrant, error) {
+	var grants []models.PasteGrant
+	query := r.db.Order("created_at DESC")
+	if len(teamIDs) > 0 {
+		query = query.Where("user_id = ? OR team_id IN ?", userID, teamIDs)
+	} else {
+		query = query.Where("user_id = ?", userID)
+	}
+	result := query.Find(&grants)
+	return grants, result.Error
+}
+
+// Save creates the grant, or updates the permission when the subject already has one on the paste
+func (r *pasteGrantRepository) Save(ctx context.Context, grant *models.PasteGrant) (*models.PasteGrant, error) {
+	var existing models.PasteGrant
+	query := r.db.Where("paste_id = ?", grant.PasteID)
+	if grant.UserID != nil {
+		query = query.Where("user_id = ?", *grant.UserID)
+	} else {
+		query = query.Where("team_id = ?", *grant.TeamID)
+	}
+
+	err := query.First(&existing).Error
+	if err == gorm.ErrRecordNotFound {
+		result := r.db.Create(grant)
+		return grant, result.Error
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	existing.Permission = grant.Permission
+	result := r.db.Save(&existing)
+	return &existing, result.Error
+}
+
+// Delete removes a grant from the paste. It reports false when no such grant exists.
+func (r *pasteGrantRepository) Delete(ctx context.Context, pasteID uint64, id uint) (bool, error) {
+	result := r.db.Where("id = ? AND paste_id = ?", id, pasteID).Delete(&models.PasteGrant{})
+	return result.RowsAffected == 1, result.Error
+}
@@ -0,0 +1,122 @@
+package repository
+
+import (
+	"context"
+	"memoria-backend/models"
+
+	"gorm.io/gorm"
+)
+
+type PasteLinkRepository interface {
+	ResolveTargets(ctx context.Context, ownerID string, ids []uint64, slugs []string) ([]models.Paste, error)
+	Replace(ctx context.Context, sourceID uint64, targetIDs []uint64) error
+	GetBacklinks(ctx context.Context, targetID uint64) ([]models.Paste, error)
+	GetGraph(ctx context.Context, userID string, limit int) ([]models.Paste, []models.PasteLink, error)
+}
+
+type pasteLinkRepository struct {
+	db *gorm.DB
+}
+
+func NewPasteLinkRepository(db *gorm.DB) PasteLinkRepository {
+	return &pasteLinkRepository{
+		db: db,
+	}
+}
+
+// ResolveTargets returns the metadata of the pastes a paste refers to: those of the given IDs
+// that exist, and the owner's pastes whose title has one of the slugs. Slugs only resolve for
+// pastes with an owner, a slug several of their pastes share links to each of them. Callers
+// decide which of them may be linked to.
+func (r *pasteLinkRepository) ResolveTargets(ctx context.Context, ownerID string, ids []uint64, slugs []string) ([]models.Paste, error) {
+	var targets []models.Paste
+	if len(ids) > 0 {
+		if err := r.db.Select(pasteSummaryColumns).Where("id IN ?", ids).Find(&targets).Error; err != nil {
+			return nil, err
+		}
+	}
+	if ownerID == "" || len(slugs) == 0 {
+		return targets, nil
+	}
+
+	var named []models.Paste
+	if err := r.db.Select(pasteSummaryColumns).Where("user_id = ? AND slug IN ?", ownerID, slugs).Find(&named).Error; err != nil {
+		return nil, err
+	}
+	return append(targets, named...), nil
+}
+
+// Replace sets the pastes a paste links to, dropping its previous links
+func (r *pasteLinkRepository) Replace(ctx context.Context, sourceID uint64, targetIDs []uint64) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("source_id = ?", sourceID).Delete(&models.PasteLink{}).Error; err != nil {
+			return err
+		}
+		if len(targetIDs) == 0 {
+			return nil
+		}
+		links := make([]models.PasteLink, len(targetIDs))
+		for i, targetID := range targetIDs {
+			links[i] = models.PasteLink{SourceID: sourceID, TargetID: targetID}
+		}
+		return tx.Create(&links).Error
+	})
+}
+
+// GetBacklinks returns the metadata of the pastes linking to a paste, newest first. Their
+// content is neither loaded nor decrypted.
+func (r *pasteLinkRepository) GetBacklinks(ctx context.Context, targetID uint64) ([]models.Paste, error) {
+	var pastes []models.Paste
+	sources := r.db.Model(&models.PasteLink{}).Select("source_id").Where("target_id = ?", targetID)
+	result := r.db.
+		Select(pasteSummaryColumns).
+		Where("id IN (?)", sources).
+		Order("created_at DESC, id DESC").
+		Find(&pastes)
+	return pastes, result.Error
+}
+
+// GetGraph returns the metadata of up to limit of the user's newest pastes and of the pastes
+// they link to or are linked from, along with those links
+func (r *pasteLinkRepository) GetGraph(ctx context.Context, userID string, limit int) ([]models.Paste, []models.PasteLink, error) {
+	var pastes []models.Paste
+	result := r.db.
+		Select(pasteSummaryColumns).
+		Where("user_id = ?", userID).
+		Order("created_at DESC, id DESC").
+		Limit(limit).
+		Find(&pastes)
+	if result.Error != nil || len(pastes) == 0 {
+		return pastes, nil, result.Error
+	}
+
+	ids := make([]uint64, len(pastes))
+	known := make(map[uint64]bool, len(pastes))
+	for i, paste := range pastes {
+		ids[i] = paste.ID
+		known[paste.ID] = true
+	}
+
+	var links []models.PasteLink
+	if err := r.db.Where("source_id IN ? OR target_id IN ?", ids, ids).Order("source_id, target_id").Find(&links).Error; err != nil {
+		return nil, nil, err
+	}
+
+	var others []uint64
+	for _, link := range links {
+		for _, id := range []uint64{link.SourceID, link.TargetID} {
+			if !known[id] {
+				known[id] = true
+				others = append(others, id)
+			}
+		}
+	}
+	if len(others) > 0 {
+		var linked []models.Paste
+		if err := r.db.Select(pasteSummaryColumns).Where("id IN ?", others).Order("id").Find(&linked).Error; err != nil {
+			return nil, nil, err
+		}
+		pastes = append(pastes, linked...)
+	}
+	return pastes, links, nil
+}
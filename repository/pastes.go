@@ -2,67 +2,816 @@ package repository
 
 import (
 	"context"
+	"encoding/base64"
+	"errors"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"io"
 	"memoria-backend/models"
+	"memoria-backend/utils"
+	"strings"
+	"time"
+)
+
+var (
+	ErrNoKeyring      = errors.New("paste content is encrypted but no master keys are configured")
+	ErrNoContentStore = errors.New("paste content is in the content store but none is configured")
+	// ErrPasteVersionConflict is returned when the paste changed since the version being written
+	ErrPasteVersionConflict = errors.New("the paste was changed since it was read")
 )
 
 type PasteRepository interface {
-	GetAll(ctx context.Context) ([]models.Paste, error)
+	GetAll(ctx context.Context, tags []string, page, limit int) ([]models.Paste, error)
 	GetByID(ctx context.Context, id uint64) (*models.Paste, error)
 	GetByPrivateAccessID(ctx context.Context, privateAccessID string) (*models.Paste, error)
 	GetByPrivateAccessIDs(ctx context.Context, privateAccessIDs []string) ([]models.Paste, error)
+	GetByTeamID(ctx context.Context, teamID uint, tags []string) ([]models.Paste, error)
+	GetByIDs(ctx context.Context, ids []uint64) ([]models.Paste, error)
+	GetForks(ctx context.Context, ids []uint64) ([]models.Paste, error)
+	GetByFolderID(ctx context.Context, folderID uint, tags []string) ([]models.Paste, error)
+	SetFolder(ctx context.Context, id uint64, folderID *uint) error
+	SetCommentsDisabled(ctx context.Context, id uint64, disabled bool) error
+	SuggestTags(ctx context.Context, prefix string, userID string, limit int) ([]models.TagSuggestion, error)
+	OpenContent(ctx context.Context, id uint64, fileName string) (*models.Paste, io.ReadCloser, int64, error)
+	GetReadableContentByHash(ctx context.Context, hash string, userID string) (string, error)
+	GetUsage(ctx context.Context, userID string, creatorIP string, since time.Time) (*models.Usage, error)
 	Create(ctx context.Context, paste *models.Paste) (*models.Paste, error)
 	Update(ctx context.Context, paste *models.Paste) (*models.Paste, error)
-	Delete(ctx context.Context, id uint64) (uint64, error)
+	Delete(ctx context.Context, id uint64, version uint64) (uint64, error)
+	GetTrashedByID(ctx context.Context, id uint64) (*models.Paste, error)
+	GetTrash(ctx context.Context, userID string, teamIDs []uint) ([]models.Paste, error)
+	GetPurgeable(ctx context.Context, before time.Time, limit int) ([]uint64, error)
+	Restore(ctx context.Context, id uint64) error
+	Purge(ctx context.Context, id uint64) error
+	RotateDataKeys(ctx context.Context, batchSize int) (int, error)
+}
+
+// PasteStorage configures how the paste repository stores content
+type PasteStorage struct {
+	Keyring          *utils.Keyring // Encrypts content at rest when set
+	EncryptPublic    bool           // Encrypt public pastes too, everything else always is
+	Store            ContentStore   // Holds content above InlineMaxBytes, nil keeps everything inline
+	InlineMaxBytes   int
+	Compression      string // Compression for content in the store, CompressionNone to disable
+	CompressMinBytes int
 }
 
+// pasteRepository encrypts paste content at rest when it has a keyring and moves large
+// content to the content store, shared between pastes with identical content. Reads load
+// and decrypt the content again, so callers only see plaintext.
 type pasteRepository struct {
-	db *gorm.DB
+	db      *gorm.DB
+	storage PasteStorage
 }
 
-func NewPasteRepository(db *gorm.DB) PasteRepository {
+func NewPasteRepository(db *gorm.DB, storage PasteStorage) PasteRepository {
 	return &pasteRepository{
-		db: db,
+		db:      db,
+		storage: storage,
 	}
 }
 
-func (r *pasteRepository) GetAll(ctx context.Context) ([]models.Paste, error) {
-	var pastes []models.Paste
+// shouldEncrypt reports whether the paste's content is encrypted at rest. Anything that
+// isn't openly public always is, public pastes only when configured.
+func (r *pasteRepository) shouldEncrypt(paste *models.Paste) bool {
+	if r.storage.Keyring == nil {
+		return false
+	}
+	return isRestricted(paste) || r.storage.EncryptPublic
+}
+
+// shouldKeyHash reports whether the paste's content hashes are keyed. Those of pastes that
+// are always encrypted at rest are, a plain hash would let anyone holding it confirm a guess
+// about the content. Public content can be read anyway.
+func (r *pasteRepository) shouldKeyHash(paste *models.Paste) bool {
+	return r.storage.Keyring != nil && isRestricted(paste)
+}
+
+// isRestricted reports whether the paste isn't openly public
+func isRestricted(paste *models.Paste) bool {
+	return paste.Privacy != "public" || paste.Password != ""
+}
+
+// contentHash returns the hash content is shared under, keyed with the keyring when asked to
+func (r *pasteRepository) contentHash(content []byte, keyed bool) string {
+	if keyed {
+		return r.storage.Keyring.MAC(content)
+	}
+	return ContentHash(content)
+}
+
+// inStore reports whether content loaded from the database is kept in a blob
+func inStore(content *models.StoredContent) bool {
+	return content.Content == "" && content.ContentHash != ""
+}
+
+// sealContent replaces content with its ciphertext when it should be encrypted
+func (r *pasteRepository) sealContent(content *models.StoredContent, encrypt bool) error {
+	if !encrypt {
+		content.DataKey = ""
+		content.DataKeyID = ""
+		return nil
+	}
+
+	ciphertext, wrappedKey, keyID, err := r.storage.Keyring.Encrypt([]byte(content.Content))
+	if err != nil {
+		return err
+	}
+	content.Content = base64.StdEncoding.EncodeToString(ciphertext)
+	content.DataKey = base64.StdEncoding.EncodeToString(wrappedKey)
+	content.DataKeyID = keyID
+	return nil
+}
+
+// storeContent hashes content and either moves it to a shared blob or seals it in place,
+// reporting whether it took a reference on a blob. The caller restores the plaintext.
+func (r *pasteRepository) storeContent(ctx context.Context, content *models.StoredContent, encrypt, keyHash bool) (bool, error) {
+	plaintext := []byte(content.Content)
+	content.ContentHash = r.contentHash(plaintext, keyHash)
+	content.ContentSize = int64(len(plaintext))
 
-	result := r.db.Where("privacy = ?", "public").Find(&pastes)
+	if r.storage.Store == nil || len(plaintext) <= r.storage.InlineMaxBytes {
+		return false, r.sealContent(content, encrypt)
+	}
+	if err := r.acquireBlob(ctx, content.ContentHash, plaintext, encrypt); err != nil {
+		return false, err
+	}
+	content.Content = ""
+	content.DataKey = ""
+	content.DataKeyID = ""
+	return true, nil
+}
+
+// openContent turns content loaded from the database back into plaintext
+func (r *pasteRepository) openContent(ctx context.Context, content *models.StoredContent) error {
+	if inStore(content) {
+		plaintext, err := r.readBlob(ctx, content.ContentHash)
+		if err != nil {
+			return err
+		}
+		content.Content = plaintext
+		return nil
+	}
+	if content.DataKey == "" {
+		return nil
+	}
+	if r.storage.Keyring == nil {
+		return ErrNoKeyring
+	}
+
+	ciphertext, err := base64.StdEncoding.DecodeString(content.Content)
+	if err != nil {
+		return err
+	}
+	wrappedKey, err := base64.StdEncoding.DecodeString(content.DataKey)
+	if err != nil {
+		return err
+	}
+	plaintext, err := r.storage.Keyring.Decrypt(ciphertext, wrappedKey, content.DataKeyID)
+	if err != nil {
+		return err
+	}
+	content.Content = string(plaintext)
+	return nil
+}
+
+// openPaste turns the content of a paste and its files back into plaintext
+func (r *pasteRepository) openPaste(ctx context.Context, paste *models.Paste) error {
+	if len(paste.Files) == 0 {
+		return r.openContent(ctx, &paste.StoredContent)
+	}
+	for i := range paste.Files {
+		if err := r.openContent(ctx, &paste.Files[i].StoredContent); err != nil {
+			return err
+		}
+	}
+	paste.Content = paste.Files[0].Content
+	return nil
+}
+
+func (r *pasteRepository) openPastes(ctx context.Context, pastes []models.Paste) error {
+	for i := range pastes {
+		if err := r.openPaste(ctx, &pastes[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// withAssociations loads pastes along with their files in order, attachments and tags
+func (r *pasteRepository) withAssociations() *gorm.DB {
+	return r.db.
+		Preload("Files", func(db *gorm.DB) *gorm.DB {
+			return db.Order("position")
+		}).
+		Preload("Attachments", func(db *gorm.DB) *gorm.DB {
+			return db.Order("id")
+		}).
+		Preload("Tags", func(db *gorm.DB) *gorm.DB {
+			return db.Order("name")
+		})
+}
+
+// taggedWith narrows a paste query to pastes carrying every one of the tags
+func (r *pasteRepository) taggedWith(query *gorm.DB, tags []string) *gorm.DB {
+	if len(tags) == 0 {
+		return query
+	}
+	tagged := r.db.Table("paste_tags").
+		Select("paste_tags.paste_id").
+		Joins("JOIN tags ON tags.id = paste_tags.tag_id").
+		Where("tags.name IN ?", tags).
+		Group("paste_tags.paste_id").
+		Having("COUNT(DISTINCT tags.id) = ?", len(tags))
+	return query.Where("pastes.id IN (?)", tagged)
+}
+
+// saveTags points the paste at its tags, creating the ones no paste had before. Pastes
+// without a tag list keep the tags they have.
+func saveTags(tx *gorm.DB, paste *models.Paste) error {
+	if paste.Tags == nil {
+		return nil
+	}
+	for i := range paste.Tags {
+		tag := &paste.Tags[i]
+		if tag.ID == 0 {
+			if err := tx.Where("name = ?", tag.Name).FirstOrCreate(tag).Error; err != nil {
+				return err
+			}
+		}
+	}
+	return tx.Model(paste).Omit("Tags.*").Association("Tags").Replace(paste.Tags)
+}
+
+// storedBlobs returns the hashes of the blobs a stored paste and its files refer to
+func (r *pasteRepository) storedBlobs(db *gorm.DB, id uint64) ([]string, error) {
+	var hashes, fileHashes []string
+	err := db.Model(&models.Paste{}).
+		Where("id = ? AND content = '' AND content_hash <> ''", id).
+		Pluck("content_hash", &hashes).Error
+	if err != nil {
+		return nil, err
+	}
+	err = db.Model(&models.PasteFile{}).
+		Where("paste_id = ? AND content = '' AND content_hash <> ''", id).
+		Pluck("content_hash", &fileHashes).Error
+	if err != nil {
+		return nil, err
+	}
+	return append(hashes, fileHashes...), nil
+}
+
+func (r *pasteRepository) releaseBlobs(ctx context.Context, hashes []string) {
+	for _, hash := range hashes {
+		r.releaseBlob(ctx, hash)
+	}
+}
+
+// save writes the paste and its files with their content hashed and sealed, leaving the
+// plaintext in the caller's struct. Large content goes to shared blobs, the blobs the paste
+// referred to before are released afterwards. The files are replaced as a whole.
+func (r *pasteRepository) save(ctx context.Context, paste *models.Paste, write func(*gorm.DB, *models.Paste) *gorm.DB) error {
+	slug := utils.Slugify(paste.Title)
+	paste.Slug = &slug
+
+	var previousBlobs []string
+	if paste.ID != 0 {
+		hashes, err := r.storedBlobs(r.db, paste.ID)
+		if err != nil {
+			return err
+		}
+		previousBlobs = hashes
+	}
+
+	encrypt := r.shouldEncrypt(paste)
+	keyHash := r.shouldKeyHash(paste)
+	plaintexts := make([]string, len(paste.Files))
+	plaintext := paste.Content
+	var acquired []string
+	restore := func() {
+		for i := range paste.Files {
+			paste.Files[i].Content = plaintexts[i]
+		}
+		paste.Content = plaintext
+	}
+
+	var err error
+	if len(paste.Files) == 0 {
+		var inBlob bool
+		inBlob, err = r.storeContent(ctx, &paste.StoredContent, encrypt, keyHash)
+		if inBlob {
+			acquired = append(acquired, paste.ContentHash)
+		}
+	} else {
+		// Content mirrors the first file, only the files are stored
+		plaintext = paste.Files[0].Content
+		paste.StoredContent = models.StoredContent{}
+		for i := range paste.Files {
+			file := &paste.Files[i]
+			plaintexts[i] = file.Content
+			file.ID = 0
+			file.Position = i
+
+			var inBlob bool
+			inBlob, err = r.storeContent(ctx, &file.StoredContent, encrypt, keyHash)
+			if inBlob {
+				acquired = append(acquired, file.ContentHash)
+			}
+			if err != nil {
+				break
+			}
+			paste.ContentSize += file.ContentSize
+		}
+	}
+
+	if err == nil {
+		err = r.db.Transaction(func(tx *gorm.DB) error {
+			if err := write(tx.Omit(clause.Associations), paste).Error; err != nil {
+				return err
+			}
+			if err := saveTags(tx, paste); err != nil {
+				return err
+			}
+			if err := tx.Where("paste_id = ?", paste.ID).Delete(&models.PasteFile{}).Error; err != nil {
+				return err
+			}
+			for i := range paste.Files {
+				paste.Files[i].PasteID = paste.ID
+			}
+			if len(paste.Files) == 0 {
+				return nil
+			}
+			return tx.Create(&paste.Files).Error
+		})
+	}
+	restore()
+	if err != nil {
+		r.releaseBlobs(ctx, acquired)
+		return err
+	}
+
+	r.releaseBlobs(ctx, previousBlobs)
+	return nil
+}
+
+// GetAll returns a page of the metadata and tags of the public pastes that haven't expired,
+// newest first, only those carrying all of the tags when any are given. Their content is
+// neither loaded nor decrypted.
+func (r *pasteRepository) GetAll(ctx context.Context, tags []string, page, limit int) ([]models.Paste, error) {
+	var pastes []models.Paste
+	query := r.db.
+		Select(pasteSummaryColumns).
+		Preload("Tags", func(db *gorm.DB) *gorm.DB {
+			return db.Order("name")
+		})
+	result := r.taggedWith(query, tags).
+		Where("privacy = ?", "public").
+		Where("expires_at IS NULL OR expires_at = ? OR expires_at > ?", time.Time{}, time.Now()).
+		Order("created_at DESC, id DESC").
+		Offset((page - 1) * limit).
+		Limit(limit).
+		Find(&pastes)
 	return pastes, result.Error
 }
 
 func (r *pasteRepository) GetByID(ctx context.Context, id uint64) (*models.Paste, error) {
 	var paste models.Paste
-	result := r.db.First(&paste, id)
-	return &paste, result.Error
+	result := r.withAssociations().First(&paste, id)
+	if result.Error != nil {
+		return &paste, result.Error
+	}
+	return &paste, r.openPaste(ctx, &paste)
 }
 
 func (r *pasteRepository) Create(ctx context.Context, paste *models.Paste) (*models.Paste, error) {
-	result := r.db.Create(&paste)
-	return paste, result.Error
+	err := r.save(ctx, paste, func(db *gorm.DB, p *models.Paste) *gorm.DB { return db.Create(p) })
+	return paste, err
 }
 
+// Update overwrites the version of the paste it was loaded at and bumps its version, failing
+// with ErrPasteVersionConflict when it was changed meanwhile
 func (r *pasteRepository) Update(ctx context.Context, paste *models.Paste) (*models.Paste, error) {
-	result := r.db.Save(&paste)
-	return paste, result.Error
+	version := paste.Version
+	paste.Version++
+	err := r.save(ctx, paste, func(db *gorm.DB, p *models.Paste) *gorm.DB {
+		result := db.Model(p).Where("version = ?", version).Select("*").Updates(p)
+		if result.Error == nil && result.RowsAffected == 0 {
+			_ = result.AddError(ErrPasteVersionConflict)
+		}
+		return result
+	})
+	if err != nil {
+		paste.Version = version
+	}
+	return paste, err
 }
 
-func (r *pasteRepository) Delete(ctx context.Context, id uint64) (uint64, error) {
-	var paste models.Paste
-	result := r.db.Delete(&paste, id)
+// bumpVersion counts a change to the paste made outside Update, such as to its attachments
+func bumpVersion(db *gorm.DB, id uint64) error {
+	return db.Model(&models.Paste{}).Where("id = ?", id).UpdateColumn("version", gorm.Expr("version + 1")).Error
+}
+
+// Delete moves the paste to the trash if it's still at the version, any version when it's 0.
+// Its files, attachments, grants and links stay until it's purged.
+func (r *pasteRepository) Delete(ctx context.Context, id uint64, version uint64) (uint64, error) {
+	query := r.db.Model(&models.Paste{}).Where("id = ?", id)
+	if version != 0 {
+		query = query.Where("version = ?", version)
+	}
+	result := query.UpdateColumns(map[string]interface{}{"deleted_at": time.Now(), "version": gorm.Expr("version + 1")})
+	if result.Error == nil && result.RowsAffected == 0 {
+		if version != 0 {
+			return id, ErrPasteVersionConflict
+		}
+		return id, gorm.ErrRecordNotFound
+	}
 	return id, result.Error
 }
 
-func (r *pasteRepository) GetByPrivateAccessID(ctx context.Context, privateAccessID string) (*models.Paste, error) {
+// GetTrashedByID returns the metadata of a paste in the trash, its content isn't loaded
+func (r *pasteRepository) GetTrashedByID(ctx context.Context, id uint64) (*models.Paste, error) {
 	var paste models.Paste
-	result := r.db.Where("private_access_id = ?", privateAccessID).First(&paste)
+	result := r.db.Unscoped().
+		Select(append(pasteSummaryColumns, "version", "deleted_at")).
+		Where("deleted_at IS NOT NULL").
+		First(&paste, id)
 	return &paste, result.Error
 }
 
+// GetTrash returns the metadata of the trashed pastes userID owns or that belong to one of the
+// teams, most recently deleted first
+func (r *pasteRepository) GetTrash(ctx context.Context, userID string, teamIDs []uint) ([]models.Paste, error) {
+	var pastes []models.Paste
+	query := r.db.Unscoped().
+		Select(append(pasteSummaryColumns, "version", "deleted_at")).
+		Where("deleted_at IS NOT NULL")
+	if len(teamIDs) > 0 {
+		query = query.Where("user_id = ? OR team_id IN ?", userID, teamIDs)
+	} else {
+		query = query.Where("user_id = ?", userID)
+	}
+	result := query.Order("deleted_at DESC, id DESC").Find(&pastes)
+	return pastes, result.Error
+}
+
+// GetPurgeable returns the IDs of up to limit pastes that went to the trash before the given
+// time, longest trashed first
+func (r *pasteRepository) GetPurgeable(ctx context.Context, before time.Time, limit int) ([]uint64, error) {
+	var ids []uint64
+	result := r.db.Unscoped().Model(&models.Paste{}).
+		Where("deleted_at IS NOT NULL AND deleted_at < ?", before).
+		Order("deleted_at, id").
+		Limit(limit).
+		Pluck("id", &ids)
+	return ids, result.Error
+}
+
+// Restore takes the paste out of the trash
+func (r *pasteRepository) Restore(ctx context.Context, id uint64) error {
+	result := r.db.Unscoped().Model(&models.Paste{}).
+		Where("id = ? AND deleted_at IS NOT NULL", id).
+		UpdateColumns(map[string]interface{}{"deleted_at": nil, "version": gorm.Expr("version + 1")})
+	if result.Error == nil && result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return result.Error
+}
+
+// Purge deletes the paste for good, whether it's in the trash or not, along with everything
+// attached to it, and releases its blobs
+func (r *pasteRepository) Purge(ctx context.Context, id uint64) error {
+	// A session, so the queries below don't pile up each other's conditions
+	db := r.db.Unscoped().Session(&gorm.Session{})
+	blobs, err := r.storedBlobs(db, id)
+	if err != nil {
+		return err
+	}
+	var attachments []models.Attachment
+	if err := db.Where("paste_id = ?", id).Find(&attachments).Error; err != nil {
+		return err
+	}
+	for _, attachment := range attachments {
+		blobs = append(blobs, attachment.ContentHash)
+		if attachment.ThumbnailHash != "" {
+			blobs = append(blobs, attachment.ThumbnailHash)
+		}
+	}
+
+	err = r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("paste_id = ?", id).Delete(&models.PasteGrant{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("paste_id = ?", id).Delete(&models.ShareLink{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("paste_id = ?", id).Delete(&models.PasteFile{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("paste_id = ?", id).Delete(&models.Attachment{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("source_id = ? OR target_id = ?", id, id).Delete(&models.PasteLink{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("paste_id = ?", id).Delete(&models.PasteComment{}).Error; err != nil {
+			return err
+		}
+		// Forks outlive their source, they just lose the link to it
+		if err := tx.Unscoped().Model(&models.Paste{}).Where("forked_from_id = ?", id).UpdateColumn("forked_from_id", nil).Error; err != nil {
+			return err
+		}
+		result := tx.Unscoped().Select("Tags").Delete(&models.Paste{ID: id})
+		if result.Error == nil && result.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		return result.Error
+	})
+	if err == nil {
+		r.releaseBlobs(ctx, blobs)
+	}
+	return err
+}
+
+// OpenContent loads a paste without its content and opens a reader over the plaintext
+// content of one of its files along with its length, streaming it from the content store
+// where possible. An empty fileName opens the first file.
+func (r *pasteRepository) OpenContent(ctx context.Context, id uint64, fileName string) (*models.Paste, io.ReadCloser, int64, error) {
+	var paste models.Paste
+	if err := r.withAssociations().First(&paste, id).Error; err != nil {
+		return nil, nil, 0, err
+	}
+
+	var content *models.StoredContent
+	for i, file := range paste.FileList() {
+		if fileName == "" || file.Name == fileName {
+			if len(paste.Files) > 0 {
+				content = &paste.Files[i].StoredContent
+			} else {
+				content = &paste.StoredContent
+			}
+			break
+		}
+	}
+	if content == nil {
+		return nil, nil, 0, gorm.ErrRecordNotFound
+	}
+
+	var reader io.ReadCloser
+	var size int64
+	if inStore(content) {
+		var err error
+		if reader, size, err = r.openBlob(ctx, content.ContentHash); err != nil {
+			return nil, nil, 0, err
+		}
+	} else {
+		if err := r.openContent(ctx, content); err != nil {
+			return nil, nil, 0, err
+		}
+		reader = io.NopCloser(strings.NewReader(content.Content))
+		size = int64(len(content.Content))
+	}
+
+	// Only the paste's metadata goes back, the reader has the content
+	paste.Content = ""
+	paste.Files = nil
+	return &paste, reader, size, nil
+}
+
+// GetReadableContentByHash returns the content of a paste or paste file with the given hash
+// that anyone may read, or that userID wrote. Expired pastes and other pastes are never
+// revealed, the hash alone must not give access. Neither are client-side encrypted pastes,
+// their content is ciphertext.
+func (r *pasteRepository) GetReadableContentByHash(ctx context.Context, hash string, userID string) (string, error) {
+	readable := func(query *gorm.DB) *gorm.DB {
+		query = query.
+			Where("pastes.encryption IS NULL").
+			Where("pastes.expires_at IS NULL OR pastes.expires_at = ? OR pastes.expires_at > ?", time.Time{}, time.Now())
+		if userID != "" {
+			return query.Where("(pastes.privacy = ? AND pastes.password = '') OR pastes.user_id = ?", "public", userID)
+		}
+		return query.Where("pastes.privacy = ? AND pastes.password = ''", "public")
+	}
+
+	var paste models.Paste
+	result := readable(r.db.Where("pastes.content_hash = ?", hash)).First(&paste)
+	if result.Error == nil {
+		err := r.openContent(ctx, &paste.StoredContent)
+		return paste.Content, err
+	}
+	if !errors.Is(result.Error, gorm.ErrRecordNotFound) {
+		return "", result.Error
+	}
+
+	var file models.PasteFile
+	result = readable(r.db.
+		Joins("JOIN pastes ON pastes.id = paste_files.paste_id AND pastes.deleted_at IS NULL").
+		Where("paste_files.content_hash = ?", hash)).
+		First(&file)
+	if result.Error != nil {
+		return "", result.Error
+	}
+	err := r.openContent(ctx, &file.StoredContent)
+	return file.Content, err
+}
+
+// GetUsage counts the pastes created since the given time and the content and attachment bytes
+// of all pastes owned by userID, or by the anonymous creatorIP when userID is empty
+func (r *pasteRepository) GetUsage(ctx context.Context, userID string, creatorIP string, since time.Time) (*models.Usage, error) {
+	owned := func() *gorm.DB {
+		// Pastes in the trash still count until they're purged
+		if userID != "" {
+			return r.db.Unscoped().Model(&models.Paste{}).Where("user_id = ?", userID)
+		}
+		return r.db.Unscoped().Model(&models.Paste{}).Where("user_id = '' AND creator_ip = ?", creatorIP)
+	}
+
+	usage := &models.Usage{}
+	if err := owned().Where("created_at >= ?", since).Count(&usage.PastesToday).Error; err != nil {
+		return nil, err
+	}
+	if err := owned().Select("COALESCE(SUM(content_size), 0)").Scan(&usage.StorageBytes).Error; err != nil {
+		return nil, err
+	}
+	var attachmentBytes int64
+	err := r.db.Model(&models.Attachment{}).
+		Where("paste_id IN (?)", owned().Select("id")).
+		Select("COALESCE(SUM(size), 0)").
+		Scan(&attachmentBytes).Error
+	if err != nil {
+		return nil, err
+	}
+	usage.StorageBytes += attachmentBytes
+	return usage, nil
+}
+
+func (r *pasteRepository) GetByPrivateAccessID(ctx context.Context, privateAccessID string) (*models.Paste, error) {
+	var paste models.Paste
+	result := r.withAssociations().Where("private_access_id = ?", privateAccessID).First(&paste)
+	if result.Error != nil {
+		return &paste, result.Error
+	}
+	return &paste, r.openPaste(ctx, &paste)
+}
+
 func (r *pasteRepository) GetByPrivateAccessIDs(ctx context.Context, privateAccessIDs []string) ([]models.Paste, error) {
 	var pastes []models.Paste
-	result := r.db.Where("private_access_id IN ?", privateAccessIDs).Find(&pastes)
+	result := r.withAssociations().Where("private_access_id IN ?", privateAccessIDs).Find(&pastes)
+	if result.Error != nil {
+		return pastes, result.Error
+	}
+	return pastes, r.openPastes(ctx, pastes)
+}
+
+// GetByTeamID returns the team's pastes, newest first, only those carrying all of the tags
+// when any are given
+func (r *pasteRepository) GetByTeamID(ctx context.Context, teamID uint, tags []string) ([]models.Paste, error) {
+	var pastes []models.Paste
+	result := r.taggedWith(r.withAssociations(), tags).Where("team_id = ?", teamID).Order("created_at DESC").Find(&pastes)
+	if result.Error != nil {
+		return pastes, result.Error
+	}
+	return pastes, r.openPastes(ctx, pastes)
+}
+
+func (r *pasteRepository) GetByIDs(ctx context.Context, ids []uint64) ([]models.Paste, error) {
+	var pastes []models.Paste
+	result := r.withAssociations().Where("id IN ?", ids).Find(&pastes)
+	if result.Error != nil {
+		return pastes, result.Error
+	}
+	return pastes, r.openPastes(ctx, pastes)
+}
+
+// pasteSummaryColumns are the columns listings load when they only need a paste's metadata
+// and what decides who may view it
+var pasteSummaryColumns = []string{"id", "title", "created_at", "expires_at", "privacy", "user_id", "team_id", "folder_id", "forked_from_id"}
+
+// GetForks returns the metadata of the pastes forked from any of the given pastes, oldest
+// first. Their content is neither loaded nor decrypted.
+func (r *pasteRepository) GetForks(ctx context.Context, ids []uint64) ([]models.Paste, error) {
+	var pastes []models.Paste
+	result := r.db.
+		Select(pasteSummaryColumns).
+		Where("forked_from_id IN ?", ids).
+		Order("created_at, id").
+		Find(&pastes)
 	return pastes, result.Error
 }
+
+// GetByFolderID returns the pastes directly in the folder, newest first, only those carrying
+// all of the tags when any are given
+func (r *pasteRepository) GetByFolderID(ctx context.Context, folderID uint, tags []string) ([]models.Paste, error) {
+	var pastes []models.Paste
+	result := r.taggedWith(r.withAssociations(), tags).Where("folder_id = ?", folderID).Order("created_at DESC").Find(&pastes)
+	if result.Error != nil {
+		return pastes, result.Error
+	}
+	return pastes, r.openPastes(ctx, pastes)
+}
+
+// SetFolder moves the paste into the folder, or out of any folder when folderID is nil
+func (r *pasteRepository) SetFolder(ctx context.Context, id uint64, folderID *uint) error {
+	result := r.db.Model(&models.Paste{}).Where("id = ?", id).
+		UpdateColumns(map[string]interface{}{"folder_id": folderID, "version": gorm.Expr("version + 1")})
+	if result.Error == nil && result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return result.Error
+}
+
+func (r *pasteRepository) SetCommentsDisabled(ctx context.Context, id uint64, disabled bool) error {
+	result := r.db.Model(&models.Paste{}).Where("id = ?", id).
+		UpdateColumns(map[string]interface{}{"comments_disabled": disabled, "version": gorm.Expr("version + 1")})
+	if result.Error == nil && result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return result.Error
+}
+
+// likeEscaper escapes the wildcards of a LIKE pattern, used with ESCAPE '\'
+var likeEscaper = strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`)
+
+// SuggestTags returns the tags starting with prefix, most used first. Only public pastes and
+// those userID wrote count, so tags on pastes the caller can't see aren't revealed.
+func (r *pasteRepository) SuggestTags(ctx context.Context, prefix string, userID string, limit int) ([]models.TagSuggestion, error) {
+	query := r.db.Table("tags").
+		Select("tags.name, COUNT(*) AS count").
+		Joins("JOIN paste_tags ON paste_tags.tag_id = tags.id").
+		Joins("JOIN pastes ON pastes.id = paste_tags.paste_id AND pastes.deleted_at IS NULL").
+		Where(`tags.name LIKE ? ESCAPE '\'`, likeEscaper.Replace(prefix)+"%")
+	if userID != "" {
+		query = query.Where("(pastes.privacy = ? AND pastes.password = '') OR pastes.user_id = ?", "public", userID)
+	} else {
+		query = query.Where("pastes.privacy = ? AND pastes.password = ''", "public")
+	}
+
+	suggestions := []models.TagSuggestion{}
+	result := query.Group("tags.name").Order("count DESC, tags.name").Limit(limit).Scan(&suggestions)
+	return suggestions, result.Error
+}
+
+// RotateDataKeys re-wraps up to batchSize data keys of pastes, paste files and content blobs
+// that aren't wrapped with the active master key. It reports how many it went through, zero
+// once every data key uses the active master key. Content is not re-encrypted.
+func (r *pasteRepository) RotateDataKeys(ctx context.Context, batchSize int) (int, error) {
+	if r.storage.Keyring == nil {
+		return 0, ErrNoKeyring
+	}
+
+	count, err := r.rotateDataKeys(&models.Paste{}, "id", batchSize)
+	if err != nil || count > 0 {
+		return count, err
+	}
+	count, err = r.rotateDataKeys(&models.PasteFile{}, "id", batchSize)
+	if err != nil || count > 0 {
+		return count, err
+	}
+	return r.rotateDataKeys(&models.ContentBlob{}, "hash", batchSize)
+}
+
+// rotateDataKeys re-wraps one batch of data keys in the table of model, keyed by keyColumn
+func (r *pasteRepository) rotateDataKeys(model interface{}, keyColumn string, batchSize int) (int, error) {
+	var rows []map[string]interface{}
+	// Pastes in the trash keep their data keys, they must be rotated too
+	result := r.db.Unscoped().Model(model).
+		Select(keyColumn, "data_key", "data_key_id").
+		Where("data_key <> '' AND data_key_id <> ?", r.storage.Keyring.ActiveKeyID()).
+		Order(keyColumn).
+		Limit(batchSize).
+		Find(&rows)
+	if result.Error != nil {
+		return 0, result.Error
+	}
+
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		for _, row := range rows {
+			dataKey, _ := row["data_key"].(string)
+			dataKeyID, _ := row["data_key_id"].(string)
+
+			wrappedKey, err := base64.StdEncoding.DecodeString(dataKey)
+			if err != nil {
+				return err
+			}
+			rewrapped, keyID, err := r.storage.Keyring.Rewrap(wrappedKey, dataKeyID)
+			if err != nil {
+				return err
+			}
+
+			// Skip rows rewritten since they were read, they already use a new data key
+			err = tx.Unscoped().Model(model).
+				Where(keyColumn+" = ? AND data_key = ?", row[keyColumn], dataKey).
+				UpdateColumns(map[string]interface{}{
+					"data_key":    base64.StdEncoding.EncodeToString(rewrapped),
+					"data_key_id": keyID,
+				}).Error
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return len(rows), nil
+}
@@ -0,0 +1,71 @@
+package repository
+
+import (
+	"context"
+	"memoria-backend/models"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type ShareLinkRepository interface {
+	Create(ctx context.Context, link *models.ShareLink) (*models.ShareLink, error)
+	GetByAccessID(ctx context.Context, accessID string) (*models.ShareLink, error)
+	GetByPasteID(ctx context.Context, pasteID uint64) ([]models.ShareLink, error)
+	UpdateAccessID(ctx context.Context, pasteID uint64, id uint, accessID string) (bool, error)
+	Consume(ctx context.Context, id uint, now time.Time) (bool, error)
+	Delete(ctx context.Context, pasteID uint64, id uint) (bool, error)
+}
+
+type shareLinkRepository struct {
+	db *gorm.DB
+}
+
+func NewShareLinkRepository(db *gorm.DB) ShareLinkRepository {
+	return &shareLinkRepository{
+		db: db,
+	}
+}
+
+func (r *shareLinkRepository) Create(ctx context.Context, link *models.ShareLink) (*models.ShareLink, error) {
+	result := r.db.Create(link)
+	return link, result.Error
+}
+
+func (r *shareLinkRepository) GetByAccessID(ctx context.Context, accessID string) (*models.ShareLink, error) {
+	var link models.ShareLink
+	result := r.db.Where("access_id = ?", accessID).First(&link)
+	return &link, result.Error
+}
+
+func (r *shareLinkRepository) GetByPasteID(ctx context.Context, pasteID uint64) ([]models.ShareLink, error) {
+	var links []models.ShareLink
+	result := r.db.Where("paste_id = ?", pasteID).Order("created_at DESC").Find(&links)
+	return links, result.Error
+}
+
+// UpdateAccessID replaces the link's access ID. It reports false when no such link exists.
+func (r *shareLinkRepository) UpdateAccessID(ctx context.Context, pasteID uint64, id uint, accessID string) (bool, error) {
+	result := r.db.Model(&models.ShareLink{}).
+		Where("id = ? AND paste_id = ?", id, pasteID).
+		UpdateColumn("access_id", accessID)
+	return result.RowsAffected == 1, result.Error
+}
+
+// Consume records one use of the link. It reports false when the link has expired or has
+// no uses left, checked in the same statement so concurrent requests can't overshoot.
+func (r *shareLinkRepository) Consume(ctx context.Context, id uint, now time.Time) (bool, error) {
+	result := r.db.Model(&models.ShareLink{}).
+		Where("id = ? AND (max_uses = 0 OR uses < max_uses) AND (expires_at IS NULL OR expires_at > ?)", id, now).
+		UpdateColumns(map[string]interface{}{
+			"uses":         gorm.Expr("uses + 1"),
+			"last_used_at": now,
+		})
+	return result.RowsAffected == 1, result.Error
+}
+
+// Delete revokes a link. It reports false when no such link exists.
+func (r *shareLinkRepository) Delete(ctx context.Context, pasteID uint64, id uint) (bool, error) {
+	result := r.db.Where("id = ? AND paste_id = ?", id, pasteID).Delete(&models.ShareLink{})
+	return result.RowsAffected == 1, result.Error
+}
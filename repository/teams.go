@@ -0,0 +1,203 @@
+package repository
+
+import (
+	"context"
+	"memoria-backend/models"
+
+	"gorm.io/gorm"
+)
+
+type TeamRepository interface {
+	Create(ctx context.Context, team *models.Team, ownerID uint) (*models.Team, error)
+	GetByID(ctx context.Context, id uint) (*models.Team, error)
+	GetByUserID(ctx context.Context, userID uint) ([]models.Team, []models.TeamMember, error)
+	Update(ctx context.Context, team *models.Team) (*models.Team, error)
+	Delete(ctx context.Context, id uint) error
+	GetMember(ctx context.Context, teamID, userID uint) (*models.TeamMember, error)
+	GetMemberships(ctx context.Context, userID uint) ([]models.TeamMember, error)
+	GetMembers(ctx context.Context, teamID uint) ([]models.TeamMemberResponse, error)
+	CountOwners(ctx context.Context, teamID uint) (int64, error)
+	UpdateMemberRole(ctx context.Context, teamID, userID uint, role string) (bool, error)
+	RemoveMember(ctx context.Context, teamID, userID uint) (bool, error)
+	CreateInvite(ctx context.Context, invite *models.TeamInvite) (*models.TeamInvite, error)
+	GetInviteByHash(ctx context.Context, tokenHash string) (*models.TeamInvite, error)
+	GetInvites(ctx context.Context, teamID uint) ([]models.TeamInvite, error)
+	DeleteInvite(ctx context.Context, teamID, id uint) (bool, error)
+	AcceptInvite(ctx context.Context, invite *models.TeamInvite, userID uint) (bool, error)
+}
+
+type teamRepository struct {
+	db *gorm.DB
+}
+
+func NewTeamRepository(db *gorm.DB) TeamRepository {
+	return &teamRepository{
+		db: db,
+	}
+}
+
+// Create stores the team and makes ownerID its first owner
+func (r *teamRepository) Create(ctx context.Context, team *models.Team, ownerID uint) (*models.Team, error) {
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(team).Error; err != nil {
+			return err
+		}
+		return tx.Create(&models.TeamMember{TeamID: team.ID, UserID: ownerID, Role: models.TeamRoleOwner}).Error
+	})
+	return team, err
+}
+
+func (r *teamRepository) GetByID(ctx context.Context, id uint) (*models.Team, error) {
+	var team models.Team
+	result := r.db.First(&team, id)
+	return &team, result.Error
+}
+
+// GetByUserID returns the teams the user belongs to along with their membership in each
+func (r *teamRepository) GetByUserID(ctx context.Context, userID uint) ([]models.Team, []models.TeamMember, error) {
+	memberships, err := r.GetMemberships(ctx, userID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(memberships) == 0 {
+		return []models.Team{}, memberships, nil
+	}
+
+	teamIDs := make([]uint, len(memberships))
+	for i, membership := range memberships {
+		teamIDs[i] = membership.TeamID
+	}
+
+	var teams []models.Team
+	result := r.db.Where("id IN ?", teamIDs).Order("name").Find(&teams)
+	return teams, memberships, result.Error
+}
+
+func (r *teamRepository) Update(ctx context.Context, team *models.Team) (*models.Team, error) {
+	result := r.db.Save(team)
+	return team, result.Error
+}
+
+// Delete removes the team with its members, invites, grants and folders. Its pastes stay
+// with their authors, team-only pastes become private, those in the trash too.
+func (r *teamRepository) Delete(ctx context.Context, id uint) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Unscoped().Model(&models.Paste{}).
+			Where("team_id = ? AND privacy = ?", id, models.PrivacyTeam).
+			Update("privacy", "private").Error; err != nil {
+			return err
+		}
+		if err := tx.Unscoped().Model(&models.Paste{}).Where("team_id = ?", id).Update("team_id", nil).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("team_id = ?", id).Delete(&models.PasteGrant{}).Error; err != nil {
+			return err
+		}
+		// The team's folders go with it, the pastes in them stay with their authors outside
+		// any folder and folders of others nested in them move to the top level
+		teamFolders := tx.Model(&models.Folder{}).Select("id").Where("team_id = ?", id)
+		if err := tx.Unscoped().Model(&models.Paste{}).Where("folder_id IN (?)", teamFolders).UpdateColumn("folder_id", nil).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&models.Folder{}).Where("parent_id IN (?) AND (team_id IS NULL OR team_id <> ?)", teamFolders, id).UpdateColumn("parent_id", nil).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("team_id = ?", id).Delete(&models.Folder{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("team_id = ?", id).Delete(&models.TeamInvite{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("team_id = ?", id).Delete(&models.TeamMember{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&models.Team{}, id).Error
+	})
+}
+
+func (r *teamRepository) GetMember(ctx context.Context, teamID, userID uint) (*models.TeamMember, error) {
+	var member models.TeamMember
+	result := r.db.Where("team_id = ? AND user_id = ?", teamID, userID).First(&member)
+	return &member, result.Error
+}
+
+func (r *teamRepository) GetMemberships(ctx context.Context, userID uint) ([]models.TeamMember, error) {
+	var memberships []models.TeamMember
+	result := r.db.Where("user_id = ?", userID).Find(&memberships)
+	return memberships, result.Error
+}
+
+func (r *teamRepository) GetMembers(ctx context.Context, teamID uint) ([]models.TeamMemberResponse, error) {
+	var members []models.TeamMemberResponse
+	result := r.db.Table("team_members").
+		Select("team_members.user_id, users.name, users.email, team_members.role, team_members.created_at AS joined_at").
+		Joins("JOIN users ON users.id = team_members.user_id").
+		Where("team_members.team_id = ?", teamID).
+		Order("team_members.created_at").
+		Scan(&members)
+	return members, result.Error
+}
+
+func (r *teamRepository) CountOwners(ctx context.Context, teamID uint) (int64, error) {
+	var count int64
+	result := r.db.Model(&models.TeamMember{}).Where("team_id = ? AND role = ?", teamID, models.TeamRoleOwner).Count(&count)
+	return count, result.Error
+}
+
+// UpdateMemberRole changes a member's role. It reports false when the user isn't a member.
+func (r *teamRepository) UpdateMemberRole(ctx context.Context, teamID, userID uint, role string) (bool, error) {
+	result := r.db.Model(&models.TeamMember{}).
+		Where("team_id = ? AND user_id = ?", teamID, userID).
+		Update("role", role)
+	return result.RowsAffected == 1, result.Error
+}
+
+// RemoveMember removes a user from the team. It reports false when the user isn't a member.
+func (r *teamRepository) RemoveMember(ctx context.Context, teamID, userID uint) (bool, error) {
+	result := r.db.Where("team_id = ? AND user_id = ?", teamID, userID).Delete(&models.TeamMember{})
+	return result.RowsAffected == 1, result.Error
+}
+
+func (r *teamRepository) CreateInvite(ctx context.Context, invite *models.TeamInvite) (*models.TeamInvite, error) {
+	result := r.db.Create(invite)
+	return invite, result.Error
+}
+
+func (r *teamRepository) GetInviteByHash(ctx context.Context, tokenHash string) (*models.TeamInvite, error) {
+	var invite models.TeamInvite
+	result := r.db.Where("token_hash = ?", tokenHash).First(&invite)
+	return &invite, result.Error
+}
+
+func (r *teamRepository) GetInvites(ctx context.Context, teamID uint) ([]models.TeamInvite, error) {
+	var invites []models.TeamInvite
+	result := r.db.Where("team_id = ?", teamID).Order("created_at DESC").Find(&invites)
+	return invites, result.Error
+}
+
+// DeleteInvite revokes an invitation. It reports false when no such invitation exists.
+func (r *teamRepository) DeleteInvite(ctx context.Context, teamID, id uint) (bool, error) {
+	result := r.db.Where("id = ? AND team_id = ?", id, teamID).Delete(&models.TeamInvite{})
+	return result.RowsAffected == 1, result.Error
+}
+
+// AcceptInvite uses up one use of the invitation and adds the user with the invite's
+// role. It reports false when the invitation has no uses left.
+func (r *teamRepository) AcceptInvite(ctx context.Context, invite *models.TeamInvite, userID uint) (bool, error) {
+	accepted := false
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&models.TeamInvite{}).
+			Where("id = ? AND (max_uses = 0 OR uses < max_uses)", invite.ID).
+			UpdateColumn("uses", gorm.Expr("uses + 1"))
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected != 1 {
+			return nil
+		}
+
+		accepted = true
+		return tx.Create(&models.TeamMember{TeamID: invite.TeamID, UserID: userID, Role: invite.Role}).Error
+	})
+	return accepted, err
+}
@@ -0,0 +1,58 @@
+package repository
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"memoria-backend/models"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func TestDeleteTeamRemovesItsFolders(t *testing.T) {
+	ctx := context.Background()
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "memoria.db")), &gorm.Config{Logger: logger.Discard})
+	require.NoError(t, err)
+	require.NoError(t, db.AutoMigrate(&models.Team{}, &models.TeamMember{}, &models.TeamInvite{}, &models.Paste{}, &models.PasteGrant{}, &models.Folder{}))
+
+	teams := NewTeamRepository(db)
+	team, err := teams.Create(ctx, &models.Team{Name: "Platform"}, 1)
+	require.NoError(t, err)
+	other, err := teams.Create(ctx, &models.Team{Name: "Other"}, 1)
+	require.NoError(t, err)
+
+	public := &models.Folder{Name: "Runbooks", TeamID: &team.ID, Privacy: models.FolderPrivacyPublic}
+	require.NoError(t, db.Create(public).Error)
+	nested := &models.Folder{Name: "Nested", ParentID: &public.ID, TeamID: &team.ID, Privacy: models.FolderPrivacyTeam}
+	require.NoError(t, db.Create(nested).Error)
+	personal := &models.Folder{Name: "Mine", ParentID: &public.ID, UserID: 1, Privacy: models.FolderPrivacyPrivate}
+	require.NoError(t, db.Create(personal).Error)
+	kept := &models.Folder{Name: "Kept", TeamID: &other.ID, Privacy: models.FolderPrivacyTeam}
+	require.NoError(t, db.Create(kept).Error)
+
+	filed := &models.Paste{Title: "Filed", Privacy: "private", PrivateAccessID: "filed", UserID: "1", FolderID: &nested.ID}
+	require.NoError(t, db.Create(filed).Error)
+	trashed := &models.Paste{Title: "Trashed", Privacy: "private", PrivateAccessID: "trashed", UserID: "1", FolderID: &public.ID}
+	require.NoError(t, db.Create(trashed).Error)
+	require.NoError(t, db.Delete(trashed).Error)
+
+	require.NoError(t, teams.Delete(ctx, team.ID))
+
+	var folders []models.Folder
+	require.NoError(t, db.Order("id").Find(&folders).Error)
+	require.Len(t, folders, 2)
+	assert.Equal(t, personal.ID, folders[0].ID)
+	assert.Nil(t, folders[0].ParentID)
+	assert.Equal(t, kept.ID, folders[1].ID)
+
+	for _, id := range []uint64{filed.ID, trashed.ID} {
+		var paste models.Paste
+		require.NoError(t, db.Unscoped().First(&paste, id).Error)
+		assert.Nil(t, paste.FolderID, paste.Title)
+	}
+}
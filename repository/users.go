@@ -2,6 +2,7 @@ package repository
 
 import (
 	"memoria-backend/models"
+	"time"
 
 	"gorm.io/gorm"
 )
@@ -9,15 +10,32 @@ import (
 type UserRepository interface {
 	GetAll() ([]models.User, error)
 	GetByID(id uint64) (*models.User, error)
+	GetByEmail(email string) (*models.User, error)
+	GetByOIDCIdentity(issuer, subject string) (*models.User, error)
 	Create(user *models.User) (*models.User, error)
 	Update(user *models.User) (*models.User, error)
+	UpdateColumns(id uint, columns map[string]interface{}) error
 	Delete(id uint64) (uint64, error)
+	AdvanceTOTPStep(id uint, step int64) (bool, error)
+	ReplaceRecoveryCodes(userID uint, codeHashes []string) error
+	ConsumeRecoveryCode(userID uint, codeHash string) (bool, error)
+	ReserveTwoFactorAttempt(id uint, challengeID string, maxAttempts int) (bool, error)
+	LockTwoFactor(id uint, maxAttempts int, until time.Time) (bool, error)
+	EndTwoFactorChallenge(id uint, challengeID string) (bool, error)
+	ReserveTwoFactorCheck(id uint, maxAttempts int) (bool, error)
+	ClearTwoFactorFailures(id uint) error
 }
 
 type GormUserRepository struct {
 	db *gorm.DB
 }
 
+func NewUserRepository(db *gorm.DB) UserRepository {
+	return &GormUserRepository{
+		db: db,
+	}
+}
+
 func (r *GormUserRepository) GetAll() ([]models.User, error) {
 	var users []models.User
 
@@ -31,10 +49,21 @@ func (r *GormUserRepository) GetByID(id uint64) (*models.User, error) {
 	return &user, result.Error
 }
 
+func (r *GormUserRepository) GetByEmail(email string) (*models.User, error) {
+	var user models.User
+	result := r.db.Where("email = ?", email).First(&user)
+	return &user, result.Error
+}
+
+func (r *GormUserRepository) GetByOIDCIdentity(issuer, subject string) (*models.User, error) {
+	var user models.User
+	result := r.db.Where("oidc_issuer = ? AND oidc_subject = ?", issuer, subject).First(&user)
+	return &user, result.Error
+}
+
 func (r *GormUserRepository) Create(user *models.User) (*models.User, error) {
-	var createdUser models.User
-	result := r.db.Create(&user)
-	return &createdUser, result.Error
+	result := r.db.Create(user)
+	return user, result.Error
 }
 
 func (r *GormUserRepository) Update(user *models.User) (*models.User, error) {
@@ -43,8 +72,98 @@ func (r *GormUserRepository) Update(user *models.User) (*models.User, error) {
 	return &updatedUser, result.Error
 }
 
+// UpdateColumns writes the given columns without running model hooks, so the
+// already hashed password is never hashed a second time
+func (r *GormUserRepository) UpdateColumns(id uint, columns map[string]interface{}) error {
+	return r.db.Model(&models.User{}).Where("id = ?", id).UpdateColumns(columns).Error
+}
+
 func (r *GormUserRepository) Delete(id uint64) (uint64, error) {
 	var user models.User
 	result := r.db.Delete(&user, id)
 	return id, result.Error
 }
+
+// AdvanceTOTPStep records step as the last accepted TOTP time step. It reports
+// false when the step was already used, so a code can't be replayed.
+func (r *GormUserRepository) AdvanceTOTPStep(id uint, step int64) (bool, error) {
+	result := r.db.Model(&models.User{}).
+		Where("id = ? AND totp_last_step < ?", id, step).
+		UpdateColumn("totp_last_step", step)
+	return result.RowsAffected == 1, result.Error
+}
+
+// ReplaceRecoveryCodes removes all existing recovery codes for the user and stores the new set
+func (r *GormUserRepository) ReplaceRecoveryCodes(userID uint, codeHashes []string) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("user_id = ?", userID).Delete(&models.RecoveryCode{}).Error; err != nil {
+			return err
+		}
+
+		if len(codeHashes) == 0 {
+			return nil
+		}
+
+		codes := make([]models.RecoveryCode, len(codeHashes))
+		for i, hash := range codeHashes {
+			codes[i] = models.RecoveryCode{UserID: userID, CodeHash: hash}
+		}
+		return tx.Create(&codes).Error
+	})
+}
+
+// ConsumeRecoveryCode marks an unused recovery code as used. It reports false
+// when no matching unused code exists.
+func (r *GormUserRepository) ConsumeRecoveryCode(userID uint, codeHash string) (bool, error) {
+	result := r.db.Model(&models.RecoveryCode{}).
+		Where("user_id = ? AND code_hash = ? AND used_at IS NULL", userID, codeHash).
+		Update("used_at", time.Now())
+	return result.RowsAffected == 1, result.Error
+}
+
+// ReserveTwoFactorAttempt counts an attempt at the user's current login challenge before the
+// second factor is checked, so concurrent guesses can't exceed maxAttempts. It reports false
+// when the challenge was replaced or used, or its attempts are used up.
+func (r *GormUserRepository) ReserveTwoFactorAttempt(id uint, challengeID string, maxAttempts int) (bool, error) {
+	result := r.db.Model(&models.User{}).
+		Where("id = ? AND two_factor_challenge_id = ? AND two_factor_failures < ?", id, challengeID, maxAttempts).
+		UpdateColumn("two_factor_failures", gorm.Expr("two_factor_failures + 1"))
+	return result.RowsAffected == 1, result.Error
+}
+
+// LockTwoFactor drops the user's login challenge and refuses second factors until the given
+// time once maxAttempts were used up. It reports whether it locked.
+func (r *GormUserRepository) LockTwoFactor(id uint, maxAttempts int, until time.Time) (bool, error) {
+	result := r.db.Model(&models.User{}).
+		Where("id = ? AND two_factor_failures >= ?", id, maxAttempts).
+		UpdateColumns(map[string]interface{}{
+			"two_factor_challenge_id": "",
+			"two_factor_failures":     0,
+			"two_factor_locked_until": until,
+		})
+	return result.RowsAffected == 1, result.Error
+}
+
+// EndTwoFactorChallenge uses up the login challenge after an accepted second factor and
+// clears the failures. It reports false when another request used it first.
+func (r *GormUserRepository) EndTwoFactorChallenge(id uint, challengeID string) (bool, error) {
+	result := r.db.Model(&models.User{}).
+		Where("id = ? AND two_factor_challenge_id = ?", id, challengeID).
+		UpdateColumns(map[string]interface{}{"two_factor_challenge_id": "", "two_factor_failures": 0})
+	return result.RowsAffected == 1, result.Error
+}
+
+// ReserveTwoFactorCheck counts an attempt at a second factor confirming a change to the
+// user's two-factor settings. Attempts count against the same failures as login challenges.
+// It reports false when the attempts are used up.
+func (r *GormUserRepository) ReserveTwoFactorCheck(id uint, maxAttempts int) (bool, error) {
+	result := r.db.Model(&models.User{}).
+		Where("id = ? AND two_factor_failures < ?", id, maxAttempts).
+		UpdateColumn("two_factor_failures", gorm.Expr("two_factor_failures + 1"))
+	return result.RowsAffected == 1, result.Error
+}
+
+// ClearTwoFactorFailures forgets the user's wrong second factors after an accepted one
+func (r *GormUserRepository) ClearTwoFactorFailures(id uint) error {
+	return r.db.Model(&models.User{}).Where("id = ?", id).UpdateColumn("two_factor_failures", 0).Error
+}
@@ -0,0 +1,21 @@
+package router
+
+import (
+	"memoria-backend/handlers"
+	"memoria-backend/middleware"
+	"memoria-backend/models"
+	"memoria-backend/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+func RegisterAdminRoutes(rg *gin.RouterGroup, pasteService services.PasteService, authService services.AuthService, configService services.ConfigService) {
+	adminHandlers := handlers.NewAdminHandler(pasteService, configService)
+	admin := rg.Group("/admin")
+	// Purging bypasses every paste's permissions, only administrators may
+	admin.Use(middleware.RequireAuth(authService), middleware.RequireScope(models.ScopeAdmin))
+	{
+		admin.DELETE("/pastes/:id", adminHandlers.PurgePaste)
+		admin.POST("/trash/purge", adminHandlers.PurgeTrash)
+	}
+}
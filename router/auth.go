@@ -0,0 +1,35 @@
+package router
+
+import (
+	"memoria-backend/handlers"
+	"memoria-backend/middleware"
+	"memoria-backend/models"
+	"memoria-backend/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+func RegisterAuthRoutes(rg *gin.RouterGroup, authService services.AuthService, configService services.ConfigService) {
+	authHandlers := handlers.NewAuthHandler(authService, configService)
+
+	auth := rg.Group("/auth")
+	{
+		auth.GET("/methods", authHandlers.GetLoginMethods)
+		auth.POST("/login", authHandlers.Login)
+		auth.GET("/oidc/login", authHandlers.OIDCLogin)
+		auth.GET("/oidc/callback", authHandlers.OIDCCallback)
+		auth.POST("/2fa/verify", authHandlers.VerifyTwoFactor)
+		auth.POST("/password/forgot", authHandlers.ForgotPassword)
+		auth.POST("/password/reset", authHandlers.ResetPassword)
+		auth.POST("/verify", authHandlers.VerifyEmail)
+		auth.POST("/verify/resend", middleware.RequireAuth(authService), authHandlers.ResendVerification)
+
+		// Enrolment also accepts the restricted token handed out when 2FA is enforced at login
+		enrollment := middleware.RequireAuth(authService, models.TokenPurposeAccess, models.TokenPurposeEnrollment)
+		auth.POST("/2fa/enroll", enrollment, authHandlers.EnrollTOTP)
+		auth.POST("/2fa/confirm", enrollment, authHandlers.ConfirmTOTP)
+
+		auth.POST("/2fa/disable", middleware.RequireAuth(authService), authHandlers.DisableTOTP)
+		auth.POST("/2fa/recovery-codes", middleware.RequireAuth(authService), authHandlers.RegenerateRecoveryCodes)
+	}
+}
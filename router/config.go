@@ -2,14 +2,18 @@ package router
 
 import (
 	"memoria-backend/handlers"
+	"memoria-backend/middleware"
+	"memoria-backend/models"
 	"memoria-backend/services"
 
 	"github.com/gin-gonic/gin"
 )
 
-func RegisterConfigRoutes(rg *gin.RouterGroup, service services.ConfigService) {
+func RegisterConfigRoutes(rg *gin.RouterGroup, service services.ConfigService, authService services.AuthService) {
 	configHandlers := handlers.NewConfigHandler(service)
 	configs := rg.Group("/config")
+	// The configuration holds secrets, only administrators may read or change it
+	configs.Use(middleware.RequireAuth(authService), middleware.RequireScope(models.ScopeAdmin))
 	{
 
 		configs.GET("", configHandlers.GetConfig)
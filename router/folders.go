@@ -0,0 +1,28 @@
+package router
+
+import (
+	"memoria-backend/handlers"
+	"memoria-backend/middleware"
+	"memoria-backend/models"
+	"memoria-backend/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+func RegisterFolderRoutes(rg *gin.RouterGroup, folderService services.FolderService, authService services.AuthService) {
+	folderHandlers := handlers.NewFolderHandler(folderService)
+
+	requireAuth := middleware.RequireAuth(authService)
+	read := middleware.RequireScope(models.ScopePastesRead)
+	write := middleware.RequireScope(models.ScopePastesWrite)
+
+	folders := rg.Group("/folders")
+	{
+		folders.GET("", requireAuth, read, folderHandlers.ListFolders)
+		folders.POST("", requireAuth, write, folderHandlers.CreateFolder)
+		// Public folders can be browsed anonymously
+		folders.GET("/:id", middleware.OptionalAuth(authService, models.ScopePastesRead), folderHandlers.GetFolder)
+		folders.PUT("/:id", requireAuth, write, folderHandlers.UpdateFolder)
+		folders.DELETE("/:id", requireAuth, write, folderHandlers.DeleteFolder)
+	}
+}
@@ -0,0 +1,15 @@
+package router
+
+import (
+	"memoria-backend/handlers"
+	"memoria-backend/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+func RegisterLanguageRoutes(rg *gin.RouterGroup, languageService services.LanguageService) {
+	languageHandlers := handlers.NewLanguageHandler(languageService)
+
+	rg.GET("/languages", languageHandlers.ListLanguages)
+	rg.POST("/paste/detect-language", languageHandlers.DetectLanguage)
+}
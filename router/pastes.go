@@ -2,26 +2,81 @@ package router
 
 import (
 	"memoria-backend/handlers"
-	"memoria-backend/repository"
+	"memoria-backend/middleware"
+	"memoria-backend/models"
 	"memoria-backend/services"
 
 	"github.com/gin-gonic/gin"
-	"gorm.io/gorm"
 )
 
-func RegisterPasteRoutes(rg *gin.RouterGroup, db *gorm.DB) {
-	pasteRepo := repository.NewPasteRepository(db)
-	pasteService := services.NewPasteService(pasteRepo)
-	pasteHandlers := handlers.NewPasteHandler(pasteService)
+func RegisterPasteRoutes(rg *gin.RouterGroup, pasteService services.PasteService, highlightService services.HighlightService, collabService services.CollabService, authService services.AuthService, configService services.ConfigService) {
+	pasteHandlers := handlers.NewPasteHandler(pasteService, highlightService, collabService, configService)
+
+	// Pastes can be used anonymously, a token that is sent must carry the matching scope
+	read := middleware.OptionalAuth(authService, models.ScopePastesRead)
+	write := middleware.OptionalAuth(authService, models.ScopePastesWrite)
 
 	pastes := rg.Group("/paste")
 	{
-		pastes.POST("", pasteHandlers.CreatePaste)
-		pastes.GET("/all", pasteHandlers.ListPastes)
-		pastes.GET("/:id", pasteHandlers.GetPaste)
-		pastes.GET("/private/:accessId", pasteHandlers.GetPasteByPrivateAccessID)
-		pastes.POST("/private/batch", pasteHandlers.GetPastesByPrivateAccessIDs)
-		pastes.PUT("", pasteHandlers.UpdatePaste)
-		pastes.DELETE("/:id", pasteHandlers.DeletePaste)
+		pastes.POST("", write, pasteHandlers.CreatePaste)
+		pastes.GET("/all", read, pasteHandlers.ListPastes)
+		pastes.GET("/tags", read, pasteHandlers.SuggestTags)
+		pastes.GET("/themes", pasteHandlers.ListHighlightThemes)
+		pastes.GET("/themes/:theme/css", pasteHandlers.GetHighlightThemeCSS)
+		pastes.GET("/:id", read, pasteHandlers.GetPaste)
+		pastes.GET("/:id/raw", read, pasteHandlers.GetRawPaste)
+		pastes.GET("/:id/html", read, pasteHandlers.GetPasteHTML)
+		pastes.GET("/:id/toc", read, pasteHandlers.GetPasteTOC)
+		pastes.GET("/:id/collab", read, pasteHandlers.CollaboratePaste)
+		pastes.GET("/:id/files/:name/raw", read, pasteHandlers.GetRawPasteFile)
+		pastes.GET("/:id/zip", read, pasteHandlers.DownloadPasteArchive)
+		pastes.POST("/:id/fork", write, pasteHandlers.ForkPaste)
+		pastes.GET("/:id/forks", read, pasteHandlers.ListPasteForks)
+		pastes.GET("/:id/backlinks", read, pasteHandlers.ListPasteBacklinks)
+		pastes.POST("/:id/attachments", write, pasteHandlers.UploadPasteAttachment)
+		pastes.GET("/:id/attachments/:attachmentId", read, pasteHandlers.GetPasteAttachment)
+		pastes.DELETE("/:id/attachments/:attachmentId", write, pasteHandlers.DeletePasteAttachment)
+		pastes.HEAD("/content/:hash", read, pasteHandlers.HeadPasteContent)
+		pastes.GET("/private/:accessId", read, pasteHandlers.GetPasteByPrivateAccessID)
+		pastes.PUT("/private/:accessId", write, pasteHandlers.UpdatePasteByAccessID)
+		pastes.GET("/private/:accessId/attachments/:attachmentId", read, pasteHandlers.GetPasteAttachmentByAccessID)
+		pastes.POST("/private/batch", read, pasteHandlers.GetPastesByPrivateAccessIDs)
+		pastes.PUT("", write, pasteHandlers.UpdatePaste)
+		pastes.PATCH("/:id", write, pasteHandlers.PatchPaste)
+		pastes.DELETE("/:id", write, pasteHandlers.DeletePaste)
+	}
+
+	// Sharing is tied to an account, so these routes always need a token
+	grants := pastes.Group("/:id/grants", middleware.RequireAuth(authService))
+	{
+		grants.GET("", middleware.RequireScope(models.ScopePastesRead), pasteHandlers.ListPasteGrants)
+		grants.POST("", middleware.RequireScope(models.ScopePastesWrite), pasteHandlers.CreatePasteGrant)
+		grants.DELETE("/:grantId", middleware.RequireScope(models.ScopePastesWrite), pasteHandlers.DeletePasteGrant)
 	}
+
+	links := pastes.Group("/:id/links", middleware.RequireAuth(authService))
+	{
+		links.GET("", middleware.RequireScope(models.ScopePastesRead), pasteHandlers.ListShareLinks)
+		links.POST("", middleware.RequireScope(models.ScopePastesWrite), pasteHandlers.CreateShareLink)
+		links.DELETE("/:linkId", middleware.RequireScope(models.ScopePastesWrite), pasteHandlers.RevokeShareLink)
+		links.POST("/:linkId/rotate", middleware.RequireScope(models.ScopePastesWrite), pasteHandlers.RotateShareLink)
+	}
+	pastes.GET("/:id/comments", read, pasteHandlers.ListPasteComments)
+	comments := pastes.Group("/:id/comments", middleware.RequireAuth(authService), middleware.RequireScope(models.ScopePastesWrite))
+	{
+		comments.POST("", pasteHandlers.CreatePasteComment)
+		comments.PUT("/settings", pasteHandlers.UpdatePasteCommentSettings)
+		comments.PUT("/:commentId", pasteHandlers.UpdatePasteComment)
+		comments.DELETE("/:commentId", pasteHandlers.DeletePasteComment)
+		comments.POST("/:commentId/resolve", pasteHandlers.ResolvePasteComment)
+		comments.POST("/:commentId/unresolve", pasteHandlers.UnresolvePasteComment)
+	}
+
+	pastes.PUT("/:id/folder", middleware.RequireAuth(authService), middleware.RequireScope(models.ScopePastesWrite), pasteHandlers.MovePasteToFolder)
+	pastes.POST("/:id/rotate-access-id", middleware.RequireAuth(authService), middleware.RequireScope(models.ScopePastesWrite), pasteHandlers.RotatePrivateAccessID)
+	pastes.POST("/:id/restore", middleware.RequireAuth(authService), middleware.RequireScope(models.ScopePastesWrite), pasteHandlers.RestorePaste)
+
+	rg.GET("/users/me/shared", middleware.RequireAuth(authService), middleware.RequireScope(models.ScopePastesRead), pasteHandlers.ListSharedPastes)
+	rg.GET("/users/me/graph", middleware.RequireAuth(authService), middleware.RequireScope(models.ScopePastesRead), pasteHandlers.GetPasteGraph)
+	rg.GET("/users/me/trash", middleware.RequireAuth(authService), middleware.RequireScope(models.ScopePastesRead), pasteHandlers.ListTrash)
 }
@@ -3,6 +3,8 @@ package router
 
 import (
 	"context"
+	"memoria-backend/middleware"
+	"memoria-backend/repository"
 	"memoria-backend/services"
 	"memoria-backend/utils"
 
@@ -11,7 +13,7 @@ import (
 	"gorm.io/gorm"
 )
 
-func Setup(ctx context.Context, db *gorm.DB, configService services.ConfigService) *gin.Engine {
+func Setup(ctx context.Context, db *gorm.DB, configService services.ConfigService, pasteStorage repository.PasteStorage) *gin.Engine {
 	r := gin.Default()
 	log := utils.LoggerFromContext(ctx)
 
@@ -25,19 +27,50 @@ func Setup(ctx context.Context, db *gorm.DB, configService services.ConfigServic
 		Msg("Allowed Origins set.")
 
 	config.AllowMethods = []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"}
-	config.AllowHeaders = []string{"Origin", "Authorization", "Content-Type"}
+	config.AllowHeaders = []string{"Origin", "Authorization", "Content-Type", "If-Match", "If-None-Match"}
+	config.ExposeHeaders = []string{"ETag"}
 	r.Use(cors.New(config))
+	r.Use(middleware.BodySizeLimit(appConfig.Limits.MaxRequestBytes))
 
 	// Setup API v1 routes
 	v1 := r.Group("api/v1")
 
 	healthService := services.NewHealthService(db)
 
+	userRepo := repository.NewUserRepository(db)
+	apiTokenRepo := repository.NewAPITokenRepository(db)
+	mailer := services.NewMailer(appConfig)
+	authService := services.NewAuthService(userRepo, apiTokenRepo, configService, mailer)
+
+	pasteRepo := repository.NewPasteRepository(db, pasteStorage)
+	teamRepo := repository.NewTeamRepository(db)
+	pasteGrantRepo := repository.NewPasteGrantRepository(db)
+	shareLinkRepo := repository.NewShareLinkRepository(db)
+	attachmentRepo := repository.NewAttachmentRepository(db, pasteStorage)
+	folderRepo := repository.NewFolderRepository(db)
+	pasteLinkRepo := repository.NewPasteLinkRepository(db)
+	pasteCommentRepo := repository.NewPasteCommentRepository(db)
+	teamService := services.NewTeamService(teamRepo, pasteRepo, configService)
+	quotaService := services.NewQuotaService(pasteRepo, configService)
+	languageService := services.NewLanguageService()
+	pasteService := services.NewPasteService(pasteRepo, teamRepo, pasteGrantRepo, shareLinkRepo, userRepo, attachmentRepo, folderRepo, pasteLinkRepo, pasteCommentRepo, languageService, quotaService, configService)
+	highlightService := services.NewHighlightService(configService)
+	collabService := services.NewCollabService(pasteService, services.NewMemoryPubSub(), configService)
+	folderService := services.NewFolderService(folderRepo, pasteRepo, teamRepo)
+
+	// Deleted pastes are purged for good once they've been in the trash for the retention period
+	go services.PurgeTrashPeriodically(ctx, pasteService, configService)
+
 	// Register all routes
-	RegisterUserRoutes(v1, db)
-	RegisterConfigRoutes(v1, configService)
+	RegisterUserRoutes(v1, db, authService, apiTokenRepo, quotaService)
+	RegisterAuthRoutes(v1, authService, configService)
+	RegisterConfigRoutes(v1, configService, authService)
+	RegisterAdminRoutes(v1, pasteService, authService, configService)
 	RegisterHealthRoutes(v1, healthService)
-	RegisterPasteRoutes(v1, db)
+	RegisterTeamRoutes(v1, teamService, authService)
+	RegisterPasteRoutes(v1, pasteService, highlightService, collabService, authService, configService)
+	RegisterFolderRoutes(v1, folderService, authService)
+	RegisterLanguageRoutes(v1, languageService)
 
 	return r
 }
@@ -0,0 +1,34 @@
+package router
+
+import (
+	"memoria-backend/handlers"
+	"memoria-backend/middleware"
+	"memoria-backend/models"
+	"memoria-backend/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+func RegisterTeamRoutes(rg *gin.RouterGroup, teamService services.TeamService, authService services.AuthService) {
+	teamHandlers := handlers.NewTeamHandler(teamService)
+
+	// Tokens limited to reading can look at teams but not change them
+	read := middleware.RequireScope(models.ScopePastesRead)
+	write := middleware.RequireScope(models.ScopePastesWrite)
+
+	teams := rg.Group("/teams", middleware.RequireAuth(authService))
+	{
+		teams.POST("", write, teamHandlers.CreateTeam)
+		teams.GET("", read, teamHandlers.ListTeams)
+		teams.POST("/join", write, teamHandlers.JoinTeam)
+		teams.GET("/:id", read, teamHandlers.GetTeam)
+		teams.PUT("/:id", write, teamHandlers.UpdateTeam)
+		teams.DELETE("/:id", write, teamHandlers.DeleteTeam)
+		teams.GET("/:id/pastes", read, teamHandlers.ListTeamPastes)
+		teams.PUT("/:id/members/:userId", write, teamHandlers.UpdateTeamMember)
+		teams.DELETE("/:id/members/:userId", write, teamHandlers.RemoveTeamMember)
+		teams.POST("/:id/invites", write, teamHandlers.CreateTeamInvite)
+		teams.GET("/:id/invites", read, teamHandlers.ListTeamInvites)
+		teams.DELETE("/:id/invites/:inviteId", write, teamHandlers.RevokeTeamInvite)
+	}
+}
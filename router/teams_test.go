@@ -0,0 +1,70 @@
+package router
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"memoria-backend/models"
+	"memoria-backend/services"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+// testAuthService accepts the tokens "read" and "write", API tokens with the matching scopes
+type testAuthService struct {
+	services.AuthService
+}
+
+func (s *testAuthService) ValidateToken(ctx context.Context, token string) (*models.AuthIdentity, error) {
+	scopes := map[string][]string{
+		"read":  {models.ScopePastesRead},
+		"write": {models.ScopePastesRead, models.ScopePastesWrite},
+	}[token]
+	if scopes == nil {
+		return nil, errors.New("invalid token")
+	}
+	return &models.AuthIdentity{UserID: 1, Purpose: models.TokenPurposeAccess, Scopes: scopes}, nil
+}
+
+// testTeamService creates and lists teams without storing them
+type testTeamService struct {
+	services.TeamService
+	created int
+}
+
+func (s *testTeamService) Create(ctx context.Context, userID uint, req *models.CreateTeamRequest) (*models.TeamData, error) {
+	s.created++
+	return &models.TeamData{Team: &models.Team{Name: req.Name}, Role: models.TeamRoleOwner}, nil
+}
+
+func (s *testTeamService) GetByUserID(ctx context.Context, userID uint) ([]models.TeamData, error) {
+	return nil, nil
+}
+
+func TestTeamRoutesRequireScopes(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	engine := gin.New()
+	teamService := &testTeamService{}
+	RegisterTeamRoutes(engine.Group(""), teamService, &testAuthService{})
+
+	send := func(method, token string) int {
+		req := httptest.NewRequest(method, "/teams", strings.NewReader(`{"name":"Platform Team"}`))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer "+token)
+		recorder := httptest.NewRecorder()
+		engine.ServeHTTP(recorder, req)
+		return recorder.Code
+	}
+
+	assert.Equal(t, http.StatusForbidden, send(http.MethodPost, "read"))
+	assert.Zero(t, teamService.created)
+	assert.Equal(t, http.StatusOK, send(http.MethodGet, "read"))
+
+	assert.Equal(t, http.StatusCreated, send(http.MethodPost, "write"))
+	assert.Equal(t, 1, teamService.created)
+}
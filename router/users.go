@@ -3,18 +3,34 @@ package router
 
 import (
 	"memoria-backend/handlers"
+	"memoria-backend/middleware"
+	"memoria-backend/repository"
+	"memoria-backend/services"
 
 	"github.com/gin-gonic/gin"
 	"gorm.io/gorm"
 )
 
-func RegisterUserRoutes(rg *gin.RouterGroup, db *gorm.DB) {
+func RegisterUserRoutes(rg *gin.RouterGroup, db *gorm.DB, authService services.AuthService, apiTokenRepo repository.APITokenRepository, quotaService services.QuotaService) {
+	apiTokenService := services.NewAPITokenService(apiTokenRepo)
+	apiTokenHandlers := handlers.NewAPITokenHandler(apiTokenService)
+	usageHandlers := handlers.NewUsageHandler(quotaService)
+
 	users := rg.Group("/users")
 	{
-		users.POST("", handlers.CreateUser(db))
+		users.POST("", handlers.CreateUser(db, authService))
 		users.GET("", handlers.GetUsers(db))
 		users.GET("/:id", handlers.GetUser(db))
-		users.PUT("/:id", handlers.UpdateUser(db))
-		users.DELETE("/:id", handlers.DeleteUser(db))
+		users.PUT("/:id", middleware.RequireAuth(authService), handlers.UpdateUser(db, authService))
+		users.DELETE("/:id", middleware.RequireAuth(authService), handlers.DeleteUser(db))
+	}
+
+	// Tokens can only be managed from a logged in session, the service refuses API tokens
+	me := users.Group("/me", middleware.RequireAuth(authService))
+	{
+		me.POST("/tokens", apiTokenHandlers.CreateAPIToken)
+		me.GET("/tokens", apiTokenHandlers.ListAPITokens)
+		me.DELETE("/tokens/:id", apiTokenHandlers.RevokeAPIToken)
+		me.GET("/usage", usageHandlers.GetUsage)
 	}
 }
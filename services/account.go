@@ -0,0 +1,238 @@
+package services
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"memoria-backend/models"
+	"memoria-backend/utils"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrEmailAlreadyVerified = errors.New("email address is already verified")
+	ErrEmailNotVerified     = errors.New("a verified email address is required for this action")
+	ErrPasswordResetSSO     = errors.New("this account signs in with single sign-on and has no password to reset")
+)
+
+// accountFingerprint identifies the state a password reset or verification token was
+// issued for. Changing the password or email changes it, so each token works only once.
+func accountFingerprint(user *models.User, purpose string) string {
+	value := user.Password
+	if purpose == models.TokenPurposeVerify {
+		value = strings.ToLower(user.Email)
+	}
+	sum := sha256.Sum256([]byte(purpose + ":" + value))
+	return hex.EncodeToString(sum[:])
+}
+
+// issueAccountToken signs a single-use password reset or verification token
+func (s *authService) issueAccountToken(user *models.User, purpose string, ttl time.Duration) (string, error) {
+	now := time.Now()
+	claims := authClaims{
+		UserID:      user.ID,
+		Purpose:     purpose,
+		Fingerprint: accountFingerprint(user, purpose),
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject:   fmt.Sprint(user.ID),
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(ttl)),
+		},
+	}
+	return jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(s.signingKey())
+}
+
+// parseAccountToken validates a single-use token and returns the user it was issued for
+func (s *authService) parseAccountToken(token, purpose string) (*models.User, error) {
+	claims, err := s.parseToken(token, purpose)
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := s.userRepo.GetByID(uint64(claims.UserID))
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+
+	expected := accountFingerprint(user, purpose)
+	if subtle.ConstantTimeCompare([]byte(expected), []byte(claims.Fingerprint)) != 1 {
+		return nil, ErrInvalidToken
+	}
+	return user, nil
+}
+
+// sendAccountEmail renders an account email template and sends it to the user
+func (s *authService) sendAccountEmail(ctx context.Context, user *models.User, template, subject, path, token string, ttl time.Duration) error {
+	cfg := s.configService.GetConfig()
+
+	link := strings.TrimRight(cfg.App.AppURL, "/") + path + "?token=" + url.QueryEscape(token)
+	data := struct {
+		Name      string
+		AppName   string
+		Link      string
+		ExpiresIn string
+	}{
+		Name:      user.Name,
+		AppName:   cfg.App.Name,
+		Link:      link,
+		ExpiresIn: formatDuration(ttl),
+	}
+
+	textBody, htmlBody, err := RenderEmail(template, data)
+	if err != nil {
+		return err
+	}
+
+	return s.mailer.Send(ctx, &EmailMessage{
+		To:       user.Email,
+		Subject:  fmt.Sprintf(subject, cfg.App.Name),
+		TextBody: textBody,
+		HTMLBody: htmlBody,
+	})
+}
+
+// formatDuration renders a whole number of hours or minutes for email copy
+func formatDuration(d time.Duration) string {
+	if d >= time.Hour && d%time.Hour == 0 {
+		if hours := int(d / time.Hour); hours != 1 {
+			return fmt.Sprintf("%d hours", hours)
+		}
+		return "1 hour"
+	}
+	if minutes := int(d / time.Minute); minutes != 1 {
+		return fmt.Sprintf("%d minutes", minutes)
+	}
+	return "1 minute"
+}
+
+// RequestPasswordReset emails a reset link when the address belongs to a local account.
+// Accounts linked to single sign-on get nothing, a password would let them around the
+// identity provider's checks. It succeeds either way, so it can't be used to probe for emails.
+func (s *authService) RequestPasswordReset(ctx context.Context, email string) error {
+	log := utils.LoggerFromContext(ctx)
+	cfg := s.configService.GetConfig()
+
+	if !cfg.Auth.EnableLocal {
+		return ErrLocalLoginDisabled
+	}
+
+	user, err := s.userRepo.GetByEmail(strings.TrimSpace(email))
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			log.Info().Msg("Password reset requested for unknown email")
+			return nil
+		}
+		return err
+	}
+	if user.OIDCSubject != nil {
+		log.Info().Uint("userId", user.ID).Msg("Password reset requested for single sign-on account")
+		return nil
+	}
+
+	ttl := time.Duration(cfg.Auth.PasswordResetTTL) * time.Minute
+	token, err := s.issueAccountToken(user, models.TokenPurposeReset, ttl)
+	if err != nil {
+		return err
+	}
+
+	// A delivery failure is only logged, an error here would tell that the account exists
+	if err := s.sendAccountEmail(ctx, user, EmailTemplatePasswordReset, "Reset your %s password", "/reset-password", token, ttl); err != nil {
+		log.Error().Err(err).Uint("userId", user.ID).Msg("Failed to send password reset email")
+		return nil
+	}
+
+	log.Info().Uint("userId", user.ID).Msg("Password reset email sent")
+	return nil
+}
+
+func (s *authService) ResetPassword(ctx context.Context, req *models.ResetPasswordRequest) error {
+	log := utils.LoggerFromContext(ctx)
+
+	if !s.configService.GetConfig().Auth.EnableLocal {
+		return ErrLocalLoginDisabled
+	}
+
+	user, err := s.parseAccountToken(req.Token, models.TokenPurposeReset)
+	if err != nil {
+		return err
+	}
+	// Resets issued before the account was linked to single sign-on no longer apply
+	if user.OIDCSubject != nil {
+		return ErrPasswordResetSSO
+	}
+
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+
+	// The reset link was delivered to the user's inbox, which also proves the address
+	columns := map[string]interface{}{"password": string(hashedPassword)}
+	if !user.EmailVerified {
+		columns["email_verified"] = true
+		columns["email_verified_at"] = time.Now()
+	}
+	if err := s.userRepo.UpdateColumns(user.ID, columns); err != nil {
+		return err
+	}
+
+	log.Info().Uint("userId", user.ID).Msg("Password reset")
+	return nil
+}
+
+func (s *authService) SendVerificationEmail(ctx context.Context, userID uint) error {
+	log := utils.LoggerFromContext(ctx)
+
+	user, err := s.userRepo.GetByID(uint64(userID))
+	if err != nil {
+		return err
+	}
+	if user.EmailVerified {
+		return ErrEmailAlreadyVerified
+	}
+
+	ttl := time.Duration(s.configService.GetConfig().Auth.VerificationTTL) * time.Hour
+	token, err := s.issueAccountToken(user, models.TokenPurposeVerify, ttl)
+	if err != nil {
+		return err
+	}
+
+	if err := s.sendAccountEmail(ctx, user, EmailTemplateVerifyEmail, "Verify your %s email address", "/verify-email", token, ttl); err != nil {
+		log.Error().Err(err).Uint("userId", user.ID).Msg("Failed to send verification email")
+		return err
+	}
+
+	log.Info().Uint("userId", user.ID).Msg("Verification email sent")
+	return nil
+}
+
+func (s *authService) VerifyEmail(ctx context.Context, token string) error {
+	log := utils.LoggerFromContext(ctx)
+
+	user, err := s.parseAccountToken(token, models.TokenPurposeVerify)
+	if err != nil {
+		return err
+	}
+	if user.EmailVerified {
+		return ErrEmailAlreadyVerified
+	}
+
+	if err := s.userRepo.UpdateColumns(user.ID, map[string]interface{}{
+		"email_verified":    true,
+		"email_verified_at": time.Now(),
+	}); err != nil {
+		return err
+	}
+
+	log.Info().Uint("userId", user.ID).Msg("Email address verified")
+	return nil
+}
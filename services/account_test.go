@@ -0,0 +1,78 @@
+package services
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"memoria-backend/models"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// testMailer keeps the messages it's asked to send
+type testMailer struct {
+	lock     sync.Mutex
+	messages []*EmailMessage
+}
+
+func (m *testMailer) Send(ctx context.Context, msg *EmailMessage) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.messages = append(m.messages, msg)
+	return nil
+}
+
+func newTestAccountAuthService(t *testing.T) (*authService, *testUserRepository, *testMailer) {
+	cfg := &models.Configuration{}
+	cfg.App.Name = "Memoria"
+	cfg.App.AppURL = "http://memoria.test"
+	cfg.Auth.EnableLocal = true
+	cfg.Auth.JWTSecret = "test-secret"
+	cfg.Auth.PasswordResetTTL = 30
+
+	users := newTestUserRepository()
+	mailer := &testMailer{}
+	service := NewAuthService(users, nil, &testConfigService{config: cfg}, mailer).(*authService)
+	return service, users, mailer
+}
+
+func TestPasswordResetIgnoresSingleSignOnAccounts(t *testing.T) {
+	service, users, mailer := newTestAccountAuthService(t)
+	subject := "alice"
+	_, err := users.Create(&models.User{Name: "Alice", Email: "alice@example.com", EmailVerified: true, OIDCSubject: &subject})
+	require.NoError(t, err)
+	_, err = users.Create(&models.User{Name: "Bob", Email: "bob@example.com", EmailVerified: true})
+	require.NoError(t, err)
+
+	// Linked accounts succeed like unknown addresses do, but get no link
+	require.NoError(t, service.RequestPasswordReset(context.Background(), "alice@example.com"))
+	assert.Empty(t, mailer.messages)
+
+	require.NoError(t, service.RequestPasswordReset(context.Background(), "bob@example.com"))
+	require.Len(t, mailer.messages, 1)
+	assert.Equal(t, "bob@example.com", mailer.messages[0].To)
+}
+
+func TestResetPasswordRefusesSingleSignOnAccounts(t *testing.T) {
+	service, users, _ := newTestAccountAuthService(t)
+	hash, err := bcrypt.GenerateFromPassword([]byte("old password"), bcrypt.MinCost)
+	require.NoError(t, err)
+	user, err := users.Create(&models.User{Name: "Alice", Email: "alice@example.com", Password: string(hash), EmailVerified: true})
+	require.NoError(t, err)
+
+	// A reset link sent before the account was linked to single sign-on
+	token, err := service.issueAccountToken(user, models.TokenPurposeReset, time.Hour)
+	require.NoError(t, err)
+	require.NoError(t, users.UpdateColumns(user.ID, map[string]interface{}{"oidc_issuer": "https://idp.example.com", "oidc_subject": "alice"}))
+
+	err = service.ResetPassword(context.Background(), &models.ResetPasswordRequest{Token: token, Password: "new password"})
+	assert.ErrorIs(t, err, ErrPasswordResetSSO)
+
+	stored, err := users.GetByID(uint64(user.ID))
+	require.NoError(t, err)
+	assert.NoError(t, bcrypt.CompareHashAndPassword([]byte(stored.Password), []byte("old password")))
+}
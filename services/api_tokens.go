@@ -0,0 +1,137 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"memoria-backend/models"
+	"memoria-backend/repository"
+	"memoria-backend/utils"
+	"time"
+)
+
+var (
+	ErrAPITokenNotFound        = errors.New("API token not found")
+	ErrAPITokenScopeNotAllowed = errors.New("you can't grant a scope you don't have")
+	ErrAPITokenSessionNeeded   = errors.New("API tokens can only be managed from a logged in session")
+	ErrAPITokenExpiryInPast    = errors.New("expiry must be in the future")
+)
+
+const (
+	// apiTokenPrefixLength is how much of the token is stored in plaintext to help users tell tokens apart
+	apiTokenPrefixLength = len(models.APITokenPrefix) + 8
+
+	// apiTokenLastUsedInterval limits how often last-used timestamps are written
+	apiTokenLastUsedInterval = time.Minute
+)
+
+type APITokenService interface {
+	Create(ctx context.Context, identity *models.AuthIdentity, req *models.CreateAPITokenRequest) (*models.APITokenData, error)
+	List(ctx context.Context, identity *models.AuthIdentity) ([]models.APIToken, error)
+	Revoke(ctx context.Context, identity *models.AuthIdentity, id uint) error
+}
+
+type apiTokenService struct {
+	repo repository.APITokenRepository
+}
+
+// NewAPITokenService creates a new personal API token service
+func NewAPITokenService(repo repository.APITokenRepository) APITokenService {
+	return &apiTokenService{
+		repo: repo,
+	}
+}
+
+// generateAPIToken creates a new random token with the API token prefix
+func generateAPIToken() (string, error) {
+	bytes := make([]byte, 32)
+	if _, err := rand.Read(bytes); err != nil {
+		return "", err
+	}
+	return models.APITokenPrefix + hex.EncodeToString(bytes), nil
+}
+
+// hashAPIToken returns the SHA-256 hex digest stored in place of the token
+func hashAPIToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// requireSession refuses callers authenticated with an API token. A leaked token must not be
+// able to mint further tokens, nor list or revoke the user's other tokens.
+func requireSession(identity *models.AuthIdentity) error {
+	if identity.TokenID != 0 {
+		return ErrAPITokenSessionNeeded
+	}
+	return nil
+}
+
+func (s *apiTokenService) Create(ctx context.Context, identity *models.AuthIdentity, req *models.CreateAPITokenRequest) (*models.APITokenData, error) {
+	log := utils.LoggerFromContext(ctx)
+
+	if err := requireSession(identity); err != nil {
+		return nil, err
+	}
+
+	for _, scope := range req.Scopes {
+		if !identity.HasScope(scope) {
+			return nil, ErrAPITokenScopeNotAllowed
+		}
+	}
+
+	if req.ExpiresAt != nil && !req.ExpiresAt.After(time.Now()) {
+		return nil, ErrAPITokenExpiryInPast
+	}
+
+	plaintext, err := generateAPIToken()
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to generate API token")
+		return nil, err
+	}
+
+	token := &models.APIToken{
+		UserID:    identity.UserID,
+		Name:      req.Name,
+		Prefix:    plaintext[:apiTokenPrefixLength],
+		TokenHash: hashAPIToken(plaintext),
+		Scopes:    req.Scopes,
+		ExpiresAt: req.ExpiresAt,
+	}
+
+	createdToken, err := s.repo.Create(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+
+	log.Info().Uint("userId", identity.UserID).Str("prefix", createdToken.Prefix).Strs("scopes", createdToken.Scopes).Msg("Created API token")
+	return &models.APITokenData{APIToken: createdToken, Token: plaintext}, nil
+}
+
+func (s *apiTokenService) List(ctx context.Context, identity *models.AuthIdentity) ([]models.APIToken, error) {
+	if err := requireSession(identity); err != nil {
+		return nil, err
+	}
+	return s.repo.GetByUserID(ctx, identity.UserID)
+}
+
+func (s *apiTokenService) Revoke(ctx context.Context, identity *models.AuthIdentity, id uint) error {
+	log := utils.LoggerFromContext(ctx)
+
+	if err := requireSession(identity); err != nil {
+		return err
+	}
+	userID := identity.UserID
+
+	deleted, err := s.repo.Delete(ctx, userID, id)
+	if err != nil {
+		return err
+	}
+	if !deleted {
+		return ErrAPITokenNotFound
+	}
+
+	log.Info().Uint("userId", userID).Uint("tokenId", id).Msg("Revoked API token")
+	return nil
+}
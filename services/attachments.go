@@ -0,0 +1,138 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"io"
+	"memoria-backend/models"
+	"memoria-backend/utils"
+	"slices"
+	"strings"
+	"unicode"
+
+	"github.com/gabriel-vasile/mimetype"
+)
+
+var (
+	ErrAttachmentNotFound    = errors.New("attachment not found")
+	ErrAttachmentNoThumbnail = errors.New("attachment has no thumbnail")
+	ErrAttachmentImage       = errors.New("attachment looks like an image but can't be decoded")
+)
+
+// thumbnailSize is the largest width and height of attachment thumbnails
+const thumbnailSize = 320
+
+// imageTypes are the image formats that get their metadata stripped and a thumbnail
+var imageTypes = []string{"image/png", "image/jpeg", "image/gif", "image/webp"}
+
+// attachmentFileName reduces an uploaded file name to its base name without control
+// characters, so it's safe to hand back in Content-Disposition headers
+func attachmentFileName(name string) string {
+	if i := strings.LastIndexAny(name, `/\`); i >= 0 {
+		name = name[i+1:]
+	}
+	name = strings.TrimSpace(strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) {
+			return -1
+		}
+		return r
+	}, name))
+	if len(name) > 255 {
+		name = strings.ToValidUTF8(name[:255], "")
+	}
+	if name == "" || name == "." || name == ".." {
+		return "attachment"
+	}
+	return name
+}
+
+// AddAttachment attaches a file to the paste. Its type is sniffed from the data, whatever
+// the client claims. Images have their metadata stripped and get a thumbnail.
+func (s *pasteService) AddAttachment(ctx context.Context, pasteID uint64, userID uint, fileName string, data []byte) (*models.Attachment, error) {
+	log := utils.LoggerFromContext(ctx)
+
+	paste, err := s.repo.GetByID(ctx, pasteID)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.CanEdit(ctx, paste, userID); err != nil {
+		return nil, err
+	}
+
+	detected := mimetype.Detect(data)
+	attachment := &models.Attachment{
+		FileName: attachmentFileName(fileName),
+		MIMEType: detected.String(),
+	}
+
+	var thumbnail []byte
+	if slices.Contains(imageTypes, detected.String()) {
+		if data, err = utils.StripImageMetadata(detected.String(), data); err != nil {
+			return nil, ErrAttachmentImage
+		}
+		thumbnail, attachment.ThumbnailType, attachment.Width, attachment.Height, err = utils.ImageThumbnail(data, thumbnailSize)
+		if err != nil {
+			return nil, ErrAttachmentImage
+		}
+	}
+
+	// Checked after stripping, so only what is actually stored counts
+	if err := s.quotas.CheckAttachment(ctx, paste, len(data)+len(thumbnail)); err != nil {
+		return nil, err
+	}
+
+	if err := s.attachmentRepo.Create(ctx, paste, attachment, data, thumbnail); err != nil {
+		return nil, err
+	}
+
+	log.Info().Uint64("pasteId", pasteID).Uint("attachmentId", attachment.ID).Str("mimeType", attachment.MIMEType).Msg("Added paste attachment")
+	return attachment, nil
+}
+
+// OpenAttachment opens a reader over one of the paste's attachments, or over its thumbnail.
+// Callers must have checked that the paste may be viewed.
+func (s *pasteService) OpenAttachment(ctx context.Context, paste *models.Paste, attachmentID uint, thumbnail bool) (*models.Attachment, io.ReadCloser, int64, error) {
+	for i := range paste.Attachments {
+		attachment := &paste.Attachments[i]
+		if attachment.ID != attachmentID {
+			continue
+		}
+
+		hash := attachment.ContentHash
+		if thumbnail {
+			if attachment.ThumbnailHash == "" {
+				return nil, nil, 0, ErrAttachmentNoThumbnail
+			}
+			hash = attachment.ThumbnailHash
+		}
+		reader, size, err := s.attachmentRepo.Open(ctx, hash)
+		if err != nil {
+			return nil, nil, 0, err
+		}
+		return attachment, reader, size, nil
+	}
+	return nil, nil, 0, ErrAttachmentNotFound
+}
+
+func (s *pasteService) DeleteAttachment(ctx context.Context, pasteID uint64, userID uint, attachmentID uint) error {
+	log := utils.LoggerFromContext(ctx)
+
+	paste, err := s.repo.GetByID(ctx, pasteID)
+	if err != nil {
+		return err
+	}
+	if err := s.CanEdit(ctx, paste, userID); err != nil {
+		return err
+	}
+
+	for _, attachment := range paste.Attachments {
+		if attachment.ID == attachmentID {
+			if err := s.attachmentRepo.Delete(ctx, &attachment); err != nil {
+				return err
+			}
+			log.Info().Uint64("pasteId", pasteID).Uint("attachmentId", attachmentID).Msg("Deleted paste attachment")
+			return nil
+		}
+	}
+	return ErrAttachmentNotFound
+}
@@ -0,0 +1,699 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base32"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"memoria-backend/models"
+	"memoria-backend/repository"
+	"memoria-backend/utils"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/pquerna/otp"
+	"github.com/pquerna/otp/totp"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrInvalidCredentials        = errors.New("invalid email or password")
+	ErrInvalidToken              = errors.New("invalid or expired token")
+	ErrInvalidTwoFactorCode      = errors.New("invalid two-factor code")
+	ErrTwoFactorDisabled         = errors.New("two-factor authentication is disabled on this server")
+	ErrTwoFactorAlreadyEnabled   = errors.New("two-factor authentication is already enabled")
+	ErrTwoFactorNotEnrolled      = errors.New("two-factor enrolment has not been started")
+	ErrTwoFactorRequired         = errors.New("two-factor authentication is required by the administrator")
+	ErrTwoFactorEnrollmentNeeded = errors.New("two-factor enrolment is required before accessing this resource")
+	ErrTwoFactorLocked           = errors.New("too many wrong two-factor codes, try again later")
+)
+
+const (
+	// TOTP parameters follow the RFC 6238 defaults that every authenticator app supports
+	totpPeriod = 30
+	totpSkew   = 1
+	totpDigits = otp.DigitsSix
+
+	recoveryCodeCount = 10
+
+	twoFactorChallengeTTL = 5 * time.Minute
+	enrollmentTokenTTL    = 15 * time.Minute
+
+	// Wrong second factors in a row before logins with a second factor are locked for a while
+	twoFactorMaxAttempts = 5
+	twoFactorLockout     = 15 * time.Minute
+)
+
+type AuthService interface {
+	Login(ctx context.Context, req *models.LoginRequest) (*models.LoginData, error)
+	VerifyTwoFactor(ctx context.Context, req *models.TwoFactorVerifyRequest) (*models.LoginData, error)
+	ValidateToken(ctx context.Context, token string) (*models.AuthIdentity, error)
+	RequestPasswordReset(ctx context.Context, email string) error
+	ResetPassword(ctx context.Context, req *models.ResetPasswordRequest) error
+	SendVerificationEmail(ctx context.Context, userID uint) error
+	VerifyEmail(ctx context.Context, token string) error
+	LoginMethods(ctx context.Context) *models.LoginMethodsData
+	BeginOIDCLogin(ctx context.Context, redirect string) (*models.OIDCLoginStart, error)
+	CompleteOIDCLogin(ctx context.Context, req *models.OIDCCallbackRequest) (*models.LoginData, string, error)
+	BeginTOTPEnrollment(ctx context.Context, userID uint) (*models.TOTPEnrollmentData, error)
+	ConfirmTOTPEnrollment(ctx context.Context, identity *models.AuthIdentity, code string) (*models.RecoveryCodesData, error)
+	DisableTOTP(ctx context.Context, userID uint, code string) error
+	RegenerateRecoveryCodes(ctx context.Context, userID uint, code string) (*models.RecoveryCodesData, error)
+}
+
+type authService struct {
+	userRepo       repository.UserRepository
+	tokenRepo      repository.APITokenRepository
+	configService  ConfigService
+	mailer         Mailer
+	fallbackSecret []byte
+	httpClient     *http.Client
+
+	oidcLock sync.Mutex
+	oidc     *oidcClient
+}
+
+// authClaims are the JWT claims issued by the auth service
+type authClaims struct {
+	UserID  uint   `json:"uid"`
+	Purpose string `json:"purpose"`
+	// Fingerprint ties single-use tokens to the account state they were issued for
+	Fingerprint string `json:"fp,omitempty"`
+	jwt.RegisteredClaims
+}
+
+// NewAuthService creates a new authentication service
+func NewAuthService(userRepo repository.UserRepository, tokenRepo repository.APITokenRepository, configService ConfigService, mailer Mailer) AuthService {
+	// Used only when no JWT secret is configured, tokens then don't survive a restart
+	fallbackSecret := make([]byte, 32)
+	if _, err := rand.Read(fallbackSecret); err != nil {
+		panic(fmt.Sprintf("failed to generate fallback JWT secret: %v", err))
+	}
+
+	return &authService{
+		userRepo:       userRepo,
+		tokenRepo:      tokenRepo,
+		configService:  configService,
+		mailer:         mailer,
+		fallbackSecret: fallbackSecret,
+		httpClient:     &http.Client{Timeout: 15 * time.Second},
+	}
+}
+
+func (s *authService) signingKey() []byte {
+	if secret := s.configService.GetConfig().Auth.JWTSecret; secret != "" {
+		return []byte(secret)
+	}
+	return s.fallbackSecret
+}
+
+// issueToken signs a token for the given user and purpose
+func (s *authService) issueToken(userID uint, purpose string, ttl time.Duration) (string, time.Time, error) {
+	now := time.Now()
+	expiresAt := now.Add(ttl)
+	claims := authClaims{
+		UserID:  userID,
+		Purpose: purpose,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject:   fmt.Sprint(userID),
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(expiresAt),
+		},
+	}
+
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(s.signingKey())
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	return token, expiresAt, nil
+}
+
+// parseToken validates the signature and expiry of a token and checks its purpose
+func (s *authService) parseToken(tokenString string, purposes ...string) (*authClaims, error) {
+	claims := &authClaims{}
+	_, err := jwt.ParseWithClaims(tokenString, claims, func(t *jwt.Token) (interface{}, error) {
+		return s.signingKey(), nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}))
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+
+	for _, purpose := range purposes {
+		if claims.Purpose == purpose {
+			return claims, nil
+		}
+	}
+	return nil, ErrInvalidToken
+}
+
+// accessLoginData issues a full access token for the user
+func (s *authService) accessLoginData(user *models.User) (*models.LoginData, error) {
+	ttl := time.Duration(s.configService.GetConfig().Auth.TokenExpiration) * time.Hour
+	token, expiresAt, err := s.issueToken(user.ID, models.TokenPurposeAccess, ttl)
+	if err != nil {
+		return nil, err
+	}
+
+	userResponse := user.ToResponse()
+	return &models.LoginData{
+		Token:     token,
+		ExpiresAt: &expiresAt,
+		User:      &userResponse,
+	}, nil
+}
+
+func (s *authService) Login(ctx context.Context, req *models.LoginRequest) (*models.LoginData, error) {
+	log := utils.LoggerFromContext(ctx)
+
+	if !s.configService.GetConfig().Auth.EnableLocal {
+		return nil, ErrLocalLoginDisabled
+	}
+
+	user, err := s.userRepo.GetByEmail(strings.TrimSpace(req.Email))
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrInvalidCredentials
+		}
+		return nil, err
+	}
+
+	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(req.Password)); err != nil {
+		log.Info().Uint("userId", user.ID).Msg("Login failed: incorrect password")
+		return nil, ErrInvalidCredentials
+	}
+
+	return s.loginUser(ctx, user)
+}
+
+// loginUser finishes a login for a user whose first factor was accepted, asking for
+// a second factor or enrolment when needed
+func (s *authService) loginUser(ctx context.Context, user *models.User) (*models.LoginData, error) {
+	log := utils.LoggerFromContext(ctx)
+	cfg := s.configService.GetConfig()
+
+	// Users who enrolled keep their second factor even if the feature is switched off later
+	if user.TwoFactorEnabled {
+		if time.Now().Before(user.TwoFactorLockedUntil) {
+			log.Info().Uint("userId", user.ID).Msg("Login refused, second factor locked")
+			return nil, ErrTwoFactorLocked
+		}
+		challenge, err := s.issueTwoFactorChallenge(user)
+		if err != nil {
+			return nil, err
+		}
+		log.Info().Uint("userId", user.ID).Msg("Password accepted, awaiting second factor")
+		return &models.LoginData{TwoFactorRequired: true, ChallengeToken: challenge}, nil
+	}
+
+	if cfg.Auth.Enable2FA && cfg.Auth.Require2FA {
+		enrollment, _, err := s.issueToken(user.ID, models.TokenPurposeEnrollment, enrollmentTokenTTL)
+		if err != nil {
+			return nil, err
+		}
+		log.Info().Uint("userId", user.ID).Msg("Password accepted, two-factor enrolment required")
+		return &models.LoginData{EnrollmentRequired: true, ChallengeToken: enrollment}, nil
+	}
+
+	log.Info().Uint("userId", user.ID).Msg("User logged in")
+	return s.accessLoginData(user)
+}
+
+// issueTwoFactorChallenge signs a login challenge and records it as the user's only valid
+// one, replacing any earlier challenge
+func (s *authService) issueTwoFactorChallenge(user *models.User) (string, error) {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return "", err
+	}
+	challengeID := hex.EncodeToString(id)
+	if err := s.userRepo.UpdateColumns(user.ID, map[string]interface{}{"two_factor_challenge_id": challengeID}); err != nil {
+		return "", err
+	}
+
+	now := time.Now()
+	claims := authClaims{
+		UserID:  user.ID,
+		Purpose: models.TokenPurposeTwoFactor,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        challengeID,
+			Subject:   fmt.Sprint(user.ID),
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(twoFactorChallengeTTL)),
+		},
+	}
+	return jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(s.signingKey())
+}
+
+// VerifyTwoFactor accepts a second factor for the user's latest challenge, once. Wrong codes
+// count against the user rather than the challenge, so logging in again doesn't reset them.
+func (s *authService) VerifyTwoFactor(ctx context.Context, req *models.TwoFactorVerifyRequest) (*models.LoginData, error) {
+	log := utils.LoggerFromContext(ctx)
+
+	claims, err := s.parseToken(req.ChallengeToken, models.TokenPurposeTwoFactor)
+	if err != nil {
+		return nil, err
+	}
+	if claims.ID == "" {
+		return nil, ErrInvalidToken
+	}
+
+	user, err := s.userRepo.GetByID(uint64(claims.UserID))
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+	if time.Now().Before(user.TwoFactorLockedUntil) {
+		return nil, ErrTwoFactorLocked
+	}
+
+	reserved, err := s.userRepo.ReserveTwoFactorAttempt(user.ID, claims.ID, twoFactorMaxAttempts)
+	if err != nil {
+		return nil, err
+	}
+	if !reserved {
+		return nil, ErrInvalidToken
+	}
+
+	if err := s.checkSecondFactor(user, req.Code, req.RecoveryCode); err != nil {
+		log.Info().Uint("userId", user.ID).Msg("Second factor rejected")
+		locked, lockErr := s.userRepo.LockTwoFactor(user.ID, twoFactorMaxAttempts, time.Now().Add(twoFactorLockout))
+		if lockErr != nil {
+			return nil, lockErr
+		}
+		if locked {
+			log.Warn().Uint("userId", user.ID).Msg("Too many wrong second factors, two-factor login locked")
+			return nil, ErrTwoFactorLocked
+		}
+		return nil, err
+	}
+
+	ended, err := s.userRepo.EndTwoFactorChallenge(user.ID, claims.ID)
+	if err != nil {
+		return nil, err
+	}
+	if !ended {
+		return nil, ErrInvalidToken
+	}
+
+	log.Info().Uint("userId", user.ID).Msg("User logged in with second factor")
+	return s.accessLoginData(user)
+}
+
+// confirmSecondFactor runs check on a second factor confirming a change to the user's
+// two-factor settings. Wrong codes count against the user and lock them out like at login,
+// so a stolen access token doesn't allow guessing.
+func (s *authService) confirmSecondFactor(ctx context.Context, user *models.User, check func() error) error {
+	log := utils.LoggerFromContext(ctx)
+
+	if time.Now().Before(user.TwoFactorLockedUntil) {
+		return ErrTwoFactorLocked
+	}
+	reserved, err := s.userRepo.ReserveTwoFactorCheck(user.ID, twoFactorMaxAttempts)
+	if err != nil {
+		return err
+	}
+
+	if reserved {
+		err = check()
+		if err == nil {
+			return s.userRepo.ClearTwoFactorFailures(user.ID)
+		}
+		log.Info().Uint("userId", user.ID).Msg("Second factor rejected")
+	}
+	locked, lockErr := s.userRepo.LockTwoFactor(user.ID, twoFactorMaxAttempts, time.Now().Add(twoFactorLockout))
+	if lockErr != nil {
+		return lockErr
+	}
+	if locked || !reserved {
+		log.Warn().Uint("userId", user.ID).Msg("Too many wrong second factors, two-factor login locked")
+		return ErrTwoFactorLocked
+	}
+	return err
+}
+
+// checkSecondFactor accepts either a TOTP code or an unused recovery code
+func (s *authService) checkSecondFactor(user *models.User, code, recoveryCode string) error {
+	if !user.TwoFactorEnabled {
+		return ErrTwoFactorNotEnrolled
+	}
+
+	if code != "" {
+		return s.checkTOTPCode(user, code)
+	}
+
+	if recoveryCode != "" {
+		used, err := s.userRepo.ConsumeRecoveryCode(user.ID, hashRecoveryCode(recoveryCode))
+		if err != nil {
+			return err
+		}
+		if !used {
+			return ErrInvalidTwoFactorCode
+		}
+		return nil
+	}
+
+	return ErrInvalidTwoFactorCode
+}
+
+// checkTOTPCode validates a code against the user's secret, allowing one step of
+// clock skew either way, and records the step so the same code can't be used twice
+func (s *authService) checkTOTPCode(user *models.User, code string) error {
+	if user.TOTPSecret == "" {
+		return ErrTwoFactorNotEnrolled
+	}
+
+	code = strings.ReplaceAll(strings.TrimSpace(code), " ", "")
+	opts := totp.ValidateOpts{
+		Period:    totpPeriod,
+		Digits:    totpDigits,
+		Algorithm: otp.AlgorithmSHA1,
+	}
+
+	now := time.Now()
+	for offset := -totpSkew; offset <= totpSkew; offset++ {
+		at := now.Add(time.Duration(offset*totpPeriod) * time.Second)
+		expected, err := totp.GenerateCodeCustom(user.TOTPSecret, at, opts)
+		if err != nil {
+			return err
+		}
+		if expected != code {
+			continue
+		}
+
+		fresh, err := s.userRepo.AdvanceTOTPStep(user.ID, at.Unix()/totpPeriod)
+		if err != nil {
+			return err
+		}
+		if !fresh {
+			return ErrInvalidTwoFactorCode
+		}
+		return nil
+	}
+
+	return ErrInvalidTwoFactorCode
+}
+
+func (s *authService) ValidateToken(ctx context.Context, token string) (*models.AuthIdentity, error) {
+	if strings.HasPrefix(token, models.APITokenPrefix) {
+		return s.validateAPIToken(ctx, token)
+	}
+
+	claims, err := s.parseToken(token, models.TokenPurposeAccess, models.TokenPurposeEnrollment)
+	if err != nil {
+		return nil, err
+	}
+
+	identity := &models.AuthIdentity{UserID: claims.UserID, Purpose: claims.Purpose}
+	if claims.Purpose != models.TokenPurposeAccess {
+		return identity, nil
+	}
+
+	user, err := s.userRepo.GetByID(uint64(claims.UserID))
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+
+	// Access tokens issued before 2FA was enforced stop working until the user enrols
+	cfg := s.configService.GetConfig()
+	if cfg.Auth.Enable2FA && cfg.Auth.Require2FA && !user.TwoFactorEnabled {
+		return nil, ErrTwoFactorEnrollmentNeeded
+	}
+
+	identity.Scopes = s.userScopes(user)
+	identity.EmailVerified = user.EmailVerified
+	return identity, nil
+}
+
+// validateAPIToken looks up a personal API token by its hash and records its use
+func (s *authService) validateAPIToken(ctx context.Context, token string) (*models.AuthIdentity, error) {
+	log := utils.LoggerFromContext(ctx)
+
+	apiToken, err := s.tokenRepo.GetByHash(ctx, hashAPIToken(token))
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+
+	now := time.Now()
+	if apiToken.ExpiresAt != nil && apiToken.ExpiresAt.Before(now) {
+		return nil, ErrInvalidToken
+	}
+
+	user, err := s.userRepo.GetByID(uint64(apiToken.UserID))
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+
+	// Like access tokens, API tokens of users who haven't enrolled stop working once 2FA
+	// is enforced
+	cfg := s.configService.GetConfig()
+	if cfg.Auth.Enable2FA && cfg.Auth.Require2FA && !user.TwoFactorEnabled {
+		return nil, ErrTwoFactorEnrollmentNeeded
+	}
+
+	// Tokens can't outlive the privileges of their owner
+	var scopes []string
+	for _, scope := range apiToken.Scopes {
+		if scope != models.ScopeAdmin || s.isAdmin(user) {
+			scopes = append(scopes, scope)
+		}
+	}
+
+	if apiToken.LastUsedAt == nil || now.Sub(*apiToken.LastUsedAt) > apiTokenLastUsedInterval {
+		if err := s.tokenRepo.UpdateLastUsed(ctx, apiToken.ID, now); err != nil {
+			log.Warn().Err(err).Uint("tokenId", apiToken.ID).Msg("Failed to record API token use")
+		}
+	}
+
+	return &models.AuthIdentity{
+		UserID:        apiToken.UserID,
+		Purpose:       models.TokenPurposeAccess,
+		Scopes:        scopes,
+		EmailVerified: user.EmailVerified,
+		TokenID:       apiToken.ID,
+	}, nil
+}
+
+// isAdmin reports whether the user has the admin role or is listed as an administrator in the config
+func (s *authService) isAdmin(user *models.User) bool {
+	if user.Role == models.RoleAdmin {
+		return true
+	}
+	for _, email := range s.configService.GetConfig().Auth.AdminEmails {
+		if strings.EqualFold(strings.TrimSpace(email), user.Email) {
+			return true
+		}
+	}
+	return false
+}
+
+// userScopes returns the scopes of a logged in session for the user
+func (s *authService) userScopes(user *models.User) []string {
+	scopes := []string{models.ScopePastesRead, models.ScopePastesWrite}
+	if s.isAdmin(user) {
+		scopes = append(scopes, models.ScopeAdmin)
+	}
+	return scopes
+}
+
+func (s *authService) BeginTOTPEnrollment(ctx context.Context, userID uint) (*models.TOTPEnrollmentData, error) {
+	log := utils.LoggerFromContext(ctx)
+	cfg := s.configService.GetConfig()
+
+	if !cfg.Auth.Enable2FA {
+		return nil, ErrTwoFactorDisabled
+	}
+
+	user, err := s.userRepo.GetByID(uint64(userID))
+	if err != nil {
+		return nil, err
+	}
+
+	if user.TwoFactorEnabled {
+		return nil, ErrTwoFactorAlreadyEnabled
+	}
+
+	key, err := totp.Generate(totp.GenerateOpts{
+		Issuer:      cfg.App.Name,
+		AccountName: user.Email,
+		Period:      totpPeriod,
+		Digits:      totpDigits,
+		Algorithm:   otp.AlgorithmSHA1,
+	})
+	if err != nil {
+		log.Error().Err(err).Uint("userId", userID).Msg("Failed to generate TOTP secret")
+		return nil, err
+	}
+
+	// The secret stays pending until confirmed with a first valid code
+	if err := s.userRepo.UpdateColumns(userID, map[string]interface{}{
+		"totp_secret":    key.Secret(),
+		"totp_last_step": 0,
+	}); err != nil {
+		return nil, err
+	}
+
+	log.Info().Uint("userId", userID).Msg("Started TOTP enrolment")
+	return &models.TOTPEnrollmentData{
+		Secret:          key.Secret(),
+		ProvisioningURI: key.URL(),
+	}, nil
+}
+
+func (s *authService) ConfirmTOTPEnrollment(ctx context.Context, identity *models.AuthIdentity, code string) (*models.RecoveryCodesData, error) {
+	log := utils.LoggerFromContext(ctx)
+
+	if !s.configService.GetConfig().Auth.Enable2FA {
+		return nil, ErrTwoFactorDisabled
+	}
+
+	user, err := s.userRepo.GetByID(uint64(identity.UserID))
+	if err != nil {
+		return nil, err
+	}
+
+	if user.TwoFactorEnabled {
+		return nil, ErrTwoFactorAlreadyEnabled
+	}
+
+	if err := s.checkTOTPCode(user, code); err != nil {
+		return nil, err
+	}
+
+	if err := s.userRepo.UpdateColumns(user.ID, map[string]interface{}{"two_factor_enabled": true}); err != nil {
+		return nil, err
+	}
+	user.TwoFactorEnabled = true
+
+	codes, err := s.replaceRecoveryCodes(user.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	data := &models.RecoveryCodesData{RecoveryCodes: codes}
+
+	// Enrolment forced at login finishes the login as well
+	if identity.Purpose == models.TokenPurposeEnrollment {
+		loginData, err := s.accessLoginData(user)
+		if err != nil {
+			return nil, err
+		}
+		data.Token = loginData.Token
+		data.ExpiresAt = loginData.ExpiresAt
+	}
+
+	log.Info().Uint("userId", user.ID).Msg("Two-factor authentication enabled")
+	return data, nil
+}
+
+func (s *authService) DisableTOTP(ctx context.Context, userID uint, code string) error {
+	log := utils.LoggerFromContext(ctx)
+	cfg := s.configService.GetConfig()
+
+	if cfg.Auth.Enable2FA && cfg.Auth.Require2FA {
+		return ErrTwoFactorRequired
+	}
+
+	user, err := s.userRepo.GetByID(uint64(userID))
+	if err != nil {
+		return err
+	}
+
+	if !user.TwoFactorEnabled {
+		return ErrTwoFactorNotEnrolled
+	}
+
+	// Accept a recovery code too, the authenticator may be why 2FA is being turned off
+	if err := s.confirmSecondFactor(ctx, user, func() error {
+		err := s.checkTOTPCode(user, code)
+		if errors.Is(err, ErrInvalidTwoFactorCode) {
+			err = s.checkSecondFactor(user, "", code)
+		}
+		return err
+	}); err != nil {
+		return err
+	}
+
+	if err := s.userRepo.UpdateColumns(userID, map[string]interface{}{
+		"two_factor_enabled": false,
+		"totp_secret":        "",
+		"totp_last_step":     0,
+	}); err != nil {
+		return err
+	}
+
+	if err := s.userRepo.ReplaceRecoveryCodes(userID, nil); err != nil {
+		return err
+	}
+
+	log.Info().Uint("userId", userID).Msg("Two-factor authentication disabled")
+	return nil
+}
+
+func (s *authService) RegenerateRecoveryCodes(ctx context.Context, userID uint, code string) (*models.RecoveryCodesData, error) {
+	log := utils.LoggerFromContext(ctx)
+
+	user, err := s.userRepo.GetByID(uint64(userID))
+	if err != nil {
+		return nil, err
+	}
+
+	if !user.TwoFactorEnabled {
+		return nil, ErrTwoFactorNotEnrolled
+	}
+
+	if err := s.confirmSecondFactor(ctx, user, func() error { return s.checkTOTPCode(user, code) }); err != nil {
+		return nil, err
+	}
+
+	codes, err := s.replaceRecoveryCodes(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	log.Info().Uint("userId", userID).Msg("Regenerated recovery codes")
+	return &models.RecoveryCodesData{RecoveryCodes: codes}, nil
+}
+
+// replaceRecoveryCodes generates a new set of recovery codes, stores their hashes
+// and returns the plaintext codes to show the user once
+func (s *authService) replaceRecoveryCodes(userID uint) ([]string, error) {
+	codes := make([]string, recoveryCodeCount)
+	hashes := make([]string, recoveryCodeCount)
+	for i := range codes {
+		code, err := generateRecoveryCode()
+		if err != nil {
+			return nil, err
+		}
+		codes[i] = code
+		hashes[i] = hashRecoveryCode(code)
+	}
+
+	if err := s.userRepo.ReplaceRecoveryCodes(userID, hashes); err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// generateRecoveryCode creates an 80-bit code formatted as four groups of four characters
+func generateRecoveryCode() (string, error) {
+	bytes := make([]byte, 10)
+	if _, err := rand.Read(bytes); err != nil {
+		return "", err
+	}
+
+	encoded := strings.ToLower(base32.StdEncoding.EncodeToString(bytes))
+	return encoded[0:4] + "-" + encoded[4:8] + "-" + encoded[8:12] + "-" + encoded[12:16], nil
+}
+
+// hashRecoveryCode normalises a recovery code and returns its SHA-256 hex digest
+func hashRecoveryCode(code string) string {
+	normalised := strings.ToLower(strings.NewReplacer("-", "", " ", "").Replace(strings.TrimSpace(code)))
+	sum := sha256.Sum256([]byte(normalised))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,881 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"memoria-backend/models"
+	"memoria-backend/utils"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+var (
+	ErrCollabEncrypted = errors.New("client-side encrypted pastes can't be edited together")
+	ErrCollabReadOnly  = errors.New("you can only view this paste")
+	ErrCollabOperation = errors.New("the edit doesn't fit the document")
+	ErrCollabRevision  = errors.New("the edit is based on a revision that's no longer known, reload the document")
+	ErrCollabTooLarge  = errors.New("the edit would make the paste larger than allowed")
+	ErrCollabMessage   = errors.New("unknown message type")
+	ErrCollabConflict  = errors.New("the paste's files were changed outside the session, reload it")
+	ErrCollabGone      = errors.New("the paste was deleted, the edits since it was last saved are lost")
+)
+
+// collabSyncTimeout is how long a replica joining a session waits for the state of the
+// replicas already in it before it loads the paste itself
+const collabSyncTimeout = 500 * time.Millisecond
+
+// collabClientBuffer is how many messages a client may fall behind before it's dropped
+const collabClientBuffer = 256
+
+type CollabService interface {
+	// Join connects a client to the session of the paste, starting one when nobody is
+	// editing it yet. Callers must have checked that the paste may be viewed, and that it may
+	// be edited unless readOnly is set.
+	Join(ctx context.Context, paste *models.Paste, userID uint, readOnly bool) (*CollabClient, error)
+}
+
+// collabService runs a session per paste being edited on this replica. Sessions of several
+// replicas on the same paste stay in step through the pub/sub topic of the paste: edits are
+// only applied when they come back from the topic, in the order every replica sees them.
+type collabService struct {
+	pasteService  PasteService
+	pubSub        PubSub
+	configService ConfigService
+	replica       string
+
+	mu       sync.Mutex
+	sessions map[uint64]*collabSession
+}
+
+// NewCollabService creates a service for editing pastes together, saving the documents
+// through the paste service
+func NewCollabService(pasteService PasteService, pubSub PubSub, configService ConfigService) CollabService {
+	replica, _ := generatePrivateAccessID()
+	return &collabService{
+		pasteService:  pasteService,
+		pubSub:        pubSub,
+		configService: configService,
+		replica:       replica,
+		sessions:      make(map[uint64]*collabSession),
+	}
+}
+
+// CollabClient is one connection to a collaboration session
+type CollabClient struct {
+	ID       string
+	UserID   uint
+	ReadOnly bool
+
+	session *collabSession
+	send    chan models.CollabMessage
+	once    sync.Once
+}
+
+// Messages returns what the session sends to the client. It's closed once the client left
+// or fell too far behind.
+func (c *CollabClient) Messages() <-chan models.CollabMessage {
+	return c.send
+}
+
+// Handle passes a message from the client to the session. Edits are applied asynchronously,
+// the client hears back through an ack or an error message.
+func (c *CollabClient) Handle(ctx context.Context, msg *models.CollabMessage) error {
+	switch msg.Type {
+	case models.CollabMessageOperation:
+		if c.ReadOnly {
+			return ErrCollabReadOnly
+		}
+		return c.session.publish(ctx, &collabEnvelope{
+			Kind:      collabEnvelopeOperation,
+			Client:    c.ID,
+			Revision:  msg.Revision,
+			File:      msg.File,
+			Operation: msg.Operation,
+		})
+	case models.CollabMessageCursor:
+		if msg.Cursor == nil {
+			return ErrCollabOperation
+		}
+		return c.session.publish(ctx, &collabEnvelope{
+			Kind:     collabEnvelopePresence,
+			Client:   c.ID,
+			UserID:   c.UserID,
+			ReadOnly: c.ReadOnly,
+			Revision: msg.Revision,
+			Cursor:   msg.Cursor,
+		})
+	default:
+		return ErrCollabMessage
+	}
+}
+
+// Leave disconnects the client from the session, the session ends with its last client
+func (c *CollabClient) Leave(ctx context.Context) {
+	c.session.leave(ctx, c)
+}
+
+// deliver queues a message for the client, dropping the client when it's too far behind.
+// The session's lock must be held.
+func (c *CollabClient) deliver(msg models.CollabMessage) {
+	select {
+	case c.send <- msg:
+	default:
+		c.session.dropLocked(c)
+	}
+}
+
+// Kinds of the messages replicas exchange over the pub/sub topic of a paste
+const (
+	collabEnvelopeOperation = "op"       // A client's edit, not yet sequenced
+	collabEnvelopePresence  = "presence" // A client joined or moved its cursor
+	collabEnvelopeLeave     = "leave"    // A client left
+	collabEnvelopeSync      = "sync"     // A replica joined and asks for the state
+	collabEnvelopeState     = "state"    // The state a replica asked for
+	collabEnvelopeSaved     = "saved"    // A replica saved the document as a new version
+	collabEnvelopeRebase    = "rebase"   // The paste was changed outside the session
+	collabEnvelopeFailed    = "failed"   // A replica can't save the document, the session ends
+)
+
+type collabEnvelope struct {
+	Kind      string                     `json:"kind"`
+	Replica   string                     `json:"replica,omitempty"`
+	Client    string                     `json:"client,omitempty"`
+	UserID    uint                       `json:"userId,omitempty"`
+	ReadOnly  bool                       `json:"readOnly,omitempty"`
+	Revision  int                        `json:"revision,omitempty"`
+	File      string                     `json:"file,omitempty"`
+	Operation []models.CollabOpComponent `json:"operation,omitempty"`
+	Cursor    *models.CollabCursor       `json:"cursor,omitempty"`
+	Nonce     string                     `json:"nonce,omitempty"`
+	State     *collabState               `json:"state,omitempty"`
+	Version   uint64                     `json:"version,omitempty"`
+	Files     []models.CollabFile        `json:"files,omitempty"`
+	Error     string                     `json:"error,omitempty"`
+}
+
+// collabState is a session's document, the recent edits and the participants, handed to
+// replicas joining the session
+type collabState struct {
+	Revision     int                        `json:"revision"`
+	Files        []models.CollabFile        `json:"files"`
+	History      []collabEdit               `json:"history"` // The edits leading up to Revision
+	Participants []models.CollabParticipant `json:"participants"`
+	Version      uint64                     `json:"version"` // Version of the paste Saved was loaded or saved as
+	Saved        []models.CollabFile        `json:"saved"`
+}
+
+type collabEdit struct {
+	File      string        `json:"file"`
+	Operation textOperation `json:"operation"`
+}
+
+type collabFile struct {
+	name    string
+	content []rune
+}
+
+// collabSession is the state of a paste being edited, kept the same on every replica with
+// clients editing it
+type collabSession struct {
+	service *collabService
+	pasteID uint64
+	topic   string
+	ctx     context.Context // Outlives the request that started the session, for saving
+
+	mu           sync.Mutex
+	ready        bool // The state is known, until then envelopes are buffered
+	syncNonce    string
+	syncSeen     bool // The sync envelope came back, envelopes from then on apply
+	buffered     []collabEnvelope
+	revision     int
+	files        []collabFile
+	history      []collabEdit
+	participants map[string]*models.CollabParticipant
+	clients      map[string]*CollabClient // Clients connected to this replica
+	dirty        bool                     // Edited by local clients since the last save
+	editor       uint                     // Local user who edited last, saves are made as them
+	closed       bool
+	// version is the version of the paste the document was loaded or last saved as, and
+	// saved its files then. Changes made outside the session are merged against them.
+	version        uint64
+	saved          []models.CollabFile
+	versionChanged chan struct{} // Closed and replaced when version moves on
+	saving         sync.Mutex    // Held while saving, so the replica's saves don't race each other
+
+	messages    <-chan []byte
+	unsubscribe func()
+	stop        chan struct{}
+}
+
+func (s *collabService) Join(ctx context.Context, paste *models.Paste, userID uint, readOnly bool) (*CollabClient, error) {
+	log := utils.LoggerFromContext(ctx)
+
+	if paste.IsEncrypted() {
+		return nil, ErrCollabEncrypted
+	}
+	clientID, err := generatePrivateAccessID()
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	session := s.sessions[paste.ID]
+	if session == nil {
+		if session, err = s.startSession(ctx, paste.ID); err != nil {
+			s.mu.Unlock()
+			return nil, err
+		}
+		s.sessions[paste.ID] = session
+	}
+	client := &CollabClient{
+		ID:       clientID[:16],
+		UserID:   userID,
+		ReadOnly: readOnly,
+		session:  session,
+		send:     make(chan models.CollabMessage, collabClientBuffer),
+	}
+	session.mu.Lock()
+	session.clients[client.ID] = client
+	if session.ready {
+		client.deliver(session.snapshotLocked(client))
+	}
+	session.mu.Unlock()
+	s.mu.Unlock()
+
+	if err := session.publish(ctx, &collabEnvelope{Kind: collabEnvelopePresence, Client: client.ID, UserID: userID, ReadOnly: readOnly}); err != nil {
+		client.Leave(ctx)
+		return nil, err
+	}
+
+	log.Info().Uint64("pasteId", paste.ID).Str("clientId", client.ID).Bool("readOnly", readOnly).Msg("Joined paste collaboration")
+	return client, nil
+}
+
+// startSession subscribes to the topic of the paste and asks the replicas already editing
+// it for the state. The service's lock must be held.
+func (s *collabService) startSession(ctx context.Context, pasteID uint64) (*collabSession, error) {
+	nonce, err := generatePrivateAccessID()
+	if err != nil {
+		return nil, err
+	}
+	session := &collabSession{
+		service:        s,
+		pasteID:        pasteID,
+		topic:          fmt.Sprintf("paste:%d", pasteID),
+		ctx:            context.WithoutCancel(ctx),
+		syncNonce:      nonce,
+		participants:   make(map[string]*models.CollabParticipant),
+		clients:        make(map[string]*CollabClient),
+		stop:           make(chan struct{}),
+		versionChanged: make(chan struct{}),
+	}
+	session.messages, session.unsubscribe, err = s.pubSub.Subscribe(ctx, session.topic)
+	if err != nil {
+		return nil, err
+	}
+	if err := session.publish(ctx, &collabEnvelope{Kind: collabEnvelopeSync, Nonce: nonce}); err != nil {
+		session.unsubscribe()
+		return nil, err
+	}
+	go session.run()
+	return session, nil
+}
+
+func (s *collabSession) publish(ctx context.Context, envelope *collabEnvelope) error {
+	envelope.Replica = s.service.replica
+	payload, err := json.Marshal(envelope)
+	if err != nil {
+		return err
+	}
+	return s.service.pubSub.Publish(ctx, s.topic, payload)
+}
+
+// run applies the envelopes of the topic in order and saves the document periodically
+func (s *collabSession) run() {
+	log := utils.LoggerFromContext(s.ctx)
+
+	interval := time.Duration(s.service.configService.GetConfig().Collab.PersistInterval) * time.Second
+	persistTicker := time.NewTicker(max(interval, time.Second))
+	defer persistTicker.Stop()
+	syncTimer := time.NewTimer(collabSyncTimeout)
+	defer syncTimer.Stop()
+
+	for {
+		select {
+		case payload, ok := <-s.messages:
+			if !ok {
+				return
+			}
+			var envelope collabEnvelope
+			if err := json.Unmarshal(payload, &envelope); err != nil {
+				log.Warn().Err(err).Uint64("pasteId", s.pasteID).Msg("Dropped malformed collaboration message")
+				continue
+			}
+			s.receive(&envelope)
+		case <-syncTimer.C:
+			s.loadPaste()
+		case <-persistTicker.C:
+			_ = s.persist()
+		case <-s.stop:
+			return
+		}
+	}
+}
+
+// loadPaste starts the session from the stored paste when no replica handed over its state
+func (s *collabSession) loadPaste() {
+	log := utils.LoggerFromContext(s.ctx)
+
+	s.mu.Lock()
+	ready := s.ready
+	s.mu.Unlock()
+	if ready {
+		return
+	}
+
+	paste, err := s.service.pasteService.GetByID(s.ctx, s.pasteID)
+	if err == nil && paste.IsEncrypted() {
+		err = ErrCollabEncrypted
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.ready {
+		return
+	}
+	if err != nil {
+		log.Error().Err(err).Uint64("pasteId", s.pasteID).Msg("Failed to load paste for collaboration")
+		for _, client := range s.clients {
+			client.deliver(models.CollabMessage{Type: models.CollabMessageError, Error: "Failed to load the paste"})
+			s.dropLocked(client)
+		}
+		return
+	}
+
+	var files []models.CollabFile
+	for _, file := range paste.FileList() {
+		files = append(files, models.CollabFile{Name: file.Name, Content: file.Content})
+	}
+	s.startLocked(&collabState{Files: files, Version: paste.Version, Saved: files})
+}
+
+// startLocked takes over a state, applies the envelopes that came after it and sends the
+// clients waiting for it their snapshot. The session's lock must be held.
+func (s *collabSession) startLocked(state *collabState) {
+	s.ready = true
+	s.syncSeen = true
+	s.revision = state.Revision
+	s.files = nil
+	for _, file := range state.Files {
+		s.files = append(s.files, collabFile{name: file.Name, content: []rune(file.Content)})
+	}
+	s.history = state.History
+	s.setVersionLocked(state.Version, state.Saved)
+	for i := range state.Participants {
+		participant := state.Participants[i]
+		s.participants[participant.ClientID] = &participant
+	}
+
+	buffered := s.buffered
+	s.buffered = nil
+	for i := range buffered {
+		s.receiveLocked(&buffered[i])
+	}
+	for _, client := range s.clients {
+		client.deliver(s.snapshotLocked(client))
+	}
+}
+
+func (s *collabSession) receive(envelope *collabEnvelope) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	mine := envelope.Replica == s.service.replica
+	switch {
+	case !s.syncSeen:
+		// Whatever came before the sync envelope is part of the state asked for
+		if mine && envelope.Kind == collabEnvelopeSync && envelope.Nonce == s.syncNonce {
+			s.syncSeen = true
+		}
+	case !s.ready:
+		if envelope.Kind == collabEnvelopeState && envelope.Nonce == s.syncNonce {
+			s.startLocked(envelope.State)
+		} else if envelope.Kind != collabEnvelopeSync && envelope.Kind != collabEnvelopeState {
+			s.buffered = append(s.buffered, *envelope)
+		}
+	default:
+		s.receiveLocked(envelope)
+	}
+}
+
+// receiveLocked applies an envelope to a ready session. Every replica does the same with
+// it, only what's sent to clients differs. The session's lock must be held.
+func (s *collabSession) receiveLocked(envelope *collabEnvelope) {
+	log := utils.LoggerFromContext(s.ctx)
+
+	switch envelope.Kind {
+	case collabEnvelopeSync:
+		if envelope.Replica == s.service.replica {
+			return
+		}
+		state := s.stateLocked()
+		go func() {
+			if err := s.publish(s.ctx, &collabEnvelope{Kind: collabEnvelopeState, Nonce: envelope.Nonce, State: state}); err != nil {
+				log.Warn().Err(err).Uint64("pasteId", s.pasteID).Msg("Failed to hand over collaboration state")
+			}
+		}()
+	case collabEnvelopeOperation:
+		s.applyLocked(envelope)
+	case collabEnvelopePresence:
+		participant := &models.CollabParticipant{ClientID: envelope.Client, UserID: envelope.UserID, ReadOnly: envelope.ReadOnly}
+		if envelope.Cursor != nil {
+			cursor := s.transformCursorLocked(*envelope.Cursor, envelope.Revision)
+			participant.Cursor = &cursor
+		}
+		s.participants[participant.ClientID] = participant
+		s.broadcastLocked(envelope.Client, models.CollabMessage{Type: models.CollabMessagePresence, Revision: s.revision, Participant: participant})
+	case collabEnvelopeLeave:
+		delete(s.participants, envelope.Client)
+		s.broadcastLocked(envelope.Client, models.CollabMessage{Type: models.CollabMessageLeave, ClientID: envelope.Client})
+	case collabEnvelopeSaved:
+		if envelope.Version > s.version {
+			s.setVersionLocked(envelope.Version, envelope.Files)
+		}
+	case collabEnvelopeRebase:
+		if envelope.Version > s.version {
+			s.rebaseLocked(envelope.Version, envelope.Files)
+		}
+	case collabEnvelopeFailed:
+		// The replica that failed ended its part already
+		if envelope.Replica != s.service.replica {
+			s.endLocked(envelope.Error)
+		}
+	}
+}
+
+// applyLocked sequences an edit: transforms it against the edits made since its revision,
+// applies it and tells the clients. The session's lock must be held.
+func (s *collabSession) applyLocked(envelope *collabEnvelope) {
+	client := s.clients[envelope.Client]
+	refuse := func(err error) {
+		if client != nil {
+			client.deliver(models.CollabMessage{Type: models.CollabMessageError, Revision: s.revision, File: envelope.File, Error: err.Error()})
+		}
+	}
+
+	var file *collabFile
+	for i := range s.files {
+		if s.files[i].name == envelope.File {
+			file = &s.files[i]
+		}
+	}
+	oldest := s.revision - len(s.history)
+	if file == nil {
+		refuse(ErrCollabOperation)
+		return
+	}
+	if envelope.Revision < oldest || envelope.Revision > s.revision {
+		refuse(ErrCollabRevision)
+		return
+	}
+
+	op, err := newTextOperation(envelope.Operation)
+	for _, edit := range s.history[envelope.Revision-oldest:] {
+		if err != nil {
+			break
+		}
+		if edit.File == envelope.File {
+			op, _, err = transformOperations(op, edit.Operation)
+		}
+	}
+	var content []rune
+	if err == nil {
+		content, err = op.apply(file.content)
+	}
+	if err != nil {
+		refuse(err)
+		return
+	}
+	if limit := s.service.configService.GetConfig().Limits.MaxPasteBytes; limit > 0 && s.sizeLocked(file, content) > limit {
+		refuse(ErrCollabTooLarge)
+		return
+	}
+
+	s.recordLocked(file, op, content)
+	if client != nil {
+		s.dirty = true
+		s.editor = client.UserID
+		client.deliver(models.CollabMessage{Type: models.CollabMessageAck, Revision: s.revision, File: file.name})
+	}
+	s.broadcastLocked(envelope.Client, models.CollabMessage{
+		Type:      models.CollabMessageOperation,
+		Revision:  s.revision,
+		File:      file.name,
+		Operation: op,
+		ClientID:  envelope.Client,
+	})
+}
+
+// recordLocked makes an edit the next revision of a file, moving the cursors in it along.
+// The session's lock must be held.
+func (s *collabSession) recordLocked(file *collabFile, op textOperation, content []rune) {
+	file.content = content
+	s.revision++
+	s.history = append(s.history, collabEdit{File: file.name, Operation: op})
+	if excess := len(s.history) - s.service.configService.GetConfig().Collab.History; excess > 0 {
+		s.history = append([]collabEdit(nil), s.history[excess:]...)
+	}
+	for _, participant := range s.participants {
+		if participant.Cursor != nil && participant.Cursor.File == file.name {
+			participant.Cursor.Position = op.transformIndex(participant.Cursor.Position)
+			participant.Cursor.SelectionEnd = op.transformIndex(participant.Cursor.SelectionEnd)
+		}
+	}
+}
+
+// setVersionLocked records the version of the paste the document was loaded or saved as and
+// wakes whoever waits for it. The session's lock must be held.
+func (s *collabSession) setVersionLocked(version uint64, saved []models.CollabFile) {
+	s.version = version
+	s.saved = saved
+	close(s.versionChanged)
+	s.versionChanged = make(chan struct{})
+}
+
+// rebaseLocked merges the files of a version of the paste saved outside the session into the
+// document. What changed since the session's version is applied as an edit on top of the
+// session's own edits, which keep their place. Files can't be added, renamed or removed in a
+// session, so when those changed the clients are told to reload instead. Every replica does
+// the same with it. The session's lock must be held.
+func (s *collabSession) rebaseLocked(version uint64, stored []models.CollabFile) {
+	log := utils.LoggerFromContext(s.ctx)
+
+	saved := make(map[string][]rune, len(s.saved))
+	for _, file := range s.saved {
+		saved[file.Name] = []rune(file.Content)
+	}
+	same := len(stored) == len(s.files) && len(saved) == len(s.files)
+	for i := 0; same && i < len(stored); i++ {
+		_, known := saved[stored[i].Name]
+		same = known && stored[i].Name == s.files[i].name
+	}
+	if !same {
+		log.Info().Uint64("pasteId", s.pasteID).Uint64("version", version).Msg("Paste files changed outside collaboration")
+		s.endLocked(ErrCollabConflict.Error())
+		s.setVersionLocked(version, stored)
+		return
+	}
+
+	for i := range s.files {
+		file := &s.files[i]
+		base := saved[file.name]
+		theirs := diffText(base, []rune(stored[i].Content))
+		_, op, err := transformOperations(diffText(base, file.content), theirs)
+		var content []rune
+		if err == nil {
+			content, err = op.apply(file.content)
+		}
+		if err != nil {
+			// Both diffs are made from the same text, they always fit
+			log.Error().Err(err).Uint64("pasteId", s.pasteID).Str("file", file.name).Msg("Failed to merge paste changed outside collaboration")
+			continue
+		}
+		if slices.Equal(content, file.content) {
+			continue
+		}
+		s.recordLocked(file, op, content)
+		s.broadcastLocked("", models.CollabMessage{
+			Type:      models.CollabMessageOperation,
+			Revision:  s.revision,
+			File:      file.name,
+			Operation: op,
+		})
+	}
+	s.setVersionLocked(version, stored)
+}
+
+// endLocked tells the local clients why the session ends and disconnects them, their edits
+// since the last save are given up. The session's lock must be held.
+func (s *collabSession) endLocked(reason string) {
+	s.dirty = false
+	for _, client := range s.clients {
+		client.deliver(models.CollabMessage{Type: models.CollabMessageError, Revision: s.revision, Error: reason})
+		s.dropLocked(client)
+	}
+}
+
+// sizeLocked returns the size of the paste's content in bytes with a file's content replaced
+func (s *collabSession) sizeLocked(changed *collabFile, content []rune) int {
+	size := len(string(content))
+	for i := range s.files {
+		if &s.files[i] != changed {
+			size += len(string(s.files[i].content))
+		}
+	}
+	return size
+}
+
+// transformCursorLocked moves a cursor placed at an earlier revision along with the edits
+// made since. The session's lock must be held.
+func (s *collabSession) transformCursorLocked(cursor models.CollabCursor, revision int) models.CollabCursor {
+	oldest := s.revision - len(s.history)
+	if revision < oldest || revision > s.revision {
+		return cursor
+	}
+	for _, edit := range s.history[revision-oldest:] {
+		if edit.File == cursor.File {
+			cursor.Position = edit.Operation.transformIndex(cursor.Position)
+			cursor.SelectionEnd = edit.Operation.transformIndex(cursor.SelectionEnd)
+		}
+	}
+	return cursor
+}
+
+// broadcastLocked sends a message to the local clients but the one it's about. The session's
+// lock must be held.
+func (s *collabSession) broadcastLocked(from string, msg models.CollabMessage) {
+	for id, client := range s.clients {
+		if id != from {
+			client.deliver(msg)
+		}
+	}
+}
+
+// snapshotLocked describes the session to a client joining it. The session's lock must be held.
+func (s *collabSession) snapshotLocked(client *CollabClient) models.CollabMessage {
+	state := s.stateLocked()
+	return models.CollabMessage{
+		Type:         models.CollabMessageSnapshot,
+		Revision:     state.Revision,
+		ClientID:     client.ID,
+		Files:        state.Files,
+		Participants: state.Participants,
+		ReadOnly:     client.ReadOnly,
+	}
+}
+
+// stateLocked copies the session's state. The session's lock must be held.
+func (s *collabSession) stateLocked() *collabState {
+	state := &collabState{
+		Revision:     s.revision,
+		History:      append([]collabEdit(nil), s.history...),
+		Participants: []models.CollabParticipant{},
+		Version:      s.version,
+		Saved:        s.saved,
+	}
+	for _, file := range s.files {
+		state.Files = append(state.Files, models.CollabFile{Name: file.name, Content: string(file.content)})
+	}
+	for _, participant := range s.participants {
+		state.Participants = append(state.Participants, *participant)
+	}
+	return state
+}
+
+// persist saves the document when local clients edited it since the last save. Edits
+// arriving meanwhile are saved next time. When the paste was changed outside the session
+// since its version, the change is handed to every replica to merge into the document, which
+// is saved next time. The PasteVersionError is returned then. When saving can't succeed
+// anymore, the session ends on every replica instead of trying again.
+func (s *collabSession) persist() error {
+	log := utils.LoggerFromContext(s.ctx)
+
+	s.saving.Lock()
+	defer s.saving.Unlock()
+
+	s.mu.Lock()
+	if !s.dirty {
+		s.mu.Unlock()
+		return nil
+	}
+	state := s.stateLocked()
+	editor := s.editor
+	s.dirty = false
+	s.mu.Unlock()
+
+	paste, err := s.save(state, editor)
+	if err != nil {
+		s.mu.Lock()
+		s.dirty = true
+		s.mu.Unlock()
+		var versionErr *PasteVersionError
+		if errors.As(err, &versionErr) {
+			log.Info().Uint64("pasteId", s.pasteID).Uint64("version", state.Version).Uint64("currentVersion", versionErr.Current).Msg("Paste changed outside collaboration, merging")
+			if err := s.publishRebase(); err != nil {
+				log.Warn().Err(err).Uint64("pasteId", s.pasteID).Msg("Failed to merge paste changed outside collaboration")
+				if collabSaveFailed(err) {
+					s.fail(err)
+				}
+			}
+			return err
+		}
+		log.Warn().Err(err).Uint64("pasteId", s.pasteID).Msg("Failed to save edited paste")
+		if collabSaveFailed(err) {
+			s.fail(err)
+		}
+		return err
+	}
+
+	s.mu.Lock()
+	if paste.Version > s.version {
+		s.setVersionLocked(paste.Version, state.Files)
+	}
+	s.mu.Unlock()
+	if err := s.publish(s.ctx, &collabEnvelope{Kind: collabEnvelopeSaved, Version: paste.Version, Files: state.Files}); err != nil {
+		log.Warn().Err(err).Uint64("pasteId", s.pasteID).Msg("Failed to announce saved paste")
+	}
+	log.Debug().Uint64("pasteId", s.pasteID).Int("revision", state.Revision).Uint64("version", paste.Version).Msg("Saved edited paste")
+	return nil
+}
+
+// collabSaveFailed reports whether saving the document failed for good: the paste is gone or
+// can't be merged with anymore, the editor lost access to it or the document no longer fits
+func collabSaveFailed(err error) bool {
+	return errors.Is(err, gorm.ErrRecordNotFound) ||
+		errors.Is(err, ErrPasteForbidden) ||
+		errors.Is(err, ErrCollabEncrypted) ||
+		errors.Is(err, ErrPasteTooLarge) ||
+		errors.Is(err, ErrStorageQuota)
+}
+
+// fail ends the session on every replica after saving the document failed for good
+func (s *collabSession) fail(err error) {
+	log := utils.LoggerFromContext(s.ctx)
+
+	reason := err.Error()
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		reason = ErrCollabGone.Error()
+	}
+	s.mu.Lock()
+	s.endLocked(reason)
+	s.mu.Unlock()
+	if err := s.publish(s.ctx, &collabEnvelope{Kind: collabEnvelopeFailed, Error: reason}); err != nil {
+		log.Warn().Err(err).Uint64("pasteId", s.pasteID).Msg("Failed to end collaboration on other replicas")
+	}
+}
+
+// save updates the paste with the session's files, keeping everything else about it. The
+// update is made to the version the session's document is based on, so that changes saved
+// outside the session meanwhile aren't overwritten.
+func (s *collabSession) save(state *collabState, editor uint) (*models.Paste, error) {
+	paste, err := s.service.pasteService.GetByID(s.ctx, s.pasteID)
+	if err != nil {
+		return nil, err
+	}
+
+	req := &models.UpdatePasteRequest{
+		ID:              paste.ID,
+		Title:           paste.Title,
+		SyntaxHighlight: paste.SyntaxHighlight,
+		EditorType:      paste.EditorType,
+		Privacy:         paste.Privacy,
+		TeamID:          paste.TeamID,
+		Version:         state.Version,
+	}
+	if editor != 0 {
+		req.UserID = strconv.FormatUint(uint64(editor), 10)
+	}
+	if len(paste.Files) == 0 {
+		req.Content = state.Files[0].Content
+	} else {
+		languages := make(map[string]string, len(paste.Files))
+		for _, file := range paste.Files {
+			languages[file.Name] = file.SyntaxHighlight
+		}
+		for _, file := range state.Files {
+			req.Files = append(req.Files, models.PasteFileRequest{Name: file.Name, Content: file.Content, SyntaxHighlight: languages[file.Name]})
+		}
+	}
+
+	return s.service.pasteService.Update(s.ctx, req)
+}
+
+// publishRebase hands the stored paste to every replica to merge into the document
+func (s *collabSession) publishRebase() error {
+	paste, err := s.service.pasteService.GetByID(s.ctx, s.pasteID)
+	if err != nil {
+		return err
+	}
+	if paste.IsEncrypted() {
+		return ErrCollabEncrypted
+	}
+	var files []models.CollabFile
+	for _, file := range paste.FileList() {
+		files = append(files, models.CollabFile{Name: file.Name, Content: file.Content})
+	}
+	return s.publish(s.ctx, &collabEnvelope{Kind: collabEnvelopeRebase, Version: paste.Version, Files: files})
+}
+
+// awaitVersion waits until the document is based on at least the version of the paste, or
+// for as long as replicas get to hand over their state
+func (s *collabSession) awaitVersion(version uint64) {
+	timeout := time.NewTimer(collabSyncTimeout)
+	defer timeout.Stop()
+	for {
+		s.mu.Lock()
+		if s.version >= version {
+			s.mu.Unlock()
+			return
+		}
+		changed := s.versionChanged
+		s.mu.Unlock()
+
+		select {
+		case <-changed:
+		case <-timeout.C:
+			return
+		}
+	}
+}
+
+// leave removes a client. The last local client to leave saves the document and ends the
+// session on this replica.
+func (s *collabSession) leave(ctx context.Context, client *CollabClient) {
+	log := utils.LoggerFromContext(ctx)
+
+	s.mu.Lock()
+	s.dropLocked(client)
+	s.mu.Unlock()
+	if err := s.publish(ctx, &collabEnvelope{Kind: collabEnvelopeLeave, Client: client.ID}); err != nil {
+		log.Warn().Err(err).Uint64("pasteId", s.pasteID).Msg("Failed to announce leaving collaboration")
+	}
+	log.Info().Uint64("pasteId", s.pasteID).Str("clientId", client.ID).Msg("Left paste collaboration")
+
+	s.mu.Lock()
+	empty := len(s.clients) == 0
+	s.mu.Unlock()
+	if !empty {
+		return
+	}
+
+	// Save before ending the session, a client joining meanwhile keeps it going. A change
+	// made outside the session is merged first, the merged document is saved once more.
+	var versionErr *PasteVersionError
+	if err := s.persist(); errors.As(err, &versionErr) {
+		s.awaitVersion(versionErr.Current)
+		_ = s.persist()
+	}
+	s.service.mu.Lock()
+	s.mu.Lock()
+	if len(s.clients) == 0 && !s.closed {
+		s.closed = true
+		delete(s.service.sessions, s.pasteID)
+		s.unsubscribe()
+		close(s.stop)
+	}
+	s.mu.Unlock()
+	s.service.mu.Unlock()
+}
+
+// dropLocked disconnects a client and closes its messages. The session's lock must be held.
+func (s *collabSession) dropLocked(client *CollabClient) {
+	client.once.Do(func() {
+		delete(s.clients, client.ID)
+		close(client.send)
+	})
+}
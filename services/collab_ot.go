@@ -0,0 +1,204 @@
+package services
+
+import (
+	"memoria-backend/models"
+	"unicode/utf8"
+)
+
+// textOperation is an edit of a text as a run of retained, inserted and deleted code points
+// covering the whole text, as in operational transformation
+type textOperation []models.CollabOpComponent
+
+// newTextOperation validates the components of an operation sent by a client and merges
+// neighbouring components of the same kind
+func newTextOperation(components []models.CollabOpComponent) (textOperation, error) {
+	var op textOperation
+	for _, component := range components {
+		kinds := 0
+		for _, set := range []bool{component.Retain != 0, component.Insert != "", component.Delete != 0} {
+			if set {
+				kinds++
+			}
+		}
+		if kinds != 1 || component.Retain < 0 || component.Delete < 0 {
+			return nil, ErrCollabOperation
+		}
+		switch {
+		case component.Retain > 0:
+			op = op.retain(component.Retain)
+		case component.Insert != "":
+			op = op.insert(component.Insert)
+		default:
+			op = op.delete(component.Delete)
+		}
+	}
+	return op, nil
+}
+
+func (op textOperation) retain(n int) textOperation {
+	if n == 0 {
+		return op
+	}
+	if last := len(op) - 1; last >= 0 && op[last].Retain > 0 {
+		op[last].Retain += n
+		return op
+	}
+	return append(op, models.CollabOpComponent{Retain: n})
+}
+
+func (op textOperation) insert(text string) textOperation {
+	if text == "" {
+		return op
+	}
+	if last := len(op) - 1; last >= 0 && op[last].Insert != "" {
+		op[last].Insert += text
+		return op
+	}
+	return append(op, models.CollabOpComponent{Insert: text})
+}
+
+func (op textOperation) delete(n int) textOperation {
+	if n == 0 {
+		return op
+	}
+	if last := len(op) - 1; last >= 0 && op[last].Delete > 0 {
+		op[last].Delete += n
+		return op
+	}
+	return append(op, models.CollabOpComponent{Delete: n})
+}
+
+// apply returns the text the operation turns text into
+func (op textOperation) apply(text []rune) ([]rune, error) {
+	result := make([]rune, 0, len(text))
+	pos := 0
+	for _, component := range op {
+		switch {
+		case component.Retain > 0:
+			if pos+component.Retain > len(text) {
+				return nil, ErrCollabOperation
+			}
+			result = append(result, text[pos:pos+component.Retain]...)
+			pos += component.Retain
+		case component.Insert != "":
+			result = append(result, []rune(component.Insert)...)
+		default:
+			if pos+component.Delete > len(text) {
+				return nil, ErrCollabOperation
+			}
+			pos += component.Delete
+		}
+	}
+	if pos != len(text) {
+		return nil, ErrCollabOperation
+	}
+	return result, nil
+}
+
+// transformOperations transforms two operations on the same text into a pair that applies
+// after the other one, so that a then b' and b then a' give the same text. Where both
+// insert at the same position, a's text comes first.
+func transformOperations(a, b textOperation) (textOperation, textOperation, error) {
+	var aPrime, bPrime textOperation
+	i, j := 0, 0
+	// Components are consumed piecemeal, these hold what's left of the current ones
+	var ca, cb models.CollabOpComponent
+	next := func(op textOperation, k *int) models.CollabOpComponent {
+		if *k >= len(op) {
+			return models.CollabOpComponent{}
+		}
+		*k++
+		return op[*k-1]
+	}
+	ca, cb = next(a, &i), next(b, &j)
+
+	for {
+		aDone := ca == (models.CollabOpComponent{})
+		bDone := cb == (models.CollabOpComponent{})
+		switch {
+		case aDone && bDone:
+			return aPrime, bPrime, nil
+		case ca.Insert != "":
+			aPrime = aPrime.insert(ca.Insert)
+			bPrime = bPrime.retain(utf8.RuneCountInString(ca.Insert))
+			ca = next(a, &i)
+			continue
+		case cb.Insert != "":
+			aPrime = aPrime.retain(utf8.RuneCountInString(cb.Insert))
+			bPrime = bPrime.insert(cb.Insert)
+			cb = next(b, &j)
+			continue
+		case aDone || bDone:
+			// The operations weren't made on texts of the same length
+			return nil, nil, ErrCollabOperation
+		}
+
+		aLen, bLen := ca.Retain+ca.Delete, cb.Retain+cb.Delete
+		n := min(aLen, bLen)
+		switch {
+		case ca.Retain > 0 && cb.Retain > 0:
+			aPrime = aPrime.retain(n)
+			bPrime = bPrime.retain(n)
+		case ca.Delete > 0 && cb.Retain > 0:
+			aPrime = aPrime.delete(n)
+		case ca.Retain > 0 && cb.Delete > 0:
+			bPrime = bPrime.delete(n)
+		}
+		// Both deleting the same text leaves nothing to do for either
+
+		ca, cb = shorten(ca, n), shorten(cb, n)
+		if ca == (models.CollabOpComponent{}) {
+			ca = next(a, &i)
+		}
+		if cb == (models.CollabOpComponent{}) {
+			cb = next(b, &j)
+		}
+	}
+}
+
+// shorten drops n code points from a retain or delete component
+func shorten(component models.CollabOpComponent, n int) models.CollabOpComponent {
+	if component.Retain > 0 {
+		component.Retain -= n
+	} else {
+		component.Delete -= n
+	}
+	return component
+}
+
+// transformIndex moves a position in the text to where it is after the operation. Text
+// inserted right at the position pushes it along.
+func (op textOperation) transformIndex(index int) int {
+	newIndex := index
+	pos := 0
+	for _, component := range op {
+		if pos > index {
+			break
+		}
+		switch {
+		case component.Retain > 0:
+			pos += component.Retain
+		case component.Insert != "":
+			newIndex += utf8.RuneCountInString(component.Insert)
+		default:
+			newIndex -= min(component.Delete, index-pos)
+			pos += component.Delete
+		}
+	}
+	return newIndex
+}
+
+// diffText returns an operation turning a into b, replacing what's between their common
+// prefix and suffix
+func diffText(a, b []rune) textOperation {
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+	var op textOperation
+	return op.retain(prefix).delete(len(a) - prefix - suffix).insert(string(b[prefix : len(b)-suffix])).retain(suffix)
+}
@@ -0,0 +1,162 @@
+package services
+
+import (
+	"math/rand"
+	"testing"
+
+	"memoria-backend/models"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testRunes mixes one, two, three and four byte code points, so that counting bytes instead
+// of code points anywhere shows
+var testRunes = []rune("ab é日🙂\n")
+
+func randomText(rng *rand.Rand, n int) []rune {
+	text := make([]rune, n)
+	for i := range text {
+		text[i] = testRunes[rng.Intn(len(testRunes))]
+	}
+	return text
+}
+
+// randomOperation returns an operation on a text of n code points
+func randomOperation(rng *rand.Rand, n int) textOperation {
+	var op textOperation
+	for pos := 0; pos < n || rng.Intn(3) == 0; {
+		if pos >= n {
+			op = op.insert(string(randomText(rng, 1+rng.Intn(3))))
+			continue
+		}
+		length := 1 + rng.Intn(n-pos)
+		switch rng.Intn(3) {
+		case 0:
+			op = op.retain(length)
+			pos += length
+		case 1:
+			op = op.insert(string(randomText(rng, 1+rng.Intn(3))))
+		default:
+			op = op.delete(length)
+			pos += length
+		}
+	}
+	return op
+}
+
+func applyString(t *testing.T, op textOperation, text string) string {
+	result, err := op.apply([]rune(text))
+	require.NoError(t, err)
+	return string(result)
+}
+
+func TestTextOperationApply(t *testing.T) {
+	op := textOperation{}.retain(6).insert("日本").delete(1).retain(1)
+	assert.Equal(t, "héllo 日本🙂", applyString(t, op, "héllo x🙂"))
+
+	// Lengths count code points, an operation covering the bytes doesn't fit
+	_, err := textOperation{}.retain(len("🙂")).apply([]rune("🙂"))
+	assert.ErrorIs(t, err, ErrCollabOperation)
+	_, err = textOperation{}.retain(1).apply([]rune("🙂🙂"))
+	assert.ErrorIs(t, err, ErrCollabOperation)
+	_, err = textOperation{}.delete(3).apply([]rune("🙂🙂"))
+	assert.ErrorIs(t, err, ErrCollabOperation)
+}
+
+func TestNewTextOperation(t *testing.T) {
+	op, err := newTextOperation([]models.CollabOpComponent{{Retain: 1}, {Retain: 2}, {Insert: "a"}, {Insert: "é"}, {Delete: 1}, {Delete: 1}})
+	require.NoError(t, err)
+	assert.Equal(t, textOperation{{Retain: 3}, {Insert: "aé"}, {Delete: 2}}, op)
+
+	invalid := [][]models.CollabOpComponent{
+		{{}},
+		{{Retain: 1, Insert: "a"}},
+		{{Insert: "a", Delete: 1}},
+		{{Retain: -1}},
+		{{Delete: -2}},
+	}
+	for _, components := range invalid {
+		_, err := newTextOperation(components)
+		assert.ErrorIs(t, err, ErrCollabOperation, "%+v", components)
+	}
+}
+
+func TestTransformOperationsConverges(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	for i := 0; i < 2000; i++ {
+		text := string(randomText(rng, rng.Intn(12)))
+		n := len([]rune(text))
+		a, b := randomOperation(rng, n), randomOperation(rng, n)
+
+		aPrime, bPrime, err := transformOperations(a, b)
+		require.NoError(t, err, "text %q a %+v b %+v", text, a, b)
+		// b' applies after a and a' after b, both orders end with the same text
+		viaA := applyString(t, bPrime, applyString(t, a, text))
+		viaB := applyString(t, aPrime, applyString(t, b, text))
+		require.Equal(t, viaA, viaB, "text %q a %+v b %+v", text, a, b)
+	}
+}
+
+func TestTransformOperationsTieBreak(t *testing.T) {
+	a := textOperation{}.retain(1).insert("日")
+	b := textOperation{}.retain(1).insert("🙂")
+	aPrime, bPrime, err := transformOperations(a, b)
+	require.NoError(t, err)
+	// Inserts at the same position put a's text first, whichever order they're applied in
+	assert.Equal(t, "é日🙂", applyString(t, bPrime, applyString(t, a, "é")))
+	assert.Equal(t, "é日🙂", applyString(t, aPrime, applyString(t, b, "é")))
+
+	_, _, err = transformOperations(textOperation{}.retain(2), textOperation{}.retain(3))
+	assert.ErrorIs(t, err, ErrCollabOperation)
+}
+
+func TestDiffText(t *testing.T) {
+	assert.Equal(t, textOperation{{Retain: 2}, {Delete: 1}, {Insert: "日本"}, {Retain: 1}}, diffText([]rune("hé🙂!"), []rune("hé日本!")))
+	assert.Empty(t, diffText(nil, nil))
+
+	rng := rand.New(rand.NewSource(3))
+	for i := 0; i < 2000; i++ {
+		a, b := randomText(rng, rng.Intn(8)), randomText(rng, rng.Intn(8))
+		result, err := diffText(a, b).apply(a)
+		require.NoError(t, err)
+		require.Equal(t, string(b), string(result))
+	}
+}
+
+func TestTransformIndex(t *testing.T) {
+	// "日本🙂語" with "é" inserted after 日 and 🙂 deleted
+	op := textOperation{}.retain(1).insert("é").retain(1).delete(1).retain(1)
+	assert.Equal(t, 0, op.transformIndex(0))
+	assert.Equal(t, 2, op.transformIndex(1)) // Text inserted right at a position pushes it along
+	assert.Equal(t, 3, op.transformIndex(2))
+	assert.Equal(t, 3, op.transformIndex(3)) // Inside deleted text, moves to where it was
+	assert.Equal(t, 4, op.transformIndex(4))
+}
+
+func TestTransformIndexFollowsRetainedText(t *testing.T) {
+	rng := rand.New(rand.NewSource(2))
+	for i := 0; i < 2000; i++ {
+		text := randomText(rng, rng.Intn(12))
+		op := randomOperation(rng, len(text))
+		result, err := op.apply(text)
+		require.NoError(t, err)
+
+		// Every retained code point is still found where its index moved to
+		pos := 0
+		for _, component := range op {
+			if component.Insert != "" {
+				continue
+			}
+			if component.Retain > 0 {
+				for index := pos; index < pos+component.Retain; index++ {
+					moved := op.transformIndex(index)
+					require.Less(t, moved, len(result), "op %+v index %d", op, index)
+					require.Equal(t, string(text[index]), string(result[moved]), "op %+v index %d", op, index)
+				}
+			}
+			pos += component.Retain + component.Delete
+		}
+		require.LessOrEqual(t, op.transformIndex(len(text)), len(result), "op %+v end", op)
+	}
+}
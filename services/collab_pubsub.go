@@ -0,0 +1,121 @@
+package services
+
+import (
+	"context"
+	"sync"
+)
+
+// PubSub carries collaboration messages between the server replicas editing the same paste.
+// Every message published on a topic is delivered to every subscription of the topic, the
+// publisher's own included, and all subscriptions see the messages of a topic in the same
+// order: that order is what sequences concurrent edits. Implementations backed by a message
+// broker let several replicas serve one paste.
+type PubSub interface {
+	Publish(ctx context.Context, topic string, payload []byte) error
+	// Subscribe returns the messages published on the topic from now on, and a function that
+	// ends the subscription and closes the channel
+	Subscribe(ctx context.Context, topic string) (<-chan []byte, func(), error)
+}
+
+// memoryPubSub is a PubSub within a single process, for servers running as one replica
+type memoryPubSub struct {
+	mu     sync.Mutex
+	topics map[string]map[*memorySubscription]bool
+}
+
+// NewMemoryPubSub creates a PubSub that delivers messages within the process
+func NewMemoryPubSub() PubSub {
+	return &memoryPubSub{
+		topics: make(map[string]map[*memorySubscription]bool),
+	}
+}
+
+// memorySubscription queues messages without bound, so publishing never waits for a slow
+// subscriber and subscribers can publish while handling a message
+type memorySubscription struct {
+	mu     sync.Mutex
+	queue  [][]byte
+	notify chan struct{} // Signals queued messages
+	done   chan struct{} // Closed when the subscription ends
+	out    chan []byte
+}
+
+func (p *memoryPubSub) Publish(ctx context.Context, topic string, payload []byte) error {
+	// Queuing under the lock keeps every subscription's order the same
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for subscription := range p.topics[topic] {
+		subscription.push(payload)
+	}
+	return nil
+}
+
+func (p *memoryPubSub) Subscribe(ctx context.Context, topic string) (<-chan []byte, func(), error) {
+	subscription := &memorySubscription{
+		notify: make(chan struct{}, 1),
+		done:   make(chan struct{}),
+		out:    make(chan []byte),
+	}
+	go subscription.pump()
+
+	p.mu.Lock()
+	if p.topics[topic] == nil {
+		p.topics[topic] = make(map[*memorySubscription]bool)
+	}
+	p.topics[topic][subscription] = true
+	p.mu.Unlock()
+
+	var once sync.Once
+	unsubscribe := func() {
+		once.Do(func() {
+			p.mu.Lock()
+			delete(p.topics[topic], subscription)
+			if len(p.topics[topic]) == 0 {
+				delete(p.topics, topic)
+			}
+			p.mu.Unlock()
+			close(subscription.done)
+		})
+	}
+	return subscription.out, unsubscribe, nil
+}
+
+func (s *memorySubscription) push(payload []byte) {
+	s.mu.Lock()
+	s.queue = append(s.queue, payload)
+	s.mu.Unlock()
+	select {
+	case s.notify <- struct{}{}:
+	default:
+	}
+}
+
+// pump hands queued messages to the subscriber until the subscription ends
+func (s *memorySubscription) pump() {
+	defer close(s.out)
+	for {
+		s.mu.Lock()
+		var payload []byte
+		queued := len(s.queue) > 0
+		if queued {
+			payload = s.queue[0]
+			s.queue = s.queue[1:]
+		}
+		s.mu.Unlock()
+
+		if !queued {
+			select {
+			case <-s.notify:
+				continue
+			case <-s.done:
+				return
+			}
+		}
+		select {
+		case s.out <- payload:
+		case <-s.done:
+			return
+		}
+	}
+}
@@ -157,7 +157,7 @@ func (s *configService) InitConfig(ctx context.Context) error {
 		k := s.envKeyReplacer(key)
 
 		// Check if this key should be an array
-		if k == "auth.allowedOrigins" {
+		if envArrayKeys[strings.ToLower(k)] {
 			log.Debug().Str("key", k).Str("value", value).Msg("Parsing array from env var")
 			// Split by comma and trim whitespace
 			parts := strings.Split(value, ",")
@@ -198,6 +198,15 @@ func (s *configService) InitConfig(ctx context.Context) error {
 	return nil
 }
 
+// envArrayKeys lists the (lowercased) config keys whose env values are comma-separated lists
+var envArrayKeys = map[string]bool{
+	"auth.allowedorigins":     true,
+	"auth.adminemails":        true,
+	"auth.oidc.scopes":        true,
+	"auth.oidc.admingroups":   true,
+	"auth.oidc.allowedgroups": true,
+}
+
 // Helper method for environment variable key conversion
 func (s *configService) envKeyReplacer(key string) string {
 	// original := key
@@ -212,6 +221,9 @@ func (s *configService) envKeyReplacer(key string) string {
 	if transformed == "auth.allowedorigins" {
 		transformed = "auth.allowedOrigins"
 	}
+	if transformed == "auth.adminemails" {
+		transformed = "auth.adminEmails"
+	}
 
 	// This would normally use logger, but since this is called during config loading
 	// before logger might be fully available, we don't log here
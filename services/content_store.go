@@ -0,0 +1,53 @@
+package services
+
+import (
+	"fmt"
+	"memoria-backend/models"
+	"memoria-backend/repository"
+
+	"gorm.io/gorm"
+)
+
+// NewContentStore creates the content store selected by the storage driver setting
+func NewContentStore(cfg *models.Configuration, db *gorm.DB) (repository.ContentStore, error) {
+	switch cfg.Storage.Driver {
+	case "", "database":
+		return repository.NewDBContentStore(db), nil
+	case "fs":
+		return repository.NewFSContentStore(cfg.Storage.Dir)
+	case "s3":
+		s3 := cfg.Storage.S3
+		return repository.NewS3ContentStore(repository.S3Options{
+			Endpoint:  s3.Endpoint,
+			Region:    s3.Region,
+			Bucket:    s3.Bucket,
+			Prefix:    s3.Prefix,
+			AccessKey: s3.AccessKey,
+			SecretKey: s3.SecretKey,
+			UseSSL:    s3.UseSSL,
+		})
+	default:
+		return nil, fmt.Errorf("unknown storage driver %q", cfg.Storage.Driver)
+	}
+}
+
+// NewPasteStorage sets up encryption at rest and the content store for the paste repository
+func NewPasteStorage(cfg *models.Configuration, db *gorm.DB) (repository.PasteStorage, error) {
+	keyring, err := LoadKeyring(cfg)
+	if err != nil {
+		return repository.PasteStorage{}, fmt.Errorf("loading encryption keys: %w", err)
+	}
+	store, err := NewContentStore(cfg, db)
+	if err != nil {
+		return repository.PasteStorage{}, fmt.Errorf("creating content store: %w", err)
+	}
+
+	return repository.PasteStorage{
+		Keyring:          keyring,
+		EncryptPublic:    cfg.Encryption.EncryptPublic,
+		Store:            store,
+		InlineMaxBytes:   cfg.Storage.InlineMaxBytes,
+		Compression:      cfg.Storage.Compression,
+		CompressMinBytes: cfg.Storage.CompressMinBytes,
+	}, nil
+}
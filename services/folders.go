@@ -0,0 +1,324 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"memoria-backend/models"
+	"memoria-backend/repository"
+	"memoria-backend/utils"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+var (
+	ErrFolderNotFound  = errors.New("folder not found")
+	ErrFolderForbidden = errors.New("you don't have permission to change this folder")
+	ErrFolderPrivacy   = errors.New("team folders must be team or public, personal folders private or public")
+	ErrFolderParent    = errors.New("a folder's parent must have the same owner and can't be the folder itself or one of its subfolders")
+	ErrFolderPublish   = errors.New("only team owners can make a team folder public")
+)
+
+type FolderService interface {
+	List(ctx context.Context, userID uint) ([]models.Folder, error)
+	Get(ctx context.Context, id, userID uint, tags []string) (*models.FolderContentsData, error)
+	Create(ctx context.Context, userID uint, req *models.CreateFolderRequest) (*models.Folder, error)
+	Update(ctx context.Context, id, userID uint, req *models.UpdateFolderRequest) (*models.Folder, error)
+	Delete(ctx context.Context, id, userID uint) error
+}
+
+type folderService struct {
+	repo      repository.FolderRepository
+	pasteRepo repository.PasteRepository
+	teamRepo  repository.TeamRepository
+}
+
+func NewFolderService(folderRepo repository.FolderRepository, pasteRepo repository.PasteRepository, teamRepo repository.TeamRepository) FolderService {
+	return &folderService{
+		repo:      folderRepo,
+		pasteRepo: pasteRepo,
+		teamRepo:  teamRepo,
+	}
+}
+
+// canViewFolder reports whether the user may see the folder and the pastes directly in it
+func canViewFolder(ctx context.Context, teamRepo repository.TeamRepository, folder *models.Folder, userID uint) (bool, error) {
+	if folder.Privacy == models.FolderPrivacyPublic {
+		return true, nil
+	}
+	if folder.TeamID == nil {
+		return userID != 0 && folder.UserID == userID, nil
+	}
+	_, err := checkTeamRole(ctx, teamRepo, *folder.TeamID, userID, models.TeamRoleViewer)
+	if errors.Is(err, ErrTeamNotFound) || errors.Is(err, ErrTeamForbidden) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// editableFolder loads a folder the user may change: their own, or one of a team they're an
+// editor of. Folders the user can't even see are reported as not found.
+func editableFolder(ctx context.Context, folderRepo repository.FolderRepository, teamRepo repository.TeamRepository, id, userID uint) (*models.Folder, error) {
+	folder, err := folderRepo.GetByID(ctx, id)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrFolderNotFound
+		}
+		return nil, err
+	}
+
+	if folder.TeamID == nil {
+		if userID != 0 && folder.UserID == userID {
+			return folder, nil
+		}
+	} else {
+		_, err := checkTeamRole(ctx, teamRepo, *folder.TeamID, userID, models.TeamRoleEditor)
+		if err == nil {
+			return folder, nil
+		}
+		if !errors.Is(err, ErrTeamNotFound) && !errors.Is(err, ErrTeamForbidden) {
+			return nil, err
+		}
+	}
+
+	visible, err := canViewFolder(ctx, teamRepo, folder, userID)
+	if err != nil {
+		return nil, err
+	}
+	if !visible {
+		return nil, ErrFolderNotFound
+	}
+	return nil, ErrFolderForbidden
+}
+
+// checkFolderPrivacy makes sure team folders aren't private to one user and personal ones
+// aren't shared with a team
+func checkFolderPrivacy(folder *models.Folder) error {
+	switch folder.Privacy {
+	case models.FolderPrivacyPublic:
+		return nil
+	case models.FolderPrivacyTeam:
+		if folder.TeamID != nil {
+			return nil
+		}
+	case models.FolderPrivacyPrivate:
+		if folder.TeamID == nil {
+			return nil
+		}
+	}
+	return ErrFolderPrivacy
+}
+
+// checkPublish makes sure the user may make the folder public. A public folder shows the
+// pastes in it to anyone, including private pastes other team members put there, so editors
+// may organize a team folder but only team owners publish it.
+func (s *folderService) checkPublish(ctx context.Context, folder *models.Folder, userID uint) error {
+	if folder.TeamID == nil {
+		return nil
+	}
+	_, err := checkTeamRole(ctx, s.teamRepo, *folder.TeamID, userID, models.TeamRoleOwner)
+	if errors.Is(err, ErrTeamForbidden) {
+		return ErrFolderPublish
+	}
+	return err
+}
+
+// checkParent makes sure the folder can go into the parent: the user may change the parent,
+// it has the same owner and isn't the folder itself or below it
+func (s *folderService) checkParent(ctx context.Context, folder *models.Folder, parentID, userID uint) error {
+	parent, err := editableFolder(ctx, s.repo, s.teamRepo, parentID, userID)
+	if err != nil {
+		return err
+	}
+	if parent.UserID != folder.UserID || (parent.TeamID == nil) != (folder.TeamID == nil) ||
+		(parent.TeamID != nil && *parent.TeamID != *folder.TeamID) {
+		return ErrFolderParent
+	}
+
+	// Walk up from the new parent, the folder must not be one of its ancestors
+	if folder.ID == 0 {
+		return nil
+	}
+	for ancestor := parent; ; {
+		if ancestor.ID == folder.ID {
+			return ErrFolderParent
+		}
+		if ancestor.ParentID == nil {
+			return nil
+		}
+		if ancestor, err = s.repo.GetByID(ctx, *ancestor.ParentID); err != nil {
+			return err
+		}
+	}
+}
+
+// List returns the user's personal folders and the folders of their teams
+func (s *folderService) List(ctx context.Context, userID uint) ([]models.Folder, error) {
+	memberships, err := s.teamRepo.GetMemberships(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	teamIDs := make([]uint, len(memberships))
+	for i, membership := range memberships {
+		teamIDs[i] = membership.TeamID
+	}
+	return s.repo.GetByOwner(ctx, userID, teamIDs)
+}
+
+// Get returns the folder with the subfolders and pastes in it the user can see, only the
+// pastes carrying all of the tags when any are given
+func (s *folderService) Get(ctx context.Context, id, userID uint, tags []string) (*models.FolderContentsData, error) {
+	folder, err := s.repo.GetByID(ctx, id)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrFolderNotFound
+		}
+		return nil, err
+	}
+	visible, err := canViewFolder(ctx, s.teamRepo, folder, userID)
+	if err != nil {
+		return nil, err
+	}
+	if !visible {
+		return nil, ErrFolderNotFound
+	}
+
+	children, err := s.repo.GetChildren(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	folders := []models.Folder{}
+	for _, child := range children {
+		visible, err := canViewFolder(ctx, s.teamRepo, &child, userID)
+		if err != nil {
+			return nil, err
+		}
+		if visible {
+			folders = append(folders, child)
+		}
+	}
+
+	pastes, err := s.pasteRepo.GetByFolderID(ctx, id, normalizeTagFilter(tags))
+	if err != nil {
+		return nil, err
+	}
+	pastes = visiblePastes(pastes)
+	if pastes == nil {
+		pastes = []models.Paste{}
+	}
+
+	return &models.FolderContentsData{Folder: folder, Folders: folders, Pastes: pastes}, nil
+}
+
+// Create makes a folder for the user, or for a team they're an editor of. Subfolders
+// belong to the owner of their parent.
+func (s *folderService) Create(ctx context.Context, userID uint, req *models.CreateFolderRequest) (*models.Folder, error) {
+	log := utils.LoggerFromContext(ctx)
+
+	folder := &models.Folder{
+		Name:     strings.TrimSpace(req.Name),
+		ParentID: req.ParentID,
+		Privacy:  req.Privacy,
+	}
+	if req.TeamID != nil {
+		if _, err := checkTeamRole(ctx, s.teamRepo, *req.TeamID, userID, models.TeamRoleEditor); err != nil {
+			return nil, err
+		}
+		folder.TeamID = req.TeamID
+	} else {
+		folder.UserID = userID
+	}
+
+	if err := checkFolderPrivacy(folder); err != nil {
+		return nil, err
+	}
+	if folder.Privacy == models.FolderPrivacyPublic {
+		if err := s.checkPublish(ctx, folder, userID); err != nil {
+			return nil, err
+		}
+	}
+	if folder.ParentID != nil {
+		if err := s.checkParent(ctx, folder, *folder.ParentID, userID); err != nil {
+			return nil, err
+		}
+	}
+
+	created, err := s.repo.Create(ctx, folder)
+	if err != nil {
+		return nil, err
+	}
+
+	log.Info().Uint("folderId", created.ID).Uint("userId", userID).Msg("Created folder")
+	return created, nil
+}
+
+// Update renames, moves or changes the privacy of a folder. The owner stays the same.
+func (s *folderService) Update(ctx context.Context, id, userID uint, req *models.UpdateFolderRequest) (*models.Folder, error) {
+	folder, err := editableFolder(ctx, s.repo, s.teamRepo, id, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if req.Privacy == models.FolderPrivacyPublic && folder.Privacy != models.FolderPrivacyPublic {
+		if err := s.checkPublish(ctx, folder, userID); err != nil {
+			return nil, err
+		}
+	}
+
+	folder.Name = strings.TrimSpace(req.Name)
+	folder.Privacy = req.Privacy
+	folder.ParentID = req.ParentID
+	if err := checkFolderPrivacy(folder); err != nil {
+		return nil, err
+	}
+	if folder.ParentID != nil {
+		if err := s.checkParent(ctx, folder, *folder.ParentID, userID); err != nil {
+			return nil, err
+		}
+	}
+
+	return s.repo.Update(ctx, folder)
+}
+
+// Delete removes a folder. Its subfolders and pastes move up into its parent.
+func (s *folderService) Delete(ctx context.Context, id, userID uint) error {
+	log := utils.LoggerFromContext(ctx)
+
+	folder, err := editableFolder(ctx, s.repo, s.teamRepo, id, userID)
+	if err != nil {
+		return err
+	}
+	if err := s.repo.Delete(ctx, folder); err != nil {
+		return err
+	}
+
+	log.Info().Uint("folderId", id).Uint("userId", userID).Msg("Deleted folder")
+	return nil
+}
+
+// MoveToFolder moves a paste into a folder, or out of its folder when folderID is nil. Anyone
+// who can see a folder can see its pastes, so only the paste's owner may move it and only
+// into a folder they may change.
+func (s *pasteService) MoveToFolder(ctx context.Context, pasteID uint64, userID uint, folderID *uint) error {
+	log := utils.LoggerFromContext(ctx)
+
+	paste, err := s.repo.GetByID(ctx, pasteID)
+	if err != nil {
+		return err
+	}
+	if err := s.requirePermission(ctx, paste, userID, models.PastePermissionOwner); err != nil {
+		return err
+	}
+	if folderID != nil {
+		if _, err := editableFolder(ctx, s.folderRepo, s.teamRepo, *folderID, userID); err != nil {
+			return err
+		}
+	}
+
+	if err := s.repo.SetFolder(ctx, pasteID, folderID); err != nil {
+		return err
+	}
+
+	log.Info().Uint64("pasteId", pasteID).Interface("folderId", folderID).Msg("Moved paste")
+	return nil
+}
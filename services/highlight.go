@@ -0,0 +1,252 @@
+package services
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"fmt"
+	"html"
+	"memoria-backend/models"
+	"memoria-backend/repository"
+	"memoria-backend/utils"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/alecthomas/chroma/v2"
+	chromahtml "github.com/alecthomas/chroma/v2/formatters/html"
+	"github.com/alecthomas/chroma/v2/lexers"
+	"github.com/alecthomas/chroma/v2/styles"
+)
+
+var (
+	ErrUnknownTheme       = errors.New("unknown highlighting theme")
+	ErrRenderingEncrypted = errors.New("client-side encrypted pastes can't be rendered on the server")
+)
+
+type HighlightService interface {
+	RenderPaste(ctx context.Context, paste *models.Paste, req *models.RenderPasteRequest) (string, error)
+	RenderDocument(ctx context.Context, paste *models.Paste, req *models.RenderPasteRequest) (string, error)
+	TableOfContents(ctx context.Context, paste *models.Paste) ([]models.TOCEntry, error)
+	ThemeCSS(theme string) (string, error)
+	Themes() []string
+}
+
+type highlightService struct {
+	configService ConfigService
+	cache         *renderCache
+}
+
+// NewHighlightService creates a service rendering pastes to highlighted HTML. Rendered files
+// are cached in memory up to render.cacheBytes.
+func NewHighlightService(configService ConfigService) HighlightService {
+	return &highlightService{
+		configService: configService,
+		cache:         newRenderCache(configService.GetConfig().Render.CacheBytes),
+	}
+}
+
+// highlightFormatter renders with CSS classes instead of inline styles, so rendered HTML is
+// the same for every theme and a theme is just a stylesheet
+func highlightFormatter(lineAnchorPrefix string) *chromahtml.Formatter {
+	return chromahtml.New(
+		chromahtml.WithClasses(true),
+		chromahtml.WithLineNumbers(true),
+		chromahtml.WithLinkableLineNumbers(true, lineAnchorPrefix),
+	)
+}
+
+// fileLexer picks the lexer for a file: the requested language, else the file's own, else
+// one matching its name. Anything unknown is highlighted as plain text.
+func fileLexer(file *models.PasteFile, language string) (chroma.Lexer, error) {
+	if language != "" {
+		lexer := lexers.Get(language)
+		if lexer == nil {
+			return nil, ErrUnknownLanguage
+		}
+		return chroma.Coalesce(lexer), nil
+	}
+	lexer := lexers.Get(file.SyntaxHighlight)
+	if lexer == nil && file.Name != models.DefaultFileName {
+		lexer = lexers.Match(file.Name)
+	}
+	if lexer == nil {
+		lexer = lexers.Fallback
+	}
+	return chroma.Coalesce(lexer), nil
+}
+
+// RenderPaste renders the paste's files as an HTML fragment, styled by the stylesheet of
+// ThemeCSS. Code lines are numbered and anchored as #L12, or #f2-L12 for the second file of
+// a multi-file paste. Text pastes and markdown files are rendered as markdown unless the
+// source or another language is asked for. Callers must have checked that the paste may be
+// viewed.
+func (s *highlightService) RenderPaste(ctx context.Context, paste *models.Paste, req *models.RenderPasteRequest) (string, error) {
+	log := utils.LoggerFromContext(ctx)
+
+	if paste.IsEncrypted() {
+		return "", ErrRenderingEncrypted
+	}
+
+	files := paste.FileList()
+	var out strings.Builder
+	out.WriteString(`<div class="memoria-paste">`)
+	for i := range files {
+		file := &files[i]
+		hash := file.ContentHash
+		if hash == "" {
+			hash = repository.ContentHash([]byte(file.Content))
+		}
+
+		var key string
+		var render func() (string, error)
+		if isMarkdownFile(paste, file) && !req.Source && req.Language == "" {
+			key = hash + "\x00markdown"
+			render = func() (string, error) { return renderMarkdown(file.Content) }
+		} else {
+			lexer, err := fileLexer(file, req.Language)
+			if err != nil {
+				return "", err
+			}
+			anchorPrefix := "L"
+			if len(files) > 1 {
+				anchorPrefix = fmt.Sprintf("f%d-L", i+1)
+			}
+			key = strings.Join([]string{hash, lexer.Config().Name, anchorPrefix}, "\x00")
+			render = func() (string, error) { return renderCode(file.Content, lexer, anchorPrefix) }
+		}
+
+		rendered, ok := s.cache.get(key)
+		if !ok {
+			var err error
+			if rendered, err = render(); err != nil {
+				return "", err
+			}
+			s.cache.add(key, rendered)
+			log.Debug().Uint64("pasteId", paste.ID).Str("file", file.Name).Msg("Rendered paste file")
+		}
+
+		fmt.Fprintf(&out, `<div class="memoria-file" id="f%d">`, i+1)
+		if len(paste.Files) > 0 {
+			fmt.Fprintf(&out, `<div class="memoria-file-name">%s</div>`, html.EscapeString(file.Name))
+		}
+		out.WriteString(rendered)
+		out.WriteString(`</div>`)
+	}
+	out.WriteString(`</div>`)
+	return out.String(), nil
+}
+
+// renderCode highlights code with numbered lines
+func renderCode(content string, lexer chroma.Lexer, anchorPrefix string) (string, error) {
+	iterator, err := lexer.Tokenise(nil, content)
+	if err != nil {
+		return "", err
+	}
+	var buf strings.Builder
+	if err := highlightFormatter(anchorPrefix).Format(&buf, styles.Fallback, iterator); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// RenderDocument renders the paste as a complete HTML page with the stylesheet of the
+// requested theme embedded, for clients that can't load a separate stylesheet and for
+// embedding in other pages. An empty theme is the configured default.
+func (s *highlightService) RenderDocument(ctx context.Context, paste *models.Paste, req *models.RenderPasteRequest) (string, error) {
+	css, err := s.ThemeCSS(req.Theme)
+	if err != nil {
+		return "", err
+	}
+	fragment, err := s.RenderPaste(ctx, paste, req)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf(`<!DOCTYPE html><html><head><meta charset="utf-8"><title>%s</title><style>%s</style></head><body>%s</body></html>`,
+		html.EscapeString(paste.Title), css, fragment), nil
+}
+
+// ThemeCSS returns the stylesheet of a theme for the HTML RenderPaste produces. An empty
+// theme is the configured default.
+func (s *highlightService) ThemeCSS(theme string) (string, error) {
+	if theme == "" {
+		theme = s.configService.GetConfig().Render.DefaultTheme
+	}
+	style, ok := styles.Registry[strings.ToLower(theme)]
+	if !ok {
+		return "", ErrUnknownTheme
+	}
+
+	var buf strings.Builder
+	if err := highlightFormatter("L").WriteCSS(&buf, style); err != nil {
+		return "", err
+	}
+	buf.WriteString(".memoria-file-name { font-weight: bold; margin: 1em 0 0.5em; }\n")
+	buf.WriteString(markdownCSS)
+	return buf.String(), nil
+}
+
+// Themes lists the names of the available themes, sorted
+func (s *highlightService) Themes() []string {
+	names := styles.Names()
+	slices.Sort(names)
+	return names
+}
+
+// renderCache keeps rendered HTML in memory, evicting the least recently used entries once
+// their total size exceeds maxBytes. A maxBytes of 0 disables caching.
+type renderCache struct {
+	mu       sync.Mutex
+	maxBytes int64
+	size     int64
+	order    *list.List // Front is the most recently used
+	entries  map[string]*list.Element
+}
+
+type renderCacheEntry struct {
+	key  string
+	html string
+}
+
+func newRenderCache(maxBytes int64) *renderCache {
+	return &renderCache{
+		maxBytes: maxBytes,
+		order:    list.New(),
+		entries:  make(map[string]*list.Element),
+	}
+}
+
+func (c *renderCache) get(key string) (string, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	element, ok := c.entries[key]
+	if !ok {
+		return "", false
+	}
+	c.order.MoveToFront(element)
+	return element.Value.(*renderCacheEntry).html, true
+}
+
+func (c *renderCache) add(key string, html string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if int64(len(html)) > c.maxBytes {
+		return
+	}
+	if element, ok := c.entries[key]; ok {
+		c.order.MoveToFront(element)
+		return
+	}
+	c.entries[key] = c.order.PushFront(&renderCacheEntry{key: key, html: html})
+	c.size += int64(len(html))
+
+	for c.size > c.maxBytes {
+		oldest := c.order.Back()
+		entry := oldest.Value.(*renderCacheEntry)
+		c.order.Remove(oldest)
+		delete(c.entries, entry.key)
+		c.size -= int64(len(entry.html))
+	}
+}
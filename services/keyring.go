@@ -0,0 +1,57 @@
+package services
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"memoria-backend/models"
+	"memoria-backend/utils"
+	"os"
+)
+
+// LoadKeyring builds the keyring for encrypting paste content at rest from the master keys
+// in the config and the optional key file. It returns nil when no master key is configured,
+// pastes are then stored in plaintext.
+func LoadKeyring(cfg *models.Configuration) (*utils.Keyring, error) {
+	encoded := make(map[string]string)
+	for id, key := range cfg.Encryption.MasterKeys {
+		encoded[id] = key
+	}
+
+	if cfg.Encryption.KeyFile != "" {
+		data, err := os.ReadFile(cfg.Encryption.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("reading key file: %w", err)
+		}
+		var fileKeys map[string]string
+		if err := json.Unmarshal(data, &fileKeys); err != nil {
+			return nil, fmt.Errorf("parsing key file: %w", err)
+		}
+		for id, key := range fileKeys {
+			encoded[id] = key
+		}
+	}
+
+	if len(encoded) == 0 {
+		return nil, nil
+	}
+
+	keys := make(map[string][]byte, len(encoded))
+	for id, key := range encoded {
+		decoded, err := base64.StdEncoding.DecodeString(key)
+		if err != nil {
+			return nil, fmt.Errorf("master key %q is not valid base64: %w", id, err)
+		}
+		keys[id] = decoded
+	}
+
+	// With a single key there is nothing to choose from
+	activeID := cfg.Encryption.ActiveKeyID
+	if activeID == "" && len(keys) == 1 {
+		for id := range keys {
+			activeID = id
+		}
+	}
+
+	return utils.NewKeyring(keys, activeID)
+}
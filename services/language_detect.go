@@ -0,0 +1,300 @@
+package services
+
+import (
+	"encoding/json"
+	"math"
+	"memoria-backend/models"
+	"path"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/alecthomas/chroma/v2/lexers"
+)
+
+const (
+	// detectSampleBytes is how much of the content the content heuristics look at
+	detectSampleBytes = 64 << 10
+	// maxLanguageGuesses caps how many guesses Detect returns
+	maxLanguageGuesses = 5
+	// minLanguageGuess drops guesses too weak to be useful
+	minLanguageGuess = 0.1
+	// minDetectedLanguage is how confident the best guess must be to be stored with a paste
+	minDetectedLanguage = 0.4
+)
+
+// Confidence each kind of evidence gives on its own. Content heuristics are capped lower,
+// they only ever suggest a language.
+const (
+	shebangConfidence    = 0.95
+	modelineConfidence   = 0.9
+	extensionConfidence  = 0.85
+	maxContentConfidence = 0.8
+)
+
+// shebangInterpreters maps interpreters to languages where the names differ
+var shebangInterpreters = map[string]string{
+	"sh": "bash", "dash": "bash", "ksh": "bash", "zsh": "bash", "ash": "bash",
+	"node": "javascript", "nodejs": "javascript", "bun": "javascript",
+	"deno": "typescript", "ts-node": "typescript", "tsx": "typescript",
+	"rscript": "r", "pwsh": "powershell", "tclsh": "tcl", "wish": "tcl",
+	"gawk": "awk", "mawk": "awk", "nawk": "awk",
+}
+
+// modelineModes maps Vim filetypes and Emacs modes to languages where the names differ
+var modelineModes = map[string]string{
+	"shell-script": "bash", "js2": "javascript", "js": "javascript", "c++": "cpp",
+	"cs": "csharp", "py": "python", "rb": "ruby", "yml": "yaml", "dosini": "ini", "conf": "ini",
+}
+
+var (
+	shebangPattern       = regexp.MustCompile(`^#!\s*(\S+)(?:\s+(.*))?`)
+	interpreterVersion   = regexp.MustCompile(`[0-9.]+$`)
+	vimModelinePattern   = regexp.MustCompile(`(?:^|\s)(?:vi|vim|ex)(?:[<=>]?\d+)?:.*?\b(?:ft|filetype|syntax)=([\w+#.-]+)`)
+	emacsModelinePattern = regexp.MustCompile(`-\*-\s*(?:.*?;\s*)?(?:mode:\s*)?([\w+#.-]+)\s*(?:;.*?)?-\*-`)
+)
+
+// languageRule is a content pattern hinting at a language, worth weight for each match up to
+// three matches
+type languageRule struct {
+	pattern *regexp.Regexp
+	weight  float64
+}
+
+func rules(weight float64, patterns ...string) []languageRule {
+	compiled := make([]languageRule, len(patterns))
+	for i, pattern := range patterns {
+		compiled[i] = languageRule{pattern: regexp.MustCompile(`(?m)` + pattern), weight: weight}
+	}
+	return compiled
+}
+
+// languageRules are the content heuristics, strong tells weigh 3 and common tokens 1
+var languageRules = map[string][]languageRule{
+	"go": slices.Concat(
+		rules(3, `^package \w+\s*$`, `^func (?:\(\w+ \*?\w+\) )?\w+\(`, `\bfmt\.\w+\(`, `^import \($`),
+		rules(1, `:= `, `\bif err != nil\b`, `\bchan\b`, `\bgo func\b`),
+	),
+	"python": slices.Concat(
+		rules(3, `^\s*def \w+\(.*\):\s*$`, `^from [\w.]+ import \w`, `^if __name__ == ['"]__main__['"]:`, `^\s*class \w+(?:\(.*\))?:\s*$`),
+		rules(1, `^import \w+\s*$`, `\bself\.\w+`, `^\s*elif\b`, `\bNone\b`, `\bprint\(`),
+	),
+	"javascript": slices.Concat(
+		rules(3, `\bconsole\.log\(`, `\brequire\(['"]`, `\bmodule\.exports\b`, `\bdocument\.\w+`),
+		rules(1, `\bfunction\s*\w*\s*\(`, `^\s*(?:const|let|var) \w+ = `, `=> \{`, `===`),
+	),
+	"typescript": slices.Concat(
+		rules(3, `^\s*(?:export )?interface \w+ \{`, `^\s*(?:export )?type \w+ = `, `:\s*(?:string|number|boolean)(?:\[\])?\s*[;,)=]`),
+		rules(1, `\bimport .* from ['"]`, `\breadonly\b`, `<\w+>\(`),
+	),
+	"java": slices.Concat(
+		rules(3, `\bpublic (?:static )?(?:final )?class \w+`, `\bSystem\.out\.println\(`, `^import java\.`, `public static void main\(String`),
+		rules(1, `@Override\b`, `\bprivate (?:final )?\w+ \w+;`, `\bnew \w+\(`),
+	),
+	"csharp": slices.Concat(
+		rules(3, `^using System(?:\.\w+)*;`, `\bConsole\.WriteLine\(`, `^namespace [\w.]+`),
+		rules(1, `\bpublic (?:async )?\w+ \w+\(`, `\bvar \w+ = new\b`, `\{ get; set; \}`),
+	),
+	"c": slices.Concat(
+		rules(3, `^#include <\w+\.h>`, `\bprintf\(`, `\bmalloc\(`),
+		rules(1, `^int main\(`, `\bsizeof\(`, `^#define \w+`),
+	),
+	"cpp": slices.Concat(
+		rules(3, `^#include <(?:iostream|vector|string|map|memory)>`, `\bstd::\w+`, `\bcout\s*<<`),
+		rules(1, `\btemplate\s*<`, `\bnullptr\b`, `^using namespace \w+;`),
+	),
+	"rust": slices.Concat(
+		rules(3, `^\s*(?:pub )?fn \w+\(`, `\blet mut \w+`, `\bprintln!\(`, `^use std::`),
+		rules(1, `\bimpl\b`, `->\s*\w+\s*\{`, `\bOption<`, `&mut\b`),
+	),
+	"ruby": slices.Concat(
+		rules(3, `^\s*require ['"]\w+`, `^\s*def \w+(?:\(.*\))?\s*$`, `\bputs\b`, `\.each do \|`),
+		rules(1, `^\s*end\s*$`, `\battr_accessor\b`, `@\w+`),
+	),
+	"php": slices.Concat(
+		rules(3, `<\?php`, `\$\w+->\w+`),
+		rules(1, `\$\w+\s*=`, `\becho\b`, `\bfunction \w+\(`),
+	),
+	"bash": slices.Concat(
+		rules(3, `^\s*(?:fi|done|esac)\s*$`, `^\s*export \w+=`, `\$\{\w+[:}]`),
+		rules(1, `^\s*echo\b`, `\[\[ .* \]\]`, `\$\(\w+`, `^\s*if \[`),
+	),
+	"sql": slices.Concat(
+		rules(3, `(?i)\bselect\b.+\bfrom\b`, `(?i)\binsert into\b`, `(?i)\bcreate table\b`, `(?i)\bupdate \w+ set\b`),
+		rules(1, `(?i)\bwhere\b`, `(?i)\bjoin\b`, `(?i)\bgroup by\b`, `(?i)\border by\b`),
+	),
+	"html": slices.Concat(
+		rules(3, `(?i)<!DOCTYPE html>`, `(?i)<html[\s>]`, `(?i)<(?:head|body)[\s>]`),
+		rules(1, `(?i)<(?:div|span|p|a|script|link)[\s>]`, `(?i)</\w+>`),
+	),
+	"css": slices.Concat(
+		rules(3, `^\s*[.#]?[\w-]+(?:\s*[,>+~]\s*[.#]?[\w-]+)*\s*\{\s*$`, `^\s*@media\b`),
+		rules(1, `^\s*[\w-]+:\s*[^;{]+;\s*$`),
+	),
+	"yaml": slices.Concat(
+		rules(3, `^---\s*$`, `^[\w-]+:\s*$`),
+		rules(1, `^\s*[\w-]+: \S`, `^\s*- [\w-]+`),
+	),
+	"markdown": slices.Concat(
+		rules(3, `^#{1,6} \S`, "^```"),
+		rules(1, `^\s*[-*] \S`, `\[[^\]]+\]\([^)]+\)`, `\*\*\S.*\S\*\*`),
+	),
+	"docker": rules(3, `^FROM \S+`, `^RUN `, `^(?:COPY|ADD|ENTRYPOINT|CMD|WORKDIR|EXPOSE) `),
+	"xml":    rules(3, `^<\?xml `, `(?i)<!\[CDATA\[`),
+}
+
+// languageGuesses collects evidence for languages and combines it
+type languageGuesses struct {
+	languages  *languageService
+	confidence map[string]float64
+	reason     map[string]string
+	strongest  map[string]float64
+}
+
+func (g *languageGuesses) add(name string, confidence float64, reason string) {
+	language, ok := g.languages.Lookup(name)
+	if !ok || confidence <= 0 {
+		return
+	}
+	// Independent pieces of evidence add up without ever reaching certainty
+	g.confidence[language.ID] = 1 - (1-g.confidence[language.ID])*(1-confidence)
+	if confidence > g.strongest[language.ID] {
+		g.strongest[language.ID] = confidence
+		g.reason[language.ID] = reason
+	}
+}
+
+// Detect guesses the language of content from a shebang, an editor modeline, the extension of
+// fileName and the content itself, best guess first
+func (s *languageService) Detect(fileName, content string) []models.LanguageGuess {
+	guesses := &languageGuesses{
+		languages:  s,
+		confidence: map[string]float64{},
+		reason:     map[string]string{},
+		strongest:  map[string]float64{},
+	}
+
+	if name := detectShebang(content); name != "" {
+		guesses.add(name, shebangConfidence, "shebang")
+	}
+	if name := detectModeline(content); name != "" {
+		guesses.add(name, modelineConfidence, "modeline")
+	}
+	if fileName = path.Base(strings.TrimSpace(fileName)); fileName != "" && fileName != "." && fileName != models.DefaultFileName {
+		if language, ok := s.lexerLanguage(lexers.Match(fileName)); ok {
+			guesses.add(language.ID, extensionConfidence, "extension")
+		}
+	}
+
+	sample := content
+	if len(sample) > detectSampleBytes {
+		sample = strings.ToValidUTF8(sample[:detectSampleBytes], "")
+	}
+	scores := contentScores(sample)
+	// Chroma's analysers only know a few languages well, plain text is its way of not knowing
+	if language, ok := s.lexerLanguage(lexers.Analyse(sample)); ok && language.ID != "text" {
+		scores[language.ID] += 3
+	}
+	total := 0.0
+	for _, score := range scores {
+		total += score
+	}
+	for id, score := range scores {
+		guesses.add(id, maxContentConfidence*score/(total+3), "content")
+	}
+
+	result := []models.LanguageGuess{}
+	for id, confidence := range guesses.confidence {
+		if confidence < minLanguageGuess {
+			continue
+		}
+		language, _ := s.Lookup(id)
+		result = append(result, models.LanguageGuess{
+			Language:   id,
+			Name:       language.Name,
+			Confidence: math.Round(confidence*100) / 100,
+			Reason:     guesses.reason[id],
+		})
+	}
+	slices.SortFunc(result, func(a, b models.LanguageGuess) int {
+		if a.Confidence != b.Confidence {
+			if a.Confidence > b.Confidence {
+				return -1
+			}
+			return 1
+		}
+		return strings.Compare(a.Language, b.Language)
+	})
+	if len(result) > maxLanguageGuesses {
+		result = result[:maxLanguageGuesses]
+	}
+	return result
+}
+
+// detectShebang returns the interpreter named by a #! line, python3.11 and
+// /usr/bin/env -S node --flags both work
+func detectShebang(content string) string {
+	firstLine, _, _ := strings.Cut(content, "\n")
+	match := shebangPattern.FindStringSubmatch(strings.TrimSpace(firstLine))
+	if match == nil {
+		return ""
+	}
+	interpreter := path.Base(match[1])
+	if interpreter == "env" {
+		interpreter = ""
+		for _, arg := range strings.Fields(match[2]) {
+			if !strings.HasPrefix(arg, "-") && !strings.Contains(arg, "=") {
+				interpreter = path.Base(arg)
+				break
+			}
+		}
+	}
+	interpreter = strings.ToLower(interpreterVersion.ReplaceAllString(interpreter, ""))
+	if language, ok := shebangInterpreters[interpreter]; ok {
+		return language
+	}
+	return interpreter
+}
+
+// detectModeline returns the filetype of a Vim or Emacs modeline in the first or last five
+// lines
+func detectModeline(content string) string {
+	lines := strings.SplitN(content, "\n", 6)
+	if len(lines) == 6 {
+		lines = lines[:5]
+		tail := strings.Split(content, "\n")
+		lines = append(lines, tail[max(len(tail)-5, 5):]...)
+	}
+	for _, line := range lines {
+		match := vimModelinePattern.FindStringSubmatch(line)
+		if match == nil {
+			match = emacsModelinePattern.FindStringSubmatch(line)
+		}
+		if match != nil {
+			mode := strings.ToLower(match[1])
+			if language, ok := modelineModes[mode]; ok {
+				return language
+			}
+			return strings.TrimSuffix(mode, "-mode")
+		}
+	}
+	return ""
+}
+
+// contentScores scores the sample against the content heuristics of each language
+func contentScores(sample string) map[string]float64 {
+	scores := map[string]float64{}
+	trimmed := strings.TrimSpace(sample)
+	if (strings.HasPrefix(trimmed, "{") || strings.HasPrefix(trimmed, "[")) && json.Valid([]byte(trimmed)) {
+		scores["json"] = 20
+		return scores
+	}
+	for language, languageRules := range languageRules {
+		for _, rule := range languageRules {
+			if matches := len(rule.pattern.FindAllStringIndex(sample, 3)); matches > 0 {
+				scores[language] += rule.weight * float64(matches)
+			}
+		}
+	}
+	return scores
+}
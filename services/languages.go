@@ -0,0 +1,100 @@
+package services
+
+import (
+	"errors"
+	"memoria-backend/models"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/alecthomas/chroma/v2"
+	"github.com/alecthomas/chroma/v2/lexers"
+)
+
+var ErrUnknownLanguage = errors.New("unknown language, GET /languages lists the supported ones")
+
+type LanguageService interface {
+	List() []models.Language
+	Lookup(name string) (*models.Language, bool)
+	Detect(fileName, content string) []models.LanguageGuess
+}
+
+// languageService serves the languages of the highlighter's lexers. Each language's ID is
+// its lexer's name when that's a plain word, else its first alias, so IDs look like "go",
+// "python", "cpp" and "csharp".
+type languageService struct {
+	languages []models.Language
+	byName    map[string]*models.Language // IDs, names and aliases, lower-cased
+	byLexer   map[string]*models.Language // Lexer names as chroma has them
+}
+
+// plainLanguageID matches lexer names usable as language IDs as they are
+var plainLanguageID = regexp.MustCompile(`^[a-z0-9]+$`)
+
+// languageIDOverrides keeps IDs pastes were stored with before there was a registry
+var languageIDOverrides = map[string]string{"plaintext": "text"}
+
+func NewLanguageService() LanguageService {
+	s := &languageService{
+		byName:  make(map[string]*models.Language),
+		byLexer: make(map[string]*models.Language),
+	}
+
+	for _, lexer := range lexers.GlobalLexerRegistry.Lexers {
+		config := lexer.Config()
+		language := models.Language{ID: strings.ToLower(config.Name), Name: config.Name}
+		if !plainLanguageID.MatchString(language.ID) && len(config.Aliases) > 0 {
+			language.ID = strings.ToLower(config.Aliases[0])
+		}
+		if id, ok := languageIDOverrides[language.ID]; ok {
+			language.ID = id
+		}
+		for _, alias := range config.Aliases {
+			if alias = strings.ToLower(alias); alias != language.ID {
+				language.Aliases = append(language.Aliases, alias)
+			}
+		}
+		for _, pattern := range config.Filenames {
+			if ext, ok := strings.CutPrefix(pattern, "*."); ok && !strings.ContainsAny(ext, "*?[") {
+				language.Extensions = append(language.Extensions, "."+ext)
+			}
+		}
+		s.languages = append(s.languages, language)
+	}
+	slices.SortFunc(s.languages, func(a, b models.Language) int { return strings.Compare(a.ID, b.ID) })
+
+	for i := range s.languages {
+		language := &s.languages[i]
+		s.byLexer[language.Name] = language
+		for _, name := range append([]string{language.ID, strings.ToLower(language.Name)}, language.Aliases...) {
+			if _, taken := s.byName[name]; !taken {
+				s.byName[name] = language
+			}
+		}
+	}
+	// The IDs win over names and aliases of other languages
+	for i := range s.languages {
+		s.byName[s.languages[i].ID] = &s.languages[i]
+	}
+	return s
+}
+
+// List returns the supported languages sorted by ID
+func (s *languageService) List() []models.Language {
+	return s.languages
+}
+
+// Lookup finds a language by its ID, name or one of its aliases, ignoring case
+func (s *languageService) Lookup(name string) (*models.Language, bool) {
+	language, ok := s.byName[strings.ToLower(strings.TrimSpace(name))]
+	return language, ok
+}
+
+// lexerLanguage returns the language of a lexer found by chroma
+func (s *languageService) lexerLanguage(lexer chroma.Lexer) (*models.Language, bool) {
+	if lexer == nil {
+		return nil, false
+	}
+	language, ok := s.byLexer[lexer.Config().Name]
+	return language, ok
+}
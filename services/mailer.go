@@ -0,0 +1,219 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"embed"
+	"encoding/hex"
+	"fmt"
+	htmltemplate "html/template"
+	"memoria-backend/models"
+	"memoria-backend/utils"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"net/smtp"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+)
+
+//go:embed templates/email/*.tmpl
+var emailTemplates embed.FS
+
+// Email templates, each has a .txt.tmpl and a .html.tmpl variant
+const (
+	EmailTemplatePasswordReset = "password_reset"
+	EmailTemplateVerifyEmail   = "verify_email"
+)
+
+// EmailMessage is a rendered email ready to be sent
+type EmailMessage struct {
+	To       string
+	Subject  string
+	TextBody string
+	HTMLBody string
+}
+
+// Mailer sends emails
+type Mailer interface {
+	Send(ctx context.Context, msg *EmailMessage) error
+}
+
+// NewMailer creates the mailer selected by the mail driver setting
+func NewMailer(cfg *models.Configuration) Mailer {
+	if cfg.Mail.Driver == "smtp" {
+		return &smtpMailer{
+			from:     cfg.Mail.From,
+			host:     cfg.Mail.SMTPHost,
+			port:     cfg.Mail.SMTPPort,
+			username: cfg.Mail.SMTPUsername,
+			password: cfg.Mail.SMTPPassword,
+		}
+	}
+	return &logMailer{from: cfg.Mail.From, outboxDir: cfg.Mail.OutboxDir}
+}
+
+// RenderEmail renders the text and HTML variants of an email template
+func RenderEmail(name string, data interface{}) (textBody string, htmlBody string, err error) {
+	textTmpl, err := template.ParseFS(emailTemplates, "templates/email/"+name+".txt.tmpl")
+	if err != nil {
+		return "", "", fmt.Errorf("error parsing text template %s: %w", name, err)
+	}
+	htmlTmpl, err := htmltemplate.ParseFS(emailTemplates, "templates/email/"+name+".html.tmpl")
+	if err != nil {
+		return "", "", fmt.Errorf("error parsing html template %s: %w", name, err)
+	}
+
+	var textBuf, htmlBuf bytes.Buffer
+	if err := textTmpl.Execute(&textBuf, data); err != nil {
+		return "", "", fmt.Errorf("error rendering text template %s: %w", name, err)
+	}
+	if err := htmlTmpl.Execute(&htmlBuf, data); err != nil {
+		return "", "", fmt.Errorf("error rendering html template %s: %w", name, err)
+	}
+	return textBuf.String(), htmlBuf.String(), nil
+}
+
+// buildMIMEMessage encodes the message as a multipart/alternative email
+func buildMIMEMessage(from string, msg *EmailMessage) ([]byte, error) {
+	var buf bytes.Buffer
+	writer := multipart.NewWriter(&buf)
+
+	messageID, err := randomToken(16)
+	if err != nil {
+		return nil, err
+	}
+	domain := "localhost"
+	if addr, err := mail.ParseAddress(from); err == nil {
+		if at := strings.LastIndex(addr.Address, "@"); at >= 0 {
+			domain = addr.Address[at+1:]
+		}
+	}
+
+	headers := []string{
+		"From: " + from,
+		"To: " + msg.To,
+		"Subject: " + mime.QEncoding.Encode("utf-8", msg.Subject),
+		"Date: " + time.Now().Format(time.RFC1123Z),
+		"Message-ID: <" + messageID + "@" + domain + ">",
+		"MIME-Version: 1.0",
+		"Content-Type: multipart/alternative; boundary=" + writer.Boundary(),
+	}
+	for _, header := range headers {
+		buf.WriteString(header + "\r\n")
+	}
+	buf.WriteString("\r\n")
+
+	parts := []struct {
+		contentType string
+		body        string
+	}{
+		{"text/plain; charset=utf-8", msg.TextBody},
+		{"text/html; charset=utf-8", msg.HTMLBody},
+	}
+	for _, part := range parts {
+		partWriter, err := writer.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {part.contentType},
+			"Content-Transfer-Encoding": {"quoted-printable"},
+		})
+		if err != nil {
+			return nil, err
+		}
+		qp := quotedprintable.NewWriter(partWriter)
+		if _, err := qp.Write([]byte(part.body)); err != nil {
+			return nil, err
+		}
+		if err := qp.Close(); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := writer.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// smtpMailer sends email through an SMTP relay, upgrading to TLS when the server supports it
+type smtpMailer struct {
+	from     string
+	host     string
+	port     int
+	username string
+	password string
+}
+
+func (m *smtpMailer) Send(ctx context.Context, msg *EmailMessage) error {
+	log := utils.LoggerFromContext(ctx)
+
+	sender, err := mail.ParseAddress(m.from)
+	if err != nil {
+		return fmt.Errorf("invalid mail from address: %w", err)
+	}
+
+	body, err := buildMIMEMessage(m.from, msg)
+	if err != nil {
+		return err
+	}
+
+	var auth smtp.Auth
+	if m.username != "" {
+		auth = smtp.PlainAuth("", m.username, m.password, m.host)
+	}
+
+	addr := m.host + ":" + strconv.Itoa(m.port)
+	if err := smtp.SendMail(addr, auth, sender.Address, []string{msg.To}, body); err != nil {
+		log.Error().Err(err).Str("smtpHost", m.host).Msg("Failed to send email")
+		return fmt.Errorf("error sending email: %w", err)
+	}
+
+	log.Info().Str("subject", msg.Subject).Msg("Email sent")
+	return nil
+}
+
+// logMailer is meant for development. It logs each email and, when an outbox
+// directory is configured, writes it there as an .eml file.
+type logMailer struct {
+	from      string
+	outboxDir string
+}
+
+func (m *logMailer) Send(ctx context.Context, msg *EmailMessage) error {
+	log := utils.LoggerFromContext(ctx)
+
+	log.Info().
+		Str("to", msg.To).
+		Str("subject", msg.Subject).
+		Str("body", msg.TextBody).
+		Msg("Email (log mailer)")
+
+	if m.outboxDir == "" {
+		return nil
+	}
+
+	body, err := buildMIMEMessage(m.from, msg)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(m.outboxDir, 0755); err != nil {
+		return fmt.Errorf("error creating outbox directory: %w", err)
+	}
+
+	suffix := make([]byte, 4)
+	if _, err := rand.Read(suffix); err != nil {
+		return err
+	}
+	name := time.Now().UTC().Format("20060102T150405") + "-" + hex.EncodeToString(suffix) + ".eml"
+	if err := os.WriteFile(filepath.Join(m.outboxDir, name), body, 0644); err != nil {
+		return fmt.Errorf("error writing email to outbox: %w", err)
+	}
+	return nil
+}
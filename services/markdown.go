@@ -0,0 +1,150 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"memoria-backend/models"
+	"regexp"
+	"slices"
+
+	chromahtml "github.com/alecthomas/chroma/v2/formatters/html"
+	"github.com/microcosm-cc/bluemonday"
+	"github.com/yuin/goldmark"
+	highlighting "github.com/yuin/goldmark-highlighting/v2"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/extension"
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/text"
+)
+
+// markdownSyntaxes are the highlighting modes rendered as markdown in text pastes. Files of
+// a text paste set to anything else are code and stay highlighted.
+var markdownSyntaxes = []string{"", "text", "plaintext", "markdown", "md"}
+
+// markdown renders CommonMark with the GFM extensions. Fenced code is highlighted with the
+// same CSS classes as code files, so themes style both. Raw HTML is escaped rather than
+// passed through.
+var markdown = goldmark.New(
+	goldmark.WithExtensions(
+		extension.GFM,
+		highlighting.NewHighlighting(highlighting.WithFormatOptions(chromahtml.WithClasses(true))),
+	),
+	goldmark.WithParserOptions(parser.WithAutoHeadingID()),
+)
+
+// markdownPolicy sanitises rendered markdown. On top of the usual user content it keeps the
+// highlighting classes of fenced code and the checkboxes of task lists.
+var markdownPolicy = func() *bluemonday.Policy {
+	policy := bluemonday.UGCPolicy()
+	policy.AllowAttrs("class").Matching(regexp.MustCompile(`^[\w -]+$`)).OnElements("pre", "code", "span", "div")
+	policy.AllowAttrs("type").Matching(regexp.MustCompile(`^checkbox$`)).OnElements("input")
+	policy.AllowAttrs("checked", "disabled").OnElements("input")
+	return policy
+}()
+
+const markdownCSS = `.memoria-markdown table { border-collapse: collapse; }
+.memoria-markdown th, .memoria-markdown td { border: 1px solid #d0d7de; padding: 0.25em 0.75em; }
+.memoria-markdown li:has(> input[type=checkbox]) { list-style: none; }
+`
+
+// isMarkdownFile reports whether a file is rendered as markdown: markdown files anywhere,
+// and text files of pastes written in the text editor
+func isMarkdownFile(paste *models.Paste, file *models.PasteFile) bool {
+	if file.SyntaxHighlight == "markdown" || file.SyntaxHighlight == "md" {
+		return true
+	}
+	return paste.EditorType == "text" && slices.Contains(markdownSyntaxes, file.SyntaxHighlight)
+}
+
+// renderMarkdown renders markdown to sanitised HTML
+func renderMarkdown(content string) (string, error) {
+	var buf bytes.Buffer
+	if err := markdown.Convert([]byte(content), &buf); err != nil {
+		return "", err
+	}
+	return `<div class="memoria-markdown">` + markdownPolicy.Sanitize(buf.String()) + `</div>`, nil
+}
+
+// TableOfContents lists the headings of the paste's markdown files, nested by level. The IDs
+// are the anchors of the headings in the HTML RenderPaste produces. Pastes without markdown
+// have an empty table of contents.
+func (s *highlightService) TableOfContents(ctx context.Context, paste *models.Paste) ([]models.TOCEntry, error) {
+	if paste.IsEncrypted() {
+		return nil, ErrRenderingEncrypted
+	}
+
+	var headings []models.TOCEntry
+	for _, file := range paste.FileList() {
+		if !isMarkdownFile(paste, &file) {
+			continue
+		}
+		source := []byte(file.Content)
+		document := markdown.Parser().Parse(text.NewReader(source))
+		err := ast.Walk(document, func(node ast.Node, entering bool) (ast.WalkStatus, error) {
+			heading, ok := node.(*ast.Heading)
+			if !entering || !ok {
+				return ast.WalkContinue, nil
+			}
+			entry := models.TOCEntry{Level: heading.Level, Text: inlineText(heading, source)}
+			if id, ok := heading.AttributeString("id"); ok {
+				entry.ID = string(id.([]byte))
+			}
+			if len(paste.Files) > 0 {
+				entry.File = file.Name
+			}
+			headings = append(headings, entry)
+			return ast.WalkSkipChildren, nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return nestHeadings(headings), nil
+}
+
+// inlineText concatenates the text of a node's inline children, dropping the markup
+func inlineText(node ast.Node, source []byte) string {
+	var buf bytes.Buffer
+	_ = ast.Walk(node, func(child ast.Node, entering bool) (ast.WalkStatus, error) {
+		if !entering {
+			return ast.WalkContinue, nil
+		}
+		switch child := child.(type) {
+		case *ast.Text:
+			buf.Write(child.Segment.Value(source))
+			if child.SoftLineBreak() || child.HardLineBreak() {
+				buf.WriteByte(' ')
+			}
+		case *ast.String:
+			buf.Write(child.Value)
+		case *ast.CodeSpan:
+			for c := child.FirstChild(); c != nil; c = c.NextSibling() {
+				if segment, ok := c.(*ast.Text); ok {
+					buf.Write(segment.Segment.Value(source))
+				}
+			}
+			return ast.WalkSkipChildren, nil
+		}
+		return ast.WalkContinue, nil
+	})
+	return buf.String()
+}
+
+// nestHeadings turns a flat list of headings into a tree, each heading holding the deeper
+// headings that follow it
+func nestHeadings(headings []models.TOCEntry) []models.TOCEntry {
+	nested := []models.TOCEntry{}
+	for i := 0; i < len(headings); {
+		entry := headings[i]
+		end := i + 1
+		for end < len(headings) && headings[end].Level > entry.Level && headings[end].File == entry.File {
+			end++
+		}
+		if end > i+1 {
+			entry.Children = nestHeadings(headings[i+1 : end])
+		}
+		nested = append(nested, entry)
+		i = end
+	}
+	return nested
+}
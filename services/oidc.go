@@ -0,0 +1,380 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"memoria-backend/models"
+	"memoria-backend/utils"
+	"strings"
+	"time"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+	"github.com/golang-jwt/jwt/v5"
+	"golang.org/x/oauth2"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrLocalLoginDisabled  = errors.New("local account login is disabled")
+	ErrOIDCDisabled        = errors.New("single sign-on is not enabled")
+	ErrOIDCInvalidState    = errors.New("single sign-on state is invalid or expired")
+	ErrOIDCEmailMissing    = errors.New("identity provider did not return a verified email address")
+	ErrOIDCNotAllowed      = errors.New("your account is not in a group allowed to use this server")
+	ErrOIDCNoAccount       = errors.New("no account exists for this identity and provisioning is disabled")
+	ErrOIDCEmailConflict   = errors.New("an account with this email already exists and is not linked to this identity")
+	ErrOIDCEmailUnverified = errors.New("an account with this email exists but its address isn't verified, verify it before signing in with single sign-on")
+)
+
+const oidcStateTTL = 10 * time.Minute
+
+// oidcStateClaims carry the per-login values between the redirect to the identity
+// provider and the callback. They are signed and stored in a short-lived cookie.
+type oidcStateClaims struct {
+	Purpose  string `json:"purpose"`
+	State    string `json:"state"`
+	Nonce    string `json:"nonce"`
+	Verifier string `json:"verifier"`
+	Redirect string `json:"redirect,omitempty"`
+	jwt.RegisteredClaims
+}
+
+// oidcClaims are the ID token claims used to provision and update users
+type oidcClaims struct {
+	Email             string `json:"email"`
+	EmailVerified     *bool  `json:"email_verified"`
+	Name              string `json:"name"`
+	PreferredUsername string `json:"preferred_username"`
+}
+
+// oidcClient holds the discovered provider for the configured issuer
+type oidcClient struct {
+	issuerURL string
+	provider  *oidc.Provider
+}
+
+// randomToken returns n random bytes, hex encoded
+func randomToken(n int) (string, error) {
+	bytes := make([]byte, n)
+	if _, err := rand.Read(bytes); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(bytes), nil
+}
+
+// oidcProvider returns the discovered provider, running discovery again when the issuer changes
+func (s *authService) oidcProvider() (*oidc.Provider, error) {
+	cfg := s.configService.GetConfig()
+	if !cfg.Auth.OIDC.Enabled {
+		return nil, ErrOIDCDisabled
+	}
+
+	s.oidcLock.Lock()
+	defer s.oidcLock.Unlock()
+
+	if s.oidc != nil && s.oidc.issuerURL == cfg.Auth.OIDC.IssuerURL {
+		return s.oidc.provider, nil
+	}
+
+	// Discovery and key fetching outlive any single request, so they don't use a request context
+	ctx := oidc.ClientContext(context.Background(), s.httpClient)
+	provider, err := oidc.NewProvider(ctx, cfg.Auth.OIDC.IssuerURL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to discover OIDC provider: %w", err)
+	}
+
+	s.oidc = &oidcClient{issuerURL: cfg.Auth.OIDC.IssuerURL, provider: provider}
+	return provider, nil
+}
+
+// oauth2Config builds the OAuth 2.0 client config for the provider
+func (s *authService) oauth2Config(provider *oidc.Provider) *oauth2.Config {
+	cfg := s.configService.GetConfig().Auth.OIDC
+
+	scopes := cfg.Scopes
+	hasOpenID := false
+	for _, scope := range scopes {
+		if scope == oidc.ScopeOpenID {
+			hasOpenID = true
+		}
+	}
+	if !hasOpenID {
+		scopes = append([]string{oidc.ScopeOpenID}, scopes...)
+	}
+
+	return &oauth2.Config{
+		ClientID:     cfg.ClientID,
+		ClientSecret: cfg.ClientSecret,
+		RedirectURL:  cfg.RedirectURL,
+		Endpoint:     provider.Endpoint(),
+		Scopes:       scopes,
+	}
+}
+
+func (s *authService) LoginMethods(ctx context.Context) *models.LoginMethodsData {
+	cfg := s.configService.GetConfig()
+	return &models.LoginMethodsData{
+		Local:        cfg.Auth.EnableLocal,
+		OIDC:         cfg.Auth.OIDC.Enabled,
+		ProviderName: cfg.Auth.OIDC.ProviderName,
+	}
+}
+
+func (s *authService) BeginOIDCLogin(ctx context.Context, redirect string) (*models.OIDCLoginStart, error) {
+	log := utils.LoggerFromContext(ctx)
+
+	provider, err := s.oidcProvider()
+	if err != nil {
+		return nil, err
+	}
+
+	// Only same-site paths are accepted so the callback can't be used as an open redirect
+	if !strings.HasPrefix(redirect, "/") || strings.HasPrefix(redirect, "//") {
+		redirect = ""
+	}
+
+	state, err := randomToken(16)
+	if err != nil {
+		return nil, err
+	}
+	nonce, err := randomToken(16)
+	if err != nil {
+		return nil, err
+	}
+	verifier := oauth2.GenerateVerifier()
+
+	now := time.Now()
+	claims := oidcStateClaims{
+		Purpose:  models.TokenPurposeOIDCState,
+		State:    state,
+		Nonce:    nonce,
+		Verifier: verifier,
+		Redirect: redirect,
+		RegisteredClaims: jwt.RegisteredClaims{
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(oidcStateTTL)),
+		},
+	}
+	stateToken, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(s.signingKey())
+	if err != nil {
+		return nil, err
+	}
+
+	authURL := s.oauth2Config(provider).AuthCodeURL(state,
+		oidc.Nonce(nonce),
+		oauth2.S256ChallengeOption(verifier),
+	)
+
+	log.Info().Str("issuer", s.configService.GetConfig().Auth.OIDC.IssuerURL).Msg("Redirecting to identity provider")
+	return &models.OIDCLoginStart{
+		AuthorizationURL: authURL,
+		StateToken:       stateToken,
+		MaxAge:           oidcStateTTL,
+	}, nil
+}
+
+func (s *authService) CompleteOIDCLogin(ctx context.Context, req *models.OIDCCallbackRequest) (*models.LoginData, string, error) {
+	log := utils.LoggerFromContext(ctx)
+
+	provider, err := s.oidcProvider()
+	if err != nil {
+		return nil, "", err
+	}
+
+	stateClaims := &oidcStateClaims{}
+	_, err = jwt.ParseWithClaims(req.StateToken, stateClaims, func(t *jwt.Token) (interface{}, error) {
+		return s.signingKey(), nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}))
+	if err != nil || stateClaims.Purpose != models.TokenPurposeOIDCState || stateClaims.State != req.State {
+		return nil, "", ErrOIDCInvalidState
+	}
+
+	if req.Error != "" {
+		return nil, stateClaims.Redirect, fmt.Errorf("identity provider returned an error: %s", req.Error)
+	}
+
+	providerCtx := oidc.ClientContext(ctx, s.httpClient)
+	oauthToken, err := s.oauth2Config(provider).Exchange(providerCtx, req.Code, oauth2.VerifierOption(stateClaims.Verifier))
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to exchange authorization code")
+		return nil, stateClaims.Redirect, fmt.Errorf("failed to exchange authorization code: %w", err)
+	}
+
+	rawIDToken, ok := oauthToken.Extra("id_token").(string)
+	if !ok || rawIDToken == "" {
+		return nil, stateClaims.Redirect, errors.New("identity provider did not return an ID token")
+	}
+
+	cfg := s.configService.GetConfig().Auth.OIDC
+	idToken, err := provider.Verifier(&oidc.Config{ClientID: cfg.ClientID}).Verify(providerCtx, rawIDToken)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to verify ID token")
+		return nil, stateClaims.Redirect, fmt.Errorf("failed to verify ID token: %w", err)
+	}
+
+	if idToken.Nonce != stateClaims.Nonce {
+		return nil, stateClaims.Redirect, ErrOIDCInvalidState
+	}
+
+	var claims oidcClaims
+	if err := idToken.Claims(&claims); err != nil {
+		return nil, stateClaims.Redirect, err
+	}
+
+	// The groups claim name differs between providers, so it's read separately
+	var allClaims map[string]interface{}
+	if err := idToken.Claims(&allClaims); err != nil {
+		return nil, stateClaims.Redirect, err
+	}
+	groups := claimStrings(allClaims[cfg.GroupsClaim])
+
+	if len(cfg.AllowedGroups) > 0 && !intersects(groups, cfg.AllowedGroups) {
+		log.Info().Str("subject", idToken.Subject).Strs("groups", groups).Msg("SSO login rejected, no allowed group")
+		return nil, stateClaims.Redirect, ErrOIDCNotAllowed
+	}
+
+	user, err := s.provisionOIDCUser(ctx, idToken.Issuer, idToken.Subject, &claims, groups)
+	if err != nil {
+		return nil, stateClaims.Redirect, err
+	}
+
+	loginData, err := s.loginUser(ctx, user)
+	if err != nil {
+		return nil, stateClaims.Redirect, err
+	}
+	return loginData, stateClaims.Redirect, nil
+}
+
+// provisionOIDCUser finds the user linked to the identity, links an existing account
+// with the same verified email, or creates a new account just in time
+func (s *authService) provisionOIDCUser(ctx context.Context, issuer, subject string, claims *oidcClaims, groups []string) (*models.User, error) {
+	log := utils.LoggerFromContext(ctx)
+	cfg := s.configService.GetConfig().Auth.OIDC
+
+	role := models.RoleUser
+	if intersects(groups, cfg.AdminGroups) {
+		role = models.RoleAdmin
+	}
+
+	user, err := s.userRepo.GetByOIDCIdentity(issuer, subject)
+	if err == nil {
+		columns := map[string]interface{}{"role": role}
+		if claims.Email != "" && claims.EmailVerified != nil && *claims.EmailVerified {
+			columns["email"] = claims.Email
+			user.Email = claims.Email
+			if !user.EmailVerified {
+				columns["email_verified"] = true
+				columns["email_verified_at"] = time.Now()
+				user.EmailVerified = true
+			}
+		}
+		if err := s.userRepo.UpdateColumns(user.ID, columns); err != nil {
+			return nil, err
+		}
+		user.Role = role
+		return user, nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+
+	if claims.Email == "" || claims.EmailVerified == nil || !*claims.EmailVerified {
+		return nil, ErrOIDCEmailMissing
+	}
+
+	// Link an existing local account with the same verified email. Only accounts that proved
+	// they own the address are linked: anyone could have registered it locally to take over
+	// the account its owner later signs in to with single sign-on.
+	user, err = s.userRepo.GetByEmail(claims.Email)
+	if err == nil {
+		if user.OIDCSubject != nil {
+			return nil, ErrOIDCEmailConflict
+		}
+		if !user.EmailVerified {
+			log.Info().Uint("userId", user.ID).Str("issuer", issuer).Msg("Refused linking SSO identity to unverified account")
+			return nil, ErrOIDCEmailUnverified
+		}
+		if err := s.userRepo.UpdateColumns(user.ID, map[string]interface{}{
+			"oidc_issuer":  issuer,
+			"oidc_subject": subject,
+			"role":         role,
+		}); err != nil {
+			return nil, err
+		}
+		user.Role = role
+		log.Info().Uint("userId", user.ID).Str("issuer", issuer).Msg("Linked existing account to SSO identity")
+		return user, nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+
+	if !cfg.AutoProvision {
+		return nil, ErrOIDCNoAccount
+	}
+
+	name := claims.Name
+	if name == "" {
+		name = claims.PreferredUsername
+	}
+	if name == "" {
+		name = claims.Email
+	}
+
+	// SSO users never log in with a password, so they get an unusable random one
+	password, err := randomToken(32)
+	if err != nil {
+		return nil, err
+	}
+
+	verifiedAt := time.Now()
+	user = &models.User{
+		Name:            name,
+		Email:           claims.Email,
+		Password:        password,
+		EmailVerified:   true,
+		EmailVerifiedAt: &verifiedAt,
+		Role:            role,
+		OIDCIssuer:      &issuer,
+		OIDCSubject:     &subject,
+	}
+	user, err = s.userRepo.Create(user)
+	if err != nil {
+		return nil, err
+	}
+
+	log.Info().Uint("userId", user.ID).Str("issuer", issuer).Msg("Provisioned user from SSO login")
+	return user, nil
+}
+
+// claimStrings converts a string or list claim into a string slice
+func claimStrings(value interface{}) []string {
+	switch v := value.(type) {
+	case string:
+		return []string{v}
+	case []interface{}:
+		values := make([]string, 0, len(v))
+		for _, item := range v {
+			if str, ok := item.(string); ok {
+				values = append(values, str)
+			}
+		}
+		return values
+	default:
+		return nil
+	}
+}
+
+// intersects reports whether the two lists share a value
+func intersects(a, b []string) bool {
+	for _, x := range a {
+		for _, y := range b {
+			if x == y {
+				return true
+			}
+		}
+	}
+	return false
+}
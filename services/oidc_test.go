@@ -0,0 +1,477 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"memoria-backend/models"
+	"memoria-backend/repository"
+
+	"github.com/go-jose/go-jose/v4"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+const (
+	testClientID    = "memoria"
+	testRedirectURL = "http://memoria.test/api/v1/auth/oidc/callback"
+	testKeyID       = "test-key"
+)
+
+// testIdP is an identity provider serving discovery, keys, authorization and tokens.
+// Authorization grants a code right away for the claims set on the provider.
+type testIdP struct {
+	server *httptest.Server
+	key    *rsa.PrivateKey
+
+	lock sync.Mutex
+	// claims go into the next ID tokens, next to the registered ones
+	claims map[string]interface{}
+	// nonce replaces the nonce sent in the authorization request when set
+	nonce  string
+	grants map[string]testGrant
+}
+
+type testGrant struct {
+	nonce     string
+	challenge string
+}
+
+func newTestIdP(t *testing.T) *testIdP {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	idp := &testIdP{key: key, grants: map[string]testGrant{}}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", idp.discovery)
+	mux.HandleFunc("/keys", idp.keys)
+	mux.HandleFunc("/authorize", idp.authorize)
+	mux.HandleFunc("/token", idp.token)
+	idp.server = httptest.NewServer(mux)
+	t.Cleanup(idp.server.Close)
+	return idp
+}
+
+func (idp *testIdP) setClaims(claims map[string]interface{}) {
+	idp.lock.Lock()
+	defer idp.lock.Unlock()
+	idp.claims = claims
+}
+
+func (idp *testIdP) discovery(w http.ResponseWriter, r *http.Request) {
+	issuer := idp.server.URL
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"issuer":                                issuer,
+		"authorization_endpoint":                issuer + "/authorize",
+		"token_endpoint":                        issuer + "/token",
+		"jwks_uri":                              issuer + "/keys",
+		"response_types_supported":              []string{"code"},
+		"subject_types_supported":               []string{"public"},
+		"id_token_signing_alg_values_supported": []string{"RS256"},
+		"code_challenge_methods_supported":      []string{"S256"},
+	})
+}
+
+func (idp *testIdP) keys(w http.ResponseWriter, r *http.Request) {
+	json.NewEncoder(w).Encode(jose.JSONWebKeySet{Keys: []jose.JSONWebKey{{
+		Key:       &idp.key.PublicKey,
+		KeyID:     testKeyID,
+		Algorithm: string(jose.RS256),
+		Use:       "sig",
+	}}})
+}
+
+func (idp *testIdP) authorize(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	if query.Get("client_id") != testClientID || query.Get("code_challenge_method") != "S256" {
+		http.Error(w, "bad authorization request", http.StatusBadRequest)
+		return
+	}
+
+	code, err := randomToken(16)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	idp.lock.Lock()
+	idp.grants[code] = testGrant{nonce: query.Get("nonce"), challenge: query.Get("code_challenge")}
+	idp.lock.Unlock()
+
+	redirect, _ := url.Parse(query.Get("redirect_uri"))
+	redirect.RawQuery = url.Values{"code": {code}, "state": {query.Get("state")}}.Encode()
+	http.Redirect(w, r, redirect.String(), http.StatusFound)
+}
+
+func (idp *testIdP) token(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	idp.lock.Lock()
+	grant, ok := idp.grants[r.PostForm.Get("code")]
+	delete(idp.grants, r.PostForm.Get("code"))
+	claims := jwt.MapClaims{}
+	for name, value := range idp.claims {
+		claims[name] = value
+	}
+	nonce := idp.nonce
+	idp.lock.Unlock()
+
+	sum := sha256.Sum256([]byte(r.PostForm.Get("code_verifier")))
+	if !ok || base64.RawURLEncoding.EncodeToString(sum[:]) != grant.challenge {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant"})
+		return
+	}
+
+	if nonce == "" {
+		nonce = grant.nonce
+	}
+	now := time.Now()
+	claims["iss"] = idp.server.URL
+	claims["aud"] = testClientID
+	claims["iat"] = now.Unix()
+	claims["exp"] = now.Add(time.Minute).Unix()
+	claims["nonce"] = nonce
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = testKeyID
+	idToken, err := token.SignedString(idp.key)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"access_token": "access-token",
+		"token_type":   "Bearer",
+		"expires_in":   60,
+		"id_token":     idToken,
+	})
+}
+
+// testConfigService serves a fixed configuration
+type testConfigService struct {
+	ConfigService
+	config *models.Configuration
+}
+
+func (s *testConfigService) GetConfig() *models.Configuration {
+	return s.config
+}
+
+// testUserRepository keeps users in memory
+type testUserRepository struct {
+	repository.UserRepository
+	lock  sync.Mutex
+	users map[uint]*models.User
+}
+
+func newTestUserRepository() *testUserRepository {
+	return &testUserRepository{users: map[uint]*models.User{}}
+}
+
+func (r *testUserRepository) find(match func(*models.User) bool) (*models.User, error) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	for _, user := range r.users {
+		if match(user) {
+			found := *user
+			return &found, nil
+		}
+	}
+	return nil, gorm.ErrRecordNotFound
+}
+
+func (r *testUserRepository) GetByID(id uint64) (*models.User, error) {
+	return r.find(func(user *models.User) bool { return uint64(user.ID) == id })
+}
+
+func (r *testUserRepository) GetByEmail(email string) (*models.User, error) {
+	return r.find(func(user *models.User) bool { return user.Email == email })
+}
+
+func (r *testUserRepository) GetByOIDCIdentity(issuer, subject string) (*models.User, error) {
+	return r.find(func(user *models.User) bool {
+		return user.OIDCIssuer != nil && *user.OIDCIssuer == issuer && user.OIDCSubject != nil && *user.OIDCSubject == subject
+	})
+}
+
+func (r *testUserRepository) Create(user *models.User) (*models.User, error) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	user.ID = uint(len(r.users) + 1)
+	stored := *user
+	r.users[user.ID] = &stored
+	return user, nil
+}
+
+func (r *testUserRepository) UpdateColumns(id uint, columns map[string]interface{}) error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	user, ok := r.users[id]
+	if !ok {
+		return gorm.ErrRecordNotFound
+	}
+	for column, value := range columns {
+		switch column {
+		case "role":
+			user.Role = value.(string)
+		case "email":
+			user.Email = value.(string)
+		case "email_verified":
+			user.EmailVerified = value.(bool)
+		case "password":
+			user.Password = value.(string)
+		case "oidc_issuer":
+			issuer := value.(string)
+			user.OIDCIssuer = &issuer
+		case "oidc_subject":
+			subject := value.(string)
+			user.OIDCSubject = &subject
+		}
+	}
+	return nil
+}
+
+func newTestOIDCAuthService(t *testing.T, idp *testIdP, configure func(cfg *models.Configuration)) (*authService, *testUserRepository) {
+	cfg := &models.Configuration{}
+	cfg.Auth.JWTSecret = "test-secret"
+	cfg.Auth.TokenExpiration = 1
+	cfg.Auth.OIDC.Enabled = true
+	cfg.Auth.OIDC.IssuerURL = idp.server.URL
+	cfg.Auth.OIDC.ClientID = testClientID
+	cfg.Auth.OIDC.ClientSecret = "client-secret"
+	cfg.Auth.OIDC.RedirectURL = testRedirectURL
+	cfg.Auth.OIDC.Scopes = []string{"openid", "email", "groups"}
+	cfg.Auth.OIDC.GroupsClaim = "groups"
+	cfg.Auth.OIDC.AutoProvision = true
+	if configure != nil {
+		configure(cfg)
+	}
+
+	users := newTestUserRepository()
+	service := NewAuthService(users, nil, &testConfigService{config: cfg}, nil).(*authService)
+	return service, users
+}
+
+// authorize follows the authorization URL to the provider and returns the callback it redirects to
+func authorize(t *testing.T, start *models.OIDCLoginStart) *models.OIDCCallbackRequest {
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}}
+	resp, err := client.Get(start.AuthorizationURL)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusFound, resp.StatusCode)
+
+	callback, err := url.Parse(resp.Header.Get("Location"))
+	require.NoError(t, err)
+	return &models.OIDCCallbackRequest{
+		Code:       callback.Query().Get("code"),
+		State:      callback.Query().Get("state"),
+		StateToken: start.StateToken,
+	}
+}
+
+func loginWithOIDC(t *testing.T, service *authService) (*models.LoginData, error) {
+	ctx := context.Background()
+	start, err := service.BeginOIDCLogin(ctx, "/pastes")
+	require.NoError(t, err)
+
+	loginData, redirect, err := service.CompleteOIDCLogin(ctx, authorize(t, start))
+	assert.Equal(t, "/pastes", redirect)
+	return loginData, err
+}
+
+func TestOIDCProvisionsUserAndMapsAdminGroups(t *testing.T) {
+	idp := newTestIdP(t)
+	service, users := newTestOIDCAuthService(t, idp, func(cfg *models.Configuration) {
+		cfg.Auth.OIDC.AdminGroups = []string{"memoria-admins"}
+	})
+
+	idp.setClaims(map[string]interface{}{
+		"sub":            "alice",
+		"email":          "alice@example.com",
+		"email_verified": true,
+		"name":           "Alice",
+		"groups":         []string{"engineering", "memoria-admins"},
+	})
+	loginData, err := loginWithOIDC(t, service)
+	require.NoError(t, err)
+	assert.NotEmpty(t, loginData.Token)
+
+	user, err := users.GetByEmail("alice@example.com")
+	require.NoError(t, err)
+	assert.Equal(t, models.RoleAdmin, user.Role)
+	assert.True(t, user.EmailVerified)
+	assert.Equal(t, user.ID, loginData.User.ID)
+
+	// Leaving the admin group at the provider takes the role away on the next login
+	idp.setClaims(map[string]interface{}{
+		"sub":            "alice",
+		"email":          "alice@example.com",
+		"email_verified": true,
+		"groups":         "engineering",
+	})
+	_, err = loginWithOIDC(t, service)
+	require.NoError(t, err)
+
+	user, err = users.GetByEmail("alice@example.com")
+	require.NoError(t, err)
+	assert.Equal(t, models.RoleUser, user.Role)
+	assert.Len(t, users.users, 1)
+}
+
+func TestOIDCRejectsStateMismatch(t *testing.T) {
+	idp := newTestIdP(t)
+	service, users := newTestOIDCAuthService(t, idp, nil)
+	idp.setClaims(map[string]interface{}{"sub": "alice", "email": "alice@example.com", "email_verified": true})
+
+	ctx := context.Background()
+	start, err := service.BeginOIDCLogin(ctx, "")
+	require.NoError(t, err)
+	callback := authorize(t, start)
+	callback.State = "forged-state"
+
+	_, _, err = service.CompleteOIDCLogin(ctx, callback)
+	assert.ErrorIs(t, err, ErrOIDCInvalidState)
+
+	// A state token signed with another key is refused as well
+	other, _ := newTestOIDCAuthService(t, idp, func(cfg *models.Configuration) {
+		cfg.Auth.JWTSecret = "other-secret"
+	})
+	otherStart, err := other.BeginOIDCLogin(ctx, "")
+	require.NoError(t, err)
+	_, _, err = service.CompleteOIDCLogin(ctx, authorize(t, otherStart))
+	assert.ErrorIs(t, err, ErrOIDCInvalidState)
+	assert.Empty(t, users.users)
+}
+
+func TestOIDCRejectsNonceMismatch(t *testing.T) {
+	idp := newTestIdP(t)
+	service, users := newTestOIDCAuthService(t, idp, nil)
+	idp.setClaims(map[string]interface{}{"sub": "alice", "email": "alice@example.com", "email_verified": true})
+	idp.nonce = "replayed-nonce"
+
+	_, err := loginWithOIDC(t, service)
+	assert.ErrorIs(t, err, ErrOIDCInvalidState)
+	assert.Empty(t, users.users)
+}
+
+func TestOIDCRejectsPKCEMismatch(t *testing.T) {
+	idp := newTestIdP(t)
+	service, users := newTestOIDCAuthService(t, idp, nil)
+	idp.setClaims(map[string]interface{}{"sub": "alice", "email": "alice@example.com", "email_verified": true})
+
+	ctx := context.Background()
+	victim, err := service.BeginOIDCLogin(ctx, "")
+	require.NoError(t, err)
+	attacker, err := service.BeginOIDCLogin(ctx, "")
+	require.NoError(t, err)
+
+	// A code issued for another login's challenge doesn't redeem with this login's verifier
+	callback := authorize(t, victim)
+	callback.Code = authorize(t, attacker).Code
+
+	_, _, err = service.CompleteOIDCLogin(ctx, callback)
+	assert.ErrorContains(t, err, "invalid_grant")
+	assert.Empty(t, users.users)
+}
+
+func TestOIDCRefusesLinkingUnverifiedEmail(t *testing.T) {
+	idp := newTestIdP(t)
+	service, users := newTestOIDCAuthService(t, idp, nil)
+	local, err := users.Create(&models.User{Name: "Alice", Email: "alice@example.com", Role: models.RoleUser, EmailVerified: true})
+	require.NoError(t, err)
+
+	idp.setClaims(map[string]interface{}{"sub": "alice", "email": "alice@example.com", "email_verified": false})
+	_, err = loginWithOIDC(t, service)
+	assert.ErrorIs(t, err, ErrOIDCEmailMissing)
+
+	idp.setClaims(map[string]interface{}{"sub": "alice", "email": "alice@example.com"})
+	_, err = loginWithOIDC(t, service)
+	assert.ErrorIs(t, err, ErrOIDCEmailMissing)
+
+	user, err := users.GetByID(uint64(local.ID))
+	require.NoError(t, err)
+	assert.Nil(t, user.OIDCSubject)
+
+	// Once the provider vouches for the address the account is linked instead of duplicated
+	idp.setClaims(map[string]interface{}{"sub": "alice", "email": "alice@example.com", "email_verified": true})
+	loginData, err := loginWithOIDC(t, service)
+	require.NoError(t, err)
+	assert.Equal(t, local.ID, loginData.User.ID)
+	assert.Len(t, users.users, 1)
+
+	user, err = users.GetByID(uint64(local.ID))
+	require.NoError(t, err)
+	require.NotNil(t, user.OIDCSubject)
+	assert.Equal(t, "alice", *user.OIDCSubject)
+}
+
+func TestOIDCRefusesLinkingUnverifiedAccount(t *testing.T) {
+	idp := newTestIdP(t)
+	service, users := newTestOIDCAuthService(t, idp, nil)
+
+	// Someone registered the address locally without proving they own it
+	squatter, err := users.Create(&models.User{Name: "Mallory", Email: "bob@example.com", Password: "hash", Role: models.RoleUser})
+	require.NoError(t, err)
+
+	idp.setClaims(map[string]interface{}{"sub": "bob", "email": "bob@example.com", "email_verified": true})
+	_, err = loginWithOIDC(t, service)
+	assert.ErrorIs(t, err, ErrOIDCEmailUnverified)
+
+	// Neither linked, nor vouched for, nor replaced by a new account
+	user, err := users.GetByID(uint64(squatter.ID))
+	require.NoError(t, err)
+	assert.Nil(t, user.OIDCSubject)
+	assert.Nil(t, user.OIDCIssuer)
+	assert.False(t, user.EmailVerified)
+	assert.Len(t, users.users, 1)
+}
+
+func TestOIDCRejectsUserOutsideAllowedGroups(t *testing.T) {
+	idp := newTestIdP(t)
+	service, users := newTestOIDCAuthService(t, idp, func(cfg *models.Configuration) {
+		cfg.Auth.OIDC.AllowedGroups = []string{"engineering"}
+	})
+
+	idp.setClaims(map[string]interface{}{
+		"sub":            "bob",
+		"email":          "bob@example.com",
+		"email_verified": true,
+		"groups":         []string{"sales"},
+	})
+	_, err := loginWithOIDC(t, service)
+	assert.ErrorIs(t, err, ErrOIDCNotAllowed)
+
+	idp.setClaims(map[string]interface{}{"sub": "bob", "email": "bob@example.com", "email_verified": true})
+	_, err = loginWithOIDC(t, service)
+	assert.ErrorIs(t, err, ErrOIDCNotAllowed)
+	assert.Empty(t, users.users)
+
+	idp.setClaims(map[string]interface{}{
+		"sub":            "bob",
+		"email":          "bob@example.com",
+		"email_verified": true,
+		"groups":         []string{"sales", "engineering"},
+	})
+	_, err = loginWithOIDC(t, service)
+	assert.NoError(t, err)
+	assert.Len(t, users.users, 1)
+}
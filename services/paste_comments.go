@@ -0,0 +1,332 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"memoria-backend/models"
+	"memoria-backend/repository"
+	"memoria-backend/utils"
+	"slices"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+var (
+	ErrPasteCommentNotFound  = errors.New("comment not found")
+	ErrPasteCommentsDisabled = errors.New("comments are disabled on this paste")
+	ErrPasteCommentAnchor    = errors.New("the lines to comment on aren't in the paste")
+	ErrPasteCommentStale     = errors.New("the file changed since, comment on its current revision")
+	ErrPasteCommentReply     = errors.New("replies can't be anchored to lines")
+	ErrPasteCommentEncrypted = errors.New("lines of client-side encrypted pastes can't be commented on")
+)
+
+// maxCommentedLines caps the line range of a comment, its lines are kept with it to find
+// them again in later revisions
+const maxCommentedLines = 500
+
+// contentLines splits content into lines, a final newline doesn't start another line
+func contentLines(content string) []string {
+	return strings.Split(strings.TrimSuffix(content, "\n"), "\n")
+}
+
+// fileRevision returns the content hash of a file, the revision comments on it refer to
+func fileRevision(file *models.PasteFile) string {
+	if file.ContentHash != "" {
+		return file.ContentHash
+	}
+	return repository.ContentHash([]byte(file.Content))
+}
+
+// GetComments returns the comment threads of a paste, oldest first with their replies.
+// Callers must have checked that the paste may be viewed.
+func (s *pasteService) GetComments(ctx context.Context, paste *models.Paste) (*models.PasteCommentListData, error) {
+	comments, err := s.commentRepo.GetByPasteID(ctx, paste.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	threads := []models.PasteComment{}
+	positions := make(map[uint]int)
+	for _, comment := range comments {
+		if comment.ParentID == nil {
+			positions[comment.ID] = len(threads)
+			threads = append(threads, comment)
+		}
+	}
+	for _, comment := range comments {
+		if comment.ParentID == nil {
+			continue
+		}
+		if i, ok := positions[*comment.ParentID]; ok {
+			threads[i].Replies = append(threads[i].Replies, comment)
+		}
+	}
+	return &models.PasteCommentListData{Comments: threads, Count: len(comments), Disabled: paste.CommentsDisabled}, nil
+}
+
+// AddComment comments on the paste, on some lines of one of its files or replying to a
+// thread. Callers must have checked that the paste may be viewed.
+func (s *pasteService) AddComment(ctx context.Context, paste *models.Paste, userID uint, req *models.CreatePasteCommentRequest) (*models.PasteComment, error) {
+	log := utils.LoggerFromContext(ctx)
+
+	if paste.CommentsDisabled {
+		return nil, ErrPasteCommentsDisabled
+	}
+
+	comment := &models.PasteComment{
+		PasteID: paste.ID,
+		UserID:  userID,
+		Body:    req.Body,
+	}
+
+	switch {
+	case req.ParentID != nil:
+		if req.StartLine != 0 || req.File != "" {
+			return nil, ErrPasteCommentReply
+		}
+		parent, err := s.comment(ctx, paste.ID, *req.ParentID)
+		if err != nil {
+			return nil, err
+		}
+		// Replies to a reply join the thread it's in
+		threadID := parent.ID
+		if parent.ParentID != nil {
+			threadID = *parent.ParentID
+		}
+		comment.ParentID = &threadID
+	case req.StartLine != 0:
+		if paste.IsEncrypted() {
+			return nil, ErrPasteCommentEncrypted
+		}
+		if err := anchorComment(comment, paste, req); err != nil {
+			return nil, err
+		}
+	case req.File != "":
+		return nil, ErrPasteCommentAnchor
+	}
+
+	savedComment, err := s.commentRepo.Create(ctx, comment)
+	if err != nil {
+		return nil, err
+	}
+
+	log.Info().Uint64("pasteId", paste.ID).Uint("commentId", savedComment.ID).Msg("Commented on paste")
+	return savedComment, nil
+}
+
+// anchorComment points the comment at the requested lines of the paste's current revision
+func anchorComment(comment *models.PasteComment, paste *models.Paste, req *models.CreatePasteCommentRequest) error {
+	files := paste.FileList()
+	var file *models.PasteFile
+	for i := range files {
+		if req.File == files[i].Name || (req.File == "" && len(files) == 1) {
+			file = &files[i]
+			break
+		}
+	}
+	if file == nil {
+		return ErrPasteCommentAnchor
+	}
+
+	endLine := max(req.EndLine, req.StartLine)
+	lines := contentLines(file.Content)
+	if endLine > len(lines) || endLine-req.StartLine >= maxCommentedLines {
+		return ErrPasteCommentAnchor
+	}
+	revision := fileRevision(file)
+	if req.ContentHash != "" && req.ContentHash != revision {
+		return ErrPasteCommentStale
+	}
+
+	comment.File = file.Name
+	comment.StartLine = req.StartLine
+	comment.EndLine = endLine
+	comment.ContentHash = revision
+	comment.AnchorText = strings.Join(lines[req.StartLine-1:endLine], "\n")
+	return nil
+}
+
+// comment loads a comment on the paste, failing with ErrPasteCommentNotFound
+func (s *pasteService) comment(ctx context.Context, pasteID uint64, commentID uint) (*models.PasteComment, error) {
+	comment, err := s.commentRepo.GetByID(ctx, pasteID, commentID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrPasteCommentNotFound
+	}
+	return comment, err
+}
+
+// UpdateComment changes the text of a comment, which only its author may do
+func (s *pasteService) UpdateComment(ctx context.Context, paste *models.Paste, userID uint, commentID uint, req *models.UpdatePasteCommentRequest) (*models.PasteComment, error) {
+	comment, err := s.comment(ctx, paste.ID, commentID)
+	if err != nil {
+		return nil, err
+	}
+	if comment.UserID != userID {
+		return nil, ErrPasteForbidden
+	}
+
+	comment.Body = req.Body
+	return s.commentRepo.Update(ctx, comment)
+}
+
+// ResolveComment resolves or reopens the thread of a comment. The thread's author and
+// anyone who may edit the paste can do that.
+func (s *pasteService) ResolveComment(ctx context.Context, paste *models.Paste, userID uint, commentID uint, resolved bool) (*models.PasteComment, error) {
+	log := utils.LoggerFromContext(ctx)
+
+	comment, err := s.comment(ctx, paste.ID, commentID)
+	if err != nil {
+		return nil, err
+	}
+	if comment.ParentID != nil {
+		if comment, err = s.comment(ctx, paste.ID, *comment.ParentID); err != nil {
+			return nil, err
+		}
+	}
+	if comment.UserID != userID {
+		if err := s.requirePermission(ctx, paste, userID, models.PastePermissionEdit); err != nil {
+			return nil, err
+		}
+	}
+
+	comment.Resolved = resolved
+	comment.ResolvedBy = nil
+	comment.ResolvedAt = nil
+	if resolved {
+		now := time.Now()
+		comment.ResolvedBy = &userID
+		comment.ResolvedAt = &now
+	}
+	savedComment, err := s.commentRepo.Update(ctx, comment)
+	if err != nil {
+		return nil, err
+	}
+
+	log.Info().Uint64("pasteId", paste.ID).Uint("commentId", comment.ID).Bool("resolved", resolved).Msg("Changed comment thread state")
+	return savedComment, nil
+}
+
+// DeleteComment removes a comment and its replies. Authors can delete their own comments,
+// the paste's owner can delete any to moderate them.
+func (s *pasteService) DeleteComment(ctx context.Context, paste *models.Paste, userID uint, commentID uint) error {
+	log := utils.LoggerFromContext(ctx)
+
+	comment, err := s.comment(ctx, paste.ID, commentID)
+	if err != nil {
+		return err
+	}
+	if comment.UserID != userID {
+		if err := s.requirePermission(ctx, paste, userID, models.PastePermissionOwner); err != nil {
+			return err
+		}
+	}
+
+	deleted, err := s.commentRepo.Delete(ctx, paste.ID, commentID)
+	if err != nil {
+		return err
+	}
+	if !deleted {
+		return ErrPasteCommentNotFound
+	}
+
+	log.Info().Uint64("pasteId", paste.ID).Uint("commentId", commentID).Msg("Deleted paste comment")
+	return nil
+}
+
+// SetCommentsDisabled turns comments on the paste off or back on, which only its owner may
+// do. Existing comments stay.
+func (s *pasteService) SetCommentsDisabled(ctx context.Context, pasteID uint64, userID uint, disabled bool) error {
+	log := utils.LoggerFromContext(ctx)
+
+	paste, err := s.repo.GetByID(ctx, pasteID)
+	if err != nil {
+		return err
+	}
+	if err := s.requirePermission(ctx, paste, userID, models.PastePermissionOwner); err != nil {
+		return err
+	}
+
+	if err := s.repo.SetCommentsDisabled(ctx, pasteID, disabled); err != nil {
+		return err
+	}
+
+	log.Info().Uint64("pasteId", pasteID).Bool("disabled", disabled).Msg("Changed paste comment settings")
+	return nil
+}
+
+// reanchorComments moves the comments on lines of a saved paste along with their lines. A
+// comment whose lines a revision changed or removed is marked outdated and keeps pointing
+// at the revision it was made on. Like links, anchors are fixed up after the save and
+// failing to store them is only logged.
+func (s *pasteService) reanchorComments(ctx context.Context, paste *models.Paste) {
+	log := utils.LoggerFromContext(ctx)
+
+	comments, err := s.commentRepo.GetAnchored(ctx, paste.ID)
+	if err != nil || len(comments) == 0 {
+		if err != nil {
+			log.Warn().Err(err).Uint64("pasteId", paste.ID).Msg("Failed to load paste comments")
+		}
+		return
+	}
+
+	files := make(map[string]*models.PasteFile)
+	if !paste.IsEncrypted() {
+		fileList := paste.FileList()
+		for i := range fileList {
+			files[fileList[i].Name] = &fileList[i]
+		}
+	}
+
+	var moved []models.PasteComment
+	for _, comment := range comments {
+		file, ok := files[comment.File]
+		if ok && fileRevision(file) == comment.ContentHash {
+			continue
+		}
+		line := 0
+		if ok {
+			line = findLines(contentLines(file.Content), strings.Split(comment.AnchorText, "\n"), comment.StartLine)
+		}
+		if line == 0 {
+			comment.Outdated = true
+		} else {
+			comment.EndLine = line + comment.EndLine - comment.StartLine
+			comment.StartLine = line
+			comment.ContentHash = fileRevision(file)
+		}
+		moved = append(moved, comment)
+	}
+	if len(moved) == 0 {
+		return
+	}
+
+	if err := s.commentRepo.UpdateAnchors(ctx, moved); err != nil {
+		log.Warn().Err(err).Uint64("pasteId", paste.ID).Msg("Failed to re-anchor paste comments")
+		return
+	}
+	log.Debug().Uint64("pasteId", paste.ID).Int("comments", len(moved)).Msg("Re-anchored paste comments")
+}
+
+// findLines returns the line number where wanted occurs in lines, the occurrence closest to
+// the line it was at before. It returns 0 when it doesn't occur.
+func findLines(lines []string, wanted []string, previous int) int {
+	found := 0
+	for i := 0; i+len(wanted) <= len(lines); i++ {
+		if !slices.Equal(lines[i:i+len(wanted)], wanted) {
+			continue
+		}
+		if found == 0 || abs(i+1-previous) < abs(found-previous) {
+			found = i + 1
+		}
+	}
+	return found
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
@@ -0,0 +1,150 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"memoria-backend/models"
+	"memoria-backend/utils"
+	"time"
+)
+
+// maxForkTreeSize caps how many forks GetForks walks, so popular pastes can't turn the fork
+// tree into an unbounded query
+const maxForkTreeSize = 1000
+
+// DefaultForkPrivacy is the privacy of a fork that doesn't ask for one. Forks of anything but
+// an openly public paste are private, so forking never exposes content the source kept hidden.
+func DefaultForkPrivacy(source *models.Paste) string {
+	if source.Privacy != "public" || source.Password != "" {
+		return "private"
+	}
+	return "public"
+}
+
+// forkLanguage keeps a language of the source the registry knows. Sources stored with one
+// it doesn't know get their language detected for the fork.
+func (s *pasteService) forkLanguage(name string) string {
+	if _, ok := s.languages.Lookup(name); !ok {
+		return ""
+	}
+	return name
+}
+
+// Fork copies the content and files of a paste into a new paste owned by the caller, linked
+// back to its source. Callers must have checked that the source may be viewed.
+func (s *pasteService) Fork(ctx context.Context, sourceID uint64, req *models.ForkPasteRequest) (*models.Paste, error) {
+	log := utils.LoggerFromContext(ctx)
+
+	source, err := s.repo.GetByID(ctx, sourceID)
+	if err != nil {
+		return nil, err
+	}
+
+	fork := &models.CreatePasteRequest{
+		Title:           req.Title,
+		Content:         source.Content,
+		SyntaxHighlight: s.forkLanguage(source.SyntaxHighlight),
+		EditorType:      source.EditorType,
+		ExpiresAt:       req.ExpiresAt,
+		Privacy:         req.Privacy,
+		Password:        req.Password,
+		TeamID:          req.TeamID,
+		UserID:          req.UserID,
+		ClientIP:        req.ClientIP,
+		ForkedFromID:    &source.ID,
+	}
+	if fork.Title == "" {
+		fork.Title = source.Title
+	}
+	if fork.Privacy == "" {
+		fork.Privacy = DefaultForkPrivacy(source)
+	}
+	for _, tag := range source.Tags {
+		fork.Tags = append(fork.Tags, tag.Name)
+	}
+	if source.Encryption != nil {
+		encryption := *source.Encryption
+		fork.Encryption = &encryption
+	}
+	if len(source.Files) > 0 {
+		fork.Content = ""
+		for _, file := range source.Files {
+			fork.Files = append(fork.Files, models.PasteFileRequest{
+				Name:            file.Name,
+				Content:         file.Content,
+				SyntaxHighlight: s.forkLanguage(file.SyntaxHighlight),
+			})
+		}
+	}
+
+	paste, err := s.Create(ctx, fork)
+	if err != nil {
+		return nil, err
+	}
+
+	log.Info().Uint64("pasteId", paste.ID).Uint64("forkedFromId", sourceID).Msg("Forked paste")
+	return paste, nil
+}
+
+// GetForks returns the tree of forks made from the paste. Forks the caller can't view and
+// expired ones are left out along with everything forked from them.
+func (s *pasteService) GetForks(ctx context.Context, paste *models.Paste, userID uint) (*models.PasteForksData, error) {
+	children := map[uint64][]models.PasteFork{}
+	now := time.Now()
+
+	level := []uint64{paste.ID}
+	walked := 0
+	for len(level) > 0 && walked < maxForkTreeSize {
+		forks, err := s.repo.GetForks(ctx, level)
+		if err != nil {
+			return nil, err
+		}
+
+		level = nil
+		for _, fork := range forks {
+			if walked >= maxForkTreeSize {
+				break
+			}
+			if !fork.ExpiresAt.IsZero() && fork.ExpiresAt.Before(now) {
+				continue
+			}
+			if err := s.CanView(ctx, &fork, userID); err != nil {
+				if errors.Is(err, ErrPasteForbidden) {
+					continue
+				}
+				return nil, err
+			}
+
+			parentID := *fork.ForkedFromID
+			children[parentID] = append(children[parentID], models.PasteFork{
+				ID:        fork.ID,
+				Title:     fork.Title,
+				UserID:    fork.UserID,
+				Privacy:   fork.Privacy,
+				CreatedAt: fork.CreatedAt,
+			})
+			level = append(level, fork.ID)
+			walked++
+		}
+	}
+
+	var build func(id uint64) []models.PasteFork
+	build = func(id uint64) []models.PasteFork {
+		forks := children[id]
+		if forks == nil {
+			return []models.PasteFork{}
+		}
+		for i := range forks {
+			forks[i].Forks = build(forks[i].ID)
+			forks[i].ForkCount = len(forks[i].Forks)
+		}
+		return forks
+	}
+
+	forks := build(paste.ID)
+	return &models.PasteForksData{
+		ForkedFromID: paste.ForkedFromID,
+		ForkCount:    len(forks),
+		Forks:        forks,
+	}, nil
+}
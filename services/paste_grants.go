@@ -0,0 +1,336 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"memoria-backend/models"
+	"memoria-backend/utils"
+	"sort"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+var (
+	ErrPasteForbidden      = errors.New("you don't have permission to do this with the paste")
+	ErrPasteGrantNotFound  = errors.New("grant not found")
+	ErrPasteGrantTarget    = errors.New("exactly one of userId, email or teamId must be set")
+	ErrPasteGrantNoSubject = errors.New("the user or team to share with doesn't exist")
+	ErrPasteGrantAuthor    = errors.New("the paste's author already has full access")
+)
+
+// pastePermissionRanks orders permissions so a check for one also admits those above it
+var pastePermissionRanks = map[string]int{
+	models.PastePermissionView:  1,
+	models.PastePermissionEdit:  2,
+	models.PastePermissionOwner: 3,
+}
+
+// teamRolePermissions maps a team role to the access it gives on the team's pastes
+var teamRolePermissions = map[string]string{
+	models.TeamRoleViewer: models.PastePermissionView,
+	models.TeamRoleEditor: models.PastePermissionEdit,
+	models.TeamRoleOwner:  models.PastePermissionOwner,
+}
+
+// higherPermission returns whichever of the two permissions grants more
+func higherPermission(a, b string) string {
+	if pastePermissionRanks[b] > pastePermissionRanks[a] {
+		return b
+	}
+	return a
+}
+
+// permission resolves the caller's access to a paste from authorship, team membership
+// and grants. It returns an empty string when the caller has no access of their own.
+func (s *pasteService) permission(ctx context.Context, paste *models.Paste, userID uint) (string, error) {
+	if userID == 0 {
+		return "", nil
+	}
+	if paste.UserID != "" && pasteCallerID(paste.UserID) == userID {
+		return models.PastePermissionOwner, nil
+	}
+
+	memberships, err := s.teamRepo.GetMemberships(ctx, userID)
+	if err != nil {
+		return "", err
+	}
+
+	permission := ""
+	teamIDs := make([]uint, len(memberships))
+	for i, membership := range memberships {
+		teamIDs[i] = membership.TeamID
+		if paste.TeamID != nil && *paste.TeamID == membership.TeamID {
+			permission = higherPermission(permission, teamRolePermissions[membership.Role])
+		}
+	}
+
+	grants, err := s.grantRepo.GetForUser(ctx, paste.ID, userID, teamIDs)
+	if err != nil {
+		return "", err
+	}
+	for _, grant := range grants {
+		permission = higherPermission(permission, grant.Permission)
+	}
+	return permission, nil
+}
+
+// requirePermission fails with ErrPasteForbidden unless the caller has at least minPermission
+func (s *pasteService) requirePermission(ctx context.Context, paste *models.Paste, userID uint, minPermission string) error {
+	permission, err := s.permission(ctx, paste, userID)
+	if err != nil {
+		return err
+	}
+	if pastePermissionRanks[permission] < pastePermissionRanks[minPermission] {
+		return ErrPasteForbidden
+	}
+	return nil
+}
+
+// CanView checks that the caller may read a private or team-only paste, either through
+// their own access or through the folder it's in. Public and password-protected pastes are
+// handled by the callers.
+func (s *pasteService) CanView(ctx context.Context, paste *models.Paste, userID uint) error {
+	if paste.Privacy != "private" && paste.Privacy != models.PrivacyTeam {
+		return nil
+	}
+	if paste.FolderID != nil {
+		folder, err := s.folderRepo.GetByID(ctx, *paste.FolderID)
+		if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+		if err == nil {
+			visible, err := canViewFolder(ctx, s.teamRepo, folder, userID)
+			if err != nil || visible {
+				return err
+			}
+		}
+	}
+	return s.requirePermission(ctx, paste, userID, models.PastePermissionView)
+}
+
+// viewablePastes is CanView for a list of pastes. It loads the caller's teams, the folders
+// and the grants once for all of them and returns the IDs of the pastes the caller may read.
+func (s *pasteService) viewablePastes(ctx context.Context, pastes []models.Paste, userID uint) (map[uint64]bool, error) {
+	viewable := make(map[uint64]bool, len(pastes))
+	var restricted []*models.Paste
+	for i := range pastes {
+		paste := &pastes[i]
+		if paste.Privacy != "private" && paste.Privacy != models.PrivacyTeam ||
+			userID != 0 && paste.UserID != "" && pasteCallerID(paste.UserID) == userID {
+			viewable[paste.ID] = true
+		} else {
+			restricted = append(restricted, paste)
+		}
+	}
+	if len(restricted) == 0 {
+		return viewable, nil
+	}
+
+	// Every team role gives at least view access to the team's pastes and folders
+	teams := make(map[uint]bool)
+	var teamIDs []uint
+	if userID != 0 {
+		memberships, err := s.teamRepo.GetMemberships(ctx, userID)
+		if err != nil {
+			return nil, err
+		}
+		for _, membership := range memberships {
+			if teamRoleRanks[membership.Role] >= teamRoleRanks[models.TeamRoleViewer] {
+				teams[membership.TeamID] = true
+				teamIDs = append(teamIDs, membership.TeamID)
+			}
+		}
+	}
+
+	var folderIDs []uint
+	for _, paste := range restricted {
+		if paste.FolderID != nil {
+			folderIDs = append(folderIDs, *paste.FolderID)
+		}
+	}
+	folders, err := s.folderRepo.GetByIDs(ctx, folderIDs)
+	if err != nil {
+		return nil, err
+	}
+	visibleFolders := make(map[uint]bool, len(folders))
+	for _, folder := range folders {
+		visibleFolders[folder.ID] = folder.Privacy == models.FolderPrivacyPublic ||
+			folder.TeamID == nil && userID != 0 && folder.UserID == userID ||
+			folder.TeamID != nil && teams[*folder.TeamID]
+	}
+
+	var ungranted []uint64
+	for _, paste := range restricted {
+		if paste.FolderID != nil && visibleFolders[*paste.FolderID] || paste.TeamID != nil && teams[*paste.TeamID] {
+			viewable[paste.ID] = true
+		} else if userID != 0 {
+			ungranted = append(ungranted, paste.ID)
+		}
+	}
+	grants, err := s.grantRepo.GetForUserOnPastes(ctx, ungranted, userID, teamIDs)
+	if err != nil {
+		return nil, err
+	}
+	for _, grant := range grants {
+		if pastePermissionRanks[grant.Permission] >= pastePermissionRanks[models.PastePermissionView] {
+			viewable[grant.PasteID] = true
+		}
+	}
+	return viewable, nil
+}
+
+// CanEdit checks that the caller may change or delete the paste. Anonymous pastes
+// outside a team have nobody to check against and stay editable as before.
+func (s *pasteService) CanEdit(ctx context.Context, paste *models.Paste, userID uint) error {
+	if paste.UserID == "" && paste.TeamID == nil {
+		return nil
+	}
+	return s.requirePermission(ctx, paste, userID, models.PastePermissionEdit)
+}
+
+func (s *pasteService) GetGrants(ctx context.Context, pasteID uint64, userID uint) ([]models.PasteGrant, error) {
+	paste, err := s.repo.GetByID(ctx, pasteID)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.requirePermission(ctx, paste, userID, models.PastePermissionOwner); err != nil {
+		return nil, err
+	}
+	return s.grantRepo.GetByPasteID(ctx, pasteID)
+}
+
+// AddGrant shares the paste with a user or team, replacing the permission of an existing grant
+func (s *pasteService) AddGrant(ctx context.Context, pasteID uint64, userID uint, req *models.CreatePasteGrantRequest) (*models.PasteGrant, error) {
+	log := utils.LoggerFromContext(ctx)
+
+	targets := 0
+	for _, set := range []bool{req.UserID != nil, req.Email != "", req.TeamID != nil} {
+		if set {
+			targets++
+		}
+	}
+	if targets != 1 {
+		return nil, ErrPasteGrantTarget
+	}
+
+	paste, err := s.repo.GetByID(ctx, pasteID)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.requirePermission(ctx, paste, userID, models.PastePermissionOwner); err != nil {
+		return nil, err
+	}
+
+	grant := &models.PasteGrant{
+		PasteID:    pasteID,
+		Permission: req.Permission,
+		CreatedBy:  userID,
+	}
+
+	switch {
+	case req.TeamID != nil:
+		if _, err := s.teamRepo.GetByID(ctx, *req.TeamID); err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return nil, ErrPasteGrantNoSubject
+			}
+			return nil, err
+		}
+		grant.TeamID = req.TeamID
+	default:
+		var user *models.User
+		if req.UserID != nil {
+			user, err = s.userRepo.GetByID(uint64(*req.UserID))
+		} else {
+			user, err = s.userRepo.GetByEmail(strings.TrimSpace(req.Email))
+		}
+		if err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return nil, ErrPasteGrantNoSubject
+			}
+			return nil, err
+		}
+		if pasteCallerID(paste.UserID) == user.ID {
+			return nil, ErrPasteGrantAuthor
+		}
+		grant.UserID = &user.ID
+	}
+
+	savedGrant, err := s.grantRepo.Save(ctx, grant)
+	if err != nil {
+		return nil, err
+	}
+
+	log.Info().Uint64("pasteId", pasteID).Uint("grantId", savedGrant.ID).Str("permission", savedGrant.Permission).Msg("Shared paste")
+	return savedGrant, nil
+}
+
+func (s *pasteService) RemoveGrant(ctx context.Context, pasteID uint64, userID uint, grantID uint) error {
+	log := utils.LoggerFromContext(ctx)
+
+	paste, err := s.repo.GetByID(ctx, pasteID)
+	if err != nil {
+		return err
+	}
+	if err := s.requirePermission(ctx, paste, userID, models.PastePermissionOwner); err != nil {
+		return err
+	}
+
+	deleted, err := s.grantRepo.Delete(ctx, pasteID, grantID)
+	if err != nil {
+		return err
+	}
+	if !deleted {
+		return ErrPasteGrantNotFound
+	}
+
+	log.Info().Uint64("pasteId", pasteID).Uint("grantId", grantID).Msg("Removed paste grant")
+	return nil
+}
+
+// GetSharedWithUser lists the pastes shared with the user directly or through their teams,
+// newest first, leaving out the user's own pastes
+func (s *pasteService) GetSharedWithUser(ctx context.Context, userID uint) ([]models.SharedPaste, error) {
+	memberships, err := s.teamRepo.GetMemberships(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	teamIDs := make([]uint, len(memberships))
+	for i, membership := range memberships {
+		teamIDs[i] = membership.TeamID
+	}
+
+	grants, err := s.grantRepo.GetSharedWithUser(ctx, userID, teamIDs)
+	if err != nil {
+		return nil, err
+	}
+	if len(grants) == 0 {
+		return []models.SharedPaste{}, nil
+	}
+
+	permissions := make(map[uint64]string)
+	var pasteIDs []uint64
+	for _, grant := range grants {
+		if _, seen := permissions[grant.PasteID]; !seen {
+			pasteIDs = append(pasteIDs, grant.PasteID)
+		}
+		permissions[grant.PasteID] = higherPermission(permissions[grant.PasteID], grant.Permission)
+	}
+
+	pastes, err := s.repo.GetByIDs(ctx, pasteIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	shared := []models.SharedPaste{}
+	for _, paste := range visiblePastes(pastes) {
+		if pasteCallerID(paste.UserID) == userID {
+			continue
+		}
+		shared = append(shared, models.SharedPaste{Paste: paste, Permission: permissions[paste.ID]})
+	}
+	sort.Slice(shared, func(i, j int) bool {
+		return shared[i].Paste.CreatedAt.After(shared[j].Paste.CreatedAt)
+	})
+	return shared, nil
+}
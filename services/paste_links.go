@@ -0,0 +1,158 @@
+package services
+
+import (
+	"context"
+	"memoria-backend/models"
+	"memoria-backend/utils"
+	"regexp"
+	"slices"
+	"strconv"
+	"time"
+)
+
+const (
+	// maxPasteLinks caps how many references of one paste are resolved and stored
+	maxPasteLinks = 200
+	// maxLinkGraphPastes caps how many of the caller's own pastes the link graph starts from
+	maxLinkGraphPastes = 1000
+)
+
+var (
+	// wikiLinkPattern matches [[target]] and [[target|label]]
+	wikiLinkPattern = regexp.MustCompile(`\[\[([^\[\]|\n]{1,200})(?:\|[^\[\]\n]*)?\]\]`)
+	// pasteURLPattern matches memoria://paste/123
+	pasteURLPattern = regexp.MustCompile(`memoria://paste/(\d{1,20})`)
+)
+
+// linkableSyntaxes are the highlighting modes of text and markdown files, the only ones
+// whose references are picked up. Code is left alone, [[ ]] means something else there.
+var linkableSyntaxes = []string{"", "text", "plaintext", "markdown", "md"}
+
+// pasteReferences collects the paste IDs and title slugs referred to from the paste's text
+// and markdown files. Encrypted content can't be read, so it never links anywhere.
+func pasteReferences(paste *models.Paste) ([]uint64, []string) {
+	if paste.IsEncrypted() {
+		return nil, nil
+	}
+
+	var ids []uint64
+	var slugs []string
+	count := 0
+	for _, file := range paste.FileList() {
+		if !slices.Contains(linkableSyntaxes, file.SyntaxHighlight) && !(len(paste.Files) == 0 && paste.EditorType == "text") {
+			continue
+		}
+		for _, match := range wikiLinkPattern.FindAllStringSubmatch(file.Content, maxPasteLinks-count) {
+			if id, err := strconv.ParseUint(match[1], 10, 64); err == nil {
+				ids = append(ids, id)
+			} else if slug := utils.Slugify(match[1]); slug != "" {
+				slugs = append(slugs, slug)
+			}
+			count++
+		}
+		for _, match := range pasteURLPattern.FindAllStringSubmatch(file.Content, maxPasteLinks-count) {
+			if id, err := strconv.ParseUint(match[1], 10, 64); err == nil {
+				ids = append(ids, id)
+			}
+			count++
+		}
+		if count >= maxPasteLinks {
+			break
+		}
+	}
+	return ids, slugs
+}
+
+// updateLinks rebuilds the links of a saved paste from its content. Only pastes its author
+// may view are linked to, so references can't be used to find out which IDs exist. Links are
+// derived data, so failing to store them is logged and fixed on the paste's next save instead
+// of failing the save itself.
+func (s *pasteService) updateLinks(ctx context.Context, paste *models.Paste) {
+	log := utils.LoggerFromContext(ctx)
+
+	ids, slugs := pasteReferences(paste)
+	resolved, err := s.pasteLinkRepo.ResolveTargets(ctx, paste.UserID, ids, slugs)
+	var viewable map[uint64]bool
+	if err == nil {
+		viewable, err = s.viewablePastes(ctx, resolved, pasteCallerID(paste.UserID))
+	}
+	if err == nil {
+		var targets []uint64
+		for _, target := range resolved {
+			if target.ID != paste.ID && viewable[target.ID] {
+				targets = append(targets, target.ID)
+			}
+		}
+		slices.Sort(targets)
+		targets = slices.Compact(targets)
+		err = s.pasteLinkRepo.Replace(ctx, paste.ID, targets)
+	}
+	if err != nil {
+		log.Warn().Err(err).Uint64("pasteId", paste.ID).Msg("Failed to update paste links")
+	}
+}
+
+// linkNodes describes pastes for a backlink list or the link graph, in the same order.
+// Pastes the caller can't view and expired ones are left out.
+func (s *pasteService) linkNodes(ctx context.Context, pastes []models.Paste, userID uint) ([]models.PasteLinkNode, error) {
+	viewable, err := s.viewablePastes(ctx, pastes, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	nodes := []models.PasteLinkNode{}
+	for _, paste := range pastes {
+		if !viewable[paste.ID] || !paste.ExpiresAt.IsZero() && paste.ExpiresAt.Before(now) {
+			continue
+		}
+		nodes = append(nodes, models.PasteLinkNode{
+			ID:      paste.ID,
+			Title:   paste.Title,
+			UserID:  paste.UserID,
+			Privacy: paste.Privacy,
+		})
+	}
+	return nodes, nil
+}
+
+// GetBacklinks lists the pastes linking to the paste. Pastes the caller can't view and
+// expired ones are left out. Callers must have checked that the paste may be viewed.
+func (s *pasteService) GetBacklinks(ctx context.Context, paste *models.Paste, userID uint) (*models.PasteBacklinksData, error) {
+	sources, err := s.pasteLinkRepo.GetBacklinks(ctx, paste.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	backlinks, err := s.linkNodes(ctx, sources, userID)
+	if err != nil {
+		return nil, err
+	}
+	return &models.PasteBacklinksData{Backlinks: backlinks, Count: len(backlinks)}, nil
+}
+
+// GetLinkGraph returns the links between the user's pastes and the pastes they link to or
+// are linked from. Linked pastes the user can't view and expired ones are dropped along with
+// their links.
+func (s *pasteService) GetLinkGraph(ctx context.Context, userID uint) (*models.PasteLinkGraphData, error) {
+	pastes, links, err := s.pasteLinkRepo.GetGraph(ctx, strconv.FormatUint(uint64(userID), 10), maxLinkGraphPastes)
+	if err != nil {
+		return nil, err
+	}
+
+	nodes, err := s.linkNodes(ctx, pastes, userID)
+	if err != nil {
+		return nil, err
+	}
+	graph := &models.PasteLinkGraphData{Nodes: nodes, Edges: []models.PasteLink{}}
+	included := make(map[uint64]bool, len(nodes))
+	for _, node := range nodes {
+		included[node.ID] = true
+	}
+	for _, link := range links {
+		if included[link.SourceID] && included[link.TargetID] {
+			graph.Edges = append(graph.Edges, link)
+		}
+	}
+	return graph, nil
+}
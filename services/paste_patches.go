@@ -0,0 +1,197 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"memoria-backend/models"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	jsonpatch "github.com/evanphx/json-patch/v5"
+	"github.com/go-playground/validator/v10"
+)
+
+var ErrPastePatch = errors.New("the patch can't be applied to the paste")
+
+// PastePatchError is returned when a patch leaves fields of the paste invalid. It tells
+// clients which fields and why, so they can point them out to the user.
+type PastePatchError struct {
+	Fields map[string]string // Field path to the rule it breaks
+}
+
+func (e *PastePatchError) Error() string {
+	fields := make([]string, 0, len(e.Fields))
+	for field, rule := range e.Fields {
+		fields = append(fields, field+" ("+rule+")")
+	}
+	sort.Strings(fields)
+	return "invalid fields: " + strings.Join(fields, ", ")
+}
+
+func (e *PastePatchError) Unwrap() error {
+	return ErrPastePatch
+}
+
+// Details returns the invalid fields, in the shape of ErrorResponse details
+func (e *PastePatchError) Details() map[string]interface{} {
+	return map[string]interface{}{"fields": e.Fields}
+}
+
+// patchValidator checks patched documents against their binding tags, like request bodies,
+// naming fields as they're named in JSON
+var patchValidator = func() *validator.Validate {
+	v := validator.New()
+	v.SetTagName("binding")
+	v.RegisterTagNameFunc(func(field reflect.StructField) string {
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "-" {
+			return ""
+		}
+		return name
+	})
+	return v
+}()
+
+// patchDocument describes the fields of a paste that a patch can change
+func patchDocument(paste *models.Paste) *models.PastePatchDocument {
+	doc := &models.PastePatchDocument{
+		Title:           paste.Title,
+		SyntaxHighlight: paste.SyntaxHighlight,
+		EditorType:      paste.EditorType,
+		Privacy:         paste.Privacy,
+		TeamID:          paste.TeamID,
+		Tags:            []string{},
+		Encryption:      paste.Encryption,
+		Version:         paste.Version,
+	}
+	if len(paste.Files) == 0 {
+		content := paste.Content
+		doc.Content = &content
+	}
+	for _, file := range paste.Files {
+		doc.Files = append(doc.Files, models.PasteFileRequest{Name: file.Name, Content: file.Content, SyntaxHighlight: file.SyntaxHighlight})
+	}
+	if !paste.ExpiresAt.IsZero() {
+		expiresAt := paste.ExpiresAt
+		doc.ExpiresAt = &expiresAt
+	}
+	for _, tag := range paste.Tags {
+		doc.Tags = append(doc.Tags, tag.Name)
+	}
+	return doc
+}
+
+// patchVersion returns the version a patch carries: the top-level version of a merge patch,
+// or the value a JSON Patch tests or replaces /version with. 0 when it carries none.
+func patchVersion(req *models.PatchPasteRequest) uint64 {
+	if !req.JSONPatch {
+		var fields struct {
+			Version uint64 `json:"version"`
+		}
+		_ = json.Unmarshal(req.Patch, &fields)
+		return fields.Version
+	}
+
+	var operations []struct {
+		Op    string          `json:"op"`
+		Path  string          `json:"path"`
+		Value json.RawMessage `json:"value"`
+	}
+	_ = json.Unmarshal(req.Patch, &operations)
+	for _, operation := range operations {
+		if operation.Path == "/version" && (operation.Op == "test" || operation.Op == "replace") {
+			var version uint64
+			_ = json.Unmarshal(operation.Value, &version)
+			return version
+		}
+	}
+	return 0
+}
+
+// PatchRequest applies a patch to the paste and returns the update it makes, to be passed to
+// Update. Changing privacy, password, team or expiry takes ownership of the paste.
+func (s *pasteService) PatchRequest(ctx context.Context, paste *models.Paste, req *models.PatchPasteRequest) (*models.UpdatePasteRequest, error) {
+	callerID := pasteCallerID(req.UserID)
+	if err := s.CanEdit(ctx, paste, callerID); err != nil {
+		return nil, err
+	}
+
+	version := req.Version
+	if version == 0 {
+		version = patchVersion(req)
+	}
+	if err := checkVersion(paste.Version, version); err != nil {
+		return nil, err
+	}
+
+	original := patchDocument(paste)
+	document, err := json.Marshal(original)
+	if err != nil {
+		return nil, err
+	}
+	if req.JSONPatch {
+		var patch jsonpatch.Patch
+		if patch, err = jsonpatch.DecodePatch(req.Patch); err == nil {
+			document, err = patch.Apply(document)
+		}
+	} else {
+		document, err = jsonpatch.MergePatch(document, req.Patch)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrPastePatch, err)
+	}
+
+	var patched models.PastePatchDocument
+	decoder := json.NewDecoder(bytes.NewReader(document))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&patched); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrPastePatch, err)
+	}
+	if err := patchValidator.Struct(&patched); err != nil {
+		var validationErrs validator.ValidationErrors
+		if !errors.As(err, &validationErrs) {
+			return nil, err
+		}
+		fields := make(map[string]string, len(validationErrs))
+		for _, fieldErr := range validationErrs {
+			// Drop the struct's own name from the namespace
+			_, field, _ := strings.Cut(fieldErr.Namespace(), ".")
+			fields[field] = fieldErr.Tag()
+		}
+		return nil, &PastePatchError{Fields: fields}
+	}
+
+	expiryChanged := (patched.ExpiresAt == nil) != (original.ExpiresAt == nil) ||
+		patched.ExpiresAt != nil && !patched.ExpiresAt.Equal(*original.ExpiresAt)
+	if expiryChanged && patched.ExpiresAt != nil && patched.ExpiresAt.Before(time.Now()) {
+		return nil, &PastePatchError{Fields: map[string]string{"expiresAt": "future"}}
+	}
+
+	update := &models.UpdatePasteRequest{
+		ID:              paste.ID,
+		Title:           patched.Title,
+		Files:           patched.Files,
+		SyntaxHighlight: patched.SyntaxHighlight,
+		EditorType:      patched.EditorType,
+		ExpiresAt:       &time.Time{},
+		Privacy:         patched.Privacy,
+		Password:        patched.Password,
+		TeamID:          patched.TeamID,
+		Encryption:      patched.Encryption,
+		UserID:          req.UserID,
+		Tags:            append([]string{}, patched.Tags...),
+		Version:         version,
+	}
+	if patched.Content != nil {
+		update.Content = *patched.Content
+	}
+	if patched.ExpiresAt != nil {
+		update.ExpiresAt = patched.ExpiresAt
+	}
+	return update, nil
+}
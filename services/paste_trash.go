@@ -0,0 +1,111 @@
+package services
+
+import (
+	"context"
+	"memoria-backend/models"
+	"memoria-backend/utils"
+	"strconv"
+	"time"
+)
+
+// trashPurgeBatch is how many pastes a purge deletes between looking up the next ones
+const trashPurgeBatch = 100
+
+// trashRetention is how long deleted pastes stay in the trash
+func (s *pasteService) trashRetention() time.Duration {
+	return time.Duration(s.config.GetConfig().Trash.RetentionDays) * 24 * time.Hour
+}
+
+// GetTrash returns the deleted pastes the caller can restore: their own, and those of the
+// teams in which they may edit pastes, most recently deleted first
+func (s *pasteService) GetTrash(ctx context.Context, userID uint) ([]models.TrashedPaste, error) {
+	memberships, err := s.teamRepo.GetMemberships(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	var teamIDs []uint
+	for _, membership := range memberships {
+		if pastePermissionRanks[teamRolePermissions[membership.Role]] >= pastePermissionRanks[models.PastePermissionEdit] {
+			teamIDs = append(teamIDs, membership.TeamID)
+		}
+	}
+
+	pastes, err := s.repo.GetTrash(ctx, strconv.FormatUint(uint64(userID), 10), teamIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	retention := s.trashRetention()
+	trash := make([]models.TrashedPaste, 0, len(pastes))
+	for _, paste := range pastes {
+		deletedAt := paste.DeletedAt.Time
+		trash = append(trash, models.TrashedPaste{Paste: paste, DeletedAt: deletedAt, PurgesAt: deletedAt.Add(retention)})
+	}
+	return trash, nil
+}
+
+// Restore takes a paste out of the trash, anyone who could edit it may
+func (s *pasteService) Restore(ctx context.Context, id uint64, userID uint) (*models.Paste, error) {
+	paste, err := s.repo.GetTrashedByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.CanEdit(ctx, paste, userID); err != nil {
+		return nil, err
+	}
+	if err := s.repo.Restore(ctx, id); err != nil {
+		return nil, err
+	}
+	return s.repo.GetByID(ctx, id)
+}
+
+func (s *pasteService) Purge(ctx context.Context, id uint64) error {
+	return s.repo.Purge(ctx, id)
+}
+
+func (s *pasteService) PurgeTrash(ctx context.Context, before time.Time) (int, error) {
+	purged := 0
+	for {
+		ids, err := s.repo.GetPurgeable(ctx, before, trashPurgeBatch)
+		if err != nil || len(ids) == 0 {
+			return purged, err
+		}
+		for _, id := range ids {
+			if err := s.repo.Purge(ctx, id); err != nil {
+				return purged, err
+			}
+			purged++
+		}
+	}
+}
+
+// PurgeTrashPeriodically purges the pastes that were in the trash for longer than the
+// retention period every trash.purgeInterval minutes, until ctx is done. Both settings are
+// read again each time, so configuration changes apply without a restart.
+func PurgeTrashPeriodically(ctx context.Context, pasteService PasteService, configService ConfigService) {
+	log := utils.LoggerFromContext(ctx)
+
+	for {
+		trash := configService.GetConfig().Trash
+		// Without a retention period nothing could be restored, rather keep everything
+		if trash.RetentionDays > 0 {
+			before := time.Now().Add(-time.Duration(trash.RetentionDays) * 24 * time.Hour)
+			purged, err := pasteService.PurgeTrash(ctx, before)
+			if err != nil {
+				log.Error().Err(err).Int("purged", purged).Msg("Failed to purge the trash")
+			} else if purged > 0 {
+				log.Info().Int("purged", purged).Msg("Purged pastes from the trash")
+			}
+		}
+
+		interval := time.Duration(trash.PurgeInterval) * time.Minute
+		if interval <= 0 {
+			interval = time.Hour
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(interval):
+		}
+	}
+}
@@ -0,0 +1,60 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"memoria-backend/repository"
+)
+
+var (
+	ErrPasteVersionRequired = errors.New("send the version of the paste being changed, in If-Match or as version")
+	ErrPasteVersionConflict = errors.New("the paste was changed since this version, reload it and try again")
+)
+
+// PasteVersionError is returned when a change is made to an outdated version of a paste. It
+// tells clients the current version, so they can fetch it and merge their change.
+type PasteVersionError struct {
+	Version uint64 // The version the change was made to
+	Current uint64
+}
+
+func (e *PasteVersionError) Error() string {
+	return ErrPasteVersionConflict.Error()
+}
+
+func (e *PasteVersionError) Unwrap() error {
+	return ErrPasteVersionConflict
+}
+
+// Details returns the versions, in the shape of ErrorResponse details
+func (e *PasteVersionError) Details() map[string]interface{} {
+	return map[string]interface{}{
+		"version":        e.Version,
+		"currentVersion": e.Current,
+	}
+}
+
+// checkVersion refuses a change made without a version or to another version of the paste
+// than the one loaded
+func checkVersion(current uint64, version uint64) error {
+	if version == 0 {
+		return ErrPasteVersionRequired
+	}
+	if version != current {
+		return &PasteVersionError{Version: version, Current: current}
+	}
+	return nil
+}
+
+// versionConflict turns a write that lost a race with another change into a PasteVersionError
+// with the version the paste is at now
+func (s *pasteService) versionConflict(ctx context.Context, id uint64, version uint64, err error) error {
+	if !errors.Is(err, repository.ErrPasteVersionConflict) {
+		return err
+	}
+	paste, getErr := s.repo.GetByID(ctx, id)
+	if getErr != nil {
+		return getErr
+	}
+	return &PasteVersionError{Version: version, Current: paste.Version}
+}
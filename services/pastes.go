@@ -4,59 +4,123 @@ import (
 	"context"
 	"crypto/rand"
 	"encoding/hex"
+	"errors"
+	"io"
 	"memoria-backend/models"
 	"memoria-backend/repository"
 	"memoria-backend/utils"
+	"reflect"
+	"strconv"
 	"strings"
 	"time"
 
 	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
 )
 
+var (
+	ErrContentHashUnknown  = errors.New("no content you can read has this hash, upload the content instead")
+	ErrContentHashMismatch = errors.New("content doesn't match contentHash")
+	ErrPasteFileName       = errors.New("file names must be unique and can't contain slashes")
+	ErrPasteFilesEncrypted = errors.New("client-side encrypted pastes can't have files")
+)
+
+// maxPasteListLimit is the most pastes a listing returns at once
+const maxPasteListLimit = 100
+
 type PasteService interface {
-	GetAll(ctx context.Context) ([]models.Paste, error)
+	GetAll(ctx context.Context, tags []string, page, limit int) ([]models.Paste, error)
 	GetByID(ctx context.Context, id uint64) (*models.Paste, error)
-	GetByPrivateAccessID(ctx context.Context, privateAccessID string) (*models.Paste, error)
+	OpenContent(ctx context.Context, id uint64, fileName string) (*models.Paste, io.ReadCloser, int64, error)
+	ContentExists(ctx context.Context, hash string, userID uint) (bool, error)
+	GetByPrivateAccessID(ctx context.Context, privateAccessID string, password string) (*models.Paste, error)
 	GetByPrivateAccessIDs(ctx context.Context, privateAccessIDs []string) ([]models.Paste, error)
 	Create(ctx context.Context, newPaste *models.CreatePasteRequest) (*models.Paste, error)
 	Update(ctx context.Context, updatedPaste *models.UpdatePasteRequest) (*models.Paste, error)
-	Delete(ctx context.Context, id uint64) (uint64, error)
+	PatchRequest(ctx context.Context, paste *models.Paste, req *models.PatchPasteRequest) (*models.UpdatePasteRequest, error)
+	// Delete moves the paste to the trash if it's still at the version
+	Delete(ctx context.Context, id uint64, version uint64) (uint64, error)
+	GetTrash(ctx context.Context, userID uint) ([]models.TrashedPaste, error)
+	Restore(ctx context.Context, id uint64, userID uint) (*models.Paste, error)
+	// Purge deletes the paste for good, without checking who asks
+	Purge(ctx context.Context, id uint64) error
+	// PurgeTrash deletes the pastes that went to the trash before the given time for good
+	PurgeTrash(ctx context.Context, before time.Time) (int, error)
 	VerifyPassword(ctx context.Context, id uint64, providedPassword string) (bool, error)
+	CanView(ctx context.Context, paste *models.Paste, userID uint) error
+	CanEdit(ctx context.Context, paste *models.Paste, userID uint) error
+	GetGrants(ctx context.Context, pasteID uint64, userID uint) ([]models.PasteGrant, error)
+	AddGrant(ctx context.Context, pasteID uint64, userID uint, req *models.CreatePasteGrantRequest) (*models.PasteGrant, error)
+	RemoveGrant(ctx context.Context, pasteID uint64, userID uint, grantID uint) error
+	GetSharedWithUser(ctx context.Context, userID uint) ([]models.SharedPaste, error)
+	GetShareLinks(ctx context.Context, pasteID uint64, userID uint) ([]models.ShareLink, error)
+	CreateShareLink(ctx context.Context, pasteID uint64, userID uint, req *models.CreateShareLinkRequest) (*models.ShareLink, error)
+	RotateShareLink(ctx context.Context, pasteID uint64, userID uint, linkID uint) (*models.ShareLink, error)
+	RevokeShareLink(ctx context.Context, pasteID uint64, userID uint, linkID uint) error
+	RotatePrivateAccessID(ctx context.Context, pasteID uint64, userID uint) (*models.Paste, error)
+	UpdateViaShareLink(ctx context.Context, accessID string, req *models.UpdateSharedPasteRequest) (*models.Paste, error)
+	AddAttachment(ctx context.Context, pasteID uint64, userID uint, fileName string, data []byte) (*models.Attachment, error)
+	OpenAttachment(ctx context.Context, paste *models.Paste, attachmentID uint, thumbnail bool) (*models.Attachment, io.ReadCloser, int64, error)
+	DeleteAttachment(ctx context.Context, pasteID uint64, userID uint, attachmentID uint) error
+	Fork(ctx context.Context, sourceID uint64, req *models.ForkPasteRequest) (*models.Paste, error)
+	GetForks(ctx context.Context, paste *models.Paste, userID uint) (*models.PasteForksData, error)
+	MoveToFolder(ctx context.Context, pasteID uint64, userID uint, folderID *uint) error
+	SuggestTags(ctx context.Context, prefix string, userID uint, limit int) ([]models.TagSuggestion, error)
+	GetBacklinks(ctx context.Context, paste *models.Paste, userID uint) (*models.PasteBacklinksData, error)
+	GetLinkGraph(ctx context.Context, userID uint) (*models.PasteLinkGraphData, error)
+	GetComments(ctx context.Context, paste *models.Paste) (*models.PasteCommentListData, error)
+	AddComment(ctx context.Context, paste *models.Paste, userID uint, req *models.CreatePasteCommentRequest) (*models.PasteComment, error)
+	UpdateComment(ctx context.Context, paste *models.Paste, userID uint, commentID uint, req *models.UpdatePasteCommentRequest) (*models.PasteComment, error)
+	ResolveComment(ctx context.Context, paste *models.Paste, userID uint, commentID uint, resolved bool) (*models.PasteComment, error)
+	DeleteComment(ctx context.Context, paste *models.Paste, userID uint, commentID uint) error
+	SetCommentsDisabled(ctx context.Context, pasteID uint64, userID uint, disabled bool) error
 }
 
 type pasteService struct {
-	repo repository.PasteRepository
+	repo           repository.PasteRepository
+	teamRepo       repository.TeamRepository
+	grantRepo      repository.PasteGrantRepository
+	linkRepo       repository.ShareLinkRepository
+	userRepo       repository.UserRepository
+	attachmentRepo repository.AttachmentRepository
+	folderRepo     repository.FolderRepository
+	pasteLinkRepo  repository.PasteLinkRepository
+	commentRepo    repository.PasteCommentRepository
+	languages      LanguageService
+	quotas         QuotaService
+	config         ConfigService
 }
 
 // NewConfigService creates a new configuration service
-func NewPasteService(pasteRepo repository.PasteRepository) PasteService {
+func NewPasteService(pasteRepo repository.PasteRepository, teamRepo repository.TeamRepository, grantRepo repository.PasteGrantRepository, linkRepo repository.ShareLinkRepository, userRepo repository.UserRepository, attachmentRepo repository.AttachmentRepository, folderRepo repository.FolderRepository, pasteLinkRepo repository.PasteLinkRepository, commentRepo repository.PasteCommentRepository, languages LanguageService, quotas QuotaService, config ConfigService) PasteService {
 	return &pasteService{
-		repo: pasteRepo,
-	}
-}
-
-// generatePrivateAccessID creates a secure random ID for private pastes
-func generatePrivateAccessID() (string, error) {
-	bytes := make([]byte, 16)
-	if _, err := rand.Read(bytes); err != nil {
-		return "", err
+		repo:           pasteRepo,
+		teamRepo:       teamRepo,
+		grantRepo:      grantRepo,
+		linkRepo:       linkRepo,
+		userRepo:       userRepo,
+		attachmentRepo: attachmentRepo,
+		folderRepo:     folderRepo,
+		pasteLinkRepo:  pasteLinkRepo,
+		commentRepo:    commentRepo,
+		languages:      languages,
+		quotas:         quotas,
+		config:         config,
 	}
-	return hex.EncodeToString(bytes), nil
 }
 
-// hashPassword securely hashes a password using bcrypt
-func hashPassword(password string) (string, error) {
-	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+// pasteCallerID converts the string user ID stored on pastes back to a user ID, 0 when anonymous
+func pasteCallerID(userID string) uint {
+	id, err := strconv.ParseUint(userID, 10, 64)
 	if err != nil {
-		return "", err
+		return 0
 	}
-	return string(hash), nil
+	return uint(id)
 }
 
-func (s *pasteService) GetAll(ctx context.Context) ([]models.Paste, error) {
-	pastes, err := s.repo.GetAll(ctx)
-
-	// replace content field for pastes that are private
+// visiblePastes drops expired pastes and hides the content and attachments of
+// password-protected ones
+func visiblePastes(pastes []models.Paste) []models.Paste {
 	var validPastes []models.Paste
 	now := time.Now()
 	for _, paste := range pastes {
@@ -69,17 +133,146 @@ func (s *pasteService) GetAll(ctx context.Context) ([]models.Paste, error) {
 			// Create a copy to avoid modifying the original
 			pasteCopy := paste
 			pasteCopy.Content = models.PasswordProtectedContentPlaceholder
+			pasteCopy.ContentHash = ""
+			pasteCopy.Files = make([]models.PasteFile, len(paste.Files))
+			for i, file := range paste.Files {
+				file.Content = models.PasswordProtectedContentPlaceholder
+				file.ContentHash = ""
+				pasteCopy.Files[i] = file
+			}
+			pasteCopy.Attachments = nil
 			validPastes = append(validPastes, pasteCopy)
 		} else {
 			validPastes = append(validPastes, paste)
 		}
 	}
+	return validPastes
+}
 
+// checkTeamAssignment validates the team a paste is being created in or moved to
+func (s *pasteService) checkTeamAssignment(ctx context.Context, privacy string, teamID *uint, userID uint) error {
+	if teamID == nil {
+		if privacy == models.PrivacyTeam {
+			return ErrTeamRequired
+		}
+		return nil
+	}
+	_, err := checkTeamRole(ctx, s.teamRepo, *teamID, userID, models.TeamRoleEditor)
+	return err
+}
+
+// generatePrivateAccessID creates a secure random ID for private pastes
+func generatePrivateAccessID() (string, error) {
+	bytes := make([]byte, 16)
+	if _, err := rand.Read(bytes); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(bytes), nil
+}
+
+// pasteFiles turns requested files into the files of a paste and returns the size of all
+// content, which is just content when there are no files. Client-side encrypted content is
+// a single ciphertext, so those pastes can't have files.
+func pasteFiles(content string, requested []models.PasteFileRequest, encrypted bool) ([]models.PasteFile, int, error) {
+	if len(requested) == 0 {
+		return nil, len(content), nil
+	}
+	if encrypted {
+		return nil, 0, ErrPasteFilesEncrypted
+	}
+
+	files := make([]models.PasteFile, len(requested))
+	names := make(map[string]bool, len(requested))
+	size := 0
+	for i, file := range requested {
+		if file.Name == "." || file.Name == ".." || strings.ContainsAny(file.Name, "/\\\x00") || names[file.Name] {
+			return nil, 0, ErrPasteFileName
+		}
+		names[file.Name] = true
+
+		files[i] = models.PasteFile{
+			Name:            file.Name,
+			SyntaxHighlight: file.SyntaxHighlight,
+			StoredContent:   models.StoredContent{Content: file.Content},
+		}
+		size += len(file.Content)
+	}
+	return files, size, nil
+}
+
+// setLanguages validates the languages of the paste and its files, storing them by their
+// IDs, and detects the ones left empty. Languages the paste already had before are kept as
+// they are, they may predate the language registry. A multi-file paste without a language
+// takes its first file's.
+func (s *pasteService) setLanguages(paste *models.Paste, previous *models.Paste) error {
+	kept := map[string]bool{}
+	if previous != nil {
+		kept[previous.SyntaxHighlight] = true
+		for _, file := range previous.Files {
+			kept[file.SyntaxHighlight] = true
+		}
+	}
+
+	resolve := func(requested, fileName, content string) (string, error) {
+		if requested != "" {
+			if kept[requested] {
+				return requested, nil
+			}
+			language, ok := s.languages.Lookup(requested)
+			if !ok {
+				return "", ErrUnknownLanguage
+			}
+			return language.ID, nil
+		}
+		// Ciphertext has no language to detect
+		if paste.IsEncrypted() {
+			return "", nil
+		}
+		if guesses := s.languages.Detect(fileName, content); len(guesses) > 0 && guesses[0].Confidence >= minDetectedLanguage {
+			return guesses[0].Language, nil
+		}
+		return "", nil
+	}
+
+	var err error
+	for i := range paste.Files {
+		file := &paste.Files[i]
+		if file.SyntaxHighlight, err = resolve(file.SyntaxHighlight, file.Name, file.Content); err != nil {
+			return err
+		}
+	}
+	if paste.SyntaxHighlight == "" && len(paste.Files) > 0 {
+		paste.SyntaxHighlight = paste.Files[0].SyntaxHighlight
+		return nil
+	}
+	paste.SyntaxHighlight, err = resolve(paste.SyntaxHighlight, paste.Title, paste.Content)
+	return err
+}
+
+// hashPassword securely hashes a password using bcrypt
+func hashPassword(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return "", err
+	}
+	return string(hash), nil
+}
+
+// GetAll returns a page of the public pastes, only those carrying all of the tags when any
+// are given. Listings hold the pastes' metadata, not their content.
+func (s *pasteService) GetAll(ctx context.Context, tags []string, page, limit int) ([]models.Paste, error) {
+	if page < 1 {
+		page = 1
+	}
+	if limit < 1 || limit > maxPasteListLimit {
+		limit = maxPasteListLimit
+	}
+	pastes, err := s.repo.GetAll(ctx, normalizeTagFilter(tags), page, limit)
 	if err != nil {
 		return nil, err
 	}
 
-	return validPastes, nil
+	return visiblePastes(pastes), nil
 }
 
 func (s *pasteService) GetByID(ctx context.Context, id uint64) (*models.Paste, error) {
@@ -91,25 +284,113 @@ func (s *pasteService) GetByID(ctx context.Context, id uint64) (*models.Paste, e
 	return paste, nil
 }
 
-func (s *pasteService) GetByPrivateAccessID(ctx context.Context, privateAccessID string) (*models.Paste, error) {
-	// You'll need to add this method to the repository interface and implement it
-	paste, err := s.repo.GetByPrivateAccessID(ctx, privateAccessID)
+// OpenContent returns the paste without its content and a reader over the content of one of
+// its files, the first one when fileName is empty. It's for streaming large pastes instead of
+// loading them whole.
+func (s *pasteService) OpenContent(ctx context.Context, id uint64, fileName string) (*models.Paste, io.ReadCloser, int64, error) {
+	return s.repo.OpenContent(ctx, id, fileName)
+}
+
+// readableContent returns the content of a paste with the given hash that the user may read
+func (s *pasteService) readableContent(ctx context.Context, hash string, userID uint) (string, error) {
+	callerID := ""
+	if userID != 0 {
+		callerID = strconv.FormatUint(uint64(userID), 10)
+	}
+	content, err := s.repo.GetReadableContentByHash(ctx, strings.ToLower(hash), callerID)
 	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return "", ErrContentHashUnknown
+		}
+		return "", err
+	}
+	return content, nil
+}
+
+// ContentExists reports whether content with the given hash was already uploaded, so
+// clients can create a paste by hash instead. Only content the user may read counts.
+func (s *pasteService) ContentExists(ctx context.Context, hash string, userID uint) (bool, error) {
+	_, err := s.readableContent(ctx, hash, userID)
+	if errors.Is(err, ErrContentHashUnknown) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// GetByPrivateAccessID resolves the paste's own private access ID or one of its share links.
+// The password is checked before a share link use is counted, callers check it for the
+// paste's own access ID.
+func (s *pasteService) GetByPrivateAccessID(ctx context.Context, privateAccessID string, password string) (*models.Paste, error) {
+	paste, err := s.repo.GetByPrivateAccessID(ctx, privateAccessID)
+	if err == nil {
+		return paste, nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
 		return nil, err
 	}
 
+	paste, _, err = s.resolveShareLink(ctx, privateAccessID, models.PastePermissionView, password)
+	if err != nil {
+		return nil, err
+	}
 	return paste, nil
 }
 
 func (s *pasteService) Create(ctx context.Context, newPaste *models.CreatePasteRequest) (*models.Paste, error) {
 	log := utils.LoggerFromContext(ctx)
+
+	if err := s.checkTeamAssignment(ctx, newPaste.Privacy, newPaste.TeamID, pasteCallerID(newPaste.UserID)); err != nil {
+		return nil, err
+	}
+
+	// Content that was uploaded before can be referenced by its hash alone
+	if newPaste.Content == "" && newPaste.ContentHash != "" {
+		content, err := s.readableContent(ctx, newPaste.ContentHash, pasteCallerID(newPaste.UserID))
+		if err != nil {
+			return nil, err
+		}
+		newPaste.Content = content
+	} else if newPaste.ContentHash != "" && !strings.EqualFold(newPaste.ContentHash, repository.ContentHash([]byte(newPaste.Content))) {
+		return nil, ErrContentHashMismatch
+	}
+
+	files, size, err := pasteFiles(newPaste.Content, newPaste.Files, newPaste.Encryption != nil)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.quotas.CheckCreate(ctx, pasteCallerID(newPaste.UserID), newPaste.ClientIP, size); err != nil {
+		return nil, err
+	}
+	tags, err := normalizeTags(newPaste.Tags)
+	if err != nil {
+		return nil, err
+	}
+	if newPaste.FolderID != nil {
+		if _, err := editableFolder(ctx, s.folderRepo, s.teamRepo, *newPaste.FolderID, pasteCallerID(newPaste.UserID)); err != nil {
+			return nil, err
+		}
+	}
+
 	paste := &models.Paste{
 		Title:           newPaste.Title,
-		Content:         newPaste.Content,
+		StoredContent:   models.StoredContent{Content: newPaste.Content},
+		Files:           files,
 		SyntaxHighlight: newPaste.SyntaxHighlight,
 		EditorType:      newPaste.EditorType,
 		ExpiresAt:       newPaste.ExpiresAt,
 		Privacy:         newPaste.Privacy,
+		UserID:          newPaste.UserID,
+		TeamID:          newPaste.TeamID,
+		ForkedFromID:    newPaste.ForkedFromID,
+		FolderID:        newPaste.FolderID,
+		Tags:            tags,
+		Encryption:      newPaste.Encryption,
+	}
+	if err := s.setLanguages(paste, nil); err != nil {
+		return nil, err
+	}
+	if paste.UserID == "" {
+		paste.CreatorIP = newPaste.ClientIP
 	}
 
 	// if newPaste.Privacy == "private" {
@@ -133,15 +414,16 @@ func (s *pasteService) Create(ctx context.Context, newPaste *models.CreatePasteR
 	}
 
 	createdPaste, err := s.repo.Create(ctx, paste)
-
-	log.Info().
-		Str("title", createdPaste.Title).
-		Str("content_preview", utils.Truncate(createdPaste.Content, 50)).
-		Msg("Repo returned new paste")
-
 	if err != nil {
 		return nil, err
 	}
+	s.updateLinks(ctx, createdPaste)
+
+	event := log.Info().Str("title", createdPaste.Title).Bool("encrypted", createdPaste.IsEncrypted())
+	if !createdPaste.IsEncrypted() {
+		event = event.Str("content_preview", utils.Truncate(createdPaste.Content, 50))
+	}
+	event.Msg("Repo returned new paste")
 
 	return createdPaste, nil
 }
@@ -155,13 +437,59 @@ func (s *pasteService) Update(ctx context.Context, updatedPaste *models.UpdatePa
 		return nil, err
 	}
 
+	callerID := pasteCallerID(updatedPaste.UserID)
+	if err := s.CanEdit(ctx, existingPaste, callerID); err != nil {
+		return nil, err
+	}
+	if err := checkVersion(existingPaste.Version, updatedPaste.Version); err != nil {
+		return nil, err
+	}
+
+	// Who can see a paste and for how long is the owner's call. What an anonymous paste is,
+	// anyone who can edit it decides.
+	ownerOnly := updatedPaste.Privacy != existingPaste.Privacy ||
+		updatedPaste.Password != "" ||
+		!reflect.DeepEqual(updatedPaste.TeamID, existingPaste.TeamID) ||
+		updatedPaste.ExpiresAt != nil && !updatedPaste.ExpiresAt.Equal(existingPaste.ExpiresAt)
+	if ownerOnly && (existingPaste.UserID != "" || existingPaste.TeamID != nil) {
+		if err := s.requirePermission(ctx, existingPaste, callerID, models.PastePermissionOwner); err != nil {
+			return nil, err
+		}
+	}
+	if err := s.checkTeamAssignment(ctx, updatedPaste.Privacy, updatedPaste.TeamID, callerID); err != nil {
+		return nil, err
+	}
+	files, size, err := pasteFiles(updatedPaste.Content, updatedPaste.Files, updatedPaste.Encryption != nil)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.quotas.CheckUpdate(ctx, existingPaste, size); err != nil {
+		return nil, err
+	}
+	tags, err := normalizeTags(updatedPaste.Tags)
+	if err != nil {
+		return nil, err
+	}
+
 	// Update the paste fields
+	previous := *existingPaste
 	existingPaste.Title = updatedPaste.Title
 	existingPaste.Content = updatedPaste.Content
+	existingPaste.Files = files
 	existingPaste.SyntaxHighlight = updatedPaste.SyntaxHighlight
 	existingPaste.EditorType = updatedPaste.EditorType
-	existingPaste.ExpiresAt = updatedPaste.ExpiresAt
+	if updatedPaste.ExpiresAt != nil {
+		existingPaste.ExpiresAt = *updatedPaste.ExpiresAt
+	}
 	existingPaste.Privacy = updatedPaste.Privacy
+	existingPaste.TeamID = updatedPaste.TeamID
+	existingPaste.Encryption = updatedPaste.Encryption
+	if tags != nil {
+		existingPaste.Tags = tags
+	}
+	if err := s.setLanguages(existingPaste, &previous); err != nil {
+		return nil, err
+	}
 
 	// Handle privacy changes
 	if updatedPaste.Privacy == "private" && existingPaste.PrivateAccessID == "" {
@@ -187,16 +515,21 @@ func (s *pasteService) Update(ctx context.Context, updatedPaste *models.UpdatePa
 
 	savedPaste, err := s.repo.Update(ctx, existingPaste)
 	if err != nil {
-		return nil, err
+		return nil, s.versionConflict(ctx, existingPaste.ID, updatedPaste.Version, err)
 	}
+	s.updateLinks(ctx, savedPaste)
+	s.reanchorComments(ctx, savedPaste)
 
 	return savedPaste, nil
 }
 
-func (s *pasteService) Delete(ctx context.Context, id uint64) (uint64, error) {
-	deletedID, err := s.repo.Delete(ctx, id)
+func (s *pasteService) Delete(ctx context.Context, id uint64, version uint64) (uint64, error) {
+	if version == 0 {
+		return 0, ErrPasteVersionRequired
+	}
+	deletedID, err := s.repo.Delete(ctx, id, version)
 	if err != nil {
-		return 0, err
+		return 0, s.versionConflict(ctx, id, version, err)
 	}
 
 	return deletedID, nil
@@ -255,24 +588,5 @@ func (s *pasteService) GetByPrivateAccessIDs(ctx context.Context, privateAccessI
 		return nil, err
 	}
 
-	// replace content field for pastes that are private
-	var validPastes []models.Paste
-	now := time.Now()
-	for _, paste := range pastes {
-		// Skip expired pastes
-		if !paste.ExpiresAt.IsZero() && paste.ExpiresAt.Before(now) {
-			continue
-		}
-		// Protect content of password-protected pastes
-		if paste.Password != "" {
-			// Create a copy to avoid modifying the original
-			pasteCopy := paste
-			pasteCopy.Content = models.PasswordProtectedContentPlaceholder
-			validPastes = append(validPastes, pasteCopy)
-		} else {
-			validPastes = append(validPastes, paste)
-		}
-	}
-
-	return validPastes, nil
+	return visiblePastes(pastes), nil
 }
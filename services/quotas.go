@@ -0,0 +1,173 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"memoria-backend/models"
+	"memoria-backend/repository"
+	"strconv"
+	"time"
+)
+
+var (
+	ErrPasteTooLarge   = errors.New("paste content exceeds the maximum paste size")
+	ErrDailyPasteLimit = errors.New("daily paste limit reached")
+	ErrStorageQuota    = errors.New("storage quota exceeded")
+	ErrAttachmentSize  = errors.New("attachment exceeds the maximum attachment size")
+	ErrAttachmentCount = errors.New("paste has the maximum number of attachments")
+)
+
+// QuotaError is returned when a paste would go over a limit. It tells clients which limit
+// was hit and how far, so they can explain it to the user.
+type QuotaError struct {
+	Err      error
+	Limit    int64
+	Used     int64
+	Needed   int64     // Size of the content, or 1 for a new paste
+	ResetsAt time.Time // Only set for the daily paste limit
+}
+
+func (e *QuotaError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *QuotaError) Unwrap() error {
+	return e.Err
+}
+
+// Details returns the limit that was hit, in the shape of ErrorResponse details
+func (e *QuotaError) Details() map[string]interface{} {
+	details := map[string]interface{}{
+		"limit":  e.Limit,
+		"used":   e.Used,
+		"needed": e.Needed,
+	}
+	if !e.ResetsAt.IsZero() {
+		details["resetsAt"] = e.ResetsAt
+	}
+	return details
+}
+
+type QuotaService interface {
+	GetUsage(ctx context.Context, userID uint, clientIP string) (*models.Usage, error)
+	CheckCreate(ctx context.Context, userID uint, clientIP string, size int) error
+	CheckUpdate(ctx context.Context, paste *models.Paste, size int) error
+	CheckAttachment(ctx context.Context, paste *models.Paste, size int) error
+}
+
+type quotaService struct {
+	pasteRepo     repository.PasteRepository
+	configService ConfigService
+}
+
+func NewQuotaService(pasteRepo repository.PasteRepository, configService ConfigService) QuotaService {
+	return &quotaService{
+		pasteRepo:     pasteRepo,
+		configService: configService,
+	}
+}
+
+// startOfDay returns the start of the current UTC day, daily limits reset then
+func startOfDay(now time.Time) time.Time {
+	return now.UTC().Truncate(24 * time.Hour)
+}
+
+// GetUsage returns the usage and limits of a user, or of the anonymous client at clientIP
+// when userID is 0
+func (s *quotaService) GetUsage(ctx context.Context, userID uint, clientIP string) (*models.Usage, error) {
+	limits := s.configService.GetConfig().Limits
+	today := startOfDay(time.Now())
+
+	ownerID := ""
+	if userID != 0 {
+		ownerID = strconv.FormatUint(uint64(userID), 10)
+	}
+	usage, err := s.pasteRepo.GetUsage(ctx, ownerID, clientIP, today)
+	if err != nil {
+		return nil, err
+	}
+
+	usage.MaxPasteBytes = limits.MaxPasteBytes
+	usage.ResetsAt = today.Add(24 * time.Hour)
+	if userID != 0 {
+		usage.DailyPasteLimit = limits.UserDailyPastes
+		usage.StorageQuotaBytes = limits.UserStorageBytes
+	} else {
+		usage.DailyPasteLimit = limits.AnonymousDailyPastes
+		usage.StorageQuotaBytes = limits.AnonymousStorageBytes
+	}
+	return usage, nil
+}
+
+// checkSize rejects content above the maximum paste size
+func (s *quotaService) checkSize(size int) error {
+	maxBytes := s.configService.GetConfig().Limits.MaxPasteBytes
+	if maxBytes > 0 && size > maxBytes {
+		return &QuotaError{Err: ErrPasteTooLarge, Limit: int64(maxBytes), Needed: int64(size)}
+	}
+	return nil
+}
+
+// checkStorage rejects growing the owner's stored content by extra bytes past their quota
+func checkStorage(usage *models.Usage, extra int64) error {
+	if usage.StorageQuotaBytes > 0 && extra > 0 && usage.StorageBytes+extra > usage.StorageQuotaBytes {
+		return &QuotaError{Err: ErrStorageQuota, Limit: usage.StorageQuotaBytes, Used: usage.StorageBytes, Needed: extra}
+	}
+	return nil
+}
+
+// CheckCreate checks whether a user, or the anonymous client at clientIP, may create a paste
+// with size bytes of content
+func (s *quotaService) CheckCreate(ctx context.Context, userID uint, clientIP string, size int) error {
+	if err := s.checkSize(size); err != nil {
+		return err
+	}
+
+	usage, err := s.GetUsage(ctx, userID, clientIP)
+	if err != nil {
+		return err
+	}
+	if usage.DailyPasteLimit > 0 && usage.PastesToday >= int64(usage.DailyPasteLimit) {
+		return &QuotaError{Err: ErrDailyPasteLimit, Limit: int64(usage.DailyPasteLimit), Used: usage.PastesToday, Needed: 1, ResetsAt: usage.ResetsAt}
+	}
+	return checkStorage(usage, int64(size))
+}
+
+// CheckUpdate checks whether the paste's content may be replaced with size bytes. Growth
+// counts against the quota of the paste's owner, whoever makes the edit.
+func (s *quotaService) CheckUpdate(ctx context.Context, paste *models.Paste, size int) error {
+	if err := s.checkSize(size); err != nil {
+		return err
+	}
+	// Pastes from before quotas existed may have no owner to charge
+	if int64(size) <= paste.ContentSize || (paste.UserID == "" && paste.CreatorIP == "") {
+		return nil
+	}
+
+	usage, err := s.GetUsage(ctx, pasteCallerID(paste.UserID), paste.CreatorIP)
+	if err != nil {
+		return err
+	}
+	return checkStorage(usage, int64(size)-paste.ContentSize)
+}
+
+// CheckAttachment checks whether an attachment of size bytes may be added to the paste. Like
+// edits, it counts against the storage quota of the paste's owner.
+func (s *quotaService) CheckAttachment(ctx context.Context, paste *models.Paste, size int) error {
+	limits := s.configService.GetConfig().Limits
+	if limits.MaxAttachmentBytes > 0 && size > limits.MaxAttachmentBytes {
+		return &QuotaError{Err: ErrAttachmentSize, Limit: int64(limits.MaxAttachmentBytes), Needed: int64(size)}
+	}
+	if limits.MaxAttachmentsPerPaste > 0 && len(paste.Attachments) >= limits.MaxAttachmentsPerPaste {
+		return &QuotaError{Err: ErrAttachmentCount, Limit: int64(limits.MaxAttachmentsPerPaste), Used: int64(len(paste.Attachments)), Needed: 1}
+	}
+	if paste.UserID == "" && paste.CreatorIP == "" {
+		return nil
+	}
+
+	usage, err := s.GetUsage(ctx, pasteCallerID(paste.UserID), paste.CreatorIP)
+	if err != nil {
+		return err
+	}
+	return checkStorage(usage, int64(size))
+}
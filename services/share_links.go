@@ -0,0 +1,252 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"memoria-backend/models"
+	"memoria-backend/utils"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrShareLinkNotFound     = errors.New("share link not found")
+	ErrShareLinkInvalid      = errors.New("share link is invalid, expired or used up")
+	ErrShareLinkReadOnly     = errors.New("this share link doesn't allow editing")
+	ErrShareLinkExpiryInPast = errors.New("expiry must be in the future")
+	ErrShareLinkPassword     = errors.New("invalid password")
+	ErrShareLinkEncryption   = errors.New("share links can't change whether a paste is encrypted")
+)
+
+// resolveShareLink finds the paste behind a share link and records the use. Expired,
+// used up and revoked links all fail the same way. Only requests that pass every check
+// count as a use, so a wrong password doesn't use up the link.
+func (s *pasteService) resolveShareLink(ctx context.Context, accessID string, minPermission string, password string) (*models.Paste, *models.ShareLink, error) {
+	log := utils.LoggerFromContext(ctx)
+
+	link, err := s.linkRepo.GetByAccessID(ctx, accessID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil, ErrShareLinkInvalid
+		}
+		return nil, nil, err
+	}
+
+	if pastePermissionRanks[link.Permission] < pastePermissionRanks[minPermission] {
+		return nil, nil, ErrShareLinkReadOnly
+	}
+
+	now := time.Now()
+	if link.ExpiresAt != nil && !link.ExpiresAt.After(now) || link.MaxUses > 0 && link.Uses >= link.MaxUses {
+		log.Info().Uint("shareLinkId", link.ID).Msg("Rejected expired or used up share link")
+		return nil, nil, ErrShareLinkInvalid
+	}
+
+	paste, err := s.repo.GetByID(ctx, link.PasteID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !paste.ExpiresAt.IsZero() && now.After(paste.ExpiresAt) {
+		return nil, nil, ErrShareLinkInvalid
+	}
+	if paste.Password != "" {
+		if err := bcrypt.CompareHashAndPassword([]byte(paste.Password), []byte(password)); err != nil {
+			return nil, nil, ErrShareLinkPassword
+		}
+	}
+
+	// The link may have been used up since it was loaded, consuming checks again
+	consumed, err := s.linkRepo.Consume(ctx, link.ID, now)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !consumed {
+		log.Info().Uint("shareLinkId", link.ID).Msg("Rejected expired or used up share link")
+		return nil, nil, ErrShareLinkInvalid
+	}
+	return paste, link, nil
+}
+
+func (s *pasteService) GetShareLinks(ctx context.Context, pasteID uint64, userID uint) ([]models.ShareLink, error) {
+	paste, err := s.repo.GetByID(ctx, pasteID)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.requirePermission(ctx, paste, userID, models.PastePermissionOwner); err != nil {
+		return nil, err
+	}
+	return s.linkRepo.GetByPasteID(ctx, pasteID)
+}
+
+func (s *pasteService) CreateShareLink(ctx context.Context, pasteID uint64, userID uint, req *models.CreateShareLinkRequest) (*models.ShareLink, error) {
+	log := utils.LoggerFromContext(ctx)
+
+	paste, err := s.repo.GetByID(ctx, pasteID)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.requirePermission(ctx, paste, userID, models.PastePermissionOwner); err != nil {
+		return nil, err
+	}
+
+	if req.ExpiresAt != nil && !req.ExpiresAt.After(time.Now()) {
+		return nil, ErrShareLinkExpiryInPast
+	}
+
+	accessID, err := generatePrivateAccessID()
+	if err != nil {
+		return nil, err
+	}
+
+	link := &models.ShareLink{
+		PasteID:    pasteID,
+		Name:       req.Name,
+		AccessID:   accessID,
+		Permission: req.Permission,
+		MaxUses:    req.MaxUses,
+		ExpiresAt:  req.ExpiresAt,
+		CreatedBy:  userID,
+	}
+
+	createdLink, err := s.linkRepo.Create(ctx, link)
+	if err != nil {
+		return nil, err
+	}
+
+	log.Info().Uint64("pasteId", pasteID).Uint("shareLinkId", createdLink.ID).Str("permission", createdLink.Permission).Msg("Created share link")
+	return createdLink, nil
+}
+
+// RotateShareLink gives the link a new access ID, keeping its name, rights and limits.
+// The old URL stops working immediately.
+func (s *pasteService) RotateShareLink(ctx context.Context, pasteID uint64, userID uint, linkID uint) (*models.ShareLink, error) {
+	log := utils.LoggerFromContext(ctx)
+
+	paste, err := s.repo.GetByID(ctx, pasteID)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.requirePermission(ctx, paste, userID, models.PastePermissionOwner); err != nil {
+		return nil, err
+	}
+
+	accessID, err := generatePrivateAccessID()
+	if err != nil {
+		return nil, err
+	}
+
+	updated, err := s.linkRepo.UpdateAccessID(ctx, pasteID, linkID, accessID)
+	if err != nil {
+		return nil, err
+	}
+	if !updated {
+		return nil, ErrShareLinkNotFound
+	}
+
+	log.Info().Uint64("pasteId", pasteID).Uint("shareLinkId", linkID).Msg("Rotated share link")
+	return s.linkRepo.GetByAccessID(ctx, accessID)
+}
+
+func (s *pasteService) RevokeShareLink(ctx context.Context, pasteID uint64, userID uint, linkID uint) error {
+	log := utils.LoggerFromContext(ctx)
+
+	paste, err := s.repo.GetByID(ctx, pasteID)
+	if err != nil {
+		return err
+	}
+	if err := s.requirePermission(ctx, paste, userID, models.PastePermissionOwner); err != nil {
+		return err
+	}
+
+	deleted, err := s.linkRepo.Delete(ctx, pasteID, linkID)
+	if err != nil {
+		return err
+	}
+	if !deleted {
+		return ErrShareLinkNotFound
+	}
+
+	log.Info().Uint64("pasteId", pasteID).Uint("shareLinkId", linkID).Msg("Revoked share link")
+	return nil
+}
+
+// RotatePrivateAccessID replaces the paste's own private access ID, for when it has leaked
+func (s *pasteService) RotatePrivateAccessID(ctx context.Context, pasteID uint64, userID uint) (*models.Paste, error) {
+	log := utils.LoggerFromContext(ctx)
+
+	paste, err := s.repo.GetByID(ctx, pasteID)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.requirePermission(ctx, paste, userID, models.PastePermissionOwner); err != nil {
+		return nil, err
+	}
+
+	privateID, err := generatePrivateAccessID()
+	if err != nil {
+		return nil, err
+	}
+	paste.PrivateAccessID = privateID
+
+	savedPaste, err := s.repo.Update(ctx, paste)
+	if err != nil {
+		return nil, s.versionConflict(ctx, pasteID, paste.Version, err)
+	}
+
+	log.Info().Uint64("pasteId", pasteID).Msg("Rotated private access ID")
+	return savedPaste, nil
+}
+
+func (s *pasteService) UpdateViaShareLink(ctx context.Context, accessID string, req *models.UpdateSharedPasteRequest) (*models.Paste, error) {
+	log := utils.LoggerFromContext(ctx)
+
+	paste, link, err := s.resolveShareLink(ctx, accessID, models.PastePermissionEdit, req.Password)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := checkVersion(paste.Version, req.Version); err != nil {
+		return nil, err
+	}
+
+	// Edits to an encrypted paste are re-encrypted by the client, so they come with a fresh IV
+	if paste.IsEncrypted() != (req.Encryption != nil) {
+		return nil, ErrShareLinkEncryption
+	}
+	files, size, err := pasteFiles(req.Content, req.Files, req.Encryption != nil)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.quotas.CheckUpdate(ctx, paste, size); err != nil {
+		return nil, err
+	}
+
+	previous := *paste
+	paste.Title = req.Title
+	paste.Content = req.Content
+	paste.Files = files
+	if req.SyntaxHighlight != "" {
+		paste.SyntaxHighlight = req.SyntaxHighlight
+	}
+	if req.EditorType != "" {
+		paste.EditorType = req.EditorType
+	}
+	if req.Encryption != nil {
+		paste.Encryption = req.Encryption
+	}
+	if err := s.setLanguages(paste, &previous); err != nil {
+		return nil, err
+	}
+
+	savedPaste, err := s.repo.Update(ctx, paste)
+	if err != nil {
+		return nil, s.versionConflict(ctx, paste.ID, req.Version, err)
+	}
+	s.updateLinks(ctx, savedPaste)
+	s.reanchorComments(ctx, savedPaste)
+
+	log.Info().Uint64("pasteId", paste.ID).Uint("shareLinkId", link.ID).Msg("Updated paste through share link")
+	return savedPaste, nil
+}
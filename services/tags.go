@@ -0,0 +1,61 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"memoria-backend/models"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var ErrTagInvalid = errors.New("tags may only contain letters, digits, dots, dashes and underscores and must start with a letter or digit")
+
+// tagPattern matches a normalised tag name
+var tagPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9._-]{0,49}$`)
+
+// normalizeTag lower-cases a tag name and trims surrounding space
+func normalizeTag(name string) string {
+	return strings.ToLower(strings.TrimSpace(name))
+}
+
+// normalizeTags turns requested tag names into tags, dropping duplicates. A nil list stays
+// nil so the paste keeps its tags, an empty one becomes an empty list that removes them.
+func normalizeTags(names []string) ([]models.Tag, error) {
+	if names == nil {
+		return nil, nil
+	}
+	tags := []models.Tag{}
+	seen := map[string]bool{}
+	for _, name := range names {
+		name = normalizeTag(name)
+		if !tagPattern.MatchString(name) {
+			return nil, ErrTagInvalid
+		}
+		if !seen[name] {
+			seen[name] = true
+			tags = append(tags, models.Tag{Name: name})
+		}
+	}
+	return tags, nil
+}
+
+// normalizeTagFilter prepares tag names from a listing filter, ignoring empty ones
+func normalizeTagFilter(names []string) []string {
+	var tags []string
+	for _, name := range names {
+		if name = normalizeTag(name); name != "" {
+			tags = append(tags, name)
+		}
+	}
+	return tags
+}
+
+// SuggestTags autocompletes a tag name from the tags on public pastes and the caller's own
+func (s *pasteService) SuggestTags(ctx context.Context, prefix string, userID uint, limit int) ([]models.TagSuggestion, error) {
+	callerID := ""
+	if userID != 0 {
+		callerID = strconv.FormatUint(uint64(userID), 10)
+	}
+	return s.repo.SuggestTags(ctx, normalizeTag(prefix), callerID, limit)
+}
@@ -0,0 +1,367 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"memoria-backend/models"
+	"memoria-backend/repository"
+	"memoria-backend/utils"
+	"net/url"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+var (
+	ErrTeamNotFound         = errors.New("team not found")
+	ErrTeamForbidden        = errors.New("your team role doesn't allow this action")
+	ErrTeamMemberNotFound   = errors.New("team member not found")
+	ErrTeamLastOwner        = errors.New("a team must keep at least one owner")
+	ErrTeamInviteInvalid    = errors.New("invitation is invalid, expired or used up")
+	ErrTeamInviteNotFound   = errors.New("invitation not found")
+	ErrTeamRequired         = errors.New("team pastes must belong to a team")
+	ErrTeamInviteExpiryPast = errors.New("expiry must be in the future")
+)
+
+// teamRoleRanks orders roles so a check for a role also admits the roles above it
+var teamRoleRanks = map[string]int{
+	models.TeamRoleViewer: 1,
+	models.TeamRoleEditor: 2,
+	models.TeamRoleOwner:  3,
+}
+
+type TeamService interface {
+	Create(ctx context.Context, userID uint, req *models.CreateTeamRequest) (*models.TeamData, error)
+	GetByUserID(ctx context.Context, userID uint) ([]models.TeamData, error)
+	Get(ctx context.Context, teamID, userID uint) (*models.TeamData, error)
+	Update(ctx context.Context, teamID, userID uint, req *models.UpdateTeamRequest) (*models.TeamData, error)
+	Delete(ctx context.Context, teamID, userID uint) error
+	GetPastes(ctx context.Context, teamID, userID uint, tags []string) ([]models.Paste, error)
+	UpdateMemberRole(ctx context.Context, teamID, userID, memberID uint, role string) error
+	RemoveMember(ctx context.Context, teamID, userID, memberID uint) error
+	CreateInvite(ctx context.Context, teamID, userID uint, req *models.CreateTeamInviteRequest) (*models.TeamInviteData, error)
+	GetInvites(ctx context.Context, teamID, userID uint) ([]models.TeamInvite, error)
+	RevokeInvite(ctx context.Context, teamID, userID, inviteID uint) error
+	Join(ctx context.Context, userID uint, token string) (*models.TeamData, error)
+}
+
+type teamService struct {
+	repo          repository.TeamRepository
+	pasteRepo     repository.PasteRepository
+	configService ConfigService
+}
+
+// NewTeamService creates a new team service
+func NewTeamService(repo repository.TeamRepository, pasteRepo repository.PasteRepository, configService ConfigService) TeamService {
+	return &teamService{
+		repo:          repo,
+		pasteRepo:     pasteRepo,
+		configService: configService,
+	}
+}
+
+// checkTeamRole returns the user's membership when their role is at least minRole.
+// Non-members get ErrTeamNotFound so team IDs can't be probed.
+func checkTeamRole(ctx context.Context, repo repository.TeamRepository, teamID, userID uint, minRole string) (*models.TeamMember, error) {
+	if userID == 0 {
+		return nil, ErrTeamNotFound
+	}
+
+	member, err := repo.GetMember(ctx, teamID, userID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrTeamNotFound
+		}
+		return nil, err
+	}
+
+	if teamRoleRanks[member.Role] < teamRoleRanks[minRole] {
+		return nil, ErrTeamForbidden
+	}
+	return member, nil
+}
+
+func (s *teamService) Create(ctx context.Context, userID uint, req *models.CreateTeamRequest) (*models.TeamData, error) {
+	log := utils.LoggerFromContext(ctx)
+
+	team := &models.Team{
+		Name:        strings.TrimSpace(req.Name),
+		Description: req.Description,
+	}
+
+	createdTeam, err := s.repo.Create(ctx, team, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	log.Info().Uint("teamId", createdTeam.ID).Uint("userId", userID).Msg("Created team")
+	return &models.TeamData{Team: createdTeam, Role: models.TeamRoleOwner}, nil
+}
+
+func (s *teamService) GetByUserID(ctx context.Context, userID uint) ([]models.TeamData, error) {
+	teams, memberships, err := s.repo.GetByUserID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	roles := make(map[uint]string, len(memberships))
+	for _, membership := range memberships {
+		roles[membership.TeamID] = membership.Role
+	}
+
+	teamData := make([]models.TeamData, len(teams))
+	for i := range teams {
+		teamData[i] = models.TeamData{Team: &teams[i], Role: roles[teams[i].ID]}
+	}
+	return teamData, nil
+}
+
+func (s *teamService) Get(ctx context.Context, teamID, userID uint) (*models.TeamData, error) {
+	member, err := checkTeamRole(ctx, s.repo, teamID, userID, models.TeamRoleViewer)
+	if err != nil {
+		return nil, err
+	}
+
+	team, err := s.repo.GetByID(ctx, teamID)
+	if err != nil {
+		return nil, err
+	}
+
+	members, err := s.repo.GetMembers(ctx, teamID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &models.TeamData{Team: team, Role: member.Role, Members: members}, nil
+}
+
+func (s *teamService) Update(ctx context.Context, teamID, userID uint, req *models.UpdateTeamRequest) (*models.TeamData, error) {
+	log := utils.LoggerFromContext(ctx)
+
+	member, err := checkTeamRole(ctx, s.repo, teamID, userID, models.TeamRoleOwner)
+	if err != nil {
+		return nil, err
+	}
+
+	team, err := s.repo.GetByID(ctx, teamID)
+	if err != nil {
+		return nil, err
+	}
+
+	team.Name = strings.TrimSpace(req.Name)
+	team.Description = req.Description
+
+	savedTeam, err := s.repo.Update(ctx, team)
+	if err != nil {
+		return nil, err
+	}
+
+	log.Info().Uint("teamId", teamID).Msg("Updated team")
+	return &models.TeamData{Team: savedTeam, Role: member.Role}, nil
+}
+
+func (s *teamService) Delete(ctx context.Context, teamID, userID uint) error {
+	log := utils.LoggerFromContext(ctx)
+
+	if _, err := checkTeamRole(ctx, s.repo, teamID, userID, models.TeamRoleOwner); err != nil {
+		return err
+	}
+
+	if err := s.repo.Delete(ctx, teamID); err != nil {
+		return err
+	}
+
+	log.Info().Uint("teamId", teamID).Uint("userId", userID).Msg("Deleted team")
+	return nil
+}
+
+func (s *teamService) GetPastes(ctx context.Context, teamID, userID uint, tags []string) ([]models.Paste, error) {
+	if _, err := checkTeamRole(ctx, s.repo, teamID, userID, models.TeamRoleViewer); err != nil {
+		return nil, err
+	}
+
+	pastes, err := s.pasteRepo.GetByTeamID(ctx, teamID, normalizeTagFilter(tags))
+	if err != nil {
+		return nil, err
+	}
+	return visiblePastes(pastes), nil
+}
+
+func (s *teamService) UpdateMemberRole(ctx context.Context, teamID, userID, memberID uint, role string) error {
+	log := utils.LoggerFromContext(ctx)
+
+	if _, err := checkTeamRole(ctx, s.repo, teamID, userID, models.TeamRoleOwner); err != nil {
+		return err
+	}
+
+	member, err := s.repo.GetMember(ctx, teamID, memberID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrTeamMemberNotFound
+		}
+		return err
+	}
+
+	if member.Role == models.TeamRoleOwner && role != models.TeamRoleOwner {
+		if err := s.ensureAnotherOwner(ctx, teamID); err != nil {
+			return err
+		}
+	}
+
+	if _, err := s.repo.UpdateMemberRole(ctx, teamID, memberID, role); err != nil {
+		return err
+	}
+
+	log.Info().Uint("teamId", teamID).Uint("memberId", memberID).Str("role", role).Msg("Changed team member role")
+	return nil
+}
+
+// RemoveMember lets owners remove anyone and every member remove themselves
+func (s *teamService) RemoveMember(ctx context.Context, teamID, userID, memberID uint) error {
+	log := utils.LoggerFromContext(ctx)
+
+	minRole := models.TeamRoleOwner
+	if userID == memberID {
+		minRole = models.TeamRoleViewer
+	}
+	if _, err := checkTeamRole(ctx, s.repo, teamID, userID, minRole); err != nil {
+		return err
+	}
+
+	member, err := s.repo.GetMember(ctx, teamID, memberID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrTeamMemberNotFound
+		}
+		return err
+	}
+
+	if member.Role == models.TeamRoleOwner {
+		if err := s.ensureAnotherOwner(ctx, teamID); err != nil {
+			return err
+		}
+	}
+
+	removed, err := s.repo.RemoveMember(ctx, teamID, memberID)
+	if err != nil {
+		return err
+	}
+	if !removed {
+		return ErrTeamMemberNotFound
+	}
+
+	log.Info().Uint("teamId", teamID).Uint("memberId", memberID).Msg("Removed team member")
+	return nil
+}
+
+// ensureAnotherOwner fails when removing or demoting an owner would leave the team without one
+func (s *teamService) ensureAnotherOwner(ctx context.Context, teamID uint) error {
+	owners, err := s.repo.CountOwners(ctx, teamID)
+	if err != nil {
+		return err
+	}
+	if owners <= 1 {
+		return ErrTeamLastOwner
+	}
+	return nil
+}
+
+func (s *teamService) CreateInvite(ctx context.Context, teamID, userID uint, req *models.CreateTeamInviteRequest) (*models.TeamInviteData, error) {
+	log := utils.LoggerFromContext(ctx)
+
+	if _, err := checkTeamRole(ctx, s.repo, teamID, userID, models.TeamRoleOwner); err != nil {
+		return nil, err
+	}
+
+	if req.ExpiresAt != nil && !req.ExpiresAt.After(time.Now()) {
+		return nil, ErrTeamInviteExpiryPast
+	}
+
+	token, err := randomToken(24)
+	if err != nil {
+		return nil, err
+	}
+
+	invite := &models.TeamInvite{
+		TeamID:    teamID,
+		Role:      req.Role,
+		TokenHash: hashAPIToken(token),
+		CreatedBy: userID,
+		MaxUses:   req.MaxUses,
+		ExpiresAt: req.ExpiresAt,
+	}
+
+	createdInvite, err := s.repo.CreateInvite(ctx, invite)
+	if err != nil {
+		return nil, err
+	}
+
+	appURL := strings.TrimRight(s.configService.GetConfig().App.AppURL, "/")
+	log.Info().Uint("teamId", teamID).Uint("inviteId", createdInvite.ID).Str("role", req.Role).Msg("Created team invitation")
+	return &models.TeamInviteData{
+		Invite: createdInvite,
+		Token:  token,
+		URL:    appURL + "/teams/join?token=" + url.QueryEscape(token),
+	}, nil
+}
+
+func (s *teamService) GetInvites(ctx context.Context, teamID, userID uint) ([]models.TeamInvite, error) {
+	if _, err := checkTeamRole(ctx, s.repo, teamID, userID, models.TeamRoleOwner); err != nil {
+		return nil, err
+	}
+	return s.repo.GetInvites(ctx, teamID)
+}
+
+func (s *teamService) RevokeInvite(ctx context.Context, teamID, userID, inviteID uint) error {
+	log := utils.LoggerFromContext(ctx)
+
+	if _, err := checkTeamRole(ctx, s.repo, teamID, userID, models.TeamRoleOwner); err != nil {
+		return err
+	}
+
+	deleted, err := s.repo.DeleteInvite(ctx, teamID, inviteID)
+	if err != nil {
+		return err
+	}
+	if !deleted {
+		return ErrTeamInviteNotFound
+	}
+
+	log.Info().Uint("teamId", teamID).Uint("inviteId", inviteID).Msg("Revoked team invitation")
+	return nil
+}
+
+// Join accepts an invitation. Existing members keep their current role.
+func (s *teamService) Join(ctx context.Context, userID uint, token string) (*models.TeamData, error) {
+	log := utils.LoggerFromContext(ctx)
+
+	invite, err := s.repo.GetInviteByHash(ctx, hashAPIToken(strings.TrimSpace(token)))
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrTeamInviteInvalid
+		}
+		return nil, err
+	}
+
+	if invite.ExpiresAt != nil && invite.ExpiresAt.Before(time.Now()) {
+		return nil, ErrTeamInviteInvalid
+	}
+
+	if _, err := s.repo.GetMember(ctx, invite.TeamID, userID); err == nil {
+		return s.Get(ctx, invite.TeamID, userID)
+	} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+
+	accepted, err := s.repo.AcceptInvite(ctx, invite, userID)
+	if err != nil {
+		return nil, err
+	}
+	if !accepted {
+		return nil, ErrTeamInviteInvalid
+	}
+
+	log.Info().Uint("teamId", invite.TeamID).Uint("userId", userID).Str("role", invite.Role).Msg("User joined team")
+	return s.Get(ctx, invite.TeamID, userID)
+}
@@ -0,0 +1,29 @@
+package utils
+
+import (
+	"memoria-backend/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// AuthIdentityKey is the gin context key the auth middleware stores the caller under
+const AuthIdentityKey = "authIdentity"
+
+// GetAuthIdentity returns the authenticated caller set by the auth middleware
+func GetAuthIdentity(c *gin.Context) (*models.AuthIdentity, bool) {
+	value, exists := c.Get(AuthIdentityKey)
+	if !exists {
+		return nil, false
+	}
+	identity, ok := value.(*models.AuthIdentity)
+	return identity, ok && identity != nil
+}
+
+// GetUserID returns the ID of the authenticated caller, if any
+func GetUserID(c *gin.Context) (uint, bool) {
+	identity, ok := GetAuthIdentity(c)
+	if !ok {
+		return 0, false
+	}
+	return identity.UserID, true
+}
@@ -11,35 +11,43 @@ import (
 
 // StatusCodeToErrorType maps HTTP status codes to ErrorType
 var StatusCodeToErrorType = map[int]models.ErrorType{
-	http.StatusBadRequest:          models.ErrorTypeBadRequest,
-	http.StatusUnauthorized:        models.ErrorTypeUnauthorized,
-	http.StatusForbidden:           models.ErrorTypeForbidden,
-	http.StatusNotFound:            models.ErrorTypeNotFound,
-	http.StatusConflict:            models.ErrorTypeConflict,
-	http.StatusUnprocessableEntity: models.ErrorTypeUnprocessableEntity,
-	http.StatusTooManyRequests:     models.ErrorTypeRateLimited,
-	http.StatusInternalServerError: models.ErrorTypeInternalError,
-	http.StatusServiceUnavailable:  models.ErrorTypeServiceUnavailable,
-	http.StatusGatewayTimeout:      models.ErrorTypeTimeout,
+	http.StatusBadRequest:           models.ErrorTypeBadRequest,
+	http.StatusUnauthorized:         models.ErrorTypeUnauthorized,
+	http.StatusForbidden:            models.ErrorTypeForbidden,
+	http.StatusNotFound:             models.ErrorTypeNotFound,
+	http.StatusConflict:             models.ErrorTypeConflict,
+	http.StatusUnsupportedMediaType: models.ErrorTypeBadRequest,
+	http.StatusUnprocessableEntity:  models.ErrorTypeUnprocessableEntity,
+	http.StatusPreconditionRequired: models.ErrorTypePreconditionRequired,
+	http.StatusTooManyRequests:      models.ErrorTypeRateLimited,
+	http.StatusInternalServerError:  models.ErrorTypeInternalError,
+	http.StatusServiceUnavailable:   models.ErrorTypeServiceUnavailable,
+	http.StatusGatewayTimeout:       models.ErrorTypeTimeout,
 }
 
 // DefaultErrorMessages maps ErrorType to default human-readable messages
 var DefaultErrorMessages = map[models.ErrorType]string{
-	models.ErrorTypeBadRequest:          "The request could not be processed due to invalid parameters",
-	models.ErrorTypeUnauthorized:        "Authentication is required to access this resource",
-	models.ErrorTypeForbidden:           "You don't have permission to access this resource",
-	models.ErrorTypeNotFound:            "The requested resource was not found",
-	models.ErrorTypeConflict:            "The request conflicts with the current state of the resource",
-	models.ErrorTypeValidation:          "The request contains validation errors",
-	models.ErrorTypeRateLimited:         "Too many requests, please try again later",
-	models.ErrorTypeTimeout:             "The operation timed out",
-	models.ErrorTypeInternalError:       "An internal server error occurred",
-	models.ErrorTypeServiceUnavailable:  "The service is currently unavailable",
-	models.ErrorTypeUnprocessableEntity: "The request was well-formed but cannot be processed",
+	models.ErrorTypeBadRequest:           "The request could not be processed due to invalid parameters",
+	models.ErrorTypeUnauthorized:         "Authentication is required to access this resource",
+	models.ErrorTypeForbidden:            "You don't have permission to access this resource",
+	models.ErrorTypeNotFound:             "The requested resource was not found",
+	models.ErrorTypeConflict:             "The request conflicts with the current state of the resource",
+	models.ErrorTypeValidation:           "The request contains validation errors",
+	models.ErrorTypeRateLimited:          "Too many requests, please try again later",
+	models.ErrorTypeTimeout:              "The operation timed out",
+	models.ErrorTypeInternalError:        "An internal server error occurred",
+	models.ErrorTypeServiceUnavailable:   "The service is currently unavailable",
+	models.ErrorTypeUnprocessableEntity:  "The request was well-formed but cannot be processed",
+	models.ErrorTypePreconditionRequired: "The request must say which version of the resource it changes",
 }
 
 // RespondWithError creates a standardized error response using models.ErrorResponse
 func RespondWithError(c *gin.Context, statusCode int, err error, customMessage ...string) {
+	RespondWithErrorDetails(c, statusCode, err, nil, customMessage...)
+}
+
+// RespondWithErrorDetails creates a standardized error response with extra details for the client
+func RespondWithErrorDetails(c *gin.Context, statusCode int, err error, details map[string]interface{}, customMessage ...string) {
 	// Get error type based on status code or default to internal error
 	errorType, exists := StatusCodeToErrorType[statusCode]
 	if !exists {
@@ -72,6 +80,10 @@ func RespondWithError(c *gin.Context, statusCode int, err error, customMessage .
 		RequestID: requestID,
 	}
 
+	for key, value := range details {
+		errorResponse.Details[key] = value
+	}
+
 	// Add error details if error is provided
 	if err != nil {
 		errorResponse.Details["error"] = err.Error()
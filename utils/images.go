@@ -0,0 +1,185 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"image"
+	_ "image/gif" // Registers the GIF decoder
+	"image/jpeg"
+	"image/png"
+
+	"golang.org/x/image/draw"
+	_ "golang.org/x/image/webp" // Registers the WebP decoder
+)
+
+var ErrInvalidImage = errors.New("image data is malformed")
+
+// maxThumbnailPixels keeps decompression bombs from being decoded for a thumbnail
+const maxThumbnailPixels = 40_000_000
+
+// StripImageMetadata removes EXIF, XMP, comments and other metadata that can give away
+// where and with what a picture was taken. The image data itself is left untouched, so
+// JPEG orientation from EXIF is lost. Formats it doesn't know are returned as they are.
+func StripImageMetadata(mimeType string, data []byte) ([]byte, error) {
+	switch mimeType {
+	case "image/jpeg":
+		return stripJPEG(data)
+	case "image/png":
+		return stripPNG(data)
+	case "image/webp":
+		return stripWebP(data)
+	default:
+		return data, nil
+	}
+}
+
+// stripJPEG drops APPn and comment segments before the image data, keeping JFIF (APP0),
+// ICC profiles (APP2) and Adobe colour information (APP14) that decoders rely on
+func stripJPEG(data []byte) ([]byte, error) {
+	if len(data) < 4 || data[0] != 0xFF || data[1] != 0xD8 {
+		return nil, ErrInvalidImage
+	}
+
+	out := bytes.NewBuffer(make([]byte, 0, len(data)))
+	out.Write(data[:2])
+	pos := 2
+	for pos < len(data) {
+		if data[pos] != 0xFF {
+			return nil, ErrInvalidImage
+		}
+		marker := data[pos+1]
+		if marker == 0xFF {
+			// Fill byte before a marker
+			pos++
+			continue
+		}
+		if marker == 0xDA {
+			// Start of scan, everything from here on is image data
+			out.Write(data[pos:])
+			return out.Bytes(), nil
+		}
+		if pos+4 > len(data) {
+			return nil, ErrInvalidImage
+		}
+		end := pos + 2 + int(binary.BigEndian.Uint16(data[pos+2:]))
+		if end > len(data) {
+			return nil, ErrInvalidImage
+		}
+
+		isMetadata := (marker >= 0xE1 && marker <= 0xEF && marker != 0xE2 && marker != 0xEE) || marker == 0xFE
+		if !isMetadata {
+			out.Write(data[pos:end])
+		}
+		pos = end
+	}
+	return nil, ErrInvalidImage
+}
+
+// pngMetadataChunks are the PNG chunks holding EXIF, text and timestamps
+var pngMetadataChunks = map[string]bool{"eXIf": true, "tEXt": true, "zTXt": true, "iTXt": true, "tIME": true}
+
+func stripPNG(data []byte) ([]byte, error) {
+	const signatureLen = 8
+	if len(data) < signatureLen || !bytes.Equal(data[:signatureLen], []byte("\x89PNG\r\n\x1a\n")) {
+		return nil, ErrInvalidImage
+	}
+
+	out := bytes.NewBuffer(make([]byte, 0, len(data)))
+	out.Write(data[:signatureLen])
+	pos := signatureLen
+	for pos < len(data) {
+		if pos+8 > len(data) {
+			return nil, ErrInvalidImage
+		}
+		// Length, type, data and CRC
+		end := pos + 12 + int(binary.BigEndian.Uint32(data[pos:]))
+		if end > len(data) || end < pos {
+			return nil, ErrInvalidImage
+		}
+		if !pngMetadataChunks[string(data[pos+4:pos+8])] {
+			out.Write(data[pos:end])
+		}
+		pos = end
+	}
+	return out.Bytes(), nil
+}
+
+// stripWebP drops the EXIF and XMP chunks and clears their flags in the extended header
+func stripWebP(data []byte) ([]byte, error) {
+	if len(data) < 12 || string(data[:4]) != "RIFF" || string(data[8:12]) != "WEBP" {
+		return nil, ErrInvalidImage
+	}
+
+	out := bytes.NewBuffer(make([]byte, 0, len(data)))
+	out.Write(data[:12])
+	pos := 12
+	for pos < len(data) {
+		if pos+8 > len(data) {
+			return nil, ErrInvalidImage
+		}
+		size := int(binary.LittleEndian.Uint32(data[pos+4:]))
+		end := pos + 8 + size + size%2 // Chunks are padded to an even size
+		if end > len(data) || end < pos {
+			return nil, ErrInvalidImage
+		}
+
+		switch string(data[pos : pos+4]) {
+		case "EXIF", "XMP ":
+		case "VP8X":
+			chunk := append([]byte(nil), data[pos:end]...)
+			if len(chunk) > 8 {
+				chunk[8] &^= 0x08 | 0x04 // EXIF and XMP present
+			}
+			out.Write(chunk)
+		default:
+			out.Write(data[pos:end])
+		}
+		pos = end
+	}
+
+	stripped := out.Bytes()
+	binary.LittleEndian.PutUint32(stripped[4:], uint32(len(stripped)-8))
+	return stripped, nil
+}
+
+// ImageThumbnail decodes an image and scales it down to fit in maxSize by maxSize pixels.
+// It returns the image's own dimensions too. Images too large to decode safely get no
+// thumbnail, data that isn't a supported image is an error.
+func ImageThumbnail(data []byte, maxSize int) (thumbnail []byte, mimeType string, width int, height int, err error) {
+	config, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, "", 0, 0, err
+	}
+	width, height = config.Width, config.Height
+	if width <= 0 || height <= 0 || width*height > maxThumbnailPixels {
+		return nil, "", width, height, nil
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, "", width, height, err
+	}
+
+	thumbWidth, thumbHeight := width, height
+	if thumbWidth > maxSize || thumbHeight > maxSize {
+		if width >= height {
+			thumbWidth, thumbHeight = maxSize, max(1, height*maxSize/width)
+		} else {
+			thumbWidth, thumbHeight = max(1, width*maxSize/height), maxSize
+		}
+	}
+	scaled := image.NewRGBA(image.Rect(0, 0, thumbWidth, thumbHeight))
+	draw.CatmullRom.Scale(scaled, scaled.Bounds(), img, img.Bounds(), draw.Src, nil)
+
+	var buf bytes.Buffer
+	if format == "jpeg" {
+		err, mimeType = jpeg.Encode(&buf, scaled, &jpeg.Options{Quality: 80}), "image/jpeg"
+	} else {
+		err, mimeType = png.Encode(&buf, scaled), "image/png"
+	}
+	if err != nil {
+		return nil, "", width, height, err
+	}
+	return buf.Bytes(), mimeType, width, height, nil
+}
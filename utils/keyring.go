@@ -0,0 +1,141 @@
+package utils
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+)
+
+var ErrUnknownMasterKey = errors.New("master key not found in keyring")
+
+// Keyring holds the master keys used for envelope encryption. Each piece of data is
+// encrypted with its own random data key, and only that data key is encrypted (wrapped)
+// with a master key. Rotating a master key then means re-wrapping the small data keys
+// instead of re-encrypting all the data.
+type Keyring struct {
+	keys     map[string][]byte
+	activeID string
+	macKey   []byte
+}
+
+// NewKeyring creates a keyring from 32-byte AES-256 master keys. New data keys are
+// wrapped with the key named by activeID.
+func NewKeyring(keys map[string][]byte, activeID string) (*Keyring, error) {
+	if len(keys) == 0 {
+		return nil, errors.New("keyring needs at least one master key")
+	}
+	for id, key := range keys {
+		if len(key) != 32 {
+			return nil, fmt.Errorf("master key %q must be 32 bytes, got %d", id, len(key))
+		}
+	}
+	if _, ok := keys[activeID]; !ok {
+		return nil, fmt.Errorf("active master key %q: %w", activeID, ErrUnknownMasterKey)
+	}
+	// The MAC key is derived so the master key itself is only ever used for wrapping
+	derive := hmac.New(sha256.New, keys[activeID])
+	derive.Write([]byte("memoria content hash"))
+	return &Keyring{keys: keys, activeID: activeID, macKey: derive.Sum(nil)}, nil
+}
+
+// ActiveKeyID returns the ID of the master key that wraps new data keys
+func (k *Keyring) ActiveKeyID() string {
+	return k.activeID
+}
+
+// MAC returns an HMAC-SHA256 of data, hex encoded like a plain SHA-256. Without the keyring
+// it can't be computed, so it doesn't allow confirming a guess about the data. It is keyed
+// from the active master key and changes when another key becomes active.
+func (k *Keyring) MAC(data []byte) string {
+	mac := hmac.New(sha256.New, k.macKey)
+	mac.Write(data)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Encrypt seals plaintext with a fresh data key and returns the ciphertext together with
+// the wrapped data key and the ID of the master key that wrapped it
+func (k *Keyring) Encrypt(plaintext []byte) (ciphertext, wrappedKey []byte, keyID string, err error) {
+	dataKey := make([]byte, 32)
+	if _, err := rand.Read(dataKey); err != nil {
+		return nil, nil, "", err
+	}
+
+	ciphertext, err = seal(dataKey, plaintext, nil)
+	if err != nil {
+		return nil, nil, "", err
+	}
+	wrappedKey, err = seal(k.keys[k.activeID], dataKey, []byte(k.activeID))
+	if err != nil {
+		return nil, nil, "", err
+	}
+	return ciphertext, wrappedKey, k.activeID, nil
+}
+
+// Decrypt unwraps the data key with the named master key and opens the ciphertext
+func (k *Keyring) Decrypt(ciphertext, wrappedKey []byte, keyID string) ([]byte, error) {
+	dataKey, err := k.unwrap(wrappedKey, keyID)
+	if err != nil {
+		return nil, err
+	}
+	return open(dataKey, ciphertext, nil)
+}
+
+// Rewrap re-encrypts a data key under the active master key. The data it protects is untouched.
+func (k *Keyring) Rewrap(wrappedKey []byte, keyID string) ([]byte, string, error) {
+	dataKey, err := k.unwrap(wrappedKey, keyID)
+	if err != nil {
+		return nil, "", err
+	}
+	rewrapped, err := seal(k.keys[k.activeID], dataKey, []byte(k.activeID))
+	if err != nil {
+		return nil, "", err
+	}
+	return rewrapped, k.activeID, nil
+}
+
+func (k *Keyring) unwrap(wrappedKey []byte, keyID string) ([]byte, error) {
+	masterKey, ok := k.keys[keyID]
+	if !ok {
+		return nil, fmt.Errorf("master key %q: %w", keyID, ErrUnknownMasterKey)
+	}
+	// The key ID is authenticated so a wrapped key can't be passed off under another master key
+	return open(masterKey, wrappedKey, []byte(keyID))
+}
+
+// seal encrypts with AES-GCM and prepends the random nonce to the result
+func seal(key, plaintext, additionalData []byte) ([]byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return gcm.Seal(nonce, nonce, plaintext, additionalData), nil
+}
+
+func open(key, sealed, additionalData []byte) ([]byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(sealed) < gcm.NonceSize() {
+		return nil, errors.New("ciphertext too short")
+	}
+	nonce, ciphertext := sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():]
+	return gcm.Open(nil, nonce, ciphertext, additionalData)
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
@@ -1,5 +1,11 @@
 package utils
 
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
 // Helper function to truncate long strings for logging
 func Truncate(s string, maxLength int) string {
 	if len(s) <= maxLength {
@@ -7,3 +13,32 @@ func Truncate(s string, maxLength int) string {
 	}
 	return s[:maxLength] + "..."
 }
+
+// maxSlugLength caps slugs in bytes
+const maxSlugLength = 100
+
+// Slugify turns a title into a lower-case slug of letters and digits joined by dashes, so
+// "Postgres: Runbook (v2)" becomes "postgres-runbook-v2"
+func Slugify(title string) string {
+	var b strings.Builder
+	dash := false
+	for _, r := range strings.ToLower(title) {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+			dash = b.Len() > 0
+			continue
+		}
+		size := utf8.RuneLen(r)
+		if dash {
+			size++
+		}
+		if b.Len()+size > maxSlugLength {
+			break
+		}
+		if dash {
+			b.WriteByte('-')
+			dash = false
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}